@@ -10,6 +10,7 @@ import (
 	"uas/internal/constants"
 	"uas/internal/handlers"
 	"uas/internal/helpers"
+	"uas/internal/jobs"
 	"uas/internal/middleware"
 	"uas/internal/models"
 	repository "uas/internal/repositories"
@@ -45,25 +46,188 @@ func Run() {
 	userRepo := repository.NewGormUserRepository(db)
 	passwordResetRepo := repository.NewGormAuthRepository(db)
 	departmentRoleRepo := repository.NewGormDepartmentRoleRepository(db)
+	privacyRepo := repository.NewGormPrivacyRepository(db)
+	invitationRepo := repository.NewGormInvitationRepository(db)
+	groupRepo := repository.NewGormGroupRepository(db)
+	platformRepo := repository.NewGormPlatformRepository(db)
+	usageRepo := repository.NewGormUsageRepository(db)
+	roleRepo := repository.NewGormRoleRepository(db)
+	policyRepo := repository.NewGormPolicyRepository(db)
+	relationRepo := repository.NewGormRelationRepository(db)
+	auditRepo := repository.NewGormAuditRepository(db)
 
 	redisHelper := helpers.NewRedisHelper(redisClient, log, ctx)
 	authHelper := helpers.NewAuthHelper(log, departmentRepo, *redisHelper)
+	usageHelper := helpers.NewUsageHelper(log, usageRepo, departmentRepo)
+	auditHelper := helpers.NewAuditHelper(log, auditRepo)
 	responseHelper := helpers.NewResponseHelper(log)
 	validatorHelper := helpers.NewValidatorHelper(log, responseHelper)
 	emailHelper := helpers.NewEmailHelper(log, emailClient)
 	twilioHelper := helpers.NewTwilioHelper(log, twilioClient)
+	importHelper := helpers.NewImportHelper(log, userRepo, authHelper, usageHelper)
+	metadataHelper := helpers.NewMetadataHelper(log, departmentRepo)
+	verificationHelper := helpers.NewVerificationHelper(log, authHelper, emailHelper, redisHelper, usageHelper)
+	deactivationHelper := helpers.NewDeactivationHelper(log, userRepo, passwordResetRepo, emailHelper)
+	scimHelper := helpers.NewScimHelper(log)
+	roleHelper := helpers.NewRoleHelper(log, roleRepo, departmentRepo, groupRepo, redisHelper)
 
-	DepartmentHandler := handlers.NewDepartmentHandler(departmentRepo, log, authHelper, responseHelper, validatorHelper)
+	if err := roleHelper.SeedAllBuiltInRoles(); err != nil {
+		log.Error().Err(err).Msg("Error seeding built-in roles")
+	}
+
+	// logins only match users of the request's department, users from before
+	// that can't log in until they have one
+	backfilled, unowned, err := userRepo.BackfillDepartments()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error assigning departments to existing users")
+	}
+
+	if backfilled > 0 {
+		log.Info().Int64("users", backfilled).Msg("Assigned departments to existing users")
+	}
+
+	if unowned > 0 {
+		log.Warn().Int64("users", unowned).Msg("Users without a department or membership can't log in")
+	}
+
+	authzHelper := helpers.NewAuthzHelper(log, userRepo, departmentRoleRepo, roleHelper)
+	relationHelper := helpers.NewRelationHelper(log, relationRepo)
+
+	DepartmentHandler := handlers.NewDepartmentHandler(departmentRepo, platformRepo, log, authHelper, responseHelper, validatorHelper, usageHelper, roleHelper, auditHelper)
 	userHandler := handlers.NewUserHandler(
 		userRepo,
 		passwordResetRepo,
 		departmentRoleRepo,
+		departmentRepo,
 		log,
 		authHelper,
 		responseHelper,
 		validatorHelper,
 		emailHelper,
 		twilioHelper,
+		metadataHelper,
+		verificationHelper,
+		usageHelper,
+		roleHelper,
+		auditHelper,
+	)
+	importHandler := handlers.NewImportHandler(log, importHelper, responseHelper)
+	profileHandler := handlers.NewProfileHandler(
+		userRepo,
+		passwordResetRepo,
+		departmentRoleRepo,
+		log,
+		authHelper,
+		responseHelper,
+		validatorHelper,
+		emailHelper,
+		twilioHelper,
+		metadataHelper,
+		deactivationHelper,
+		usageHelper,
+		roleHelper,
+	)
+
+	adminUserHandler := handlers.NewAdminUserHandler(
+		userRepo,
+		passwordResetRepo,
+		departmentRoleRepo,
+		groupRepo,
+		log,
+		authHelper,
+		responseHelper,
+		validatorHelper,
+		emailHelper,
+		metadataHelper,
+		verificationHelper,
+		deactivationHelper,
+		usageHelper,
+		roleHelper,
+		auditHelper,
+	)
+
+	privacyHandler := handlers.NewPrivacyHandler(
+		userRepo,
+		passwordResetRepo,
+		departmentRoleRepo,
+		privacyRepo,
+		log,
+		authHelper,
+		redisHelper,
+		responseHelper,
+		roleHelper,
+		auditRepo,
+	)
+
+	if config.AppConfig.UnverifiedAccountExpire > 0 {
+		unverifiedUserJob := jobs.NewUnverifiedUserJob(log, userRepo)
+		go unverifiedUserJob.Start(ctx, time.Duration(config.AppConfig.UnverifiedSweepInterval)*time.Minute)
+	}
+
+	invitationHandler := handlers.NewInvitationHandler(
+		invitationRepo,
+		userRepo,
+		departmentRoleRepo,
+		departmentRepo,
+		log,
+		authHelper,
+		responseHelper,
+		validatorHelper,
+		emailHelper,
+		usageHelper,
+		roleHelper,
+	)
+
+	roleHandler := handlers.NewRoleHandler(
+		roleRepo,
+		userRepo,
+		departmentRoleRepo,
+		departmentRepo,
+		log,
+		roleHelper,
+		responseHelper,
+		validatorHelper,
+		auditHelper,
+	)
+
+	authzHandler := handlers.NewAuthzHandler(policyRepo, log, authzHelper, responseHelper, validatorHelper)
+	groupHandler := handlers.NewGroupHandler(groupRepo, departmentRoleRepo, log, roleHelper, responseHelper, validatorHelper, auditHelper)
+	relationHandler := handlers.NewRelationHandler(relationRepo, log, relationHelper, responseHelper, validatorHelper)
+	auditHandler := handlers.NewAuditHandler(auditRepo, log, responseHelper)
+
+	purgeJob := jobs.NewPurgeJob(log, userRepo, departmentRepo, emailHelper)
+	go purgeJob.Start(ctx, time.Duration(config.AppConfig.PurgeSweepInterval)*time.Minute)
+
+	tenantDeletionJob := jobs.NewTenantDeletionJob(log, departmentRepo, platformRepo, authHelper, redisHelper)
+	go tenantDeletionJob.Start(ctx, time.Duration(config.AppConfig.TenantDeletionInterval)*time.Minute)
+
+	if config.AppConfig.AuditRetentionDays > 0 {
+		auditRetentionJob := jobs.NewAuditRetentionJob(log, auditRepo, time.Duration(config.AppConfig.AuditRetentionDays)*24*time.Hour)
+		go auditRetentionJob.Start(ctx, time.Duration(config.AppConfig.AuditRetentionInterval)*time.Minute)
+	}
+
+	membershipHandler := handlers.NewMembershipHandler(
+		userRepo,
+		departmentRoleRepo,
+		departmentRepo,
+		log,
+		authHelper,
+		responseHelper,
+		validatorHelper,
+		usageHelper,
+		roleHelper,
+	)
+
+	scimHandler := handlers.NewScimHandler(
+		userRepo,
+		departmentRoleRepo,
+		groupRepo,
+		log,
+		authHelper,
+		scimHelper,
+		deactivationHelper,
+		usageHelper,
+		roleHelper,
 	)
 
 	router := mux.NewRouter()
@@ -78,33 +242,165 @@ func Run() {
 	router.Use(rateLimitMiddleware.Start)
 	router.Use(middleware.ContentTypeJSON)
 
-	rbacMiddleware := middleware.NewRBACMiddleware(log, departmentRoleRepo)
+	corsMiddleware := middleware.NewCorsMiddleware(log, authHelper, responseHelper)
+	router.Use(corsMiddleware.Start)
+
+	// the other routes don't match OPTIONS, so every preflight ends up here
+	router.PathPrefix(constants.ApiPrefix).Methods(http.MethodOptions).HandlerFunc(corsMiddleware.Preflight)
+
+	rbacMiddleware := middleware.NewRBACMiddleware(log, authHelper, userRepo, departmentRoleRepo, roleHelper, auditHelper)
+
+	platformHandler := handlers.NewPlatformHandler(platformRepo, log, authHelper, responseHelper, validatorHelper)
+	platformMiddleware := middleware.NewPlatformMiddleware(log, authHelper, platformRepo, responseHelper)
+
+	router.HandleFunc(constants.PlatformLoginEndpoint, platformHandler.PlatformLoginHandler).Methods(http.MethodPost)
 
-	var AdminAccess = []models.Role{models.Admin}
-	var GeneralAccess = []models.Role{models.Admin, models.User}
-	// var UserAccess = []models.Role{models.User}
+	platformRouter := router.NewRoute().Subrouter()
+	platformRouter.Use(platformMiddleware.Authorize)
 
-	router.HandleFunc(constants.OnboardTenantEndpoint, DepartmentHandler.OnboardDepartmentHandler).Methods(http.MethodPost)
+	platformRouter.HandleFunc(constants.OnboardTenantEndpoint, DepartmentHandler.OnboardDepartmentHandler).Methods(http.MethodPost)
+	platformRouter.HandleFunc(constants.TenantsEndpoint, DepartmentHandler.ListDepartmentsHandler).Methods(http.MethodGet)
+	platformRouter.HandleFunc(constants.DeleteTenantEndpoint, DepartmentHandler.DeleteDepartmentHandler).Methods(http.MethodDelete)
+	platformRouter.HandleFunc(constants.TenantDeletionEndpoint, DepartmentHandler.GetTenantDeletionHandler).Methods(http.MethodGet)
+	platformRouter.HandleFunc(constants.TenantUsageEndpoint, DepartmentHandler.GetTenantUsageHandler).Methods(http.MethodGet)
+	platformRouter.HandleFunc(constants.TenantQuotasEndpoint, DepartmentHandler.GetQuotasHandler).Methods(http.MethodGet)
+	platformRouter.HandleFunc(constants.TenantQuotasEndpoint, DepartmentHandler.UpdateQuotasHandler).Methods(http.MethodPut)
+	platformRouter.HandleFunc(constants.PlatformAdminsEndpoint, platformHandler.CreatePlatformAdminHandler).Methods(http.MethodPost)
+	platformRouter.HandleFunc(constants.PlatformAuditEndpoint, platformHandler.ListTenantAuditHandler).Methods(http.MethodGet)
 
-	delTenant := router.Methods(http.MethodDelete).Subrouter()
-	delTenant.HandleFunc(constants.DeleteTenantEndpoint, DepartmentHandler.DeleteDepartmentHandler)
-	delTenant.Use(func(next http.Handler) http.Handler {
-		return rbacMiddleware.Authorize(AdminAccess, next)
-	})
+	tenantMiddleware := middleware.NewTenantMiddleware(log, responseHelper)
+
+	tenantRouter := router.NewRoute().Subrouter()
+	tenantRouter.Use(tenantMiddleware.Authorize)
+
+	tenantRouter.HandleFunc(constants.TenantEndpoint, DepartmentHandler.GetDepartmentHandler).Methods(http.MethodGet)
+	tenantRouter.HandleFunc(constants.TenantEndpoint, DepartmentHandler.UpdateDepartmentHandler).Methods(http.MethodPatch)
+	tenantRouter.HandleFunc(constants.RotateTenantSecretEndpoint, DepartmentHandler.RotateSecretHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.TenantCredentialsEndpoint, DepartmentHandler.GetCredentialsHandler).Methods(http.MethodGet)
+	tenantRouter.HandleFunc(constants.AuthzCheckEndpoint, authzHandler.CheckHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.AuthzBatchCheckEndpoint, authzHandler.BatchCheckHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.RelationWriteEndpoint, relationHandler.WriteRelationsHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.RelationDeleteEndpoint, relationHandler.DeleteRelationsHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.RelationCheckEndpoint, relationHandler.CheckRelationHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.RelationExpandEndpoint, relationHandler.ExpandRelationHandler).Methods(http.MethodPost)
+	tenantRouter.HandleFunc(constants.RelationListObjectsEndpoint, relationHandler.ListObjectsHandler).Methods(http.MethodPost)
+
+	router.HandleFunc(constants.JwksEndpoint, DepartmentHandler.JwksHandler).Methods(http.MethodGet)
+
+	router.HandleFunc(constants.DeactivateTenantEndpoint, DepartmentHandler.DeactivateDepartmentHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.RestoreTenantEndpoint, DepartmentHandler.RestoreDepartmentHandler).Methods(http.MethodPost)
 
 	router.HandleFunc(constants.CredentialsRegisterEndpoint, userHandler.CredentialsRegisterUserHandler).Methods(http.MethodPost)
 	router.HandleFunc(constants.CredentialsLoginEndpoint, userHandler.CredentialsLoginUserHandler).Methods(http.MethodPost)
 	router.HandleFunc(constants.CredentialsForgotEndpoint, userHandler.CredentialsForgotPasswordHandler).Methods(http.MethodPost)
 	router.HandleFunc(constants.CredentialsResetEndpoint, userHandler.CredentialsResetPasswordHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.CredentialsVerifyEndpoint, userHandler.CredentialsVerifyEmailHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.CredentialsVerifyEndpoint, userHandler.CredentialsVerifyEmailLinkHandler).Methods(http.MethodGet)
+	router.HandleFunc(constants.CredentialsResendEndpoint, userHandler.CredentialsResendVerificationHandler).Methods(http.MethodPost)
+
+	router.HandleFunc(constants.InvitationEndpoint, invitationHandler.GetInvitationHandler).Methods(http.MethodGet)
+	router.HandleFunc(constants.AcceptInvitationEndpoint, invitationHandler.AcceptInvitationHandler).Methods(http.MethodPost)
 
 	router.HandleFunc(constants.OtpSendEndpoint, userHandler.SendOtpCode).Methods(http.MethodPost)
 	router.HandleFunc(constants.OtpVerifyEndpoint, userHandler.VerifyOtpCode).Methods(http.MethodPost)
 
-	refreshToken := router.Methods(http.MethodPost).Subrouter()
-	refreshToken.HandleFunc(constants.RefreshTokenEndpoint, userHandler.RefreshAccessTokenHandler)
-	refreshToken.Use(func(next http.Handler) http.Handler {
-		return rbacMiddleware.Authorize(GeneralAccess, next)
-	})
+	// the refresh token authenticates the request, the access token may have expired
+	router.HandleFunc(constants.RefreshTokenEndpoint, userHandler.RefreshAccessTokenHandler).Methods(http.MethodPost)
+
+	// routes declare the permissions they need, the member's role in the department has to grant all of them,
+	// and the scope the access token needs: admin for the admin routes, profile for the member's own routes
+	adminScope := []models.Scope{models.AdminScope}
+	profileScope := []models.Scope{models.ProfileScope}
+
+	router.Handle(constants.ImportUsersEndpoint, rbacMiddleware.RequireScopes(importHandler.ImportUsersHandler, adminScope, models.UsersImportPermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminUsersEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.ListUsersHandler, adminScope, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.GetUserHandler, adminScope, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.DeleteUserHandler, adminScope, models.UsersDeletePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminDisableUserEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.DisableUserHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminRestoreUserEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.RestoreUserHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminEnableUserEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.EnableUserHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminResetPasswordEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.ForcePasswordResetHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminResendVerifyEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.ResendVerificationHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminUserRoleEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.ChangeRoleHandler, adminScope, models.RolesAssignPermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminUserExportEndpoint, rbacMiddleware.RequireScopes(privacyHandler.ExportUserHandler, adminScope, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserErasureEndpoint, rbacMiddleware.RequireScopes(privacyHandler.EraseUserHandler, adminScope, models.UsersDeletePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminErasuresEndpoint, rbacMiddleware.RequireScopes(privacyHandler.ListErasuresHandler, adminScope, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserMetadataEndpoint, rbacMiddleware.RequireScopes(adminUserHandler.UpdateMetadataHandler, adminScope, models.UsersWritePermission)).Methods(http.MethodPatch)
+	router.Handle(constants.AdminUserSchemaEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.GetUserSchemaHandler, adminScope, models.SettingsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserSchemaEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.UpdateUserSchemaHandler, adminScope, models.SettingsWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminInvitationsEndpoint, rbacMiddleware.RequireScopes(invitationHandler.CreateInvitationHandler, adminScope, models.InvitationsWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminInvitationsEndpoint, rbacMiddleware.RequireScopes(invitationHandler.ListInvitationsHandler, adminScope, models.InvitationsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminResendInviteEndpoint, rbacMiddleware.RequireScopes(invitationHandler.ResendInvitationHandler, adminScope, models.InvitationsWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminInvitationEndpoint, rbacMiddleware.RequireScopes(invitationHandler.RevokeInvitationHandler, adminScope, models.InvitationsWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminSettingsEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.GetSettingsHandler, adminScope, models.SettingsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminSettingsEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.UpdateSettingsHandler, adminScope, models.SettingsWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminSigningKeysEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.ListSigningKeysHandler, adminScope, models.KeysReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminSigningKeysEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.RotateSigningKeyHandler, adminScope, models.KeysWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminUsageEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.GetUsageHandler, adminScope, models.UsageReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminScimTokenEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.CreateScimTokenHandler, adminScope, models.ScimWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminScimTokenEndpoint, rbacMiddleware.RequireScopes(DepartmentHandler.RevokeScimTokenHandler, adminScope, models.ScimWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminAuditEndpoint, rbacMiddleware.RequireScopes(auditHandler.ListAuditEventsHandler, adminScope, models.AuditReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminPermissionsEndpoint, rbacMiddleware.RequireScopes(roleHandler.ListPermissionsHandler, adminScope, models.RolesReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminRolesEndpoint, rbacMiddleware.RequireScopes(roleHandler.ListRolesHandler, adminScope, models.RolesReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminRolesEndpoint, rbacMiddleware.RequireScopes(roleHandler.CreateRoleHandler, adminScope, models.RolesWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminRoleEndpoint, rbacMiddleware.RequireScopes(roleHandler.GetRoleHandler, adminScope, models.RolesReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminRoleEndpoint, rbacMiddleware.RequireScopes(roleHandler.UpdateRoleHandler, adminScope, models.RolesWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminRoleEndpoint, rbacMiddleware.RequireScopes(roleHandler.DeleteRoleHandler, adminScope, models.RolesWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminRoleMembersEndpoint, rbacMiddleware.RequireScopes(roleHandler.ListRoleMembersHandler, adminScope, models.RolesReadPermission, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminRoleMemberEndpoint, rbacMiddleware.RequireScopes(roleHandler.AssignRoleHandler, adminScope, models.RolesAssignPermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminRoleMemberEndpoint, rbacMiddleware.RequireScopes(roleHandler.RevokeRoleHandler, adminScope, models.RolesAssignPermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminUserRolesEndpoint, rbacMiddleware.RequireScopes(roleHandler.ListUserRolesHandler, adminScope, models.RolesReadPermission, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminUserPermissionsEndpoint, rbacMiddleware.RequireScopes(roleHandler.UserPermissionsHandler, adminScope, models.RolesReadPermission, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminGroupsEndpoint, rbacMiddleware.RequireScopes(groupHandler.ListGroupsHandler, adminScope, models.GroupsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminGroupsEndpoint, rbacMiddleware.RequireScopes(groupHandler.CreateGroupHandler, adminScope, models.GroupsWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminGroupEndpoint, rbacMiddleware.RequireScopes(groupHandler.GetGroupHandler, adminScope, models.GroupsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminGroupEndpoint, rbacMiddleware.RequireScopes(groupHandler.UpdateGroupHandler, adminScope, models.GroupsWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminGroupEndpoint, rbacMiddleware.RequireScopes(groupHandler.DeleteGroupHandler, adminScope, models.GroupsWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminGroupMembersEndpoint, rbacMiddleware.RequireScopes(groupHandler.ListGroupMembersHandler, adminScope, models.GroupsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminGroupMembersEndpoint, rbacMiddleware.RequireScopes(groupHandler.AddGroupMembersHandler, adminScope, models.GroupsWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminGroupMemberEndpoint, rbacMiddleware.RequireScopes(groupHandler.RemoveGroupMemberHandler, adminScope, models.GroupsWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminGroupRoleEndpoint, rbacMiddleware.RequireScopes(groupHandler.GrantGroupRoleHandler, adminScope, models.GroupsWritePermission, models.RolesAssignPermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminGroupRoleEndpoint, rbacMiddleware.RequireScopes(groupHandler.RevokeGroupRoleHandler, adminScope, models.GroupsWritePermission, models.RolesAssignPermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminPoliciesEndpoint, rbacMiddleware.RequireScopes(authzHandler.ListPoliciesHandler, adminScope, models.PoliciesReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminPoliciesEndpoint, rbacMiddleware.RequireScopes(authzHandler.CreatePolicyHandler, adminScope, models.PoliciesWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.AdminPolicyEndpoint, rbacMiddleware.RequireScopes(authzHandler.GetPolicyHandler, adminScope, models.PoliciesReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminPolicyEndpoint, rbacMiddleware.RequireScopes(authzHandler.UpdatePolicyHandler, adminScope, models.PoliciesWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminPolicyEndpoint, rbacMiddleware.RequireScopes(authzHandler.DeletePolicyHandler, adminScope, models.PoliciesWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.AdminNamespacesEndpoint, rbacMiddleware.RequireScopes(relationHandler.ListNamespacesHandler, adminScope, models.RelationsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminNamespaceEndpoint, rbacMiddleware.RequireScopes(relationHandler.GetNamespaceHandler, adminScope, models.RelationsReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.AdminNamespaceEndpoint, rbacMiddleware.RequireScopes(relationHandler.SaveNamespaceHandler, adminScope, models.RelationsWritePermission)).Methods(http.MethodPut)
+	router.Handle(constants.AdminNamespaceEndpoint, rbacMiddleware.RequireScopes(relationHandler.DeleteNamespaceHandler, adminScope, models.RelationsWritePermission)).Methods(http.MethodDelete)
+
+	router.Handle(constants.ProfileEndpoint, rbacMiddleware.RequireScopes(profileHandler.GetProfileHandler, profileScope, models.ProfileReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.ProfileEndpoint, rbacMiddleware.RequireScopes(profileHandler.UpdateProfileHandler, profileScope, models.ProfileWritePermission)).Methods(http.MethodPatch)
+	router.Handle(constants.ProfileEndpoint, rbacMiddleware.RequireScopes(profileHandler.DeleteProfileHandler, profileScope, models.ProfileWritePermission)).Methods(http.MethodDelete)
+	router.Handle(constants.ProfileVerifyEmailEndpoint, rbacMiddleware.RequireScopes(profileHandler.VerifyProfileEmailHandler, profileScope, models.ProfileWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.ProfileVerifyPhoneEndpoint, rbacMiddleware.RequireScopes(profileHandler.VerifyProfilePhoneHandler, profileScope, models.ProfileWritePermission)).Methods(http.MethodPost)
+	router.Handle(constants.ProfileDepartmentsEndpoint, rbacMiddleware.RequireScopes(membershipHandler.ListDepartmentsHandler, profileScope)).Methods(http.MethodGet)
+	router.Handle(constants.TokenExchangeEndpoint, rbacMiddleware.RequireScopes(membershipHandler.TokenExchangeHandler, profileScope)).Methods(http.MethodPost)
+	router.Handle(constants.ProfileExportEndpoint, rbacMiddleware.RequireScopes(privacyHandler.ExportProfileHandler, profileScope, models.ProfileReadPermission)).Methods(http.MethodGet)
+	router.Handle(constants.ProfileErasureEndpoint, rbacMiddleware.RequireScopes(privacyHandler.EraseProfileHandler, profileScope, models.ProfileWritePermission)).Methods(http.MethodPost)
+
+	scimMiddleware := middleware.NewScimMiddleware(log, authHelper, scimHelper)
+
+	scimRouter := router.NewRoute().Subrouter()
+	scimRouter.Use(scimMiddleware.Authorize)
+
+	scimRouter.HandleFunc(constants.ScimUsersEndpoint, scimHandler.ListScimUsersHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimUsersEndpoint, scimHandler.CreateScimUserHandler).Methods(http.MethodPost)
+	scimRouter.HandleFunc(constants.ScimUserEndpoint, scimHandler.GetScimUserHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimUserEndpoint, scimHandler.ReplaceScimUserHandler).Methods(http.MethodPut)
+	scimRouter.HandleFunc(constants.ScimUserEndpoint, scimHandler.PatchScimUserHandler).Methods(http.MethodPatch)
+	scimRouter.HandleFunc(constants.ScimUserEndpoint, scimHandler.DeleteScimUserHandler).Methods(http.MethodDelete)
+	scimRouter.HandleFunc(constants.ScimGroupsEndpoint, scimHandler.ListScimGroupsHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimGroupsEndpoint, scimHandler.CreateScimGroupHandler).Methods(http.MethodPost)
+	scimRouter.HandleFunc(constants.ScimGroupEndpoint, scimHandler.GetScimGroupHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimGroupEndpoint, scimHandler.ReplaceScimGroupHandler).Methods(http.MethodPut)
+	scimRouter.HandleFunc(constants.ScimGroupEndpoint, scimHandler.PatchScimGroupHandler).Methods(http.MethodPatch)
+	scimRouter.HandleFunc(constants.ScimGroupEndpoint, scimHandler.DeleteScimGroupHandler).Methods(http.MethodDelete)
+	scimRouter.HandleFunc(constants.ScimServiceConfigEndpoint, scimHandler.ServiceProviderConfigHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimSchemasEndpoint, scimHandler.SchemasHandler).Methods(http.MethodGet)
+	scimRouter.HandleFunc(constants.ScimResourceTypesEndpoint, scimHandler.ResourceTypesHandler).Methods(http.MethodGet)
 
 	port := fmt.Sprintf("%d", config.AppConfig.Port)
 	srv := &http.Server{
@@ -0,0 +1,86 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"uas/internal/helpers"
+	repository "uas/internal/repositories"
+	"uas/pkg/logger"
+	"uas/pkg/storage/mysql"
+	"uas/pkg/storage/redis"
+)
+
+// Run creates the first platform admin. It refuses to run once any platform
+// admin exists, further admins are added through the platform API.
+//
+//	uas bootstrap -email admin@example.com -name "Platform Admin" [-password <password>]
+//
+// Without -password a random password is generated and printed once.
+func Run(args []string) {
+	ctx := context.Background()
+	log := logger.NewWithCtx(ctx)
+
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	email := flags.String("email", "", "email of the first platform admin")
+	name := flags.String("name", "Platform Admin", "name of the first platform admin")
+	password := flags.String("password", "", "password of the first platform admin (default: generated)")
+	flags.Parse(args)
+
+	if *email == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := mysql.New(*log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while connecting to database")
+	}
+
+	redisClient := redis.New(*log, ctx)
+
+	departmentRepo := repository.NewGormDepartmentRepository(db)
+	platformRepo := repository.NewGormPlatformRepository(db)
+
+	count, err := platformRepo.CountAdmins()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error counting platform admins")
+	}
+
+	if count > 0 {
+		log.Fatal().Msg("A platform admin already exists, bootstrap can only run once")
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	redisHelper := helpers.NewRedisHelper(redisClient, log, ctx)
+	authHelper := helpers.NewAuthHelper(log, departmentRepo, *redisHelper)
+
+	admin, err := authHelper.NewPlatformAdmin(*email, *name, *password, "bootstrap")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error creating platform admin")
+	}
+
+	if err := platformRepo.CreateAdmin(admin); err != nil {
+		log.Fatal().Err(err).Msg("Error creating platform admin")
+	}
+
+	out := map[string]string{"adminId": admin.ID, "email": admin.Email}
+	if generated {
+		out["password"] = *password
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		log.Fatal().Err(err).Msg("Error writing bootstrap result")
+	}
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"uas/config"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+	"uas/pkg/logger"
+	"uas/pkg/storage/mysql"
+	"uas/pkg/storage/redis"
+)
+
+// Run imports users from an NDJSON or CSV file into a department.
+//
+//	uas import -file users.ndjson -department <id> [-format csv] [-dry-run] [-report errors.json]
+func Run(args []string) {
+	ctx := context.Background()
+	log := logger.NewWithCtx(ctx)
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "path to the NDJSON or CSV file to import")
+	format := flags.String("format", "", "input format: ndjson or csv (default: from file extension)")
+	departmentId := flags.String("department", "", "department the users are imported into")
+	dryRun := flags.Bool("dry-run", false, "validate the file without writing anything")
+	reportPath := flags.String("report", "", "write the full import report to this file")
+	signerKey := flags.String("firebase-signer-key", config.AppConfig.FirebaseSignerKey, "base64 firebase scrypt signer key")
+	saltSeparator := flags.String("firebase-salt-separator", config.AppConfig.FirebaseSaltSeparator, "base64 firebase scrypt salt separator")
+	rounds := flags.Int("firebase-rounds", config.AppConfig.FirebaseRounds, "firebase scrypt rounds")
+	memCost := flags.Int("firebase-mem-cost", config.AppConfig.FirebaseMemCost, "firebase scrypt memory cost")
+	flags.Parse(args)
+
+	if *file == "" || *departmentId == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	importFormat := models.ImportFormat(*format)
+	if importFormat == "" {
+		importFormat = models.NDJSON
+		if strings.EqualFold(filepath.Ext(*file), ".csv") {
+			importFormat = models.CSV
+		}
+	}
+
+	db, err := mysql.New(*log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while connecting to database")
+	}
+
+	redisClient := redis.New(*log, ctx)
+
+	departmentRepo := repository.NewGormDepartmentRepository(db)
+	userRepo := repository.NewGormUserRepository(db)
+
+	if _, err := departmentRepo.FindById(*departmentId); err != nil {
+		log.Fatal().Err(err).Str("departmentId", *departmentId).Msg("Department does not exist")
+	}
+
+	redisHelper := helpers.NewRedisHelper(redisClient, log, ctx)
+	authHelper := helpers.NewAuthHelper(log, departmentRepo, *redisHelper)
+	usageHelper := helpers.NewUsageHelper(log, repository.NewGormUsageRepository(db), departmentRepo)
+	importHelper := helpers.NewImportHelper(log, userRepo, authHelper, usageHelper)
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error opening import file")
+	}
+	defer input.Close()
+
+	report, err := importHelper.ImportUsers(input, importFormat, *departmentId, models.ImportOptions{
+		DryRun:                *dryRun,
+		FirebaseSignerKey:     *signerKey,
+		FirebaseSaltSeparator: *saltSeparator,
+		FirebaseRounds:        *rounds,
+		FirebaseMemCost:       *memCost,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error importing users")
+	}
+
+	out := os.Stdout
+	if *reportPath != "" {
+		out, err = os.Create(*reportPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error creating report file")
+		}
+		defer out.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal().Err(err).Msg("Error writing import report")
+	}
+}
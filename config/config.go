@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"uas/pkg/logger"
 
 	"github.com/caarlos0/env/v6"
@@ -32,20 +34,58 @@ type Config struct {
 	RefreshJwtSecret string `env:"REFRESH_JWT_SECRET" envDefault:"refresh_jwt_secret"`
 	RefreshJwtExpire int    `env:"REFRESH_JWT_EXPIRE" envDefault:"24"`
 
-	AccessJwtSecret string `env:"ACCESS_JWT_SECRET" envDefault:"access_jwt_secret"`
 	AccessJwtExpire int    `env:"ACCESS_JWT_EXPIRE" envDefault:"15"`
+	JwtIssuer       string `env:"JWT_ISSUER" envDefault:"http://127.0.0.1:8080"`
+
+	// SigningKeySecret encrypts the departments' signing keys at rest.
+	SigningKeySecret string `env:"SIGNING_KEY_SECRET" envDefault:"signing_key_secret"`
 
 	RateLimitCapacity int `env:"RATE_LIMIT_CAPACITY" envDefault:"100"`
 	TimeUnitInSeconds int `env:"TIME_UNIT_IN_SECONDS" envDefault:"60"`
 
-	CookieBlockKey string `env:COOKIE_BLOCK_KEY" envDefault:"cookie_block_key"`
-	CookieHashKey  string `env:COOKIE_HASH_KEY" envDefault:"cookie_hash_key"`
+	CookieBlockKey string `env:"COOKIE_BLOCK_KEY" envDefault:"cookie_block_key"`
+	CookieHashKey  string `env:"COOKIE_HASH_KEY" envDefault:"cookie_hash_key"`
+
+	// CorsMaxAge is how many seconds browsers may cache a preflight response.
+	CorsMaxAge int `env:"CORS_MAX_AGE" envDefault:"600"`
 
 	TwilioAccountSid  string `env:"TWILIO_ACCOUNT_SID" envDefault:"twilio_account_sid"`
 	TwilioAuthToken   string `env:"TWILIO_AUTH_TOKEN" envDefault:"twilio_auth_token"`
 	TwilioPhoneNumber string `env:"TWILIO_PHONE_NUMBER" envDefault:"twilio_phone_number"`
 
 	OtpExpire int `env:"OTP_EXPIRE" envDefault:"5"`
+
+	LinkSigningSecret       string `env:"LINK_SIGNING_SECRET" envDefault:"link_signing_secret"`
+	VerifyLinkBaseUrl       string `env:"VERIFY_LINK_BASE_URL" envDefault:"http://127.0.0.1:8080/api/v1/users/credential/verify-email"`
+	VerifyLinkExpire        int    `env:"VERIFY_LINK_EXPIRE" envDefault:"24"`
+	VerifyResendCooldown    int    `env:"VERIFY_RESEND_COOLDOWN" envDefault:"60"`
+	UnverifiedAccountExpire int    `env:"UNVERIFIED_ACCOUNT_EXPIRE" envDefault:"72"`
+	UnverifiedSweepInterval int    `env:"UNVERIFIED_SWEEP_INTERVAL" envDefault:"60"`
+
+	ResetLinkBaseUrl string `env:"RESET_LINK_BASE_URL" envDefault:"http://127.0.0.1:8080/api/v1/users/credential/reset-password"`
+
+	InvitationBaseUrl string `env:"INVITATION_BASE_URL" envDefault:"http://127.0.0.1:8080/api/v1/invitations"`
+	InvitationExpire  int    `env:"INVITATION_EXPIRE" envDefault:"72"`
+
+	DeactivationGracePeriod int `env:"DEACTIVATION_GRACE_PERIOD" envDefault:"30"`
+	PurgeWarningPeriod      int `env:"PURGE_WARNING_PERIOD" envDefault:"3"`
+	PurgeSweepInterval      int `env:"PURGE_SWEEP_INTERVAL" envDefault:"60"`
+	TenantDeletionInterval  int `env:"TENANT_DELETION_INTERVAL" envDefault:"1"`
+
+	AuditRetentionDays     int `env:"AUDIT_RETENTION_DAYS" envDefault:"365"`
+	AuditRetentionInterval int `env:"AUDIT_RETENTION_INTERVAL" envDefault:"60"`
+
+	SecretRotationGracePeriod int `env:"SECRET_ROTATION_GRACE_PERIOD" envDefault:"24"`
+
+	PlatformApiKey        string `env:"PLATFORM_API_KEY" envDefault:""`
+	PlatformSessionExpire int    `env:"PLATFORM_SESSION_EXPIRE" envDefault:"8"`
+
+	PseudonymSecret string `env:"PSEUDONYM_SECRET" envDefault:"pseudonym_secret"`
+
+	FirebaseSignerKey     string `env:"FIREBASE_SIGNER_KEY" envDefault:""`
+	FirebaseSaltSeparator string `env:"FIREBASE_SALT_SEPARATOR" envDefault:"Bw=="`
+	FirebaseRounds        int    `env:"FIREBASE_ROUNDS" envDefault:"8"`
+	FirebaseMemCost       int    `env:"FIREBASE_MEM_COST" envDefault:"14"`
 }
 
 var AppConfig = Config{}
@@ -54,8 +94,10 @@ func init() {
 	log := logger.New()
 	log.Debug().Msg("Loading env vars")
 
+	// Without a .env file the variables come from the environment alone, as
+	// in containers and tests.
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatal().Err(err).Msg("Error while loading env vars")
 	}
 
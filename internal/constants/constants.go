@@ -10,21 +10,102 @@ const (
 	BadRequest          = "UAS-400"
 	Unauthorized        = "UAS-401"
 	Forbidden           = "UAS-403"
+	TooManyRequests     = "UAS-429"
+	QuotaExceeded       = "UAS-429-QUOTA"
 	InternalServerError = "UAS-500"
 
 	// Endpoints
-	ApiPrefix                   = "/api/v1"
-	HealthCheckEndpoint         = ApiPrefix + "/health/alive"
-	ReadinessEndpoint           = ApiPrefix + "/health/status"
-	OnboardTenantEndpoint       = ApiPrefix + "/tenants"
-	DeleteTenantEndpoint        = ApiPrefix + "/tenants/{id}"
-	CredentialsLoginEndpoint    = ApiPrefix + "/users/credential/login"
-	CredentialsRegisterEndpoint = ApiPrefix + "/users/credential/register"
-	CredentialsForgotEndpoint   = ApiPrefix + "/users/credential/forgot-password"
-	CredentialsResetEndpoint    = ApiPrefix + "/users/credential/reset-password"
-	OtpSendEndpoint             = ApiPrefix + "/users/otp/send"
-	OtpVerifyEndpoint           = ApiPrefix + "/users/otp/verify"
-	RefreshTokenEndpoint        = ApiPrefix + "/users/refresh-token"
+	ApiPrefix                    = "/api/v1"
+	HealthCheckEndpoint          = ApiPrefix + "/health/alive"
+	ReadinessEndpoint            = ApiPrefix + "/health/status"
+	OnboardTenantEndpoint        = ApiPrefix + "/tenants"
+	DeleteTenantEndpoint         = ApiPrefix + "/tenants/{id}"
+	DeactivateTenantEndpoint     = ApiPrefix + "/tenants/{id}/deactivate"
+	RestoreTenantEndpoint        = ApiPrefix + "/tenants/{id}/restore"
+	TenantsEndpoint              = ApiPrefix + "/tenants"
+	TenantEndpoint               = ApiPrefix + "/tenants/{id}"
+	RotateTenantSecretEndpoint   = ApiPrefix + "/tenants/{id}/rotate-secret"
+	TenantCredentialsEndpoint    = ApiPrefix + "/tenants/{id}/credentials"
+	TenantDeletionEndpoint       = ApiPrefix + "/tenants/{id}/deletion"
+	TenantUsageEndpoint          = ApiPrefix + "/tenants/{id}/usage"
+	TenantQuotasEndpoint         = ApiPrefix + "/tenants/{id}/quotas"
+	PlatformLoginEndpoint        = ApiPrefix + "/platform/login"
+	PlatformAdminsEndpoint       = ApiPrefix + "/platform/admins"
+	PlatformAuditEndpoint        = ApiPrefix + "/platform/audit"
+	CredentialsLoginEndpoint     = ApiPrefix + "/users/credential/login"
+	CredentialsRegisterEndpoint  = ApiPrefix + "/users/credential/register"
+	CredentialsForgotEndpoint    = ApiPrefix + "/users/credential/forgot-password"
+	CredentialsResetEndpoint     = ApiPrefix + "/users/credential/reset-password"
+	CredentialsVerifyEndpoint    = ApiPrefix + "/users/credential/verify-email"
+	CredentialsResendEndpoint    = ApiPrefix + "/users/credential/resend-verification"
+	OtpSendEndpoint              = ApiPrefix + "/users/otp/send"
+	OtpVerifyEndpoint            = ApiPrefix + "/users/otp/verify"
+	RefreshTokenEndpoint         = ApiPrefix + "/users/refresh-token"
+	TokenExchangeEndpoint        = ApiPrefix + "/users/token/exchange"
+	ProfileDepartmentsEndpoint   = ApiPrefix + "/users/me/departments"
+	ProfileEndpoint              = ApiPrefix + "/users/me"
+	ProfileVerifyEmailEndpoint   = ApiPrefix + "/users/me/email/verify"
+	ProfileVerifyPhoneEndpoint   = ApiPrefix + "/users/me/phone/verify"
+	AdminUsersEndpoint           = ApiPrefix + "/admin/users"
+	AdminUserEndpoint            = ApiPrefix + "/admin/users/{id}"
+	AdminDisableUserEndpoint     = ApiPrefix + "/admin/users/{id}/disable"
+	AdminEnableUserEndpoint      = ApiPrefix + "/admin/users/{id}/enable"
+	AdminResetPasswordEndpoint   = ApiPrefix + "/admin/users/{id}/reset-password"
+	AdminResendVerifyEndpoint    = ApiPrefix + "/admin/users/{id}/resend-verification"
+	AdminUserRoleEndpoint        = ApiPrefix + "/admin/users/{id}/role"
+	AdminRestoreUserEndpoint     = ApiPrefix + "/admin/users/{id}/restore"
+	ProfileExportEndpoint        = ApiPrefix + "/users/me/export"
+	ProfileErasureEndpoint       = ApiPrefix + "/users/me/erasure"
+	AdminUserExportEndpoint      = ApiPrefix + "/admin/users/{id}/export"
+	AdminUserErasureEndpoint     = ApiPrefix + "/admin/users/{id}/erasure"
+	AdminErasuresEndpoint        = ApiPrefix + "/admin/erasures"
+	AdminUserSchemaEndpoint      = ApiPrefix + "/admin/department/user-schema"
+	AdminUserMetadataEndpoint    = ApiPrefix + "/admin/users/{id}/metadata"
+	ImportUsersEndpoint          = ApiPrefix + "/admin/users/import"
+	AdminInvitationsEndpoint     = ApiPrefix + "/admin/invitations"
+	AdminInvitationEndpoint      = ApiPrefix + "/admin/invitations/{id}"
+	AdminResendInviteEndpoint    = ApiPrefix + "/admin/invitations/{id}/resend"
+	InvitationEndpoint           = ApiPrefix + "/invitations"
+	AcceptInvitationEndpoint     = ApiPrefix + "/invitations/accept"
+	AdminScimTokenEndpoint       = ApiPrefix + "/admin/department/scim-token"
+	AdminSettingsEndpoint        = ApiPrefix + "/admin/department/settings"
+	AdminSigningKeysEndpoint     = ApiPrefix + "/admin/department/signing-keys"
+	AdminUsageEndpoint           = ApiPrefix + "/admin/department/usage"
+	AdminRolesEndpoint           = ApiPrefix + "/admin/roles"
+	AdminRoleEndpoint            = ApiPrefix + "/admin/roles/{name}"
+	AdminRoleMembersEndpoint     = ApiPrefix + "/admin/roles/{name}/members"
+	AdminRoleMemberEndpoint      = ApiPrefix + "/admin/roles/{name}/members/{id}"
+	AdminUserRolesEndpoint       = ApiPrefix + "/admin/users/{id}/roles"
+	AdminUserPermissionsEndpoint = ApiPrefix + "/admin/users/{id}/permissions"
+	AdminGroupsEndpoint          = ApiPrefix + "/admin/groups"
+	AdminGroupEndpoint           = ApiPrefix + "/admin/groups/{id}"
+	AdminGroupMembersEndpoint    = ApiPrefix + "/admin/groups/{id}/members"
+	AdminGroupMemberEndpoint     = ApiPrefix + "/admin/groups/{id}/members/{memberId}"
+	AdminGroupRoleEndpoint       = ApiPrefix + "/admin/groups/{id}/roles/{name}"
+	AdminPoliciesEndpoint        = ApiPrefix + "/admin/authz/policies"
+	AdminPolicyEndpoint          = ApiPrefix + "/admin/authz/policies/{id}"
+	AuthzCheckEndpoint           = ApiPrefix + "/authz/check"
+	AuthzBatchCheckEndpoint      = ApiPrefix + "/authz/check/batch"
+	AdminNamespacesEndpoint      = ApiPrefix + "/admin/relations/namespaces"
+	AdminNamespaceEndpoint       = ApiPrefix + "/admin/relations/namespaces/{name}"
+	RelationWriteEndpoint        = ApiPrefix + "/relations/write"
+	RelationDeleteEndpoint       = ApiPrefix + "/relations/delete"
+	RelationCheckEndpoint        = ApiPrefix + "/relations/check"
+	RelationExpandEndpoint       = ApiPrefix + "/relations/expand"
+	RelationListObjectsEndpoint  = ApiPrefix + "/relations/list-objects"
+	AdminPermissionsEndpoint     = ApiPrefix + "/admin/permissions"
+	AdminAuditEndpoint           = ApiPrefix + "/admin/audit"
+	JwksEndpoint                 = ApiPrefix + "/departments/{id}/.well-known/jwks.json"
+
+	// SCIM endpoints
+	ScimPrefix                = ApiPrefix + "/scim/v2"
+	ScimUsersEndpoint         = ScimPrefix + "/Users"
+	ScimUserEndpoint          = ScimPrefix + "/Users/{id}"
+	ScimGroupsEndpoint        = ScimPrefix + "/Groups"
+	ScimGroupEndpoint         = ScimPrefix + "/Groups/{id}"
+	ScimServiceConfigEndpoint = ScimPrefix + "/ServiceProviderConfig"
+	ScimSchemasEndpoint       = ScimPrefix + "/Schemas"
+	ScimResourceTypesEndpoint = ScimPrefix + "/ResourceTypes"
 
 	// Messages
 	EntityNotFound             = "%s with %s %s does not exist."
@@ -34,22 +115,123 @@ const (
 	CreateEntityError          = "Error while creating %s."
 	CreateEntityMessage        = "Created %s successfully."
 	OtpCodeMessage             = "Your OTP code is %s."
+	OtpRedisKey                = "otp:%s:%s"
+	VerifyResendRedisKey       = "verify-resend:%s:%s"
+	SettingsRedisKey           = "department-settings:%s"
+	CorsOriginRedisKey         = "cors-origin:%s"
+	GroupRolesRedisKey         = "group-roles:%s:%s"
+	SigningKeysRedisKey        = "signing-keys:%s"
 	InternalServerErrorMessage = "Internal server error."
 
 	// Queries
-	FindByIdQuery           = "id = ?"
-	FindByEmailQuery        = "email = ?"
-	FindByTokenAndTypeQuery = "token = ? AND type = ?"
-	FindByUserIdQuery       = "userId = ?"
-	FindByPhoneNumberQuery  = "phone_number = ?"
-	FindByIdAndUserIdQuery  = "id = ? AND userId = ?"
+	FindByIdQuery            = "id = ?"
+	FindByEmailQuery         = "email = ?"
+	FindByTokenAndTypeQuery  = "token = ? AND type = ?"
+	FindByTokenQuery         = "token = ?"
+	FindByDepartmentQuery    = "department_id = ?"
+	FindByUserIdQuery        = "user_id = ?"
+	FindByDepartmentAndEmail = "department_id = ? AND email = ?"
+	FindByDepartmentAndPhone = "department_id = ? AND phone_number = ?"
+	FindByDepartmentAndUser  = "department_id = ? AND user_id = ?"
+	FindByIdsQuery           = "id IN ?"
+	FindByUserIdsQuery       = "user_id IN ?"
+	FindExpiredUnverified    = "email_verified = ? AND verification_expires_at < ?"
+	FindByIdAndDepartment    = "id = ? AND department_id = ?"
+	FindPendingInvitation    = "department_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?"
+	OrderByNewest            = "created_at DESC"
+	OrderByOldest            = "created_at ASC"
+	FindDuePurgeQuery        = "purge_at <= ?"
+	FindPurgeWarningQuery    = "purge_at <= ? AND purge_warning_sent_at IS NULL"
+	FindByDepartmentIdsQuery = "department_id IN ?"
+	FindByExternalIdQuery    = "external_id = ?"
+	FindByNameQuery          = "name = ?"
+	FindByGroupIdQuery       = "group_id = ?"
+	FindByGroupIdsQuery      = "group_id IN ?"
+	FindByMemberIdQuery      = "member_id = ?"
+	FindByMemberIdsQuery     = "member_id IN ?"
+	FindGroupMembersQuery    = "group_id = ? AND member_id IN ?"
+	FindByMemberTypeQuery    = "member_type = ?"
+	FindByRoleNameQuery      = "role = ?"
+	OrderByRole              = "role ASC"
+	FindLiveRelationTuples   = "created_revision <= ? AND (deleted_revision IS NULL OR deleted_revision > ?)"
+	FindUndeletedTuples      = "deleted_revision IS NULL"
+	FindRelationObjectQuery  = "department_id = ? AND namespace = ? AND object_id = ? AND relation = ?"
+	FindRelationSubjectQuery = "subject_namespace = ? AND subject_id = ? AND subject_relation = ?"
+	FindSubjectObjectQuery   = "subject_namespace = ? AND subject_id = ?"
+	FindByNamespaceQuery     = "department_id = ? AND namespace = ?"
+	FindObjectIdsAfterQuery  = "object_id > ?"
+	OrderByObjectId          = "object_id ASC"
+	OrderById                = "id ASC"
+	OrderByName              = "name ASC"
+	OrderByNewestId          = "id DESC"
+	FindIdsAfterQuery        = "id > ?"
+	FindByActionQuery        = "action = ?"
+	FindByOutcomeQuery       = "outcome = ?"
+	FindByActorQuery         = "actor_id = ?"
+	FindByTargetQuery        = "target_id = ?"
+	FindByRequestIdQuery     = "request_id = ?"
+	FindCreatedFromQuery     = "created_at >= ?"
+	FindCreatedToQuery       = "created_at <= ?"
+	FindCreatedBeforeQuery   = "created_at < ?"
+	FindByActorOrTargetQuery = "(actor_id = ? OR target_id = ?)"
+	SearchByNameQuery        = "name LIKE ?"
+	FindDeactivatedTenants   = "deactivated_at IS NOT NULL"
+	FindActiveSigningKeys    = "department_id = ? AND retired_at IS NULL"
+	FindUnownedUsersQuery    = "(department_id IS NULL OR department_id = '')"
+	FindByIdInQuery          = "id IN (?)"
+	FindByIdNotInQuery       = "id NOT IN (?)"
+	FindOutsideDepartments   = "department_id NOT IN ?"
+	FindClaimableDeletions   = "(status = ? OR (status = ? AND started_at < ?))"
+	FindActiveTenants        = "deactivated_at IS NULL"
+	FindByCorsOrigin         = "JSON_CONTAINS(settings, JSON_QUOTE(?), '$.corsOrigins')"
+	FindUsageCounter         = "department_id = ? AND day = ? AND metric = ?"
+	FindUsageCounters        = "department_id = ? AND day BETWEEN ? AND ?"
+	FindActiveUser           = "department_id = ? AND month = ? AND user_id = ?"
+	FindActiveUsers          = "department_id = ? AND month BETWEEN ? AND ?"
+	SelectActiveUsers        = "month, COUNT(*) AS count"
+	IncrementCount           = "count + 1"
+	OrderByDay               = "day ASC"
+	FindByDepartmentAndName  = "department_id = ? AND name = ?"
+	FindByDepartmentAndRole  = "department_id = ? AND role = ?"
+
+	JoinDepartmentRolesQuery = "JOIN department_roles ON department_roles.user_id = user_models.id AND department_roles.deleted_at IS NULL"
+	FindByDepartmentIdQuery  = "department_roles.department_id = ?"
+	FindUserByIdQuery        = "user_models.id = ?"
+	SearchEmailOrPhoneQuery  = "(user_models.email LIKE ? OR user_models.phone_number LIKE ?)"
+	FindByRoleQuery          = "department_roles.role = ?"
+	FindByEmailVerifiedQuery = "user_models.email_verified = ?"
+	FindByDisabledQuery      = "user_models.disabled = ?"
+	FindDeactivatedQuery     = "user_models.deactivated_at IS NOT NULL"
+	FindUserByEmailQuery     = "user_models.email = ?"
+	FindUserByExternalId     = "user_models.external_id = ?"
+	FindUserByNameQuery      = "user_models.name = ?"
+	FindActiveQuery          = "user_models.deactivated_at IS NULL"
+	SelectUserColumns        = "user_models.*"
+	OrderByNewestUsers       = "user_models.created_at DESC"
+	JoinMemberUsersQuery     = "JOIN user_models ON user_models.id = department_roles.user_id AND user_models.deleted_at IS NULL"
+	FindMembersByRoleQuery   = "department_roles.department_id = ? AND department_roles.role = ?"
+	FindOtherMembersQuery    = "department_roles.user_id <> ?"
+	FindLoginAllowedQuery    = "user_models.disabled = ? AND user_models.deactivated_at IS NULL"
+	HasMembershipQuery       = "EXISTS (SELECT 1 FROM department_roles WHERE department_roles.user_id = user_models.id AND department_roles.deleted_at IS NULL)"
+	FirstMembershipQuery     = "(SELECT department_roles.department_id FROM department_roles WHERE department_roles.user_id = user_models.id AND department_roles.deleted_at IS NULL ORDER BY department_roles.created_at, department_roles.department_id LIMIT 1)"
 
 	// Misc
+	DefaultPageSize     = 20
+	MaxPageSize         = 100
 	TimeFormat          = "2006-01-02 15:04:05"
+	UsageDayFormat      = "2006-01-02"
+	UsageMonthFormat    = "2006-01"
+	TimeOfDayFormat     = "15:04"
+	MaxUsageDays        = 366
 	TraceIdHeader       = "x-trace-id"
 	AuthorizationHeader = "Authorization"
+	PlatformTokenHeader = "x-platform-token"
+	PlatformApiKeyActor = "api-key"
 	JwtHeader           = "x-jwt-token"
 	AccessTokenCookie   = "access-token"
+	OriginHeader        = "Origin"
+	CorsAllowedHeaders  = "Authorization, Content-Type, x-jwt-token, x-trace-id"
+	CorsExposedHeaders  = "x-jwt-token, x-trace-id"
 	HealthCheckMessage  = "Performing health-check for service: %s"
 	DBTablePrefix       = "uas_%s"
 	LocalEnv            = "local"
@@ -57,21 +239,109 @@ const (
 	ProductionEnv       = "prod"
 	StartMessage        = "Starting API Service on PORT=%s | ENV=%s"
 	DefaultRedisTtl     = 1 * time.Hour
+	ScimContentType     = "application/scim+json"
+	CsvContentType      = "text/csv"
+	NdjsonContentType   = "application/x-ndjson"
+	AuditExportFilename = "attachment; filename=\"audit-%s.%s\""
+	ScimDefaultCount    = 100
+	ScimMaxCount        = 1000
+	CredentialUseWindow = 1 * time.Minute
+	SettingsCacheTtl    = 5 * time.Minute
+	SigningKeyCacheTtl  = 5 * time.Minute
+	GroupRolesCacheTtl  = 5 * time.Minute
+	// a running tenant deletion is retried after this long, e.g. after a crash
+	TenantDeletionTimeout = 30 * time.Minute
+	SigningKeyBits        = 2048
+	SigningAlgorithm      = "RS256"
+	JwtIssuerFormat       = "%s/departments/%s"
+	DefaultOtpLength      = 4
+	RoleNamePattern       = "^[a-z][a-z0-9_-]{1,49}$"
+	// relation tuples look like doc:123#viewer@user:abc or doc:123#viewer@group:eng#member
+	RelationNamePattern    = "^[a-z][a-z0-9_]{0,63}$"
+	RelationUsersetPattern = `^([a-z][a-z0-9_]{0,63}):([A-Za-z0-9_.|-]{1,128})#([a-z][a-z0-9_]{0,63})$`
+	RelationSubjectPattern = `^([a-z][a-z0-9_]{0,63}):([A-Za-z0-9_.|-]{1,128})(?:#([a-z][a-z0-9_]{0,63}))?$`
+	// checks and expansions give up past this many nested usersets
+	RelationMaxDepth = 25
+	// a check or expansion gives up after visiting this many usersets
+	RelationMaxUsersets = 1000
+	// list-objects examines at most this many objects per page
+	RelationListObjectsLimit = 1000
+	// audit exports read the log in batches of this many events
+	AuditExportBatchSize = 1000
+	AuditUserAgentLength = 255
+	AuditDetailsLength   = 255
+	AuditIdLength        = 100
+	AuditRequestIdLength = 36
+	// imported hashes are recomputed on every login, higher costs are rejected
+	MaxPbkdf2Iterations  = 2000000
+	MaxScryptN           = 1 << 17
+	MaxScryptBlockSize   = 16
+	MaxScryptParallelism = 4
+	MaxScryptMemory      = 128 << 20
 
 	// Email
-	EmailTemplatePath   = "%s/web/emails/%s.html"
-	EmailFrom           = "Example <team@%s>"
-	WelcomeEmailSubject = "Welcome to Example!"
+	EmailTemplatePath         = "%s/web/emails/%s.html"
+	EmailFromWithName         = "%s <team@%s>"
+	DefaultEmailSenderName    = "Example"
+	WelcomeEmailSubject       = "Welcome to Example!"
+	ResetPasswordEmailSubject = "Reset your password"
+	VerifyEmailSubject        = "Verify your email address"
+	MagicLinkEmailSubject     = "Your sign-in link"
+	InvitationEmailSubject    = "You have been invited"
+	DeactivatedEmailSubject   = "Your account has been deactivated"
+	PurgeWarningEmailSubject  = "Your account will be deleted soon"
 
 	// Context keys
 	RequestIdCtxKey    = "request_id"
 	UserIdCtxKey       = "userId"
 	DepartmentIdCtxKey = "department_id"
 	RoleCtxKey         = "department_role"
+	PermissionsCtxKey  = "permissions"
+	PlatformActorKey   = "platform_actor"
+	CredentialCtxKey   = "tenant_credential"
+	ErasedUserCtxKey   = "erased_user"
 
 	// Errors
 	HealthCheckError         = "Error while performing health-check for service: %s"
 	InvalidTemplatePathError = "invalid template path: %s"
 	TokenExpiredError        = "Token expired"
 	TokenInvalidError        = "Token invalid"
+	AccountDisabledError     = "Account disabled"
+	AccountDeactivatedError  = "Account deactivated"
+	ResetRequiredError       = "Password reset required"
+	TenantDeactivatedError   = "Department deactivated"
+	TenantCredentialsError   = "Invalid tenant credentials"
+	PreviousSecretError      = "The previous tenant secret can't rotate the secret, use the current one"
+	ForeignUserError         = "User belongs to another department, only their membership can be changed here"
+	PlatformCredentialsError = "Invalid platform credentials"
+	LoginMethodDisabledError = "Login method %s is disabled for this department"
+	SignupClosedError        = "Signup is closed for this department"
+	RedirectNotAllowedError  = "Redirect URL is not allowed for this department"
+	TokenIssuerError         = "Token was not issued for this department"
+	AccessTokenMissingError  = "Access token is missing"
+	RefreshTokenMissingError = "Refresh token is missing"
+	RefreshTokenInvalidError = "Refresh token is invalid or expired"
+	QuotaExceededError       = "Department has reached its quota of %d %s"
+	CorsOriginError          = "Origin is not allowed for this department"
+	UsageRangeError          = "Invalid usage range, expected from <= to in YYYY-MM-DD at most %d days apart"
+	RoleNotFoundError        = "Role %s does not exist in this department"
+	BuiltInRoleError         = "Built-in roles can't be changed"
+	RoleInUseError           = "Role %s is still assigned to %d members or groups"
+	LastAdminError           = "The department's last admin can't be demoted or removed"
+	RoleEscalationError      = "Roles can't grant permissions the caller doesn't have"
+	RoleNotAssignedError     = "User doesn't have the role %s"
+	DefaultRoleRevokeError   = "Members always have a role, remove them from the department instead"
+	GroupNameTakenError      = "A group named %s already exists in this department"
+	GroupCycleError          = "Groups can't contain themselves, directly or through nested groups"
+	RelationNotDefinedError  = "Relation %s is not defined in namespace %s"
+	RelationDepthError       = "Relations are nested more than %d levels deep"
+	RelationFanOutError      = "Relations fan out to more than %d usersets"
+	ConsistencyTokenError    = "Invalid consistency token"
+	NamespaceInUseError      = "Namespace %s still has relation tuples"
+	DuplicateRelationError   = "Relation %s is defined more than once"
+
+	// Signed token purposes
+	VerifyEmailTokenPurpose = "verify-email"
+	InvitationTokenPurpose  = "invitation"
+	PlatformTokenPurpose    = "platform-session"
 )
@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+type AdminUserHandler struct {
+	userRepo           repository.UserRepository
+	authRepo           repository.AuthRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	groupRepo          repository.GroupRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	emailHelper        *helpers.EmailHelper
+	metadataHelper     *helpers.MetadataHelper
+	verificationHelper *helpers.VerificationHelper
+	deactivationHelper *helpers.DeactivationHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+	auditHelper        *helpers.AuditHelper
+}
+
+func NewAdminUserHandler(
+	userRepo repository.UserRepository,
+	authRepo repository.AuthRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	groupRepo repository.GroupRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	emailHelper *helpers.EmailHelper,
+	metadataHelper *helpers.MetadataHelper,
+	verificationHelper *helpers.VerificationHelper,
+	deactivationHelper *helpers.DeactivationHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+	auditHelper *helpers.AuditHelper,
+) *AdminUserHandler {
+	return &AdminUserHandler{
+		userRepo:           userRepo,
+		authRepo:           authRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		groupRepo:          groupRepo,
+		log:                log,
+		authHelper:         authHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		emailHelper:        emailHelper,
+		metadataHelper:     metadataHelper,
+		verificationHelper: verificationHelper,
+		deactivationHelper: deactivationHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+		auditHelper:        auditHelper,
+	}
+}
+
+// ListUsersHandler godoc
+// @Summary List Users
+// @Description List the users of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param q query string false "Search by email or phone number"
+// @Param role query string false "Filter by role"
+// @Param verified query bool false "Filter by email verification state"
+// @Param disabled query bool false "Filter by disabled state"
+// @Param deactivated query bool false "Filter by deactivation state"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users [get]
+func (h *AdminUserHandler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	filter := models.UserFilter{
+		Search: params.Get("q"),
+		Role:   models.Role(params.Get("role")),
+	}
+
+	var err error
+
+	if filter.EmailVerified, err = parseOptionalBool(params.Get("verified")); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for verified", constants.BadRequest, err)
+		return
+	}
+
+	if filter.Disabled, err = parseOptionalBool(params.Get("disabled")); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for disabled", constants.BadRequest, err)
+		return
+	}
+
+	if filter.Deactivated, err = parseOptionalBool(params.Get("deactivated")); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for deactivated", constants.BadRequest, err)
+		return
+	}
+
+	filter.Page, filter.PageSize = parsePagination(params.Get("page"), params.Get("pageSize"))
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	users, total, err := h.userRepo.FindByDepartment(departmentId, filter)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	items := make([]*models.AdminUserResponse, 0, len(users))
+
+	for i := range users {
+		role, err := h.departmentRoleRepo.FindById(departmentId, users[i].ID)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+			return
+		}
+
+		items = append(items, toAdminUserResponse(&users[i], role.Role))
+	}
+
+	res := &models.PaginatedResponse{
+		Items:    items,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    total,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Users retrieved successfully", res)
+}
+
+// GetUserHandler godoc
+// @Summary Get User
+// @Description Get a user of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id} [get]
+func (h *AdminUserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User retrieved successfully", toAdminUserResponse(user, role.Role))
+}
+
+// DisableUserHandler godoc
+// @Summary Disable User
+// @Description Block a user of the caller's department from logging in
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/disable [post]
+func (h *AdminUserHandler) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableUserHandler godoc
+// @Summary Enable User
+// @Description Allow a disabled user of the caller's department to log in again
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/enable [post]
+func (h *AdminUserHandler) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+// DeleteUserHandler godoc
+// @Summary Delete User
+// @Description Deactivate a user of the caller's department. The user is
+// @Description permanently deleted after the grace period unless restored.
+// @Description A member whose identity belongs to another department is only
+// @Description removed from the caller's department and its groups.
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id} [delete]
+func (h *AdminUserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.notSelf(w, r, user) {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		h.responseHelper.SendErrorResponse(w, "User is already deactivated", constants.BadRequest, nil)
+		return
+	}
+
+	if !h.canManage(w, r, role) {
+		return
+	}
+
+	if !user.OwnedBy(role.DepartmentID) {
+		if err := h.roleHelper.CheckRemoval(role); err != nil {
+			sendRoleError(h.responseHelper, w, role.Role, err)
+			return
+		}
+
+		h.removeMember(w, role)
+		return
+	}
+
+	if !checkUserRemoval(h.departmentRoleRepo, h.roleHelper, h.responseHelper, w, user.ID) {
+		return
+	}
+
+	err := h.deactivationHelper.DeactivateUser(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error deleting user", constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User deactivated successfully", toAdminUserResponse(user, role.Role))
+}
+
+// RestoreUserHandler godoc
+// @Summary Restore User
+// @Description Restore a deactivated user of the caller's department before it is purged
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/restore [post]
+func (h *AdminUserHandler) RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) {
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		h.responseHelper.SendErrorResponse(w, "User is not deactivated", constants.BadRequest, nil)
+		return
+	}
+
+	err := h.deactivationHelper.RestoreUser(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User restored successfully", toAdminUserResponse(user, role.Role))
+}
+
+// ForcePasswordResetHandler godoc
+// @Summary Force Password Reset
+// @Description Block password login for a user until they reset their password, and email them a reset link
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/reset-password [post]
+func (h *AdminUserHandler) ForcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) || !h.canManage(w, r, role) {
+		return
+	}
+
+	if user.Email == "" {
+		h.responseHelper.SendErrorResponse(w, "User has no email address", constants.BadRequest, nil)
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	if err := h.usageHelper.CheckQuota(departmentId, models.EmailUsage); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+		return
+	}
+
+	reset_token := h.authHelper.GenerateAuthToken()
+
+	err := h.authRepo.Create(&models.AuthModel{
+		UserID: user.ID,
+		Token:  reset_token,
+		Type:   models.ResetPassword,
+	})
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error sending reset password email", constants.InternalServerError, err)
+		return
+	}
+
+	user.PasswordResetRequired = true
+
+	err = h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	settings, err := h.authHelper.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	tmpl_data := models.ForgotPasswordData{
+		Name: user.Name,
+		Url:  fmt.Sprintf("%s?token=%s", config.AppConfig.ResetLinkBaseUrl, url.QueryEscape(reset_token)),
+	}
+
+	err = h.emailHelper.SendDepartmentEmail(settings, user.Email, "reset-password", tmpl_data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error sending reset password email", constants.InternalServerError, err)
+		return
+	}
+
+	h.usageHelper.Record(departmentId, models.EmailUsage)
+
+	h.responseHelper.SendSuccessResponse(w, "Password reset required", nil)
+}
+
+// ResendVerificationHandler godoc
+// @Summary Resend Verification
+// @Description Send a new email verification code to a user of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/resend-verification [post]
+func (h *AdminUserHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) {
+		return
+	}
+
+	if user.Email == "" || user.EmailVerified {
+		h.responseHelper.SendErrorResponse(w, "User has no unverified email address", constants.BadRequest, nil)
+		return
+	}
+
+	if err := h.usageHelper.CheckQuota(user.DepartmentID, models.EmailUsage); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+		return
+	}
+
+	err := h.verificationHelper.SendVerificationEmail(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error w/ sending verification email", constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Verification email sent successfully", nil)
+}
+
+// ChangeRoleHandler godoc
+// @Summary Change Role
+// @Description Change the role of a user within the caller's department. The role
+// @Description can't grant more than the caller has, and the last admin keeps the role.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/role [put]
+func (h *AdminUserHandler) ChangeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ChangeRoleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.notSelf(w, r, user) {
+		return
+	}
+
+	if err := h.roleHelper.CheckRoleChange(helpers.GetPermissions(r), role, data.Role); err != nil {
+		sendRoleError(h.responseHelper, w, data.Role, err)
+		return
+	}
+
+	role.Role = data.Role
+
+	err = h.departmentRoleRepo.Update(role)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error updating user role", constants.InternalServerError, err)
+		return
+	}
+
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.RoleAssigned, TargetID: user.ID, Details: string(role.Role)})
+
+	h.responseHelper.SendSuccessResponse(w, "User role updated successfully", toAdminUserResponse(user, role.Role))
+}
+
+// UpdateMetadataHandler godoc
+// @Summary Update User Metadata
+// @Description Merge custom attributes into a user's metadata, including readOnly attributes
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/metadata [patch]
+func (h *AdminUserHandler) UpdateMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.UpdateMetadataRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) {
+		return
+	}
+
+	metadata, err := helpers.MergeMetadata(user.Metadata, data.Metadata)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	schema, err := h.metadataHelper.LoadSchema(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	if schema != nil {
+		if err := schema.Validate(metadata); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+			return
+		}
+	}
+
+	user.Metadata = metadata
+
+	err = h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User metadata updated successfully", toAdminUserResponse(user, role.Role))
+}
+
+func (h *AdminUserHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, role, ok := h.departmentUser(w, r)
+
+	if !ok || !h.notSelf(w, r, user) || !h.ownUser(w, r, user) {
+		return
+	}
+
+	if !h.canManage(w, r, role) {
+		return
+	}
+
+	if disabled && !checkUserRemoval(h.departmentRoleRepo, h.roleHelper, h.responseHelper, w, user.ID) {
+		return
+	}
+
+	user.Disabled = disabled
+
+	err := h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User updated successfully", toAdminUserResponse(user, role.Role))
+}
+
+// departmentUser loads the user from the {id} path variable, only if it
+// belongs to the caller's department.
+func (h *AdminUserHandler) departmentUser(w http.ResponseWriter, r *http.Request) (*models.UserModel, *models.DepartmentRoles, bool) {
+	userId := mux.Vars(r)["id"]
+	departmentId := helpers.GetDepartmentId(r)
+
+	user, err := h.userRepo.FindByIdInDepartment(departmentId, userId)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "id", userId)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return nil, nil, false
+	}
+
+	role, err := h.departmentRoleRepo.FindById(departmentId, userId)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "id", userId)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return nil, nil, false
+	}
+
+	return user, role, true
+}
+
+// ownUser only lets identity level changes through for users the caller's
+// department owns. Members from other departments keep their identity, the
+// caller can only change their membership.
+func (h *AdminUserHandler) ownUser(w http.ResponseWriter, r *http.Request, user *models.UserModel) bool {
+	if !user.OwnedBy(helpers.GetDepartmentId(r)) {
+		h.responseHelper.SendErrorResponse(w, constants.ForeignUserError, constants.Forbidden, nil)
+		return false
+	}
+	return true
+}
+
+// removeMember removes a member from the department and its groups, their
+// identity and other memberships stay untouched.
+func (h *AdminUserHandler) removeMember(w http.ResponseWriter, role *models.DepartmentRoles) {
+	if err := h.groupRepo.RemoveFromDepartment(role.DepartmentID, role.UserID); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error removing user", constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(role.DepartmentID)
+
+	if err := h.departmentRoleRepo.Delete(role.DepartmentID, role.UserID); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error removing user", constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User removed from the department successfully", nil)
+}
+
+// canManage only lets the caller act on members who can't do more than they
+// can.
+func (h *AdminUserHandler) canManage(w http.ResponseWriter, r *http.Request, role *models.DepartmentRoles) bool {
+	if err := h.roleHelper.CheckManage(helpers.GetPermissions(r), role); err != nil {
+		sendRoleError(h.responseHelper, w, role.Role, err)
+		return false
+	}
+	return true
+}
+
+func (h *AdminUserHandler) notSelf(w http.ResponseWriter, r *http.Request, user *models.UserModel) bool {
+	if user.ID == helpers.GetUserId(r) {
+		h.responseHelper.SendErrorResponse(w, "Admins cannot perform this action on themselves", constants.BadRequest, nil)
+		return false
+	}
+	return true
+}
+
+func toAdminUserResponse(user *models.UserModel, role models.Role) *models.AdminUserResponse {
+	return &models.AdminUserResponse{
+		UserProfileResponse:   *toProfileResponse(user),
+		Role:                  role,
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		DeactivatedAt:         user.DeactivatedAt,
+		PurgeAt:               user.PurgeAt,
+		CreatedAt:             user.CreatedAt,
+	}
+}
+
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func parsePagination(pageParam string, pageSizeParam string) (int, int) {
+	page, err := strconv.Atoi(pageParam)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeParam)
+	if err != nil || pageSize < 1 {
+		pageSize = constants.DefaultPageSize
+	}
+
+	if pageSize > constants.MaxPageSize {
+		pageSize = constants.MaxPageSize
+	}
+
+	return page, pageSize
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"uas/internal/models"
+)
+
+// supportPermissions can manage users but not hand out roles.
+var supportPermissions = []models.Permission{
+	models.UsersReadPermission,
+	models.UsersWritePermission,
+	models.UsersDeletePermission,
+	models.ProfileReadPermission,
+	models.ProfileWritePermission,
+}
+
+func TestAdminActionsCantEscalate(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"disable", http.MethodPost, adminUserPath("other-admin", "/disable")},
+		{"enable", http.MethodPost, adminUserPath("other-admin", "/enable")},
+		{"delete", http.MethodDelete, adminUserPath("other-admin", "")},
+		{"force password reset", http.MethodPost, adminUserPath("other-admin", "/reset-password")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newIsolationFixture(t)
+			f.permissions = supportPermissions
+
+			f.userRepo.users["other-admin"] = &models.UserModel{ID: "other-admin", DepartmentID: departmentA, Email: "other@a.example", Disabled: true}
+			f.departmentRoleRepo.roles = append(f.departmentRoleRepo.roles, models.DepartmentRoles{DepartmentID: departmentA, UserID: "other-admin", Role: models.Admin})
+			before := *f.userRepo.users["other-admin"]
+
+			w := f.serve(tt.method, tt.path, "")
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+			}
+
+			if after := f.userRepo.users["other-admin"]; after.Disabled != before.Disabled || after.PasswordResetRequired || after.DeactivatedAt != nil {
+				t.Errorf("admin changed: before %+v, after %+v", before, *after)
+			}
+		})
+	}
+}
+
+func TestAdminActionsOnLesserMember(t *testing.T) {
+	f := newIsolationFixture(t)
+	f.permissions = supportPermissions
+
+	if w := f.serve(http.MethodPost, adminUserPath(ownUserId, "/disable"), ""); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if !f.userRepo.users[ownUserId].Disabled {
+		t.Error("user was not disabled")
+	}
+}
+
+func TestDisableLastAdminOfAnotherDepartment(t *testing.T) {
+	f := newIsolationFixture(t)
+
+	// ownUserId is a plain member of A but the only admin of B
+	f.departmentRoleRepo.roles = append(f.departmentRoleRepo.roles, models.DepartmentRoles{DepartmentID: departmentB, UserID: ownUserId, Role: models.Admin})
+
+	if w := f.serve(http.MethodPost, adminUserPath(ownUserId, "/disable"), ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+
+	if f.userRepo.users[ownUserId].Disabled {
+		t.Error("last admin of department B was disabled")
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+var auditCsvHeader = []string{
+	"eventId",
+	"departmentId",
+	"action",
+	"outcome",
+	"actorId",
+	"targetId",
+	"details",
+	"ip",
+	"userAgent",
+	"requestId",
+	"createdAt",
+}
+
+type AuditHandler struct {
+	auditRepo      repository.AuditRepository
+	log            *zerolog.Logger
+	responseHelper *helpers.ResponseHelper
+}
+
+func NewAuditHandler(
+	auditRepo repository.AuditRepository,
+	log *zerolog.Logger,
+	responseHelper *helpers.ResponseHelper,
+) *AuditHandler {
+	return &AuditHandler{
+		auditRepo:      auditRepo,
+		log:            log,
+		responseHelper: responseHelper,
+	}
+}
+
+// ListAuditEventsHandler godoc
+// @Summary List Audit Events
+// @Description List the audit log of the caller's department, newest first.
+// @Description Filter with `action`, `outcome`, `actorId`, `targetId`,
+// @Description `requestId`, `from` and `to`, paginate with `page` and
+// @Description `pageSize`. With `format` set to `csv` or `ndjson` every
+// @Description matching event is exported instead, oldest first.
+// @Tags Admin
+// @Produce  json,text/csv,application/x-ndjson
+// @Param action query string false "Action, e.g. user.login"
+// @Param outcome query string false "success or failure"
+// @Param actorId query string false "Who performed the action"
+// @Param targetId query string false "What the action was performed on"
+// @Param requestId query string false "Request ID from the x-trace-id header"
+// @Param from query string false "Earliest time, RFC 3339"
+// @Param to query string false "Latest time, RFC 3339"
+// @Param format query string false "csv or ndjson to export"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/audit [get]
+func (h *AuditHandler) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	filter := models.AuditFilter{
+		Action:    models.AuditAction(params.Get("action")),
+		Outcome:   models.AuditOutcome(params.Get("outcome")),
+		ActorID:   params.Get("actorId"),
+		TargetID:  params.Get("targetId"),
+		RequestID: params.Get("requestId"),
+	}
+
+	if filter.Outcome != "" && filter.Outcome != models.AuditSuccess && filter.Outcome != models.AuditFailure {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for outcome", constants.BadRequest, nil)
+		return
+	}
+
+	format := models.ImportFormat(params.Get("format"))
+
+	if format != "" && format != models.CSV && format != models.NDJSON {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for format", constants.BadRequest, nil)
+		return
+	}
+
+	var err error
+
+	if filter.From, err = parseOptionalTime(params.Get("from")); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for from", constants.BadRequest, err)
+		return
+	}
+
+	if filter.To, err = parseOptionalTime(params.Get("to")); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Invalid value for to", constants.BadRequest, err)
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	if format != "" {
+		h.export(w, departmentId, filter, format)
+		return
+	}
+
+	filter.Page, filter.PageSize = parsePagination(params.Get("page"), params.Get("pageSize"))
+
+	events, total, err := h.auditRepo.FindEvents(departmentId, filter)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := &models.PaginatedResponse{
+		Items:    toAuditEventResponses(events),
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    total,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Audit events retrieved successfully", res)
+}
+
+// export streams every matching event in batches. Once the first batch is
+// written the status can't change anymore, later errors end the export early.
+func (h *AuditHandler) export(w http.ResponseWriter, departmentId string, filter models.AuditFilter, format models.ImportFormat) {
+	events, err := h.auditRepo.FindEventsAfter(departmentId, filter, 0, constants.AuditExportBatchSize)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	contentType := constants.NdjsonContentType
+	if format == models.CSV {
+		contentType = constants.CsvContentType
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(constants.AuditExportFilename, departmentId, format))
+
+	csvWriter := csv.NewWriter(w)
+	jsonEncoder := json.NewEncoder(w)
+
+	if format == models.CSV {
+		csvWriter.Write(auditCsvHeader)
+	}
+
+	for len(events) > 0 {
+		for _, event := range events {
+			res := toAuditEventResponse(&event)
+
+			if format == models.CSV {
+				err = csvWriter.Write(auditCsvRecord(&res))
+			} else {
+				err = jsonEncoder.Encode(res)
+			}
+
+			if err != nil {
+				h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error writing audit export")
+				return
+			}
+		}
+
+		csvWriter.Flush()
+
+		if len(events) < constants.AuditExportBatchSize {
+			return
+		}
+
+		events, err = h.auditRepo.FindEventsAfter(departmentId, filter, events[len(events)-1].ID, constants.AuditExportBatchSize)
+
+		if err != nil {
+			h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error reading audit export")
+			return
+		}
+	}
+
+	csvWriter.Flush()
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func auditCsvRecord(event *models.AuditEventResponse) []string {
+	return []string{
+		strconv.FormatUint(event.EventID, 10),
+		event.DepartmentID,
+		string(event.Action),
+		string(event.Outcome),
+		event.ActorID,
+		event.TargetID,
+		event.Details,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func toAuditEventResponse(event *models.AuditEventModel) models.AuditEventResponse {
+	return models.AuditEventResponse{
+		EventID:      event.ID,
+		DepartmentID: event.DepartmentID,
+		Action:       event.Action,
+		Outcome:      event.Outcome,
+		ActorID:      event.ActorID,
+		TargetID:     event.TargetID,
+		Details:      event.Details,
+		IP:           event.IP,
+		UserAgent:    event.UserAgent,
+		RequestID:    event.RequestID,
+		CreatedAt:    event.CreatedAt,
+	}
+}
+
+func toAuditEventResponses(events []models.AuditEventModel) []models.AuditEventResponse {
+	res := make([]models.AuditEventResponse, 0, len(events))
+	for i := range events {
+		res = append(res, toAuditEventResponse(&events[i]))
+	}
+	return res
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type AuthzHandler struct {
+	policyRepo      repository.PolicyRepository
+	log             *zerolog.Logger
+	authzHelper     *helpers.AuthzHelper
+	responseHelper  *helpers.ResponseHelper
+	validatorHelper *helpers.ValidatorHelper
+}
+
+func NewAuthzHandler(
+	policyRepo repository.PolicyRepository,
+	log *zerolog.Logger,
+	authzHelper *helpers.AuthzHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+) *AuthzHandler {
+	return &AuthzHandler{
+		policyRepo:      policyRepo,
+		log:             log,
+		authzHelper:     authzHelper,
+		responseHelper:  responseHelper,
+		validatorHelper: validatorHelper,
+	}
+}
+
+// CheckHandler godoc
+// @Summary Check Authorization
+// @Description Decide whether a member of the tenant may perform an action on a
+// @Description resource. `explain` returns how the decision was reached, `dryRun`
+// @Description evaluates the policies in the request instead of the stored ones.
+// @Description Requires tenant credentials.
+// @Tags Authz
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} AuthzDecision
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /authz/check [post]
+func (h *AuthzHandler) CheckHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.AuthzCheckRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	policies, err := h.policyRepo.FindByDepartment(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	decision, err := h.check(departmentId, &data, policies)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Authorization checked successfully", decision)
+}
+
+// BatchCheckHandler godoc
+// @Summary Check Authorization in Batch
+// @Description Decide up to 100 checks at once, results are in the order of the
+// @Description checks. Requires tenant credentials.
+// @Tags Authz
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} AuthzBatchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /authz/check/batch [post]
+func (h *AuthzHandler) BatchCheckHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.AuthzBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	policies, err := h.policyRepo.FindByDepartment(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := &models.AuthzBatchResponse{Results: make([]models.AuthzDecision, 0, len(data.Checks))}
+
+	for i := range data.Checks {
+		decision, err := h.check(departmentId, &data.Checks[i], policies)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+			return
+		}
+
+		res.Results = append(res.Results, *decision)
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Authorization checked successfully", res)
+}
+
+func (h *AuthzHandler) check(departmentId string, req *models.AuthzCheckRequest, stored []models.AuthzPolicyModel) (*models.AuthzDecision, error) {
+	policies := stored
+
+	if req.DryRun {
+		policies = helpers.PoliciesFromRequest(departmentId, req.Policies)
+	}
+
+	return h.authzHelper.Check(departmentId, req, policies)
+}
+
+// ListPoliciesHandler godoc
+// @Summary List Policies
+// @Description List the authorization policies of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Success 200 {array} PolicyResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/authz/policies [get]
+func (h *AuthzHandler) ListPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.policyRepo.FindByDepartment(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := make([]models.PolicyResponse, 0, len(policies))
+
+	for _, policy := range policies {
+		res = append(res, toPolicyResponse(&policy))
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Policies retrieved successfully", res)
+}
+
+// CreatePolicyHandler godoc
+// @Summary Create Policy
+// @Description Allow or deny actions to roles of the caller's department under
+// @Description conditions. Roles and actions may end in * to match a prefix.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} PolicyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/authz/policies [post]
+func (h *AuthzHandler) CreatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.PolicyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	policy := &helpers.PoliciesFromRequest(helpers.GetDepartmentId(r), []models.PolicyRequest{data})[0]
+	policy.ID = uuid.New().String()
+
+	if err := h.policyRepo.Create(policy); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "Policy"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Policy created successfully", toPolicyResponse(policy))
+}
+
+// GetPolicyHandler godoc
+// @Summary Get Policy
+// @Description Get an authorization policy of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} PolicyResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/authz/policies/{id} [get]
+func (h *AuthzHandler) GetPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.departmentPolicy(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Policy retrieved successfully", toPolicyResponse(policy))
+}
+
+// UpdatePolicyHandler godoc
+// @Summary Update Policy
+// @Description Replace an authorization policy of the caller's department
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} PolicyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/authz/policies/{id} [put]
+func (h *AuthzHandler) UpdatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.PolicyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	policy, ok := h.departmentPolicy(w, r)
+
+	if !ok {
+		return
+	}
+
+	policy.Name = data.Name
+	policy.Description = data.Description
+	policy.Effect = data.Effect
+	policy.Roles = data.Roles
+	policy.Actions = data.Actions
+	policy.Conditions = data.Conditions
+
+	if err := h.policyRepo.Save(policy); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Policy"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Policy updated successfully", toPolicyResponse(policy))
+}
+
+// DeletePolicyHandler godoc
+// @Summary Delete Policy
+// @Description Delete an authorization policy of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/authz/policies/{id} [delete]
+func (h *AuthzHandler) DeletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.departmentPolicy(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.policyRepo.Delete(policy.DepartmentID, policy.ID); err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Policy deleted successfully", nil)
+}
+
+func (h *AuthzHandler) departmentPolicy(w http.ResponseWriter, r *http.Request) (*models.AuthzPolicyModel, bool) {
+	id := mux.Vars(r)["id"]
+
+	policy, err := h.policyRepo.FindById(helpers.GetDepartmentId(r), id)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "Policy", "id", id), constants.NotFound, err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return nil, false
+	}
+
+	return policy, true
+}
+
+func toPolicyResponse(policy *models.AuthzPolicyModel) models.PolicyResponse {
+	return models.PolicyResponse{
+		ID:          policy.ID,
+		Name:        policy.Name,
+		Description: policy.Description,
+		Effect:      policy.Effect,
+		Roles:       policy.Roles,
+		Actions:     policy.Actions,
+		Conditions:  policy.Conditions,
+		CreatedAt:   policy.CreatedAt,
+		UpdatedAt:   policy.UpdatedAt,
+	}
+}
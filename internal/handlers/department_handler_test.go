@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/middleware"
+	"uas/internal/models"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	rotationTenantId = "826dad3c-ae6d-4603-8190-730cad295035"
+	currentSecret    = "current-secret"
+	previousSecret   = "previous-secret"
+)
+
+func hashSecret(t *testing.T, secret string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+type rotationFixture struct {
+	router         *mux.Router
+	authHelper     *helpers.AuthHelper
+	departmentRepo *fakeDepartmentRepo
+	auditRepo      *fakeAuditRepo
+}
+
+// newRotationFixture serves the rotation endpoint behind the same middleware
+// as in main.go, for a tenant in the middle of a rotation.
+func newRotationFixture(t *testing.T) *rotationFixture {
+	t.Helper()
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	departmentRepo := &fakeDepartmentRepo{departments: map[string]*models.DepartmentModel{
+		rotationTenantId: {
+			ID:                      rotationTenantId,
+			Secret:                  hashSecret(t, currentSecret),
+			PreviousSecret:          hashSecret(t, previousSecret),
+			PreviousSecretExpiresAt: &expiresAt,
+		},
+	}}
+	auditRepo := &fakeAuditRepo{}
+
+	authHelper := helpers.NewAuthHelper(&testLog, departmentRepo, helpers.RedisHelper{})
+	responseHelper := helpers.NewResponseHelper(&testLog)
+
+	handler := NewDepartmentHandler(
+		departmentRepo,
+		nil,
+		&testLog,
+		authHelper,
+		responseHelper,
+		helpers.NewValidatorHelper(&testLog, responseHelper),
+		nil,
+		nil,
+		helpers.NewAuditHelper(&testLog, auditRepo),
+	)
+
+	router := mux.NewRouter()
+	router.Use(middleware.NewTraceRequestMiddleware(&testLog, authHelper).Start)
+	router.Use(middleware.NewTenantMiddleware(&testLog, responseHelper).Authorize)
+	router.HandleFunc(constants.RotateTenantSecretEndpoint, handler.RotateSecretHandler).Methods(http.MethodPost)
+
+	return &rotationFixture{router: router, authHelper: authHelper, departmentRepo: departmentRepo, auditRepo: auditRepo}
+}
+
+func (f *rotationFixture) rotate(tenantId string, secret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/tenants/"+tenantId+"/rotate-secret", nil)
+	r.Header.Set(constants.AuthorizationHeader, "Bearer "+f.authHelper.GenerateBasicAuthToken(rotationTenantId, secret))
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestRotateSecretRejectsPreviousSecret(t *testing.T) {
+	f := newRotationFixture(t)
+	before := *f.departmentRepo.departments[rotationTenantId]
+
+	w := f.rotate(rotationTenantId, previousSecret)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	after := f.departmentRepo.departments[rotationTenantId]
+
+	if after.Secret != before.Secret || after.PreviousSecret != before.PreviousSecret {
+		t.Error("rotation with the previous secret changed the tenant's secrets")
+	}
+
+	if len(f.auditRepo.events) != 1 || f.auditRepo.events[0].Outcome != models.AuditFailure {
+		t.Errorf("audit events = %+v, want one failed rotation", f.auditRepo.events)
+	}
+
+	// the real owner still authenticates with the current secret
+	if _, credential, err := f.authHelper.ValidateBasicAuthToken(f.authHelper.GenerateBasicAuthToken(rotationTenantId, currentSecret)); err != nil || credential != models.TenantCredentialCurrent {
+		t.Errorf("current secret: credential = %q, err = %v", credential, err)
+	}
+}
+
+func TestRotateSecretWithCurrentSecret(t *testing.T) {
+	f := newRotationFixture(t)
+	before := *f.departmentRepo.departments[rotationTenantId]
+
+	w := f.rotate(rotationTenantId, currentSecret)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	after := f.departmentRepo.departments[rotationTenantId]
+
+	if after.Secret == before.Secret {
+		t.Error("secret was not rotated")
+	}
+
+	if after.PreviousSecret != before.Secret {
+		t.Error("the replaced secret is not kept as the previous secret")
+	}
+
+	if w.Header().Get(constants.AuthorizationHeader) == "" {
+		t.Error("the new token is missing from the response")
+	}
+}
+
+func TestRotateSecretRejectsOtherTenant(t *testing.T) {
+	f := newRotationFixture(t)
+
+	w := f.rotate("other-tenant", currentSecret)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
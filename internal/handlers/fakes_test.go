@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"time"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var testLog = zerolog.Nop()
+
+// The fakes embed their repository interface, methods a test doesn't need
+// panic on the nil interface.
+
+type fakeDepartmentRepo struct {
+	repository.DepartmentRepository
+	departments map[string]*models.DepartmentModel
+	settings    map[string]models.DepartmentSettings
+	keys        []models.SigningKeyModel
+}
+
+func (r *fakeDepartmentRepo) FindById(id string) (*models.DepartmentModel, error) {
+	department, ok := r.departments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *department
+	return &copied, nil
+}
+
+func (r *fakeDepartmentRepo) Save(department *models.DepartmentModel) error {
+	copied := *department
+	r.departments[department.ID] = &copied
+	return nil
+}
+
+func (r *fakeDepartmentRepo) FindConfig(departmentId string) (*models.DepartmentConfig, error) {
+	return &models.DepartmentConfig{DepartmentID: departmentId, Settings: r.settings[departmentId]}, nil
+}
+
+func (r *fakeDepartmentRepo) FindSigningKey(id string) (*models.SigningKeyModel, error) {
+	for _, key := range r.keys {
+		if key.ID == id {
+			copied := key
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeDepartmentRepo) FindSigningKeys(departmentId string) ([]models.SigningKeyModel, error) {
+	var keys []models.SigningKeyModel
+	for _, key := range r.keys {
+		if key.DepartmentID == departmentId {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeDepartmentRepo) RotateSigningKey(key *models.SigningKeyModel) error {
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *fakeDepartmentRepo) CreateSigningKeyIfAbsent(key *models.SigningKeyModel) (*models.SigningKeyModel, error) {
+	for _, existing := range r.keys {
+		if existing.DepartmentID == key.DepartmentID && existing.RetiredAt == nil {
+			return &existing, nil
+		}
+	}
+	r.keys = append(r.keys, *key)
+	return key, nil
+}
+
+func (r *fakeDepartmentRepo) RecordCredentialUse(id string, credential models.TenantCredential, at time.Time) error {
+	return nil
+}
+
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	events []models.AuditEventModel
+}
+
+func (r *fakeAuditRepo) Create(event *models.AuditEventModel) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// fakeUserRepo finds users through the memberships of departmentRoleRepo,
+// like the join in GormUserRepository.
+type fakeUserRepo struct {
+	repository.UserRepository
+	users              map[string]*models.UserModel
+	departmentRoleRepo *fakeDepartmentRoleRepo
+}
+
+func (r *fakeUserRepo) FindById(id string) (*models.UserModel, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) FindByIdInDepartment(departmentId string, id string) (*models.UserModel, error) {
+	if _, err := r.departmentRoleRepo.FindById(departmentId, id); err != nil {
+		return nil, err
+	}
+	return r.FindById(id)
+}
+
+func (r *fakeUserRepo) FindByEmailInDepartment(departmentId string, email string) (*models.UserModel, error) {
+	for _, user := range r.users {
+		if user.DepartmentID == departmentId && user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) Save(user *models.UserModel) error {
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+type fakeDepartmentRoleRepo struct {
+	repository.DepartmentRoleRepository
+	roles []models.DepartmentRoles
+}
+
+func (r *fakeDepartmentRoleRepo) FindById(departmentId string, userId string) (*models.DepartmentRoles, error) {
+	for _, role := range r.roles {
+		if role.DepartmentID == departmentId && role.UserID == userId {
+			copied := role
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeDepartmentRoleRepo) FindByUserId(userId string) ([]models.DepartmentRoles, error) {
+	var roles []models.DepartmentRoles
+	for _, role := range r.roles {
+		if role.UserID == userId {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeDepartmentRoleRepo) Delete(departmentId string, userId string) error {
+	roles := r.roles[:0]
+	for _, role := range r.roles {
+		if role.DepartmentID != departmentId || role.UserID != userId {
+			roles = append(roles, role)
+		}
+	}
+	r.roles = roles
+	return nil
+}
+
+// fakeRoleRepo counts the members of userRepo, like the join in
+// GormRoleRepository.
+type fakeRoleRepo struct {
+	repository.RoleRepository
+	userRepo *fakeUserRepo
+}
+
+func (r *fakeRoleRepo) CountActiveMembers(departmentId string, name models.Role, exceptUserId string) (int64, error) {
+	var count int64
+	for _, role := range r.userRepo.departmentRoleRepo.roles {
+		if role.DepartmentID != departmentId || role.Role != name || role.UserID == exceptUserId {
+			continue
+		}
+		user, ok := r.userRepo.users[role.UserID]
+		if ok && !user.Disabled && user.DeactivatedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type fakeGroupRepo struct {
+	repository.GroupRepository
+	removed []string
+}
+
+func (r *fakeGroupRepo) RemoveFromDepartment(departmentId string, memberId string) error {
+	r.removed = append(r.removed, departmentId+"/"+memberId)
+	return nil
+}
+
+func (r *fakeGroupRepo) FindByMember(departmentId string, memberId string) ([]models.GroupModel, error) {
+	return nil, nil
+}
+
+func (r *fakeGroupRepo) FindMemberships(departmentId string, memberIds []string) ([]models.GroupMemberModel, error) {
+	return nil, nil
+}
+
+func (r *fakeGroupRepo) FindRoles(groupIds []string) ([]models.GroupRoleModel, error) {
+	return nil, nil
+}
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type GroupHandler struct {
+	groupRepo          repository.GroupRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	log                *zerolog.Logger
+	roleHelper         *helpers.RoleHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	auditHelper        *helpers.AuditHelper
+}
+
+func NewGroupHandler(
+	groupRepo repository.GroupRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	log *zerolog.Logger,
+	roleHelper *helpers.RoleHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	auditHelper *helpers.AuditHelper,
+) *GroupHandler {
+	return &GroupHandler{
+		groupRepo:          groupRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		log:                log,
+		roleHelper:         roleHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		auditHelper:        auditHelper,
+	}
+}
+
+// ListGroupsHandler godoc
+// @Summary List Groups
+// @Description List the groups of the caller's department with the roles granted
+// @Description to them. Supports `name`, `page` and `pageSize`.
+// @Tags Admin
+// @Produce  json
+// @Success 200 {object} PaginatedResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups [get]
+func (h *GroupHandler) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, pageSize := parsePagination(params.Get("page"), params.Get("pageSize"))
+	filter := models.GroupFilter{Name: params.Get("name"), Offset: (page - 1) * pageSize, Limit: pageSize}
+
+	groups, total, err := h.groupRepo.FindByDepartment(helpers.GetDepartmentId(r), filter)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	groupIds := make([]string, 0, len(groups))
+
+	for _, group := range groups {
+		groupIds = append(groupIds, group.ID)
+	}
+
+	grants, err := h.groupRepo.FindRoles(groupIds)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	items := make([]models.GroupResponse, 0, len(groups))
+
+	for i := range groups {
+		items = append(items, toGroupResponse(&groups[i], grants))
+	}
+
+	res := &models.PaginatedResponse{
+		Items:    items,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Groups retrieved successfully", res)
+}
+
+// CreateGroupHandler godoc
+// @Summary Create Group
+// @Description Create a group in the caller's department. Names are unique within
+// @Description the department, groups provisioned over SCIM included.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} GroupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups [post]
+func (h *GroupHandler) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.GroupRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	group := &models.GroupModel{
+		ID:           uuid.New().String(),
+		DepartmentID: helpers.GetDepartmentId(r),
+		Name:         data.Name,
+		Description:  data.Description,
+	}
+
+	if !h.uniqueName(w, group) {
+		return
+	}
+
+	if err := h.groupRepo.Create(group); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Group created successfully", toGroupResponse(group, nil))
+}
+
+// GetGroupHandler godoc
+// @Summary Get Group
+// @Description Get a group of the caller's department with the roles granted to it
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} GroupResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id} [get]
+func (h *GroupHandler) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.sendGroup(w, group, "Group retrieved successfully")
+}
+
+// UpdateGroupHandler godoc
+// @Summary Update Group
+// @Description Rename a group of the caller's department or change its description
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} GroupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id} [put]
+func (h *GroupHandler) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.GroupRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	group.Name = data.Name
+	group.Description = data.Description
+
+	if !h.uniqueName(w, group) {
+		return
+	}
+
+	if err := h.groupRepo.Save(group); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.sendGroup(w, group, "Group updated successfully")
+}
+
+// DeleteGroupHandler godoc
+// @Summary Delete Group
+// @Description Delete a group of the caller's department. Its members lose the
+// @Description roles they had through it on their next request.
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id} [delete]
+func (h *GroupHandler) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.groupRepo.Delete(group.ID); err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.responseHelper.SendSuccessResponse(w, "Group deleted successfully", nil)
+}
+
+// ListGroupMembersHandler godoc
+// @Summary List Group Members
+// @Description List the users and groups directly in a group of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {array} GroupMemberResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id}/members [get]
+func (h *GroupHandler) ListGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.sendMembers(w, group, "Group members retrieved successfully")
+}
+
+// AddGroupMembersHandler godoc
+// @Summary Add Group Members
+// @Description Add users of the caller's department and other groups to a group.
+// @Description A group can't end up containing itself, and the caller can't add
+// @Description members to a group whose roles can do more than they can.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {array} GroupMemberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id}/members [post]
+func (h *GroupHandler) AddGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.GroupMembersRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	for _, userId := range data.Users {
+		_, err := h.departmentRoleRepo.FindById(group.DepartmentID, userId)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "User", "id", userId), constants.BadRequest, err)
+			return
+		}
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+			return
+		}
+	}
+
+	for _, groupId := range data.Groups {
+		_, err := h.groupRepo.FindByIdInDepartment(group.DepartmentID, groupId)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "Group", "id", groupId), constants.BadRequest, err)
+			return
+		}
+
+		if err == nil {
+			err = h.roleHelper.CheckNesting(group.DepartmentID, group.ID, groupId)
+		}
+
+		if err != nil {
+			sendRoleError(h.responseHelper, w, "", err)
+			return
+		}
+	}
+
+	if err := h.roleHelper.CheckGroupGrant(group.DepartmentID, helpers.GetPermissions(r), group.ID); err != nil {
+		sendRoleError(h.responseHelper, w, "", err)
+		return
+	}
+
+	if err := h.groupRepo.AddMembers(group.ID, models.GroupMemberUser, data.Users); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	if err := h.groupRepo.AddMembers(group.ID, models.GroupMemberGroup, data.Groups); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.sendMembers(w, group, "Group members added successfully")
+}
+
+// RemoveGroupMemberHandler godoc
+// @Summary Remove Group Member
+// @Description Remove a user or a nested group from a group of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Param memberId path string true "User or group ID"
+// @Success 200 {array} GroupMemberResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id}/members/{memberId} [delete]
+func (h *GroupHandler) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.groupRepo.RemoveMembers(group.ID, []string{mux.Vars(r)["memberId"]}); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.sendMembers(w, group, "Group member removed successfully")
+}
+
+// GrantGroupRoleHandler godoc
+// @Summary Grant Group Role
+// @Description Grant a role to a group of the caller's department. Its members,
+// @Description and the members of the groups nested in it, get the role's
+// @Description permissions on top of their own. The role can't grant more than
+// @Description the caller has.
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Param name path string true "Role name"
+// @Success 200 {object} GroupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id}/roles/{name} [put]
+func (h *GroupHandler) GrantGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(mux.Vars(r)["name"])
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.roleHelper.CheckGrant(group.DepartmentID, helpers.GetPermissions(r), role); err != nil {
+		sendRoleError(h.responseHelper, w, role, err)
+		return
+	}
+
+	grant := &models.GroupRoleModel{GroupID: group.ID, Role: role, DepartmentID: group.DepartmentID}
+
+	if err := h.groupRepo.GrantRole(grant); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.GroupRoleGranted, TargetID: group.ID, Details: string(role)})
+	h.sendGroup(w, group, "Role granted successfully")
+}
+
+// RevokeGroupRoleHandler godoc
+// @Summary Revoke Group Role
+// @Description Take a role away from a group of the caller's department. The
+// @Description caller can't revoke a role that can do more than they can.
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Param name path string true "Role name"
+// @Success 200 {object} GroupResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/groups/{id}/roles/{name} [delete]
+func (h *GroupHandler) RevokeGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(mux.Vars(r)["name"])
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	// a role deleted from under the group grants nothing and can always go
+	err := h.roleHelper.CheckGrant(group.DepartmentID, helpers.GetPermissions(r), role)
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		sendRoleError(h.responseHelper, w, role, err)
+		return
+	}
+
+	if err := h.groupRepo.RevokeRole(group.ID, role); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Group"), constants.InternalServerError, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.GroupRoleRevoked, TargetID: group.ID, Details: string(role)})
+	h.sendGroup(w, group, "Role revoked successfully")
+}
+
+func (h *GroupHandler) departmentGroup(w http.ResponseWriter, r *http.Request) (*models.GroupModel, bool) {
+	groupId := mux.Vars(r)["id"]
+
+	group, err := h.groupRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), groupId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "Group", "id", groupId), constants.NotFound, err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return nil, false
+	}
+
+	return group, true
+}
+
+// uniqueName checks no other group of the department has the group's name.
+func (h *GroupHandler) uniqueName(w http.ResponseWriter, group *models.GroupModel) bool {
+	existing, _, err := h.groupRepo.FindByDepartment(group.DepartmentID, models.GroupFilter{Name: group.Name, Limit: 1})
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if len(existing) > 0 && existing[0].ID != group.ID {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.GroupNameTakenError, group.Name), constants.BadRequest, nil)
+		return false
+	}
+
+	return true
+}
+
+func (h *GroupHandler) sendGroup(w http.ResponseWriter, group *models.GroupModel, message string) {
+	grants, err := h.groupRepo.FindRoles([]string{group.ID})
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, message, toGroupResponse(group, grants))
+}
+
+func (h *GroupHandler) sendMembers(w http.ResponseWriter, group *models.GroupModel, message string) {
+	members, err := h.groupRepo.FindMembers(group.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := make([]models.GroupMemberResponse, 0, len(members))
+
+	for _, member := range members {
+		res = append(res, models.GroupMemberResponse{
+			ID:      member.MemberID,
+			Type:    member.MemberType,
+			AddedAt: member.CreatedAt,
+		})
+	}
+
+	h.responseHelper.SendSuccessResponse(w, message, res)
+}
+
+// toGroupResponse lists the roles of the grants that belong to the group.
+func toGroupResponse(group *models.GroupModel, grants []models.GroupRoleModel) models.GroupResponse {
+	res := models.GroupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		ExternalID:  group.ExternalID,
+		Roles:       []models.Role{},
+		CreatedAt:   group.CreatedAt,
+		UpdatedAt:   group.UpdatedAt,
+	}
+
+	for _, grant := range grants {
+		if grant.GroupID == group.ID {
+			res.Roles = append(res.Roles, grant.Role)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+type ImportHandler struct {
+	log            *zerolog.Logger
+	importHelper   *helpers.ImportHelper
+	responseHelper *helpers.ResponseHelper
+}
+
+func NewImportHandler(
+	log *zerolog.Logger,
+	importHelper *helpers.ImportHelper,
+	responseHelper *helpers.ResponseHelper,
+) *ImportHandler {
+	return &ImportHandler{
+		log:            log,
+		importHelper:   importHelper,
+		responseHelper: responseHelper,
+	}
+}
+
+// ImportUsersHandler godoc
+// @Summary Import Users
+// @Description Bulk import users with precomputed password hashes from NDJSON or CSV
+// @Tags Admin
+// @Accept  application/x-ndjson,text/csv
+// @Produce  json
+// @Param format query string false "ndjson or csv"
+// @Param dryRun query bool false "Validate without writing"
+// @Success 200 {object} ImportUsersResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/import [post]
+func (h *ImportHandler) ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	format := models.ImportFormat(params.Get("format"))
+	if format == "" {
+		format = models.NDJSON
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = models.CSV
+		}
+	}
+
+	dryRun, _ := strconv.ParseBool(params.Get("dryRun"))
+
+	opts := models.ImportOptions{
+		DryRun:                dryRun,
+		FirebaseSignerKey:     config.AppConfig.FirebaseSignerKey,
+		FirebaseSaltSeparator: config.AppConfig.FirebaseSaltSeparator,
+		FirebaseRounds:        config.AppConfig.FirebaseRounds,
+		FirebaseMemCost:       config.AppConfig.FirebaseMemCost,
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	report, err := h.importHelper.ImportUsers(r.Body, format, departmentId, opts)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User import processed", report)
+}
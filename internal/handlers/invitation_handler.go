@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type InvitationHandler struct {
+	invitationRepo     repository.InvitationRepository
+	userRepo           repository.UserRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	departmentRepo     repository.DepartmentRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	emailHelper        *helpers.EmailHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+}
+
+func NewInvitationHandler(
+	invitationRepo repository.InvitationRepository,
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	departmentRepo repository.DepartmentRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	emailHelper *helpers.EmailHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+) *InvitationHandler {
+	return &InvitationHandler{
+		invitationRepo:     invitationRepo,
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		departmentRepo:     departmentRepo,
+		log:                log,
+		authHelper:         authHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		emailHelper:        emailHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+	}
+}
+
+// CreateInvitationHandler godoc
+// @Summary Create Invitation
+// @Description Invite someone to the caller's department with a role
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} InvitationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invitations [post]
+func (h *InvitationHandler) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.CreateInvitationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	if err := h.roleHelper.CheckGrant(departmentId, helpers.GetPermissions(r), data.Role); err != nil {
+		sendRoleError(h.responseHelper, w, data.Role, err)
+		return
+	}
+
+	if user, err := h.userRepo.FindByEmailInDepartment(departmentId, data.Email); err == nil {
+		if _, err := h.departmentRoleRepo.FindById(departmentId, user.ID); err == nil {
+			h.responseHelper.SendErrorResponse(w, "User is already a member of the department", constants.BadRequest, nil)
+			return
+		}
+	}
+
+	_, err = h.invitationRepo.FindPending(departmentId, data.Email)
+
+	if err == nil {
+		h.responseHelper.SendErrorResponse(w, "A pending invitation already exists for this email, resend it instead", constants.BadRequest, nil)
+		return
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	invitation := &models.InvitationModel{
+		ID:           uuid.New().String(),
+		DepartmentID: departmentId,
+		Email:        data.Email,
+		Role:         data.Role,
+		InvitedBy:    helpers.GetUserId(r),
+		ExpiresAt:    invitationExpiry(),
+	}
+
+	err = h.invitationRepo.Create(invitation)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "Invitation"), constants.InternalServerError, err)
+		return
+	}
+
+	if !h.sendInvitation(w, invitation) {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitation sent successfully", toInvitationResponse(invitation))
+}
+
+// ListInvitationsHandler godoc
+// @Summary List Invitations
+// @Description List the invitations of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param status query string false "Filter by status (pending, accepted, revoked, expired)"
+// @Success 200 {array} InvitationResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invitations [get]
+func (h *InvitationHandler) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.invitationRepo.FindByDepartment(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	status := models.InvitationStatus(r.URL.Query().Get("status"))
+	res := make([]*models.InvitationResponse, 0, len(invitations))
+
+	for i := range invitations {
+		if status != "" && invitations[i].Status() != status {
+			continue
+		}
+		res = append(res, toInvitationResponse(&invitations[i]))
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitations retrieved successfully", res)
+}
+
+// ResendInvitationHandler godoc
+// @Summary Resend Invitation
+// @Description Send the invitation again with a new expiry. Earlier links stop working.
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Invitation ID"
+// @Success 200 {object} InvitationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invitations/{id}/resend [post]
+func (h *InvitationHandler) ResendInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.departmentInvitation(w, r)
+
+	if !ok {
+		return
+	}
+
+	if status := invitation.Status(); status == models.InvitationAccepted || status == models.InvitationRevoked {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf("Invitation is %s", status), constants.BadRequest, nil)
+		return
+	}
+
+	invitation.ExpiresAt = invitationExpiry()
+
+	err := h.invitationRepo.Save(invitation)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Invitation"), constants.InternalServerError, err)
+		return
+	}
+
+	if !h.sendInvitation(w, invitation) {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitation sent successfully", toInvitationResponse(invitation))
+}
+
+// RevokeInvitationHandler godoc
+// @Summary Revoke Invitation
+// @Description Revoke a pending invitation
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "Invitation ID"
+// @Success 200 {object} InvitationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.departmentInvitation(w, r)
+
+	if !ok {
+		return
+	}
+
+	if invitation.Status() == models.InvitationAccepted {
+		h.responseHelper.SendErrorResponse(w, "Invitation has already been accepted", constants.BadRequest, nil)
+		return
+	}
+
+	if invitation.RevokedAt == nil {
+		now := time.Now()
+		invitation.RevokedAt = &now
+
+		err := h.invitationRepo.Save(invitation)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Invitation"), constants.InternalServerError, err)
+			return
+		}
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitation revoked successfully", toInvitationResponse(invitation))
+}
+
+// GetInvitationHandler godoc
+// @Summary Get Invitation
+// @Description Look up an invitation by its token before accepting it
+// @Tags User
+// @Produce  json
+// @Param token query string true "Token"
+// @Success 200 {object} InvitationPreviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /invitations [get]
+func (h *InvitationHandler) GetInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.pendingInvitation(w, r.URL.Query().Get("token"))
+
+	if !ok {
+		return
+	}
+
+	department, err := h.departmentRepo.FindById(invitation.DepartmentID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	_, err = h.userRepo.FindByEmailInDepartment(invitation.DepartmentID, invitation.Email)
+
+	res := &models.InvitationPreviewResponse{
+		DepartmentName: department.Name,
+		Email:          invitation.Email,
+		Role:           invitation.Role,
+		ExistingUser:   err == nil,
+		ExpiresAt:      invitation.ExpiresAt,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitation retrieved successfully", res)
+}
+
+// AcceptInvitationHandler godoc
+// @Summary Accept Invitation
+// @Description Join the department with the invited role. A new account is created
+// @Description for the invited email, the password is optional. Existing accounts
+// @Description keep their credentials.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} AcceptInvitationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /invitations/accept [post]
+func (h *InvitationHandler) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.AcceptInvitationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	invitation, ok := h.pendingInvitation(w, data.Token)
+
+	// the role may have been deleted since the invitation was sent
+	if !ok || !h.roleExists(w, invitation.DepartmentID, invitation.Role) {
+		return
+	}
+
+	var newUser *models.UserModel
+
+	user, err := h.userRepo.FindByEmailInDepartment(invitation.DepartmentID, invitation.Email)
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	if err != nil {
+		if err := h.usageHelper.CheckUserQuota(invitation.DepartmentID); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+			return
+		}
+
+		// the invitation link was delivered to this address, so it counts as verified
+		newUser = &models.UserModel{
+			ID:            uuid.New().String(),
+			DepartmentID:  invitation.DepartmentID,
+			Name:          data.Name,
+			Email:         invitation.Email,
+			EmailVerified: true,
+		}
+
+		if data.Password != "" {
+			password_hash, err := h.authHelper.HashPassword(data.Password)
+
+			if err != nil {
+				h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "User"), constants.InternalServerError, err)
+				return
+			}
+
+			newUser.Password = password_hash
+			newUser.PasswordAlgorithm = models.Bcrypt
+		}
+
+		user = newUser
+	} else if _, err := h.departmentRoleRepo.FindById(invitation.DepartmentID, user.ID); err == nil {
+		h.responseHelper.SendErrorResponse(w, "User is already a member of the department", constants.BadRequest, nil)
+		return
+	}
+
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	invitation.AcceptedBy = user.ID
+
+	role := &models.DepartmentRoles{
+		DepartmentID: invitation.DepartmentID,
+		Role:         invitation.Role,
+		UserID:       user.ID,
+	}
+
+	err = h.invitationRepo.Accept(invitation, newUser, role)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error accepting invitation", constants.InternalServerError, err)
+		return
+	}
+
+	res := &models.AcceptInvitationResponse{
+		UserID:       user.ID,
+		DepartmentID: invitation.DepartmentID,
+		Role:         invitation.Role,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Invitation accepted successfully", res)
+}
+
+func (h *InvitationHandler) sendInvitation(w http.ResponseWriter, invitation *models.InvitationModel) bool {
+	department, err := h.departmentRepo.FindById(invitation.DepartmentID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if err := h.usageHelper.CheckQuota(invitation.DepartmentID, models.EmailUsage); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+		return false
+	}
+
+	settings, err := h.authHelper.GetEffectiveSettings(invitation.DepartmentID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	// the expiry is part of the token so a resend invalidates earlier links
+	token := h.authHelper.GenerateSignedToken(
+		constants.InvitationTokenPurpose,
+		invitation.ExpiresAt,
+		invitation.ID,
+		strconv.FormatInt(invitation.ExpiresAt.Unix(), 10),
+	)
+
+	tmpl_data := models.InvitationData{
+		DepartmentName: department.Name,
+		Role:           invitation.Role,
+		Url:            fmt.Sprintf("%s?token=%s", config.AppConfig.InvitationBaseUrl, url.QueryEscape(token)),
+		ExpiresAt:      invitation.ExpiresAt.UTC().Format(constants.TimeFormat),
+	}
+
+	err = h.emailHelper.SendDepartmentEmail(settings, invitation.Email, "invitation", tmpl_data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error sending invitation email", constants.InternalServerError, err)
+		return false
+	}
+
+	h.usageHelper.Record(invitation.DepartmentID, models.EmailUsage)
+
+	return true
+}
+
+// pendingInvitation resolves an invitation token, rejecting links that were
+// superseded by a resend or whose invitation is no longer pending.
+func (h *InvitationHandler) pendingInvitation(w http.ResponseWriter, token string) (*models.InvitationModel, bool) {
+	if token == "" {
+		h.responseHelper.SendErrorResponse(w, "Token is empty", constants.BadRequest, nil)
+		return nil, false
+	}
+
+	values, err := h.authHelper.ValidateSignedToken(constants.InvitationTokenPurpose, token)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return nil, false
+	}
+
+	if len(values) != 2 {
+		h.responseHelper.SendErrorResponse(w, constants.TokenInvalidError, constants.BadRequest, nil)
+		return nil, false
+	}
+
+	invitation, err := h.invitationRepo.FindById(values[0])
+
+	if err != nil || strconv.FormatInt(invitation.ExpiresAt.Unix(), 10) != values[1] {
+		h.responseHelper.SendErrorResponse(w, constants.TokenInvalidError, constants.BadRequest, err)
+		return nil, false
+	}
+
+	if status := invitation.Status(); status != models.InvitationPending {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf("Invitation is %s", status), constants.BadRequest, nil)
+		return nil, false
+	}
+
+	return invitation, true
+}
+
+func (h *InvitationHandler) departmentInvitation(w http.ResponseWriter, r *http.Request) (*models.InvitationModel, bool) {
+	id := mux.Vars(r)["id"]
+
+	invitation, err := h.invitationRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), id)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "Invitation", "id", id)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return nil, false
+	}
+
+	return invitation, true
+}
+
+func invitationExpiry() time.Time {
+	// whole seconds, the expiry is compared against the token after a database round trip
+	return time.Now().Add(time.Duration(config.AppConfig.InvitationExpire) * time.Hour).Truncate(time.Second)
+}
+
+func toInvitationResponse(invitation *models.InvitationModel) *models.InvitationResponse {
+	return &models.InvitationResponse{
+		InvitationID: invitation.ID,
+		DepartmentID: invitation.DepartmentID,
+		Email:        invitation.Email,
+		Role:         invitation.Role,
+		Status:       invitation.Status(),
+		InvitedBy:    invitation.InvitedBy,
+		ExpiresAt:    invitation.ExpiresAt,
+		AcceptedAt:   invitation.AcceptedAt,
+		CreatedAt:    invitation.CreatedAt,
+	}
+}
+
+func (h *InvitationHandler) roleExists(w http.ResponseWriter, departmentId string, role models.Role) bool {
+	exists, err := h.roleHelper.RoleExists(departmentId, role)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if !exists {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.RoleNotFoundError, role), constants.BadRequest, nil)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+func TestLastAdminCantLeave(t *testing.T) {
+	deactivatedAt := time.Now()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		other  *models.UserModel
+	}{
+		{name: "delete own account", method: http.MethodDelete, path: constants.ProfileEndpoint},
+		{name: "erase own account", method: http.MethodPost, path: constants.ProfileErasureEndpoint},
+		{name: "scim delete", method: http.MethodDelete, path: scimUserPath(adminUserId)},
+		{name: "scim deactivate", method: http.MethodPatch, path: scimUserPath(adminUserId), body: `{"Operations":[{"op":"replace","path":"active","value":false}]}`},
+		{name: "scim replace inactive", method: http.MethodPut, path: scimUserPath(adminUserId), body: `{"userName":"admin@a.example","active":false}`},
+		{
+			name:   "other admin disabled",
+			method: http.MethodDelete,
+			path:   constants.ProfileEndpoint,
+			other:  &models.UserModel{ID: "other-admin", DepartmentID: departmentA, Disabled: true},
+		},
+		{
+			name:   "other admin deactivated",
+			method: http.MethodPost,
+			path:   constants.ProfileErasureEndpoint,
+			other:  &models.UserModel{ID: "other-admin", DepartmentID: departmentA, DeactivatedAt: &deactivatedAt},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newIsolationFixture(t)
+
+			if tt.other != nil {
+				f.userRepo.users[tt.other.ID] = tt.other
+				f.departmentRoleRepo.roles = append(f.departmentRoleRepo.roles, models.DepartmentRoles{DepartmentID: departmentA, UserID: tt.other.ID, Role: models.Admin})
+			}
+
+			w := f.serve(tt.method, tt.path, tt.body)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+
+			if _, err := f.departmentRoleRepo.FindById(departmentA, adminUserId); err != nil {
+				t.Error("membership of the last admin was removed")
+			}
+
+			if admin := f.userRepo.users[adminUserId]; admin.Disabled || admin.DeactivatedAt != nil {
+				t.Errorf("last admin was disabled or deactivated: %+v", *admin)
+			}
+		})
+	}
+}
+
+func TestAdminCanBeDeactivatedWithAnotherActiveAdmin(t *testing.T) {
+	f := newIsolationFixture(t)
+
+	f.userRepo.users["other-admin"] = &models.UserModel{ID: "other-admin", DepartmentID: departmentA}
+	f.departmentRoleRepo.roles = append(f.departmentRoleRepo.roles, models.DepartmentRoles{DepartmentID: departmentA, UserID: "other-admin", Role: models.Admin})
+
+	w := f.serve(http.MethodPatch, scimUserPath(adminUserId), `{"Operations":[{"op":"replace","path":"active","value":false}]}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if !f.userRepo.users[adminUserId].Disabled {
+		t.Error("admin was not disabled")
+	}
+}
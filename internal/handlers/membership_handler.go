@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+type MembershipHandler struct {
+	userRepo           repository.UserRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	departmentRepo     repository.DepartmentRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+}
+
+func NewMembershipHandler(
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	departmentRepo repository.DepartmentRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+) *MembershipHandler {
+	return &MembershipHandler{
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		departmentRepo:     departmentRepo,
+		log:                log,
+		authHelper:         authHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+	}
+}
+
+// ListDepartmentsHandler godoc
+// @Summary List My Departments
+// @Description List the departments the authenticated user belongs to and their role in each
+// @Tags User
+// @Produce  json
+// @Success 200 {array} MembershipResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/departments [get]
+func (h *MembershipHandler) ListDepartmentsHandler(w http.ResponseWriter, r *http.Request) {
+	memberships, err := h.departmentRoleRepo.FindByUserId(helpers.GetUserId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	currentDepartment := helpers.GetDepartmentId(r)
+	res := make([]*models.MembershipResponse, 0, len(memberships))
+
+	for _, membership := range memberships {
+		department, err := h.departmentRepo.FindById(membership.DepartmentID)
+
+		// memberships of deleted departments are not listed
+		if err != nil {
+			h.log.Warn().Err(err).Str("departmentId", membership.DepartmentID).Msg("Skipping membership of missing department")
+			continue
+		}
+
+		res = append(res, &models.MembershipResponse{
+			DepartmentID:   membership.DepartmentID,
+			DepartmentName: department.Name,
+			Role:           membership.Role,
+			Current:        membership.DepartmentID == currentDepartment,
+			JoinedAt:       membership.CreatedAt,
+		})
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Departments retrieved successfully", res)
+}
+
+// TokenExchangeHandler godoc
+// @Summary Switch Department
+// @Description Re-issue the access and refresh tokens for another department the
+// @Description authenticated user belongs to
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} TokenExchangeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/token/exchange [post]
+func (h *MembershipHandler) TokenExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.TokenExchangeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	userId := helpers.GetUserId(r)
+
+	membership, err := h.departmentRoleRepo.FindById(data.DepartmentID, userId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Not a member of the department", constants.Forbidden, err)
+		return
+	}
+
+	user, err := h.userRepo.FindByIdInDepartment(data.DepartmentID, userId)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "id", userId)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return
+	}
+
+	if err := h.authHelper.CheckLoginAllowed(user, data.DepartmentID); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+		return
+	}
+
+	if err := h.usageHelper.CheckLoginQuota(data.DepartmentID, user.ID); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+		return
+	}
+
+	scopes, err := h.roleHelper.MemberScopes(data.DepartmentID, user.ID, membership.Role)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error generating access token", constants.InternalServerError, err)
+		return
+	}
+
+	access_token, err := h.authHelper.GenerateAccessJwtToken(user, data.DepartmentID, scopes)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error generating access token", constants.InternalServerError, err)
+		return
+	}
+
+	refresh_token, err := h.authHelper.GenerateRefreshJwtToken(user, data.DepartmentID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error generating refresh token", constants.InternalServerError, err)
+		return
+	}
+
+	h.authHelper.GenerateAccessCookie(access_token, data.DepartmentID, w)
+	w.Header().Set(constants.JwtHeader, refresh_token)
+
+	h.usageHelper.RecordLogin(data.DepartmentID, user.ID)
+
+	res := &models.TokenExchangeResponse{
+		DepartmentID: membership.DepartmentID,
+		Role:         membership.Role,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Department switched successfully", res)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type PlatformHandler struct {
+	platformRepo    repository.PlatformRepository
+	log             *zerolog.Logger
+	authHelper      *helpers.AuthHelper
+	responseHelper  *helpers.ResponseHelper
+	validatorHelper *helpers.ValidatorHelper
+}
+
+func NewPlatformHandler(
+	platformRepo repository.PlatformRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+) *PlatformHandler {
+	return &PlatformHandler{
+		platformRepo:    platformRepo,
+		log:             log,
+		authHelper:      authHelper,
+		responseHelper:  responseHelper,
+		validatorHelper: validatorHelper,
+	}
+}
+
+// PlatformLoginHandler godoc
+// @Summary Platform Login
+// @Description Log in as a platform admin. The returned token is sent in the
+// @Description x-platform-token header to call platform endpoints.
+// @Tags Platform
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} PlatformLoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /platform/login [post]
+func (h *PlatformHandler) PlatformLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.PlatformLoginRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	admin, err := h.platformRepo.FindAdminByEmail(data.Email)
+
+	if err != nil || !h.authHelper.CheckPasswordHash(data.Password, admin.Password) {
+		h.responseHelper.SendErrorResponse(w, constants.PlatformCredentialsError, constants.Unauthorized, err)
+		return
+	}
+
+	token, expiresAt := h.authHelper.GeneratePlatformToken(admin.ID)
+
+	h.log.Info().Str("adminId", admin.ID).Msg("Platform admin logged in")
+
+	h.responseHelper.SendSuccessResponse(w, "Logged in successfully", &models.PlatformLoginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// CreatePlatformAdminHandler godoc
+// @Summary Create Platform Admin
+// @Description Add another platform admin
+// @Tags Platform
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} PlatformAdminResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /platform/admins [post]
+func (h *PlatformHandler) CreatePlatformAdminHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.CreatePlatformAdminRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	_, err = h.platformRepo.FindAdminByEmail(data.Email)
+
+	if err == nil {
+		h.responseHelper.SendErrorResponse(w, "A platform admin with this email already exists", constants.BadRequest, nil)
+		return
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	admin, err := h.authHelper.NewPlatformAdmin(data.Email, data.Name, data.Password, helpers.GetPlatformActor(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	err = h.platformRepo.CreateAdmin(admin)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "Platform admin"), constants.InternalServerError, err)
+		return
+	}
+
+	h.log.Info().Str("adminId", admin.ID).Str("createdBy", admin.CreatedBy).Msg("Platform admin created")
+
+	h.responseHelper.SendSuccessResponse(w, "Platform admin created successfully", toPlatformAdminResponse(admin))
+}
+
+// ListTenantAuditHandler godoc
+// @Summary List Tenant Audit Trail
+// @Description List who created and deleted tenants, newest first. Filter
+// @Description with `departmentId`, paginate with `page` and `pageSize`.
+// @Tags Platform
+// @Produce  json
+// @Success 200 {object} PaginatedResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /platform/audit [get]
+func (h *PlatformHandler) ListTenantAuditHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, pageSize := parsePagination(params.Get("page"), params.Get("pageSize"))
+
+	audits, total, err := h.platformRepo.FindAudit(params.Get("departmentId"), page, pageSize)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	items := make([]*models.TenantAuditResponse, 0, len(audits))
+	for _, audit := range audits {
+		items = append(items, &models.TenantAuditResponse{
+			AuditID:      audit.ID,
+			DepartmentID: audit.DepartmentID,
+			Action:       audit.Action,
+			Actor:        audit.Actor,
+			CreatedAt:    audit.CreatedAt,
+		})
+	}
+
+	res := &models.PaginatedResponse{
+		Items:    items,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Audit trail retrieved successfully", res)
+}
+
+func toPlatformAdminResponse(admin *models.PlatformAdminModel) *models.PlatformAdminResponse {
+	return &models.PlatformAdminResponse{
+		AdminID:   admin.ID,
+		Email:     admin.Email,
+		Name:      admin.Name,
+		CreatedBy: admin.CreatedBy,
+		CreatedAt: admin.CreatedAt,
+	}
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+type PrivacyHandler struct {
+	userRepo           repository.UserRepository
+	authRepo           repository.AuthRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	privacyRepo        repository.PrivacyRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	redisHelper        *helpers.RedisHelper
+	responseHelper     *helpers.ResponseHelper
+	roleHelper         *helpers.RoleHelper
+	auditRepo          repository.AuditRepository
+}
+
+func NewPrivacyHandler(
+	userRepo repository.UserRepository,
+	authRepo repository.AuthRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	privacyRepo repository.PrivacyRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	redisHelper *helpers.RedisHelper,
+	responseHelper *helpers.ResponseHelper,
+	roleHelper *helpers.RoleHelper,
+	auditRepo repository.AuditRepository,
+) *PrivacyHandler {
+	return &PrivacyHandler{
+		userRepo:           userRepo,
+		authRepo:           authRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		privacyRepo:        privacyRepo,
+		log:                log,
+		authHelper:         authHelper,
+		redisHelper:        redisHelper,
+		responseHelper:     responseHelper,
+		roleHelper:         roleHelper,
+		auditRepo:          auditRepo,
+	}
+}
+
+// ExportProfileHandler godoc
+// @Summary Export My Data
+// @Description Machine-readable export of everything held about the authenticated user
+// @Tags User
+// @Produce  json
+// @Success 200 {object} DataExportResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/export [get]
+func (h *PrivacyHandler) ExportProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.findUser(w, r, helpers.GetUserId(r))
+
+	if !ok {
+		return
+	}
+
+	h.sendExport(w, r, user)
+}
+
+// EraseProfileHandler godoc
+// @Summary Erase My Data
+// @Description Permanently erase the authenticated user's account and personal data
+// @Tags User
+// @Produce  json
+// @Success 200 {object} DataErasureResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/erasure [post]
+func (h *PrivacyHandler) EraseProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.findUser(w, r, helpers.GetUserId(r))
+
+	if !ok {
+		return
+	}
+
+	record, ok := h.erase(w, r, user)
+
+	if !ok {
+		return
+	}
+
+	h.authHelper.ClearAccessCookie(helpers.GetDepartmentId(r), w)
+
+	h.responseHelper.SendSuccessResponse(w, "User data erased successfully", toErasureResponse(record))
+}
+
+// ExportUserHandler godoc
+// @Summary Export User Data
+// @Description Machine-readable export of everything held about a user of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} DataExportResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/export [get]
+func (h *PrivacyHandler) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.findUser(w, r, mux.Vars(r)["id"])
+
+	if !ok {
+		return
+	}
+
+	h.sendExport(w, r, user)
+}
+
+// EraseUserHandler godoc
+// @Summary Erase User Data
+// @Description Permanently erase a user owned by the caller's department and their personal data
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} DataErasureResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/erasure [post]
+func (h *PrivacyHandler) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.findUser(w, r, mux.Vars(r)["id"])
+
+	if !ok {
+		return
+	}
+
+	if !user.OwnedBy(helpers.GetDepartmentId(r)) {
+		h.responseHelper.SendErrorResponse(w, constants.ForeignUserError, constants.Forbidden, nil)
+		return
+	}
+
+	if user.ID == helpers.GetUserId(r) {
+		h.responseHelper.SendErrorResponse(w, "Use /users/me/erasure to erase your own account", constants.BadRequest, nil)
+		return
+	}
+
+	record, ok := h.erase(w, r, user)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User data erased successfully", toErasureResponse(record))
+}
+
+// ListErasuresHandler godoc
+// @Summary List Erasures
+// @Description List completed erasure requests for the caller's department
+// @Tags Admin
+// @Produce  json
+// @Success 200 {array} DataErasureResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/erasures [get]
+func (h *PrivacyHandler) ListErasuresHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := h.privacyRepo.FindErasuresByDepartment(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := make([]*models.DataErasureResponse, 0, len(records))
+
+	for i := range records {
+		res = append(res, toErasureResponse(&records[i]))
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Erasures retrieved successfully", res)
+}
+
+func (h *PrivacyHandler) sendExport(w http.ResponseWriter, r *http.Request, user *models.UserModel) {
+	roles, err := h.departmentRoleRepo.FindByUserId(user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	tokens, err := h.authRepo.FindByUserId(user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	events, err := h.auditRepo.FindByUser(helpers.GetDepartmentId(r), user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	var currentRole models.Role
+	exportRoles := make([]models.ExportRole, 0, len(roles))
+
+	for _, role := range roles {
+		if role.DepartmentID == helpers.GetDepartmentId(r) {
+			currentRole = role.Role
+		}
+
+		exportRoles = append(exportRoles, models.ExportRole{
+			DepartmentID: role.DepartmentID,
+			Role:         role.Role,
+			AssignedAt:   role.CreatedAt,
+		})
+	}
+
+	// token values are credentials, only their existence is exported
+	sessions := make([]models.ExportSession, 0, len(tokens))
+
+	for _, token := range tokens {
+		sessions = append(sessions, models.ExportSession{
+			Type:      token.Type,
+			CreatedAt: token.CreatedAt,
+		})
+	}
+
+	res := &models.DataExportResponse{
+		ExportedAt:  time.Now().UTC(),
+		Profile:     toAdminUserResponse(user, currentRole),
+		Roles:       exportRoles,
+		Sessions:    sessions,
+		Identities:  exportIdentities(user),
+		AuditEvents: toAuditEventResponses(events),
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Data exported successfully", res)
+}
+
+// erase erases the user from every department, so it checks that none of them
+// loses its last admin.
+func (h *PrivacyHandler) erase(w http.ResponseWriter, r *http.Request, user *models.UserModel) (*models.DataErasureModel, bool) {
+	if !checkUserRemoval(h.departmentRoleRepo, h.roleHelper, h.responseHelper, w, user.ID) {
+		return nil, false
+	}
+
+	requestedBy := h.authHelper.Pseudonymize(helpers.GetUserId(r))
+
+	record := &models.DataErasureModel{
+		ID:            uuid.New().String(),
+		UserPseudonym: h.authHelper.Pseudonymize(user.ID),
+		DepartmentID:  helpers.GetDepartmentId(r),
+		RequestedBy:   requestedBy,
+		CompletedAt:   time.Now().UTC(),
+	}
+
+	err := h.privacyRepo.EraseUser(user.ID, record)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error erasing user data", constants.InternalServerError, err)
+		return nil, false
+	}
+
+	var otpKeys []string
+
+	for _, target := range []string{user.Email, user.PhoneNumber, user.PendingEmail, user.PendingPhoneNumber} {
+		if target != "" {
+			otpKeys = append(otpKeys, fmt.Sprintf(constants.OtpRedisKey, user.DepartmentID, target))
+		}
+	}
+
+	if len(otpKeys) > 0 {
+		if err := h.redisHelper.DeleteData(otpKeys...); err != nil {
+			h.log.Error().Err(err).Str("erasureId", record.ID).Msg("Error deleting OTP codes for erased user")
+		}
+	}
+
+	helpers.MarkErased(r, user.ID, record.UserPseudonym)
+
+	h.log.Info().Str("erasureId", record.ID).Str("userPseudonym", record.UserPseudonym).Msg("User data erased")
+
+	return record, true
+}
+
+// findUser loads a user of the caller's department by id.
+func (h *PrivacyHandler) findUser(w http.ResponseWriter, r *http.Request, userId string) (*models.UserModel, bool) {
+	user, err := h.userRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), userId)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "id", userId)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func exportIdentities(user *models.UserModel) []models.ExportIdentity {
+	identities := []models.ExportIdentity{}
+
+	if user.Email != "" {
+		identities = append(identities, models.ExportIdentity{Type: "email", Value: user.Email, Verified: user.EmailVerified})
+	}
+
+	if user.PhoneNumber != "" {
+		identities = append(identities, models.ExportIdentity{Type: "phone", Value: user.PhoneNumber, Verified: true})
+	}
+
+	if user.Password != "" {
+		algorithm := user.PasswordAlgorithm
+		if algorithm == "" {
+			algorithm = models.Bcrypt
+		}
+		identities = append(identities, models.ExportIdentity{Type: "password", Value: string(algorithm), Verified: true})
+	}
+
+	return identities
+}
+
+func toErasureResponse(record *models.DataErasureModel) *models.DataErasureResponse {
+	return &models.DataErasureResponse{
+		ErasureID:     record.ID,
+		UserPseudonym: record.UserPseudonym,
+		CompletedAt:   record.CompletedAt,
+	}
+}
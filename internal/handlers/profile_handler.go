@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type ProfileHandler struct {
+	userRepo           repository.UserRepository
+	authRepo           repository.AuthRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	emailHelper        *helpers.EmailHelper
+	twilioHelper       *helpers.TwilioHelper
+	metadataHelper     *helpers.MetadataHelper
+	deactivationHelper *helpers.DeactivationHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+}
+
+func NewProfileHandler(
+	userRepo repository.UserRepository,
+	authRepo repository.AuthRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	emailHelper *helpers.EmailHelper,
+	twilioHelper *helpers.TwilioHelper,
+	metadataHelper *helpers.MetadataHelper,
+	deactivationHelper *helpers.DeactivationHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+) *ProfileHandler {
+	return &ProfileHandler{
+		userRepo:           userRepo,
+		authRepo:           authRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		log:                log,
+		authHelper:         authHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		emailHelper:        emailHelper,
+		twilioHelper:       twilioHelper,
+		metadataHelper:     metadataHelper,
+		deactivationHelper: deactivationHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+	}
+}
+
+// GetProfileHandler godoc
+// @Summary Get Profile
+// @Description Get the authenticated user's profile
+// @Tags User
+// @Produce  json
+// @Success 200 {object} UserProfileResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /users/me [get]
+func (h *ProfileHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Profile retrieved successfully", toProfileResponse(user))
+}
+
+// UpdateProfileHandler godoc
+// @Summary Update Profile
+// @Description Update the authenticated user's profile. A new email or phone
+// @Description number only takes effect once it has been verified.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} UserProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me [patch]
+func (h *ProfileHandler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.UpdateProfileRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	if data.Name != "" {
+		user.Name = data.Name
+	}
+
+	if data.Metadata != nil && !h.applyMetadata(w, r, user, data.Metadata) {
+		return
+	}
+
+	if data.Email != "" && data.Email != user.Email {
+		if !h.ensureAvailable(w, "email", user.DepartmentID, data.Email, h.userRepo.FindByEmailInDepartment) {
+			return
+		}
+
+		if err := h.usageHelper.CheckQuota(user.DepartmentID, models.EmailUsage); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+			return
+		}
+
+		settings, err := h.authHelper.GetEffectiveSettings(user.DepartmentID)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+			return
+		}
+
+		code, err := h.authHelper.GenerateOtpCode(user.DepartmentID, data.Email)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, "Error w/ otp generation", constants.InternalServerError, err)
+			return
+		}
+
+		tmpl_data := models.VerifyEmailData{
+			Name: user.Name,
+			Otp:  code,
+		}
+
+		err = h.emailHelper.SendDepartmentEmail(settings, data.Email, "verify-email", tmpl_data)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, "Error w/ sending verification email", constants.InternalServerError, err)
+			return
+		}
+
+		h.usageHelper.Record(user.DepartmentID, models.EmailUsage)
+		user.PendingEmail = data.Email
+	}
+
+	if data.PhoneNumber != "" && data.PhoneNumber != user.PhoneNumber {
+		if !h.ensureAvailable(w, "phone number", user.DepartmentID, data.PhoneNumber, h.userRepo.FindByPhoneNumberInDepartment) {
+			return
+		}
+
+		if err := h.usageHelper.CheckQuota(user.DepartmentID, models.SmsUsage); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+			return
+		}
+
+		code, err := h.authHelper.GenerateOtpCode(user.DepartmentID, data.PhoneNumber)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, "Error generating OTP code", constants.InternalServerError, err)
+			return
+		}
+
+		err = h.twilioHelper.SendSMS(data.PhoneNumber, fmt.Sprintf(constants.OtpCodeMessage, code))
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, "Error sending OTP code", constants.InternalServerError, err)
+			return
+		}
+
+		h.usageHelper.Record(user.DepartmentID, models.SmsUsage)
+		user.PendingPhoneNumber = data.PhoneNumber
+	}
+
+	err = h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Profile updated successfully", toProfileResponse(user))
+}
+
+// VerifyProfileEmailHandler godoc
+// @Summary Verify Profile Email
+// @Description Confirm a pending email change with the OTP sent to the new address
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} UserProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/email/verify [post]
+func (h *ProfileHandler) VerifyProfileEmailHandler(w http.ResponseWriter, r *http.Request) {
+	h.verifyPendingChange(w, r, func(user *models.UserModel) *string {
+		return &user.PendingEmail
+	}, func(user *models.UserModel) {
+		user.Email = user.PendingEmail
+		user.EmailVerified = true
+		user.PendingEmail = ""
+	})
+}
+
+// VerifyProfilePhoneHandler godoc
+// @Summary Verify Profile Phone Number
+// @Description Confirm a pending phone number change with the OTP sent to the new number
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} UserProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me/phone/verify [post]
+func (h *ProfileHandler) VerifyProfilePhoneHandler(w http.ResponseWriter, r *http.Request) {
+	h.verifyPendingChange(w, r, func(user *models.UserModel) *string {
+		return &user.PendingPhoneNumber
+	}, func(user *models.UserModel) {
+		user.PhoneNumber = user.PendingPhoneNumber
+		user.PendingPhoneNumber = ""
+	})
+}
+
+// DeleteProfileHandler godoc
+// @Summary Delete Account
+// @Description Deactivate the authenticated user's account. It is permanently
+// @Description deleted after the grace period unless an admin restores it.
+// @Tags User
+// @Produce  json
+// @Success 200 {object} DeactivationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/me [delete]
+func (h *ProfileHandler) DeleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	if !checkUserRemoval(h.departmentRoleRepo, h.roleHelper, h.responseHelper, w, user.ID) {
+		return
+	}
+
+	err := h.deactivationHelper.DeactivateUser(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error deleting account", constants.InternalServerError, err)
+		return
+	}
+
+	h.authHelper.ClearAccessCookie(helpers.GetDepartmentId(r), w)
+
+	res := &models.DeactivationResponse{
+		DeactivatedAt: user.DeactivatedAt,
+		PurgeAt:       user.PurgeAt,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Account deactivated successfully", res)
+}
+
+func (h *ProfileHandler) verifyPendingChange(
+	w http.ResponseWriter,
+	r *http.Request,
+	pending func(user *models.UserModel) *string,
+	apply func(user *models.UserModel),
+) {
+	var data models.VerifyProfileChangeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	target := *pending(user)
+
+	if target == "" {
+		h.responseHelper.SendErrorResponse(w, "No pending change to verify", constants.BadRequest, nil)
+		return
+	}
+
+	err = h.authHelper.ValidateOtpCode(user.DepartmentID, target, data.Otp)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error verifying OTP code", constants.BadRequest, err)
+		return
+	}
+
+	apply(user)
+
+	err = h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "User"), constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Profile updated successfully", toProfileResponse(user))
+}
+
+// applyMetadata merges a metadata patch into the user and validates the
+// result against the department's schema. Users cannot change readOnly
+// attributes, those are managed by admins.
+func (h *ProfileHandler) applyMetadata(w http.ResponseWriter, r *http.Request, user *models.UserModel, patch map[string]json.RawMessage) bool {
+	schema, err := h.metadataHelper.LoadSchema(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if schema != nil {
+		for key := range patch {
+			if schema.ReadOnlyProperty(key) {
+				h.responseHelper.SendErrorResponse(w, fmt.Sprintf("Attribute %s can only be changed by an admin", key), constants.Forbidden, nil)
+				return false
+			}
+		}
+	}
+
+	metadata, err := helpers.MergeMetadata(user.Metadata, patch)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if schema != nil {
+		if err := schema.Validate(metadata); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+			return false
+		}
+	}
+
+	user.Metadata = metadata
+	return true
+}
+
+func (h *ProfileHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.UserModel, bool) {
+	userId := helpers.GetUserId(r)
+
+	user, err := h.userRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), userId)
+
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "id", userId)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *ProfileHandler) ensureAvailable(
+	w http.ResponseWriter,
+	field string,
+	departmentId string,
+	value string,
+	find func(string, string) (*models.UserModel, error),
+) bool {
+	_, err := find(departmentId, value)
+
+	if err == nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf("The %s is already in use", field), constants.BadRequest, nil)
+		return false
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+func toProfileResponse(user *models.UserModel) *models.UserProfileResponse {
+	return &models.UserProfileResponse{
+		UserID:             user.ID,
+		Name:               user.Name,
+		Email:              user.Email,
+		PhoneNumber:        user.PhoneNumber,
+		EmailVerified:      user.EmailVerified,
+		PendingEmail:       user.PendingEmail,
+		PendingPhoneNumber: user.PendingPhoneNumber,
+		Metadata:           user.Metadata,
+	}
+}
@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type RelationHandler struct {
+	relationRepo    repository.RelationRepository
+	log             *zerolog.Logger
+	relationHelper  *helpers.RelationHelper
+	responseHelper  *helpers.ResponseHelper
+	validatorHelper *helpers.ValidatorHelper
+}
+
+func NewRelationHandler(
+	relationRepo repository.RelationRepository,
+	log *zerolog.Logger,
+	relationHelper *helpers.RelationHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+) *RelationHandler {
+	return &RelationHandler{
+		relationRepo:    relationRepo,
+		log:             log,
+		relationHelper:  relationHelper,
+		responseHelper:  responseHelper,
+		validatorHelper: validatorHelper,
+	}
+}
+
+// WriteRelationsHandler godoc
+// @Summary Write Relation Tuples
+// @Description Write up to 100 tuples such as `doc:123#viewer@user:abc` in one
+// @Description revision. Their relations have to be defined by the department's
+// @Description namespaces. Reads with the returned token see the write.
+// @Description Requires tenant credentials.
+// @Tags Relations
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RelationTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /relations/write [post]
+func (h *RelationHandler) WriteRelationsHandler(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, false)
+}
+
+// DeleteRelationsHandler godoc
+// @Summary Delete Relation Tuples
+// @Description Delete up to 100 tuples in one revision, tuples that don't exist
+// @Description are skipped. Requires tenant credentials.
+// @Tags Relations
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RelationTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /relations/delete [post]
+func (h *RelationHandler) DeleteRelationsHandler(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, true)
+}
+
+func (h *RelationHandler) write(w http.ResponseWriter, r *http.Request, deleting bool) {
+	var data models.RelationTuplesRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	writes, deletes := data.Tuples, []string{}
+
+	if deleting {
+		writes, deletes = deletes, data.Tuples
+	}
+
+	token, err := h.relationHelper.Write(helpers.GetDepartmentId(r), writes, deletes)
+
+	if err != nil {
+		h.sendRelationError(w, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Relation tuples saved successfully", &models.RelationTokenResponse{Token: token})
+}
+
+// CheckRelationHandler godoc
+// @Summary Check Relation
+// @Description Check whether the subject of a tuple has the relation to its
+// @Description object, directly, through relations implying it, through related
+// @Description objects or through usersets. Requires tenant credentials.
+// @Tags Relations
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RelationCheckResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /relations/check [post]
+func (h *RelationHandler) CheckRelationHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.RelationCheckRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	revision, ok := h.revision(w, departmentId, data.Consistency)
+
+	if !ok {
+		return
+	}
+
+	allowed, err := h.relationHelper.Check(departmentId, data.Tuple, revision)
+
+	if err != nil {
+		h.sendRelationError(w, err)
+		return
+	}
+
+	res := &models.RelationCheckResponse{
+		Allowed: allowed,
+		Token:   helpers.EncodeConsistencyToken(departmentId, revision),
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Relation checked successfully", res)
+}
+
+// ExpandRelationHandler godoc
+// @Summary Expand Relation
+// @Description Show the tree of the subjects that have a userset such as
+// @Description `doc:123#viewer`. Requires tenant credentials.
+// @Tags Relations
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RelationExpandResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /relations/expand [post]
+func (h *RelationHandler) ExpandRelationHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.RelationExpandRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	revision, ok := h.revision(w, departmentId, data.Consistency)
+
+	if !ok {
+		return
+	}
+
+	tree, err := h.relationHelper.Expand(departmentId, data.Userset, revision)
+
+	if err != nil {
+		h.sendRelationError(w, err)
+		return
+	}
+
+	res := &models.RelationExpandResponse{
+		Tree:  tree,
+		Token: helpers.EncodeConsistencyToken(departmentId, revision),
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Relation expanded successfully", res)
+}
+
+// ListObjectsHandler godoc
+// @Summary List Related Objects
+// @Description List the ids of the objects of a namespace the subject has the
+// @Description relation to. A page examines up to limit objects (at most 1000)
+// @Description after the cursor, pass nextCursor to get the next page.
+// @Description Requires tenant credentials.
+// @Tags Relations
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RelationListObjectsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /relations/list-objects [post]
+func (h *RelationHandler) ListObjectsHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.RelationListObjectsRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	revision, ok := h.revision(w, departmentId, data.Consistency)
+
+	if !ok {
+		return
+	}
+
+	objects, next, err := h.relationHelper.ListObjects(departmentId, data.Namespace, data.Relation, data.Subject, revision, data.Cursor, data.Limit)
+
+	if err != nil {
+		h.sendRelationError(w, err)
+		return
+	}
+
+	res := &models.RelationListObjectsResponse{
+		Objects:    objects,
+		NextCursor: next,
+		Token:      helpers.EncodeConsistencyToken(departmentId, revision),
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Related objects retrieved successfully", res)
+}
+
+// ListNamespacesHandler godoc
+// @Summary List Relation Namespaces
+// @Description List the namespace configurations of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Success 200 {array} NamespaceResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/relations/namespaces [get]
+func (h *RelationHandler) ListNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := h.relationRepo.FindNamespaces(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := make([]models.NamespaceResponse, 0, len(namespaces))
+
+	for i := range namespaces {
+		res = append(res, toNamespaceResponse(&namespaces[i]))
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Namespaces retrieved successfully", res)
+}
+
+// GetNamespaceHandler godoc
+// @Summary Get Relation Namespace
+// @Description Get a namespace configuration of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Namespace"
+// @Success 200 {object} NamespaceResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/relations/namespaces/{name} [get]
+func (h *RelationHandler) GetNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := h.departmentNamespace(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Namespace retrieved successfully", toNamespaceResponse(namespace))
+}
+
+// SaveNamespaceHandler godoc
+// @Summary Save Relation Namespace
+// @Description Create a namespace configuration of the caller's department or
+// @Description replace its relations. `impliedBy` lists relations of the same
+// @Description object implying the relation, `fromRelated` grants it to the
+// @Description subjects having a relation on the objects of a tupleset. Tuples
+// @Description of relations that are no longer defined grant nothing.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Namespace"
+// @Success 200 {object} NamespaceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/relations/namespaces/{name} [put]
+func (h *RelationHandler) SaveNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.NamespaceRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	if !helpers.ValidRelationName(name) {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf("Invalid namespace %s", name), constants.BadRequest, nil)
+		return
+	}
+
+	if err := helpers.ValidateNamespace(name, data.Relations); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	namespace := &models.RelationNamespaceModel{
+		DepartmentID: helpers.GetDepartmentId(r),
+		Name:         name,
+		Relations:    data.Relations,
+	}
+
+	if err := h.relationRepo.SaveNamespace(namespace); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Namespace"), constants.InternalServerError, err)
+		return
+	}
+
+	// reload for the creation time of namespaces that already existed
+	saved, err := h.relationRepo.FindNamespace(namespace.DepartmentID, name)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Namespace saved successfully", toNamespaceResponse(saved))
+}
+
+// DeleteNamespaceHandler godoc
+// @Summary Delete Relation Namespace
+// @Description Delete a namespace configuration of the caller's department.
+// @Description Namespaces that still have tuples can't be deleted.
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Namespace"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/relations/namespaces/{name} [delete]
+func (h *RelationHandler) DeleteNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := h.departmentNamespace(w, r)
+
+	if !ok {
+		return
+	}
+
+	tuples, err := h.relationRepo.CountTuples(namespace.DepartmentID, namespace.Name)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	if tuples > 0 {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.NamespaceInUseError, namespace.Name), constants.BadRequest, nil)
+		return
+	}
+
+	if err := h.relationRepo.DeleteNamespace(namespace.DepartmentID, namespace.Name); err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Namespace deleted successfully", nil)
+}
+
+func (h *RelationHandler) revision(w http.ResponseWriter, departmentId string, consistency models.RelationConsistency) (uint64, bool) {
+	revision, err := h.relationHelper.Revision(departmentId, consistency)
+
+	if err != nil {
+		h.sendRelationError(w, err)
+		return 0, false
+	}
+
+	return revision, true
+}
+
+func (h *RelationHandler) departmentNamespace(w http.ResponseWriter, r *http.Request) (*models.RelationNamespaceModel, bool) {
+	name := mux.Vars(r)["name"]
+
+	namespace, err := h.relationRepo.FindNamespace(helpers.GetDepartmentId(r), name)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "Namespace", "name", name), constants.NotFound, err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return nil, false
+	}
+
+	return namespace, true
+}
+
+func (h *RelationHandler) sendRelationError(w http.ResponseWriter, err error) {
+	var notDefined *helpers.RelationNotDefinedError
+
+	switch {
+	case errors.As(err, &notDefined), errors.Is(err, helpers.ErrConsistencyToken), errors.Is(err, helpers.ErrRelationDepth), errors.Is(err, helpers.ErrRelationFanOut):
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+	default:
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+	}
+}
+
+func toNamespaceResponse(namespace *models.RelationNamespaceModel) models.NamespaceResponse {
+	return models.NamespaceResponse{
+		Name:      namespace.Name,
+		Relations: namespace.Relations,
+		CreatedAt: namespace.CreatedAt,
+		UpdatedAt: namespace.UpdatedAt,
+	}
+}
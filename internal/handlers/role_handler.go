@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type RoleHandler struct {
+	roleRepo           repository.RoleRepository
+	userRepo           repository.UserRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	departmentRepo     repository.DepartmentRepository
+	log                *zerolog.Logger
+	roleHelper         *helpers.RoleHelper
+	responseHelper     *helpers.ResponseHelper
+	validatorHelper    *helpers.ValidatorHelper
+	auditHelper        *helpers.AuditHelper
+}
+
+func NewRoleHandler(
+	roleRepo repository.RoleRepository,
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	departmentRepo repository.DepartmentRepository,
+	log *zerolog.Logger,
+	roleHelper *helpers.RoleHelper,
+	responseHelper *helpers.ResponseHelper,
+	validatorHelper *helpers.ValidatorHelper,
+	auditHelper *helpers.AuditHelper,
+) *RoleHandler {
+	return &RoleHandler{
+		roleRepo:           roleRepo,
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		departmentRepo:     departmentRepo,
+		log:                log,
+		roleHelper:         roleHelper,
+		responseHelper:     responseHelper,
+		validatorHelper:    validatorHelper,
+		auditHelper:        auditHelper,
+	}
+}
+
+// ListPermissionsHandler godoc
+// @Summary List Permissions
+// @Description List every permission a role can grant
+// @Tags Admin
+// @Produce  json
+// @Success 200 {array} string
+// @Router /admin/permissions [get]
+func (h *RoleHandler) ListPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	h.responseHelper.SendSuccessResponse(w, "Permissions retrieved successfully", models.Permissions)
+}
+
+// ListRolesHandler godoc
+// @Summary List Roles
+// @Description List the roles of the caller's department, built-in ones included
+// @Tags Admin
+// @Produce  json
+// @Success 200 {array} RoleResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles [get]
+func (h *RoleHandler) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleRepo.FindByDepartment(helpers.GetDepartmentId(r))
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := make([]models.RoleResponse, 0, len(roles))
+
+	for _, role := range roles {
+		res = append(res, toRoleResponse(&role))
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Roles retrieved successfully", res)
+}
+
+// CreateRoleHandler godoc
+// @Summary Create Role
+// @Description Create a custom role in the caller's department. Names are lowercase
+// @Description letters, digits, dashes and underscores.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} RoleResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles [post]
+func (h *RoleHandler) CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.CreateRoleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	if !helpers.HasPermissions(helpers.GetPermissions(r), data.Permissions) {
+		h.responseHelper.SendErrorResponse(w, constants.RoleEscalationError, constants.Forbidden, nil)
+		return
+	}
+
+	if models.IsBuiltInRole(data.Name) {
+		h.responseHelper.SendErrorResponse(w, constants.BuiltInRoleError, constants.BadRequest, nil)
+		return
+	}
+
+	_, err = h.roleRepo.FindByName(departmentId, data.Name)
+
+	if err == nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf("Role %s already exists", data.Name), constants.BadRequest, nil)
+		return
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	role := &models.RoleModel{
+		DepartmentID: departmentId,
+		Name:         data.Name,
+		Description:  data.Description,
+		Permissions:  permissionStrings(data.Permissions),
+	}
+
+	if err := h.roleRepo.Create(role); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.CreateEntityError, "Role"), constants.InternalServerError, err)
+		return
+	}
+
+	h.recordRoleChange(r, models.RoleCreated, role)
+
+	h.responseHelper.SendSuccessResponse(w, "Role created successfully", toRoleResponse(role))
+}
+
+// GetRoleHandler godoc
+// @Summary Get Role
+// @Description Get a role of the caller's department
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Role name"
+// @Success 200 {object} RoleResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/roles/{name} [get]
+func (h *RoleHandler) GetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := h.departmentRole(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Role retrieved successfully", toRoleResponse(role))
+}
+
+// ListRoleMembersHandler godoc
+// @Summary List Role Members
+// @Description List the members of the caller's department that have the role
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Role name"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Page size"
+// @Success 200 {object} PaginatedResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles/{name}/members [get]
+func (h *RoleHandler) ListRoleMembersHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := h.departmentRole(w, r)
+
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := models.UserFilter{Role: role.Name}
+	filter.Page, filter.PageSize = parsePagination(params.Get("page"), params.Get("pageSize"))
+
+	users, total, err := h.userRepo.FindByDepartment(role.DepartmentID, filter)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	items := make([]*models.AdminUserResponse, 0, len(users))
+
+	for i := range users {
+		items = append(items, toAdminUserResponse(&users[i], role.Name))
+	}
+
+	res := &models.PaginatedResponse{
+		Items:    items,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    total,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Role members retrieved successfully", res)
+}
+
+// AssignRoleHandler godoc
+// @Summary Assign Role
+// @Description Give a member of the caller's department the role, replacing their
+// @Description current one. The role can't grant more than the caller has.
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Role name"
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles/{name}/members/{id} [put]
+func (h *RoleHandler) AssignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(mux.Vars(r)["name"])
+
+	user, membership, ok := h.member(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.roleHelper.CheckRoleChange(helpers.GetPermissions(r), membership, role); err != nil {
+		sendRoleError(h.responseHelper, w, role, err)
+		return
+	}
+
+	h.setRole(w, r, user, membership, role, "Role assigned successfully")
+}
+
+// RevokeRoleHandler godoc
+// @Summary Revoke Role
+// @Description Take the role away from a member of the caller's department, who
+// @Description falls back to the built-in user role. The last admin keeps the role.
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Role name"
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles/{name}/members/{id} [delete]
+func (h *RoleHandler) RevokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(mux.Vars(r)["name"])
+
+	if role == models.User {
+		h.responseHelper.SendErrorResponse(w, constants.DefaultRoleRevokeError, constants.BadRequest, nil)
+		return
+	}
+
+	user, membership, ok := h.member(w, r)
+
+	if !ok {
+		return
+	}
+
+	if membership.Role != role {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.RoleNotAssignedError, role), constants.BadRequest, nil)
+		return
+	}
+
+	if err := h.roleHelper.CheckRoleChange(helpers.GetPermissions(r), membership, models.User); err != nil {
+		sendRoleError(h.responseHelper, w, role, err)
+		return
+	}
+
+	h.setRole(w, r, user, membership, models.User, "Role revoked successfully")
+}
+
+// ListUserRolesHandler godoc
+// @Summary List User Roles
+// @Description List the roles a user of the caller's department has in every
+// @Description department they belong to
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {array} MembershipResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/roles [get]
+func (h *RoleHandler) ListUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.member(w, r)
+
+	if !ok {
+		return
+	}
+
+	memberships, err := h.departmentRoleRepo.FindByUserId(user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	currentDepartment := helpers.GetDepartmentId(r)
+	res := make([]*models.MembershipResponse, 0, len(memberships))
+
+	for _, membership := range memberships {
+		department, err := h.departmentRepo.FindById(membership.DepartmentID)
+
+		// memberships of deleted departments are not listed
+		if err != nil {
+			h.log.Warn().Err(err).Str("departmentId", membership.DepartmentID).Msg("Skipping membership of missing department")
+			continue
+		}
+
+		res = append(res, &models.MembershipResponse{
+			DepartmentID:   membership.DepartmentID,
+			DepartmentName: department.Name,
+			Role:           membership.Role,
+			Current:        membership.DepartmentID == currentDepartment,
+			JoinedAt:       membership.CreatedAt,
+		})
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User roles retrieved successfully", res)
+}
+
+// UserPermissionsHandler godoc
+// @Summary Get User Permissions
+// @Description Show the effective permissions of a member of the caller's
+// @Description department, from their role and the roles of every group they
+// @Description are in, directly or through nested groups
+// @Tags Admin
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} EffectivePermissionsResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{id}/permissions [get]
+func (h *RoleHandler) UserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, membership, ok := h.member(w, r)
+
+	if !ok {
+		return
+	}
+
+	groups, err := h.roleHelper.Ancestors(membership.DepartmentID, user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	groupRoles, err := h.roleHelper.GroupRoles(membership.DepartmentID, user.ID)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	permissions, err := h.roleHelper.EffectivePermissions(membership.DepartmentID, user.ID, membership.Role)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	res := &models.EffectivePermissionsResponse{
+		Role:        membership.Role,
+		Groups:      groups,
+		GroupRoles:  groupRoles,
+		Permissions: permissions,
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "User permissions retrieved successfully", res)
+}
+
+// UpdateRoleHandler godoc
+// @Summary Update Role
+// @Description Replace the description and permissions of a custom role. Members
+// @Description get the new permissions on their next request.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Role name"
+// @Success 200 {object} RoleResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles/{name} [put]
+func (h *RoleHandler) UpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.UpdateRoleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	role, ok := h.customRole(w, r)
+
+	if !ok {
+		return
+	}
+
+	// the caller can neither add permissions nor take away ones they don't have
+	granted := helpers.GetPermissions(r)
+
+	if !helpers.HasPermissions(granted, data.Permissions) || !helpers.HasPermissions(granted, role.PermissionList()) {
+		h.responseHelper.SendErrorResponse(w, constants.RoleEscalationError, constants.Forbidden, nil)
+		return
+	}
+
+	role.Description = data.Description
+	role.Permissions = permissionStrings(data.Permissions)
+
+	if err := h.roleRepo.Update(role); err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.SaveEntityError, "Role"), constants.InternalServerError, err)
+		return
+	}
+
+	h.recordRoleChange(r, models.RoleUpdated, role)
+
+	h.responseHelper.SendSuccessResponse(w, "Role updated successfully", toRoleResponse(role))
+}
+
+// DeleteRoleHandler godoc
+// @Summary Delete Role
+// @Description Delete a custom role. Roles still assigned to members or granted
+// @Description to groups can't be deleted.
+// @Tags Admin
+// @Produce  json
+// @Param name path string true "Role name"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/roles/{name} [delete]
+func (h *RoleHandler) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := h.customRole(w, r)
+
+	if !ok {
+		return
+	}
+
+	members, err := h.roleRepo.CountMembers(role.DepartmentID, role.Name)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	groups, err := h.roleRepo.CountGroups(role.DepartmentID, role.Name)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	members += groups
+
+	if members > 0 {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.RoleInUseError, role.Name, members), constants.BadRequest, nil)
+		return
+	}
+
+	if err := h.roleRepo.Delete(role.DepartmentID, role.Name); err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	h.auditHelper.Success(r, models.RoleDeleted, string(role.Name))
+
+	h.responseHelper.SendSuccessResponse(w, "Role deleted successfully", nil)
+}
+
+func (h *RoleHandler) departmentRole(w http.ResponseWriter, r *http.Request) (*models.RoleModel, bool) {
+	name := mux.Vars(r)["name"]
+
+	role, err := h.roleRepo.FindByName(helpers.GetDepartmentId(r), models.Role(name))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "Role", "name", name), constants.NotFound, err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return nil, false
+	}
+
+	return role, true
+}
+
+// member loads the user from the {id} path variable with their membership,
+// only if they belong to the caller's department.
+func (h *RoleHandler) member(w http.ResponseWriter, r *http.Request) (*models.UserModel, *models.DepartmentRoles, bool) {
+	userId := mux.Vars(r)["id"]
+	departmentId := helpers.GetDepartmentId(r)
+
+	user, err := h.userRepo.FindByIdInDepartment(departmentId, userId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "User", "id", userId), constants.NotFound, err)
+		return nil, nil, false
+	}
+
+	membership, err := h.departmentRoleRepo.FindById(departmentId, userId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.EntityNotFound, "User", "id", userId), constants.NotFound, err)
+		return nil, nil, false
+	}
+
+	return user, membership, true
+}
+
+// setRole changes the member's role. Falling back to the user role is recorded
+// as revoking the previous one.
+func (h *RoleHandler) setRole(w http.ResponseWriter, r *http.Request, user *models.UserModel, membership *models.DepartmentRoles, role models.Role, message string) {
+	event := &models.AuditEventModel{Action: models.RoleAssigned, TargetID: user.ID, Details: string(role)}
+
+	if role == models.User && membership.Role != models.User {
+		event.Action = models.RoleRevoked
+		event.Details = string(membership.Role)
+	}
+
+	membership.Role = role
+
+	if err := h.departmentRoleRepo.Update(membership); err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error updating user role", constants.InternalServerError, err)
+		return
+	}
+
+	h.auditHelper.Record(r, event)
+
+	h.responseHelper.SendSuccessResponse(w, message, toAdminUserResponse(user, role))
+}
+
+// recordRoleChange adds the role and the permissions it now grants to the
+// audit log.
+func (h *RoleHandler) recordRoleChange(r *http.Request, action models.AuditAction, role *models.RoleModel) {
+	h.auditHelper.Record(r, &models.AuditEventModel{
+		Action:   action,
+		TargetID: string(role.Name),
+		Details:  strings.Join(role.Permissions, " "),
+	})
+}
+
+// customRole is departmentRole for changes, which built-in roles don't allow.
+func (h *RoleHandler) customRole(w http.ResponseWriter, r *http.Request) (*models.RoleModel, bool) {
+	role, ok := h.departmentRole(w, r)
+
+	if ok && (role.BuiltIn || models.IsBuiltInRole(role.Name)) {
+		h.responseHelper.SendErrorResponse(w, constants.BuiltInRoleError, constants.BadRequest, nil)
+		return nil, false
+	}
+
+	return role, ok
+}
+
+// sendRoleError answers a failed role check.
+func sendRoleError(responseHelper *helpers.ResponseHelper, w http.ResponseWriter, role models.Role, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		responseHelper.SendErrorResponse(w, fmt.Sprintf(constants.RoleNotFoundError, role), constants.BadRequest, err)
+	case errors.Is(err, helpers.ErrRoleEscalation):
+		responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+	case errors.Is(err, helpers.ErrLastAdmin), errors.Is(err, helpers.ErrGroupCycle):
+		responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+	default:
+		responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+	}
+}
+
+// checkUserRemoval answers ErrLastAdmin if the user is the last admin of any
+// of their departments. Disabling, deactivating or erasing a user takes them
+// out of all of them at once.
+func checkUserRemoval(
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	roleHelper *helpers.RoleHelper,
+	responseHelper *helpers.ResponseHelper,
+	w http.ResponseWriter,
+	userId string,
+) bool {
+	memberships, err := departmentRoleRepo.FindByUserId(userId)
+
+	if err != nil {
+		responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return false
+	}
+
+	if err := roleHelper.CheckUserRemoval(memberships); err != nil {
+		sendRoleError(responseHelper, w, models.Admin, err)
+		return false
+	}
+
+	return true
+}
+
+func toRoleResponse(role *models.RoleModel) models.RoleResponse {
+	return models.RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		BuiltIn:     role.BuiltIn,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+// permissionStrings stores permissions once each, in the order given.
+func permissionStrings(permissions []models.Permission) models.StringList {
+	list := make(models.StringList, 0, len(permissions))
+	for _, p := range permissions {
+		if !slices.Contains(list, string(p)) {
+			list = append(list, string(p))
+		}
+	}
+	return list
+}
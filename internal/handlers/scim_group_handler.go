@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ListScimGroupsHandler godoc
+// @Summary List SCIM Groups
+// @Description List the department's groups. Supports `filter` on displayName
+// @Description and externalId with the `eq` operator, pagination with
+// @Description `startIndex` and `count` and `excludedAttributes=members`.
+// @Tags SCIM
+// @Produce  json
+// @Success 200 {object} ScimListResponse
+// @Failure 400 {object} ScimError
+// @Router /scim/v2/Groups [get]
+func (h *ScimHandler) ListScimGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := helpers.ParseScimFilter(r.URL.Query().Get("filter"))
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidFilter, err.Error(), err)
+		return
+	}
+
+	startIndex, count := helpers.ScimPagination(r)
+
+	groupFilter := models.GroupFilter{Offset: startIndex - 1, Limit: count}
+
+	if filter != nil {
+		switch filter.Attribute {
+		case "displayname":
+			groupFilter.Name = filter.Value
+		case "externalid":
+			groupFilter.ExternalID = filter.Value
+		default:
+			err := fmt.Errorf("filtering on %s is not supported", filter.Attribute)
+			h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidFilter, err.Error(), err)
+			return
+		}
+	}
+
+	groups, total, err := h.groupRepo.FindByDepartment(helpers.GetDepartmentId(r), groupFilter)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	withMembers := !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+
+	resources := make([]*models.ScimGroup, 0, len(groups))
+	for i := range groups {
+		var members []models.GroupMemberModel
+
+		if withMembers {
+			members, err = h.groupRepo.FindMembers(groups[i].ID)
+
+			if err != nil {
+				h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+				return
+			}
+		}
+
+		resources = append(resources, toScimGroup(&groups[i], members))
+	}
+
+	h.scimHelper.Send(w, http.StatusOK, &models.ScimListResponse{
+		Schemas:      []string{models.ScimListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// CreateScimGroupHandler godoc
+// @Summary Create SCIM Group
+// @Description Create a group in the department. Members must be users of the department.
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Success 201 {object} ScimGroup
+// @Failure 400 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Groups [post]
+func (h *ScimHandler) CreateScimGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimGroup
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	group := &models.GroupModel{
+		ID:           uuid.New().String(),
+		DepartmentID: helpers.GetDepartmentId(r),
+		Name:         data.DisplayName,
+		ExternalID:   data.ExternalID,
+	}
+
+	memberIds := memberValues(data.Members)
+
+	if !h.validGroup(w, group) || !h.departmentMembers(w, group.DepartmentID, memberIds) {
+		return
+	}
+
+	if err := h.groupRepo.Create(group); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.CreateEntityError, "Group"), err)
+		return
+	}
+
+	if err := h.groupRepo.AddMembers(group.ID, models.GroupMemberUser, memberIds); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "Group members"), err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+
+	w.Header().Set("Location", constants.ScimGroupsEndpoint+"/"+group.ID)
+
+	h.sendGroup(w, http.StatusCreated, group)
+}
+
+// GetScimGroupHandler godoc
+// @Summary Get SCIM Group
+// @Description Get a group of the department with its members
+// @Tags SCIM
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} ScimGroup
+// @Failure 404 {object} ScimError
+// @Router /scim/v2/Groups/{id} [get]
+func (h *ScimHandler) GetScimGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.sendGroup(w, http.StatusOK, group)
+}
+
+// ReplaceScimGroupHandler godoc
+// @Summary Replace SCIM Group
+// @Description Replace a group's name, external id and members
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} ScimGroup
+// @Failure 400 {object} ScimError
+// @Failure 404 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Groups/{id} [put]
+func (h *ScimHandler) ReplaceScimGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimGroup
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	group.Name = data.DisplayName
+	group.ExternalID = data.ExternalID
+
+	memberIds := memberValues(data.Members)
+
+	if !h.validGroup(w, group) || !h.departmentMembers(w, group.DepartmentID, memberIds) {
+		return
+	}
+
+	if err := h.groupRepo.Save(group); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "Group"), err)
+		return
+	}
+
+	// members are users, groups nested through the admin API are kept
+	if err := h.groupRepo.ReplaceMembers(group.ID, models.GroupMemberUser, memberIds); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "Group members"), err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+
+	h.sendGroup(w, http.StatusOK, group)
+}
+
+// PatchScimGroupHandler godoc
+// @Summary Patch SCIM Group
+// @Description Rename a group or add, remove and replace its members
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Group ID"
+// @Success 200 {object} ScimGroup
+// @Failure 400 {object} ScimError
+// @Failure 404 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Groups/{id} [patch]
+func (h *ScimHandler) PatchScimGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimPatchRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	// operations are validated up front so a bad operation doesn't leave
+	// the group half updated
+	changes := make([]scimMemberChange, 0, len(data.Operations))
+
+	for _, operation := range data.Operations {
+		change, err := groupPatchChange(group, operation)
+
+		if err != nil {
+			h.sendPatchError(w, err)
+			return
+		}
+
+		if change == nil {
+			continue
+		}
+
+		if change.op != "remove" && !h.departmentMembers(w, group.DepartmentID, change.memberIds) {
+			return
+		}
+
+		changes = append(changes, *change)
+	}
+
+	if !h.validGroup(w, group) {
+		return
+	}
+
+	if err := h.groupRepo.Save(group); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "Group"), err)
+		return
+	}
+
+	for _, change := range changes {
+		var err error
+
+		switch change.op {
+		case "add":
+			err = h.groupRepo.AddMembers(group.ID, models.GroupMemberUser, change.memberIds)
+		case "remove":
+			err = h.groupRepo.RemoveMembers(group.ID, change.memberIds)
+		case "replace":
+			err = h.groupRepo.ReplaceMembers(group.ID, models.GroupMemberUser, change.memberIds)
+		}
+
+		if err != nil {
+			h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "Group members"), err)
+			return
+		}
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+	h.sendGroup(w, http.StatusOK, group)
+}
+
+// DeleteScimGroupHandler godoc
+// @Summary Delete SCIM Group
+// @Description Delete a group of the department, its members are kept
+// @Tags SCIM
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 404 {object} ScimError
+// @Router /scim/v2/Groups/{id} [delete]
+func (h *ScimHandler) DeleteScimGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.departmentGroup(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.groupRepo.Delete(group.ID); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(group.DepartmentID)
+
+	h.scimHelper.Send(w, http.StatusNoContent, nil)
+}
+
+func (h *ScimHandler) sendGroup(w http.ResponseWriter, status int, group *models.GroupModel) {
+	members, err := h.groupRepo.FindMembers(group.ID)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	h.scimHelper.Send(w, status, toScimGroup(group, members))
+}
+
+func (h *ScimHandler) departmentGroup(w http.ResponseWriter, r *http.Request) (*models.GroupModel, bool) {
+	groupId := mux.Vars(r)["id"]
+
+	group, err := h.groupRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), groupId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.scimHelper.SendError(w, http.StatusNotFound, "", fmt.Sprintf(constants.EntityNotFound, "Group", "id", groupId), err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return nil, false
+	}
+
+	return group, true
+}
+
+// validGroup checks the group has a name that is unique within the department.
+func (h *ScimHandler) validGroup(w http.ResponseWriter, group *models.GroupModel) bool {
+	if strings.TrimSpace(group.Name) == "" {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidValue, "displayName is required", nil)
+		return false
+	}
+
+	existing, _, err := h.groupRepo.FindByDepartment(group.DepartmentID, models.GroupFilter{Name: group.Name, Limit: 1})
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return false
+	}
+
+	if len(existing) > 0 && existing[0].ID != group.ID {
+		h.scimHelper.SendError(w, http.StatusConflict, helpers.ScimUniqueness, "A group with this displayName already exists", nil)
+		return false
+	}
+
+	return true
+}
+
+// departmentMembers checks every member is a user of the department.
+func (h *ScimHandler) departmentMembers(w http.ResponseWriter, departmentId string, memberIds []string) bool {
+	for _, memberId := range memberIds {
+		_, err := h.departmentRoleRepo.FindById(departmentId, memberId)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			detail := fmt.Sprintf(constants.EntityNotFound, "User", "id", memberId)
+			h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidValue, detail, err)
+			return false
+		}
+
+		if err != nil {
+			h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// scimMemberChange is a membership change from a PATCH operation, applied
+// once every operation has been validated.
+type scimMemberChange struct {
+	op        string
+	memberIds []string
+}
+
+// groupPatchChange applies a PATCH operation's attribute changes to the
+// group and returns the membership change it makes, if any.
+func groupPatchChange(group *models.GroupModel, operation models.ScimPatchOperation) (*scimMemberChange, error) {
+	op := strings.ToLower(operation.Op)
+
+	if op != "add" && op != "replace" && op != "remove" {
+		return nil, fmt.Errorf("unsupported operation %q", operation.Op)
+	}
+
+	if operation.Path == "" {
+		if op == "remove" {
+			return nil, fmt.Errorf("%w: remove requires a path", errScimInvalidPath)
+		}
+
+		var attributes map[string]json.RawMessage
+
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return nil, errors.New("value must be an object when no path is given")
+		}
+
+		var change *scimMemberChange
+
+		for name, value := range attributes {
+			next, err := groupPatchChange(group, models.ScimPatchOperation{Op: op, Path: name, Value: value})
+
+			if err != nil {
+				return nil, err
+			}
+
+			if next != nil {
+				change = next
+			}
+		}
+
+		return change, nil
+	}
+
+	attribute, filter, err := helpers.ParseScimPath(operation.Path)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errScimInvalidPath, err)
+	}
+
+	switch attribute {
+	case "members":
+		if filter != nil {
+			if op != "remove" || filter.Attribute != "value" {
+				return nil, fmt.Errorf("%w: %s", errScimInvalidPath, operation.Path)
+			}
+			return &scimMemberChange{op: op, memberIds: []string{filter.Value}}, nil
+		}
+
+		if op == "remove" && (len(operation.Value) == 0 || string(operation.Value) == "null") {
+			return &scimMemberChange{op: "replace"}, nil
+		}
+
+		var members []models.ScimMultiValue
+
+		if err := json.Unmarshal(operation.Value, &members); err != nil {
+			return nil, errors.New("members must be a list")
+		}
+
+		return &scimMemberChange{op: op, memberIds: memberValues(members)}, nil
+
+	case "displayname", "externalid":
+		value := ""
+
+		if op != "remove" {
+			if value, err = scimString(operation.Value); err != nil {
+				return nil, fmt.Errorf("%s: %w", attribute, err)
+			}
+		}
+
+		if attribute == "displayname" {
+			group.Name = value
+		} else {
+			group.ExternalID = value
+		}
+
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errScimInvalidPath, attribute)
+}
+
+func toScimGroup(group *models.GroupModel, members []models.GroupMemberModel) *models.ScimGroup {
+	res := &models.ScimGroup{
+		Schemas:     []string{models.ScimGroupSchema},
+		ID:          group.ID,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.Name,
+		Members:     make([]models.ScimMultiValue, 0, len(members)),
+		Meta: &models.ScimMeta{
+			ResourceType: "Group",
+			Created:      &group.CreatedAt,
+			LastModified: &group.UpdatedAt,
+			Location:     constants.ScimGroupsEndpoint + "/" + group.ID,
+		},
+	}
+
+	for _, member := range members {
+		value := models.ScimMultiValue{
+			Value: member.MemberID,
+			Type:  "User",
+			Ref:   constants.ScimUsersEndpoint + "/" + member.MemberID,
+		}
+
+		if member.MemberType == models.GroupMemberGroup {
+			value.Type = "Group"
+			value.Ref = constants.ScimGroupsEndpoint + "/" + member.MemberID
+		}
+
+		res.Members = append(res.Members, value)
+	}
+
+	return res
+}
+
+func memberValues(members []models.ScimMultiValue) []string {
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.Value != "" {
+			ids = append(ids, member.Value)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,869 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var errScimInvalidPath = errors.New("unsupported attribute")
+
+// ScimHandler serves the SCIM 2.0 provisioning API. Users map onto
+// UserModel and the department membership, groups onto GroupModel.
+type ScimHandler struct {
+	userRepo           repository.UserRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	groupRepo          repository.GroupRepository
+	log                *zerolog.Logger
+	authHelper         *helpers.AuthHelper
+	scimHelper         *helpers.ScimHelper
+	deactivationHelper *helpers.DeactivationHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+}
+
+func NewScimHandler(
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	groupRepo repository.GroupRepository,
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	scimHelper *helpers.ScimHelper,
+	deactivationHelper *helpers.DeactivationHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+) *ScimHandler {
+	return &ScimHandler{
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		groupRepo:          groupRepo,
+		log:                log,
+		authHelper:         authHelper,
+		scimHelper:         scimHelper,
+		deactivationHelper: deactivationHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+	}
+}
+
+// ListScimUsersHandler godoc
+// @Summary List SCIM Users
+// @Description List the department's users. Supports `filter` on userName,
+// @Description emails.value, externalId and displayName with the `eq` operator
+// @Description and pagination with `startIndex` and `count`.
+// @Tags SCIM
+// @Produce  json
+// @Success 200 {object} ScimListResponse
+// @Failure 400 {object} ScimError
+// @Failure 401 {object} ScimError
+// @Router /scim/v2/Users [get]
+func (h *ScimHandler) ListScimUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := helpers.ParseScimFilter(r.URL.Query().Get("filter"))
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidFilter, err.Error(), err)
+		return
+	}
+
+	startIndex, count := helpers.ScimPagination(r)
+
+	userFilter := models.UserFilter{Page: 1, PageSize: count, Offset: startIndex - 1}
+
+	if filter != nil {
+		switch filter.Attribute {
+		case "username", "emails", "emails.value":
+			userFilter.Email = filter.Value
+		case "externalid":
+			userFilter.ExternalID = filter.Value
+		case "displayname", "name.formatted":
+			userFilter.Name = filter.Value
+		default:
+			err := fmt.Errorf("filtering on %s is not supported", filter.Attribute)
+			h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidFilter, err.Error(), err)
+			return
+		}
+	}
+
+	users, total, err := h.userRepo.FindByDepartment(helpers.GetDepartmentId(r), userFilter)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	resources := make([]*models.ScimUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, toScimUser(&users[i], nil))
+	}
+
+	h.scimHelper.Send(w, http.StatusOK, &models.ScimListResponse{
+		Schemas:      []string{models.ScimListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// CreateScimUserHandler godoc
+// @Summary Create SCIM User
+// @Description Provision a user into the department. The email is taken from
+// @Description userName, or from the primary email when userName is not an
+// @Description email address, and is trusted as verified.
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Success 201 {object} ScimUser
+// @Failure 400 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Users [post]
+func (h *ScimHandler) CreateScimUserHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimUser
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	update := &scimUserUpdate{user: &models.UserModel{ID: uuid.New().String(), DepartmentID: helpers.GetDepartmentId(r), EmailVerified: true}}
+
+	if err := update.replace(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidValue, err.Error(), err)
+		return
+	}
+
+	user := update.user
+
+	if !h.emailAvailable(w, user) {
+		return
+	}
+
+	if err := h.usageHelper.CheckUserQuota(user.DepartmentID); err != nil {
+		h.scimHelper.SendError(w, http.StatusForbidden, "", err.Error(), err)
+		return
+	}
+
+	if data.Password != "" {
+		hash, err := h.authHelper.HashPassword(data.Password)
+
+		if err != nil {
+			h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+			return
+		}
+
+		user.Password = hash
+	}
+
+	if update.active != nil {
+		user.Disabled = !*update.active
+	}
+
+	err := h.userRepo.CreateWithRole(user, &models.DepartmentRoles{
+		DepartmentID: helpers.GetDepartmentId(r),
+		UserID:       user.ID,
+		Role:         models.User,
+	})
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.CreateEntityError, "User"), err)
+		return
+	}
+
+	res := toScimUser(user, nil)
+	w.Header().Set("Location", res.Meta.Location)
+
+	h.scimHelper.Send(w, http.StatusCreated, res)
+}
+
+// GetScimUserHandler godoc
+// @Summary Get SCIM User
+// @Description Get a user of the department, including their groups
+// @Tags SCIM
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} ScimUser
+// @Failure 404 {object} ScimError
+// @Router /scim/v2/Users/{id} [get]
+func (h *ScimHandler) GetScimUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.departmentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	h.sendUser(w, r, user)
+}
+
+// ReplaceScimUserHandler godoc
+// @Summary Replace SCIM User
+// @Description Replace a user's attributes. Setting active to false disables
+// @Description the user, setting it to true enables or restores them. Only
+// @Description users owned by the department can be changed.
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} ScimUser
+// @Failure 400 {object} ScimError
+// @Failure 403 {object} ScimError
+// @Failure 404 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Users/{id} [put]
+func (h *ScimHandler) ReplaceScimUserHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimUser
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	user, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) {
+		return
+	}
+
+	update := &scimUserUpdate{user: user, email: user.Email}
+
+	if err := update.replace(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidValue, err.Error(), err)
+		return
+	}
+
+	if h.saveUser(w, update) {
+		h.sendUser(w, r, user)
+	}
+}
+
+// PatchScimUserHandler godoc
+// @Summary Patch SCIM User
+// @Description Apply add, replace and remove operations to a user owned by
+// @Description the department
+// @Tags SCIM
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} ScimUser
+// @Failure 400 {object} ScimError
+// @Failure 403 {object} ScimError
+// @Failure 404 {object} ScimError
+// @Failure 409 {object} ScimError
+// @Router /scim/v2/Users/{id} [patch]
+func (h *ScimHandler) PatchScimUserHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ScimPatchRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidSyntax, err.Error(), err)
+		return
+	}
+
+	user, ok := h.departmentUser(w, r)
+
+	if !ok || !h.ownUser(w, r, user) {
+		return
+	}
+
+	update := &scimUserUpdate{user: user, email: user.Email}
+
+	for _, operation := range data.Operations {
+		if err := update.apply(operation); err != nil {
+			h.sendPatchError(w, err)
+			return
+		}
+	}
+
+	if h.saveUser(w, update) {
+		h.sendUser(w, r, user)
+	}
+}
+
+// DeleteScimUserHandler godoc
+// @Summary Delete SCIM User
+// @Description Remove the user from the department and its groups. A user
+// @Description the department owns is deactivated once they are left without
+// @Description any department.
+// @Tags SCIM
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} ScimError
+// @Failure 404 {object} ScimError
+// @Router /scim/v2/Users/{id} [delete]
+func (h *ScimHandler) DeleteScimUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.departmentUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	membership, err := h.departmentRoleRepo.FindById(departmentId, user.ID)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	if !h.checkRemoval(w, []models.DepartmentRoles{*membership}) {
+		return
+	}
+
+	if err := h.groupRepo.RemoveFromDepartment(departmentId, user.ID); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	h.roleHelper.InvalidateGroupRoles(departmentId)
+
+	if err := h.departmentRoleRepo.Delete(departmentId, user.ID); err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	memberships, err := h.departmentRoleRepo.FindByUserId(user.ID)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	if len(memberships) == 0 && user.DeactivatedAt == nil && user.OwnedBy(departmentId) {
+		if err := h.deactivationHelper.DeactivateUser(user); err != nil {
+			h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+			return
+		}
+	}
+
+	h.scimHelper.Send(w, http.StatusNoContent, nil)
+}
+
+// ServiceProviderConfigHandler godoc
+// @Summary SCIM Service Provider Config
+// @Description Describe the SCIM features supported by the service
+// @Tags SCIM
+// @Produce  json
+// @Success 200
+// @Router /scim/v2/ServiceProviderConfig [get]
+func (h *ScimHandler) ServiceProviderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	h.scimHelper.Send(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{models.ScimConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": constants.ScimMaxCount},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "The department's SCIM token in the Authorization header",
+			"primary":     true,
+		}},
+		"meta": &models.ScimMeta{ResourceType: "ServiceProviderConfig", Location: constants.ScimServiceConfigEndpoint},
+	})
+}
+
+// ResourceTypesHandler godoc
+// @Summary SCIM Resource Types
+// @Description List the SCIM resource types supported by the service
+// @Tags SCIM
+// @Produce  json
+// @Success 200 {object} ScimListResponse
+// @Router /scim/v2/ResourceTypes [get]
+func (h *ScimHandler) ResourceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name string, endpoint string, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{models.ScimResourceTypeSchema},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta":     &models.ScimMeta{ResourceType: "ResourceType", Location: constants.ScimResourceTypesEndpoint + "/" + name},
+		}
+	}
+
+	h.sendList(w, []map[string]interface{}{
+		resourceType("User", "/Users", models.ScimUserSchema),
+		resourceType("Group", "/Groups", models.ScimGroupSchema),
+	})
+}
+
+// SchemasHandler godoc
+// @Summary SCIM Schemas
+// @Description Describe the attributes supported for users and groups
+// @Tags SCIM
+// @Produce  json
+// @Success 200 {object} ScimListResponse
+// @Router /scim/v2/Schemas [get]
+func (h *ScimHandler) SchemasHandler(w http.ResponseWriter, r *http.Request) {
+	multiValue := []map[string]interface{}{
+		scimAttribute("value", "string", false, false, "readWrite"),
+		scimAttribute("type", "string", false, false, "readWrite"),
+		scimAttribute("primary", "boolean", false, false, "readWrite"),
+	}
+
+	schema := func(id string, name string, attributes ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":    []string{models.ScimSchemaSchema},
+			"id":         id,
+			"name":       name,
+			"attributes": attributes,
+			"meta":       &models.ScimMeta{ResourceType: "Schema", Location: constants.ScimSchemasEndpoint + "/" + id},
+		}
+	}
+
+	withSubAttributes := func(attribute map[string]interface{}, subAttributes []map[string]interface{}) map[string]interface{} {
+		attribute["subAttributes"] = subAttributes
+		return attribute
+	}
+
+	h.sendList(w, []map[string]interface{}{
+		schema(models.ScimUserSchema, "User",
+			scimAttribute("userName", "string", false, true, "readWrite"),
+			withSubAttributes(scimAttribute("name", "complex", false, false, "readWrite"), []map[string]interface{}{
+				scimAttribute("formatted", "string", false, false, "readWrite"),
+				scimAttribute("givenName", "string", false, false, "readWrite"),
+				scimAttribute("familyName", "string", false, false, "readWrite"),
+			}),
+			scimAttribute("displayName", "string", false, false, "readWrite"),
+			withSubAttributes(scimAttribute("emails", "complex", true, false, "readWrite"), multiValue),
+			withSubAttributes(scimAttribute("phoneNumbers", "complex", true, false, "readWrite"), multiValue),
+			scimAttribute("active", "boolean", false, false, "readWrite"),
+			scimAttribute("password", "string", false, false, "writeOnly"),
+			withSubAttributes(scimAttribute("groups", "complex", true, false, "readOnly"), []map[string]interface{}{
+				scimAttribute("value", "string", false, false, "readOnly"),
+				scimAttribute("display", "string", false, false, "readOnly"),
+			}),
+		),
+		schema(models.ScimGroupSchema, "Group",
+			scimAttribute("displayName", "string", false, true, "readWrite"),
+			withSubAttributes(scimAttribute("members", "complex", true, false, "readWrite"), []map[string]interface{}{
+				scimAttribute("value", "string", false, false, "immutable"),
+			}),
+		),
+	})
+}
+
+func (h *ScimHandler) sendList(w http.ResponseWriter, resources []map[string]interface{}) {
+	h.scimHelper.Send(w, http.StatusOK, &models.ScimListResponse{
+		Schemas:      []string{models.ScimListSchema},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *ScimHandler) sendUser(w http.ResponseWriter, r *http.Request, user *models.UserModel) {
+	groups, err := h.groupRepo.FindByMember(helpers.GetDepartmentId(r), user.ID)
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return
+	}
+
+	h.scimHelper.Send(w, http.StatusOK, toScimUser(user, groups))
+}
+
+func (h *ScimHandler) sendPatchError(w http.ResponseWriter, err error) {
+	scimType := helpers.ScimInvalidValue
+	if errors.Is(err, errScimInvalidPath) {
+		scimType = helpers.ScimInvalidPath
+	}
+
+	h.scimHelper.SendError(w, http.StatusBadRequest, scimType, err.Error(), err)
+}
+
+func (h *ScimHandler) departmentUser(w http.ResponseWriter, r *http.Request) (*models.UserModel, bool) {
+	userId := mux.Vars(r)["id"]
+
+	user, err := h.userRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), userId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.scimHelper.SendError(w, http.StatusNotFound, "", fmt.Sprintf(constants.EntityNotFound, "User", "id", userId), err)
+		return nil, false
+	}
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// ownUser only lets changes to the identity through for users the department
+// owns, members from other departments can only be removed.
+func (h *ScimHandler) ownUser(w http.ResponseWriter, r *http.Request, user *models.UserModel) bool {
+	if !user.OwnedBy(helpers.GetDepartmentId(r)) {
+		h.scimHelper.SendError(w, http.StatusForbidden, "", constants.ForeignUserError, nil)
+		return false
+	}
+	return true
+}
+
+// checkRemoval answers ErrLastAdmin if removing the memberships would leave
+// a department without an admin.
+func (h *ScimHandler) checkRemoval(w http.ResponseWriter, memberships []models.DepartmentRoles) bool {
+	err := h.roleHelper.CheckUserRemoval(memberships)
+
+	if errors.Is(err, helpers.ErrLastAdmin) {
+		h.scimHelper.SendError(w, http.StatusBadRequest, helpers.ScimInvalidValue, err.Error(), err)
+		return false
+	}
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return false
+	}
+
+	return true
+}
+
+// emailAvailable checks that no other user of the department has the user's email.
+func (h *ScimHandler) emailAvailable(w http.ResponseWriter, user *models.UserModel) bool {
+	existing, err := h.userRepo.FindByEmailInDepartment(user.DepartmentID, user.Email)
+
+	if err == nil && existing.ID != user.ID {
+		h.scimHelper.SendError(w, http.StatusConflict, helpers.ScimUniqueness, "A user with this userName already exists", nil)
+		return false
+	}
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+		return false
+	}
+
+	return true
+}
+
+// saveUser saves an updated user. A user set to active is enabled and, if
+// they were deactivated, restored. The last admin of a department can't be
+// set inactive.
+func (h *ScimHandler) saveUser(w http.ResponseWriter, update *scimUserUpdate) bool {
+	user := update.user
+
+	if update.active != nil && !*update.active && !user.Disabled {
+		memberships, err := h.departmentRoleRepo.FindByUserId(user.ID)
+
+		if err != nil {
+			h.scimHelper.SendError(w, http.StatusInternalServerError, "", constants.InternalServerErrorMessage, err)
+			return false
+		}
+
+		if !h.checkRemoval(w, memberships) {
+			return false
+		}
+	}
+
+	if user.Email != update.email {
+		if !h.emailAvailable(w, user) {
+			return false
+		}
+
+		user.EmailVerified = true
+		user.PendingEmail = ""
+	}
+
+	var err error
+
+	if update.active != nil {
+		user.Disabled = !*update.active
+	}
+
+	if update.active != nil && *update.active && user.DeactivatedAt != nil {
+		err = h.deactivationHelper.RestoreUser(user)
+	} else {
+		err = h.userRepo.Save(user)
+	}
+
+	if err != nil {
+		h.scimHelper.SendError(w, http.StatusInternalServerError, "", fmt.Sprintf(constants.SaveEntityError, "User"), err)
+		return false
+	}
+
+	return true
+}
+
+// scimUserUpdate applies SCIM attributes to a user. The email the user had
+// before the update is kept to detect changes, active is applied on save.
+type scimUserUpdate struct {
+	user   *models.UserModel
+	email  string
+	active *bool
+}
+
+// replace applies a full SCIM user, as sent on create and replace.
+func (u *scimUserUpdate) replace(data *models.ScimUser) error {
+	email := data.UserName
+	if !isEmail(email) {
+		email = primaryValue(data.Emails)
+	}
+
+	if !isEmail(email) {
+		return errors.New("userName or the primary email must be an email address")
+	}
+
+	u.user.Email = email
+	u.user.PhoneNumber = primaryValue(data.PhoneNumbers)
+	u.user.ExternalID = data.ExternalID
+	u.active = data.Active
+
+	if data.Name != nil {
+		u.setName(data.Name)
+	}
+
+	if u.user.Name == "" {
+		u.user.Name = data.DisplayName
+	}
+
+	return nil
+}
+
+// apply applies a single PATCH operation. Without a path the value is an
+// object of attributes to set.
+func (u *scimUserUpdate) apply(operation models.ScimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+
+	if op != "add" && op != "replace" && op != "remove" {
+		return fmt.Errorf("unsupported operation %q", operation.Op)
+	}
+
+	if operation.Path == "" {
+		if op == "remove" {
+			return fmt.Errorf("%w: remove requires a path", errScimInvalidPath)
+		}
+
+		var attributes map[string]json.RawMessage
+
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return errors.New("value must be an object when no path is given")
+		}
+
+		for name, value := range attributes {
+			if err := u.set(strings.ToLower(name), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	attribute, _, err := helpers.ParseScimPath(operation.Path)
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", errScimInvalidPath, err)
+	}
+
+	if op == "remove" {
+		return u.remove(attribute)
+	}
+
+	return u.set(attribute, operation.Value)
+}
+
+func (u *scimUserUpdate) set(attribute string, raw json.RawMessage) error {
+	switch attribute {
+	case "active":
+		active, err := helpers.ParseScimBool(raw)
+		if err != nil {
+			return err
+		}
+		u.active = &active
+		return nil
+
+	case "name":
+		var name models.ScimName
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return errors.New("name must be an object")
+		}
+		u.setName(&name)
+		return nil
+
+	case "emails", "phonenumbers":
+		var values []models.ScimMultiValue
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return fmt.Errorf("%s must be a list", attribute)
+		}
+		value, _ := json.Marshal(primaryValue(values))
+		return u.set(attribute+".value", value)
+	}
+
+	value, err := scimString(raw)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", attribute, err)
+	}
+
+	switch attribute {
+	case "username", "emails.value":
+		// a userName that isn't an email address is not used, the email
+		// then comes from the emails attribute
+		if attribute == "username" && !isEmail(value) {
+			return nil
+		}
+		if !isEmail(value) {
+			return errors.New("email must be an email address")
+		}
+		u.user.Email = value
+
+	case "phonenumbers.value":
+		u.user.PhoneNumber = value
+
+	case "externalid":
+		u.user.ExternalID = value
+
+	case "displayname", "name.formatted":
+		u.user.Name = value
+
+	case "name.givenname":
+		_, family := splitName(u.user.Name)
+		u.user.Name = joinName(value, family)
+
+	case "name.familyname":
+		given, _ := splitName(u.user.Name)
+		u.user.Name = joinName(given, value)
+
+	default:
+		return fmt.Errorf("%w: %s", errScimInvalidPath, attribute)
+	}
+
+	return nil
+}
+
+func (u *scimUserUpdate) remove(attribute string) error {
+	switch attribute {
+	case "externalid":
+		u.user.ExternalID = ""
+	case "phonenumbers", "phonenumbers.value":
+		u.user.PhoneNumber = ""
+	case "displayname", "name", "name.formatted":
+		u.user.Name = ""
+	case "name.givenname", "name.familyname":
+		return u.set(attribute, json.RawMessage(`""`))
+	default:
+		return fmt.Errorf("%w: %s cannot be removed", errScimInvalidPath, attribute)
+	}
+
+	return nil
+}
+
+func (u *scimUserUpdate) setName(name *models.ScimName) {
+	if name.Formatted != "" {
+		u.user.Name = name.Formatted
+	} else if name.GivenName != "" || name.FamilyName != "" {
+		u.user.Name = joinName(name.GivenName, name.FamilyName)
+	}
+}
+
+func toScimUser(user *models.UserModel, groups []models.GroupModel) *models.ScimUser {
+	active := !user.Disabled && user.DeactivatedAt == nil
+	given, family := splitName(user.Name)
+
+	res := &models.ScimUser{
+		Schemas:     []string{models.ScimUserSchema},
+		ID:          user.ID,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		DisplayName: user.Name,
+		Active:      &active,
+		Meta: &models.ScimMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     constants.ScimUsersEndpoint + "/" + user.ID,
+		},
+	}
+
+	if user.Name != "" {
+		res.Name = &models.ScimName{Formatted: user.Name, GivenName: given, FamilyName: family}
+	}
+
+	if user.Email != "" {
+		res.Emails = []models.ScimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+
+	if user.PhoneNumber != "" {
+		res.PhoneNumbers = []models.ScimMultiValue{{Value: user.PhoneNumber, Type: "mobile", Primary: true}}
+	}
+
+	for _, group := range groups {
+		res.Groups = append(res.Groups, models.ScimMultiValue{
+			Value:   group.ID,
+			Display: group.Name,
+			Ref:     constants.ScimGroupsEndpoint + "/" + group.ID,
+		})
+	}
+
+	return res
+}
+
+func scimAttribute(name string, kind string, multiValued bool, required bool, mutability string) map[string]interface{} {
+	returned := "default"
+	if mutability == "writeOnly" {
+		returned = "never"
+	}
+
+	return map[string]interface{}{
+		"name":        name,
+		"type":        kind,
+		"multiValued": multiValued,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    returned,
+		"uniqueness":  "none",
+	}
+}
+
+func scimString(raw json.RawMessage) (string, error) {
+	var value string
+
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", errors.New("value must be a string")
+	}
+
+	return value, nil
+}
+
+// primaryValue returns the primary value of a multi-valued attribute, or
+// the first value when none is marked primary.
+func primaryValue(values []models.ScimMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+
+	if len(values) > 0 {
+		return values[0].Value
+	}
+
+	return ""
+}
+
+func isEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+func splitName(name string) (string, string) {
+	given, family, _ := strings.Cut(name, " ")
+	return given, family
+}
+
+func joinName(given string, family string) string {
+	return strings.TrimSpace(given + " " + family)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+// Department A's admin acts on two members: ownUserId belongs to A,
+// foreignUserId belongs to B and is only a member of A.
+const (
+	departmentA   = "department-a"
+	departmentB   = "department-b"
+	adminUserId   = "admin"
+	ownUserId     = "own-user"
+	foreignUserId = "foreign-user"
+)
+
+type isolationFixture struct {
+	router             *mux.Router
+	userRepo           *fakeUserRepo
+	departmentRoleRepo *fakeDepartmentRoleRepo
+	groupRepo          *fakeGroupRepo
+
+	// permissions are the caller's, an admin's unless a test narrows them
+	permissions []models.Permission
+}
+
+// unreachableRedis fails fast, the cache invalidations it is used for only
+// log their errors.
+func unreachableRedis() *helpers.RedisHelper {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: time.Millisecond, MaxRetries: -1})
+	return helpers.NewRedisHelper(client, &testLog, context.Background())
+}
+
+// newIsolationFixture serves the admin, SCIM, profile and erasure routes as a member
+// of department A, without the RBAC middleware.
+func newIsolationFixture(t *testing.T) *isolationFixture {
+	t.Helper()
+
+	departmentRoleRepo := &fakeDepartmentRoleRepo{roles: []models.DepartmentRoles{
+		{DepartmentID: departmentA, UserID: adminUserId, Role: models.Admin},
+		{DepartmentID: departmentA, UserID: ownUserId, Role: models.User},
+		{DepartmentID: departmentB, UserID: foreignUserId, Role: models.User},
+		{DepartmentID: departmentA, UserID: foreignUserId, Role: models.User},
+	}}
+
+	userRepo := &fakeUserRepo{departmentRoleRepo: departmentRoleRepo, users: map[string]*models.UserModel{
+		adminUserId:   {ID: adminUserId, DepartmentID: departmentA, Email: "admin@a.example"},
+		ownUserId:     {ID: ownUserId, DepartmentID: departmentA, Email: "own@a.example", Name: "Own"},
+		foreignUserId: {ID: foreignUserId, DepartmentID: departmentB, Email: "foreign@b.example", Name: "Foreign", PhoneNumber: "+15550100"},
+	}}
+
+	groupRepo := &fakeGroupRepo{}
+	responseHelper := helpers.NewResponseHelper(&testLog)
+	roleHelper := helpers.NewRoleHelper(&testLog, &fakeRoleRepo{userRepo: userRepo}, nil, groupRepo, unreachableRedis())
+
+	// the deactivation helper is nil, a foreign member must never be deactivated
+	adminHandler := NewAdminUserHandler(
+		userRepo,
+		nil,
+		departmentRoleRepo,
+		groupRepo,
+		&testLog,
+		nil,
+		responseHelper,
+		helpers.NewValidatorHelper(&testLog, responseHelper),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		roleHelper,
+		helpers.NewAuditHelper(&testLog, &fakeAuditRepo{}),
+	)
+
+	scimHandler := NewScimHandler(
+		userRepo,
+		departmentRoleRepo,
+		groupRepo,
+		&testLog,
+		nil,
+		helpers.NewScimHelper(&testLog),
+		nil,
+		nil,
+		roleHelper,
+	)
+
+	privacyHandler := NewPrivacyHandler(userRepo, nil, departmentRoleRepo, nil, &testLog, nil, nil, responseHelper, roleHelper, nil)
+
+	profileHandler := NewProfileHandler(userRepo, nil, departmentRoleRepo, &testLog, nil, responseHelper, nil, nil, nil, nil, nil, nil, roleHelper)
+
+	f := &isolationFixture{userRepo: userRepo, departmentRoleRepo: departmentRoleRepo, groupRepo: groupRepo, permissions: models.BuiltInRolePermissions[models.Admin]}
+
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = helpers.SetDepartmentId(r, departmentA)
+			r = helpers.SetUserId(r, adminUserId)
+			r = helpers.SetPermissions(r, f.permissions)
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	router.HandleFunc(constants.AdminUserEndpoint, adminHandler.GetUserHandler).Methods(http.MethodGet)
+	router.HandleFunc(constants.AdminUserEndpoint, adminHandler.DeleteUserHandler).Methods(http.MethodDelete)
+	router.HandleFunc(constants.AdminDisableUserEndpoint, adminHandler.DisableUserHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.AdminEnableUserEndpoint, adminHandler.EnableUserHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.AdminRestoreUserEndpoint, adminHandler.RestoreUserHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.AdminResetPasswordEndpoint, adminHandler.ForcePasswordResetHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.AdminResendVerifyEndpoint, adminHandler.ResendVerificationHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.AdminUserMetadataEndpoint, adminHandler.UpdateMetadataHandler).Methods(http.MethodPatch)
+	router.HandleFunc(constants.AdminUserErasureEndpoint, privacyHandler.EraseUserHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.ProfileEndpoint, profileHandler.DeleteProfileHandler).Methods(http.MethodDelete)
+	router.HandleFunc(constants.ProfileErasureEndpoint, privacyHandler.EraseProfileHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.ScimUserEndpoint, scimHandler.ReplaceScimUserHandler).Methods(http.MethodPut)
+	router.HandleFunc(constants.ScimUserEndpoint, scimHandler.PatchScimUserHandler).Methods(http.MethodPatch)
+	router.HandleFunc(constants.ScimUserEndpoint, scimHandler.DeleteScimUserHandler).Methods(http.MethodDelete)
+
+	f.router = router
+	return f
+}
+
+func (f *isolationFixture) serve(method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+	return w
+}
+
+func adminUserPath(userId string, action string) string {
+	return "/api/v1/admin/users/" + userId + action
+}
+
+func scimUserPath(userId string) string {
+	return strings.Replace(constants.ScimUserEndpoint, "{id}", userId, 1)
+}
+
+func TestForeignMemberIdentityCantBeChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"disable", http.MethodPost, adminUserPath(foreignUserId, "/disable"), ""},
+		{"enable", http.MethodPost, adminUserPath(foreignUserId, "/enable"), ""},
+		{"restore", http.MethodPost, adminUserPath(foreignUserId, "/restore"), ""},
+		{"force password reset", http.MethodPost, adminUserPath(foreignUserId, "/reset-password"), ""},
+		{"resend verification", http.MethodPost, adminUserPath(foreignUserId, "/resend-verification"), ""},
+		{"metadata", http.MethodPatch, adminUserPath(foreignUserId, "/metadata"), `{"metadata":{"team":"a"}}`},
+		{"erasure", http.MethodPost, adminUserPath(foreignUserId, "/erasure"), ""},
+		{"scim replace", http.MethodPut, scimUserPath(foreignUserId), `{"userName":"taken@a.example","active":false}`},
+		{"scim patch", http.MethodPatch, scimUserPath(foreignUserId), `{"Operations":[{"op":"remove","path":"phoneNumbers"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newIsolationFixture(t)
+			before := *f.userRepo.users[foreignUserId]
+
+			w := f.serve(tt.method, tt.path, tt.body)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+			}
+
+			after := f.userRepo.users[foreignUserId]
+
+			if after.Disabled != before.Disabled || after.Email != before.Email || after.PhoneNumber != before.PhoneNumber ||
+				after.PasswordResetRequired != before.PasswordResetRequired || string(after.Metadata) != string(before.Metadata) {
+				t.Errorf("foreign identity changed: before %+v, after %+v", before, *after)
+			}
+		})
+	}
+}
+
+func TestOwnUserIdentityCanBeChanged(t *testing.T) {
+	f := newIsolationFixture(t)
+
+	w := f.serve(http.MethodPost, adminUserPath(ownUserId, "/disable"), "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if !f.userRepo.users[ownUserId].Disabled {
+		t.Error("own user was not disabled")
+	}
+}
+
+func TestForeignMemberCanBeRead(t *testing.T) {
+	f := newIsolationFixture(t)
+
+	if w := f.serve(http.MethodGet, adminUserPath(foreignUserId, ""), ""); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestUserOfOtherDepartmentIsNotFound(t *testing.T) {
+	f := newIsolationFixture(t)
+
+	f.departmentRoleRepo.Delete(departmentA, foreignUserId)
+
+	if w := f.serve(http.MethodPost, adminUserPath(foreignUserId, "/disable"), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeleteForeignMemberOnlyRemovesMembership(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"admin", http.MethodDelete, adminUserPath(foreignUserId, ""), http.StatusOK},
+		{"scim", http.MethodDelete, scimUserPath(foreignUserId), http.StatusNoContent},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newIsolationFixture(t)
+
+			// without the membership in department B the user would be left
+			// without any department, still only B may deactivate them
+			f.departmentRoleRepo.Delete(departmentB, foreignUserId)
+
+			w := f.serve(tt.method, tt.path, "")
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			if _, err := f.departmentRoleRepo.FindById(departmentA, foreignUserId); err == nil {
+				t.Error("membership of department A was not removed")
+			}
+
+			if len(f.groupRepo.removed) != 1 || f.groupRepo.removed[0] != departmentA+"/"+foreignUserId {
+				t.Errorf("removed from groups = %v, want only department A's", f.groupRepo.removed)
+			}
+
+			if f.userRepo.users[foreignUserId].DeactivatedAt != nil {
+				t.Error("foreign identity was deactivated")
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"uas/config"
 	"uas/internal/constants"
 	"uas/internal/helpers"
@@ -11,8 +13,8 @@ import (
 	repository "uas/internal/repositories"
 
 	"github.com/google/uuid"
-	"github.com/gorilla/securecookie"
 	"github.com/rs/zerolog"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
@@ -26,6 +28,11 @@ type UserHandler struct {
 	validatorHelper    *helpers.ValidatorHelper
 	emailHelper        *helpers.EmailHelper
 	twilioHelper       *helpers.TwilioHelper
+	metadataHelper     *helpers.MetadataHelper
+	verificationHelper *helpers.VerificationHelper
+	usageHelper        *helpers.UsageHelper
+	roleHelper         *helpers.RoleHelper
+	auditHelper        *helpers.AuditHelper
 }
 
 func NewUserHandler(
@@ -39,6 +46,11 @@ func NewUserHandler(
 	validatorHelper *helpers.ValidatorHelper,
 	emailHelper *helpers.EmailHelper,
 	twilioHelper *helpers.TwilioHelper,
+	metadataHelper *helpers.MetadataHelper,
+	verificationHelper *helpers.VerificationHelper,
+	usageHelper *helpers.UsageHelper,
+	roleHelper *helpers.RoleHelper,
+	auditHelper *helpers.AuditHelper,
 ) *UserHandler {
 	return &UserHandler{
 		userRepo:           userRepo,
@@ -51,6 +63,11 @@ func NewUserHandler(
 		validatorHelper:    validatorHelper,
 		emailHelper:        emailHelper,
 		twilioHelper:       twilioHelper,
+		metadataHelper:     metadataHelper,
+		verificationHelper: verificationHelper,
+		usageHelper:        usageHelper,
+		roleHelper:         roleHelper,
+		auditHelper:        auditHelper,
 	}
 }
 
@@ -72,9 +89,49 @@ func (h *UserHandler) CredentialsRegisterUserHandler(w http.ResponseWriter, r *h
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
 	}
 
-	h.validatorHelper.ValidateStruct(w, &data)
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	if !h.checkLoginMethod(w, departmentId, models.PasswordLogin) || !h.checkSignupOpen(w, departmentId) {
+		return
+	}
+
+	// the verification email is sent once the user exists
+	if !h.checkQuota(w, h.usageHelper.CheckUserQuota(departmentId)) || !h.checkQuota(w, h.usageHelper.CheckQuota(departmentId, models.EmailUsage)) {
+		return
+	}
+
+	_, err = h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
+
+	if err == nil {
+		h.responseHelper.SendErrorResponse(w, "User with this email already exists", constants.BadRequest, nil)
+		return
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	schema, err := h.metadataHelper.LoadSchema(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	if schema != nil {
+		if err := schema.Validate(data.Metadata); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+			return
+		}
+	}
 
 	password_hash, err := h.authHelper.HashPassword(data.Password)
 	err_message := fmt.Sprintf(constants.CreateEntityError, "User")
@@ -82,57 +139,47 @@ func (h *UserHandler) CredentialsRegisterUserHandler(w http.ResponseWriter, r *h
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error hashing password")
 		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+		return
 	}
 
 	userId := uuid.New().String()
 
 	user := models.UserModel{
 		ID:            userId,
+		DepartmentID:  departmentId,
 		Name:          data.Name,
 		Email:         data.Email,
 		Password:      password_hash,
 		PhoneNumber:   data.PhoneNumber,
 		EmailVerified: false,
-	}
+		Metadata:      data.Metadata,
 
-	err = h.userRepo.Create(&user)
-
-	if err != nil {
-		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+		VerificationExpiresAt: helpers.VerificationExpiry(),
 	}
 
-	departmentId := helpers.GetDepartmentId(r)
-
 	user_role := models.DepartmentRoles{
-		ID:     departmentId,
-		Role:   models.User,
-		UserID: userId,
+		DepartmentID: departmentId,
+		Role:         models.User,
+		UserID:       userId,
 	}
 
-	err = h.departmentRoleRepo.Create(&user_role)
+	err = h.userRepo.CreateWithRole(&user, &user_role)
 
 	if err != nil {
-		h.responseHelper.SendErrorResponse(w, "Error creating user role", constants.InternalServerError, err)
-	}
-
-	code, err := h.authHelper.GenerateOtpCode(data.PhoneNumber)
-
-	if err != nil {
-		h.responseHelper.SendErrorResponse(w, "Error w/ otp generation", constants.InternalServerError, err)
-	}
-
-	tmpl_data := models.VerifyEmailData{
-		Name: user.Name,
-		Otp:  code,
+		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+		return
 	}
 
-	err = h.emailHelper.SendEmail(data.Email, "verify-email", tmpl_data)
+	err = h.verificationHelper.SendVerificationEmail(&user)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error sending verification email")
 		h.responseHelper.SendErrorResponse(w, "Error w/ sending verification email", constants.InternalServerError, err)
+		return
 	}
 
+	h.recordRegistered(r, userId)
+
 	res := &models.RegisterUserResponse{
 		UserID: userId,
 		Name:   data.Name,
@@ -145,16 +192,15 @@ func (h *UserHandler) CredentialsRegisterUserHandler(w http.ResponseWriter, r *h
 
 // VerifyEmailHandler godoc
 // @Summary Verify Email
-// @Description Verify Email
+// @Description Verify an email address with the OTP code from the verification email
 // @Tags User
 // @Accept  json
 // @Produce  json
-// @Param token path string true "Token"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /users/credentials/verify-email/{token} [post]
+// @Router /users/credential/verify-email [post]
 func (h *UserHandler) CredentialsVerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	var data models.VerifyEmailRequest
 
@@ -162,37 +208,125 @@ func (h *UserHandler) CredentialsVerifyEmailHandler(w http.ResponseWriter, r *ht
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
 	}
 
-	h.validatorHelper.ValidateStruct(w, &data)
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
 
-	err = h.authHelper.ValidateOtpCode(data.Email, data.Otp)
+	departmentId := helpers.GetDepartmentId(r)
+
+	err = h.authHelper.ValidateOtpCode(departmentId, data.Email, data.Otp)
 
 	if err != nil {
-		h.responseHelper.SendErrorResponse(w, "Error verifying OTP code", constants.InternalServerError, err)
+		h.responseHelper.SendErrorResponse(w, "Error verifying OTP code", constants.BadRequest, err)
+		return
 	}
 
-	user, err := h.userRepo.FindByEmail(data.Email)
+	user, err := h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
 
 	if err != nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "email:", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "email", data.Email)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return
 	}
 
-	if user == nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "email: ", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, nil)
-	} else {
-		user.EmailVerified = true
-		err = h.userRepo.Save(user)
+	h.markEmailVerified(w, user)
+}
+
+// VerifyEmailLinkHandler godoc
+// @Summary Verify Email Link
+// @Description Verify an email address with the signed link from the verification email
+// @Tags User
+// @Produce  json
+// @Param token query string true "Token"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/credential/verify-email [get]
+func (h *UserHandler) CredentialsVerifyEmailLinkHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		h.responseHelper.SendErrorResponse(w, "Token is empty", constants.BadRequest, nil)
+		return
+	}
+
+	userId, email, err := h.authHelper.ValidateVerificationToken(token)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	// the link is opened without tenant credentials, the signed token binds it to the user
+	user, err := h.userRepo.FindById(userId)
+
+	if err != nil || user.Email != email {
+		h.responseHelper.SendErrorResponse(w, constants.TokenInvalidError, constants.BadRequest, err)
+		return
+	}
+
+	h.markEmailVerified(w, user)
+}
+
+// ResendVerificationHandler godoc
+// @Summary Resend Verification
+// @Description Send a new verification email. Requests for unknown or already
+// @Description verified addresses get the same response to avoid leaking accounts.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/credential/resend-verification [post]
+func (h *UserHandler) CredentialsResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var data models.ResendVerificationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
+
+	allowed, err := h.verificationHelper.AllowResend(departmentId, data.Email)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	if !allowed {
+		h.responseHelper.SendErrorResponse(w, "Please wait before requesting another verification email", constants.TooManyRequests, nil)
+		return
+	}
+
+	if !h.checkQuota(w, h.usageHelper.CheckQuota(departmentId, models.EmailUsage)) {
+		return
+	}
+
+	user, err := h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
+
+	if err == nil && !user.EmailVerified {
+		err = h.verificationHelper.SendVerificationEmail(user)
 
 		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error verifying email", constants.InternalServerError, err)
+			h.responseHelper.SendErrorResponse(w, "Error w/ sending verification email", constants.InternalServerError, err)
+			return
 		}
 	}
 
-	h.responseHelper.SendSuccessResponse(w, "Email verified successfully", nil)
-
+	h.responseHelper.SendSuccessResponse(w, "If the account exists and is unverified, a verification email has been sent", nil)
 }
 
 // LoginUserHandler godoc
@@ -213,38 +347,68 @@ func (h *UserHandler) CredentialsLoginUserHandler(w http.ResponseWriter, r *http
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
 	}
 
-	h.validatorHelper.ValidateStruct(w, &data)
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
 
-	user, err := h.userRepo.FindByEmail(data.Email)
+	departmentId := helpers.GetDepartmentId(r)
 
-	if err != nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "email:", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+	if !h.checkLoginMethod(w, departmentId, models.PasswordLogin) {
+		return
 	}
 
-	if user == nil {
+	user, err := h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
+
+	if err != nil {
+		h.recordLoginFailed(r, "", "Unknown email")
 		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "email: ", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, nil)
-	} else {
-		if !user.EmailVerified {
-			h.responseHelper.SendErrorResponse(w, "Email not verified", constants.BadRequest, err)
-		}
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return
 	}
 
-	valid := h.authHelper.CheckPasswordHash(data.Password, user.Password)
+	if !user.EmailVerified {
+		h.recordLoginFailed(r, user.ID, "Email not verified")
+		h.responseHelper.SendErrorResponse(w, "Email not verified", constants.BadRequest, nil)
+		return
+	}
+
+	if err := h.authHelper.CheckLoginAllowed(user, departmentId); err != nil {
+		h.recordLoginFailed(r, user.ID, err.Error())
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+		return
+	}
+
+	if user.PasswordResetRequired {
+		h.recordLoginFailed(r, user.ID, constants.ResetRequiredError)
+		h.responseHelper.SendErrorResponse(w, constants.ResetRequiredError, constants.Forbidden, nil)
+		return
+	}
+
+	valid, upgrade := h.authHelper.VerifyPassword(data.Password, user)
 
 	if !valid {
-		h.responseHelper.SendErrorResponse(w, "Invalid credentials", constants.BadRequest, err)
+		h.recordLoginFailed(r, user.ID, "Invalid credentials")
+		h.responseHelper.SendErrorResponse(w, "Invalid credentials", constants.BadRequest, nil)
+		return
 	}
 
-	departmentId := helpers.GetDepartmentId(r)
-	access_token, err := h.authHelper.GenerateAccessJwtToken(user, departmentId)
+	if !h.checkQuota(w, h.usageHelper.CheckLoginQuota(departmentId, user.ID)) {
+		return
+	}
+
+	if upgrade {
+		h.upgradePasswordHash(user, data.Password)
+	}
+
+	access_token, err := h.issueAccessToken(user, departmentId)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error generating access token")
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, err)
+		return
 	}
 
 	refresh_token, err := h.authHelper.GenerateRefreshJwtToken(user, departmentId)
@@ -252,24 +416,14 @@ func (h *UserHandler) CredentialsLoginUserHandler(w http.ResponseWriter, r *http
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error generating refresh token")
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, err)
+		return
 	}
 
-	cookieHashKey := []byte(config.AppConfig.CookieHashKey)
-	cookieBlockKey := []byte(config.AppConfig.CookieBlockKey)
+	h.authHelper.GenerateAccessCookie(access_token, departmentId, w)
+	w.Header().Set(constants.JwtHeader, refresh_token)
 
-	var s = securecookie.New(cookieHashKey, cookieBlockKey)
-
-	if encoded, err := s.Encode("access-token", access_token); err == nil {
-		cookie := &http.Cookie{
-			Name:     "access-token",
-			Value:    encoded,
-			Path:     "/",
-			Secure:   true,
-			HttpOnly: true,
-		}
-		http.SetCookie(w, cookie)
-		w.Header().Set(constants.JwtHeader, refresh_token)
-	}
+	h.usageHelper.RecordLogin(departmentId, user.ID)
+	h.recordLogin(r, user.ID, models.PasswordLogin)
 
 	h.responseHelper.SendSuccessResponse(w, "Successful login", nil)
 }
@@ -292,24 +446,42 @@ func (h *UserHandler) CredentialsForgotPasswordHandler(w http.ResponseWriter, r
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
 	}
 
-	h.validatorHelper.ValidateStruct(w, &data)
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
+	}
+
+	departmentId := helpers.GetDepartmentId(r)
 
-	user, err := h.userRepo.FindByEmail(data.Email)
+	user, err := h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "email", data.Email)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, err)
+		return
+	}
 
 	if err != nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "email:", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.InternalServerError, err)
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
 	}
 
-	if user == nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User", "email: ", data.Email)
-		h.responseHelper.SendErrorResponse(w, err_message, constants.NotFound, nil)
-	} else {
-		if !user.EmailVerified {
-			h.responseHelper.SendErrorResponse(w, "Email not verified", constants.BadRequest, err)
-		}
+	if !user.EmailVerified {
+		h.responseHelper.SendErrorResponse(w, "Email not verified", constants.BadRequest, nil)
+		return
+	}
+
+	if !h.checkQuota(w, h.usageHelper.CheckQuota(departmentId, models.EmailUsage)) {
+		return
+	}
+
+	settings, err := h.authHelper.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
 	}
 
 	reset_token := h.authHelper.GenerateAuthToken()
@@ -317,29 +489,32 @@ func (h *UserHandler) CredentialsForgotPasswordHandler(w http.ResponseWriter, r
 	tmp := models.AuthModel{
 		UserID: user.ID,
 		Token:  reset_token,
-		Type: models.ResetPassword,
+		Type:   models.ResetPassword,
 	}
 
 	err = h.authRepo.Create(&tmp)
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, "Error sending reset password email", constants.InternalServerError, err)
+		return
 	}
 
-	url := fmt.Sprintf("%s?token=%s", r.URL, reset_token)
-
 	tmpl_data := models.ForgotPasswordData{
 		Name: user.Name,
-		Url:  url,
+		Url:  fmt.Sprintf("%s?token=%s", config.AppConfig.ResetLinkBaseUrl, url.QueryEscape(reset_token)),
 	}
 
-	err = h.emailHelper.SendEmail(data.Email, "reset-password", tmpl_data)
+	err = h.emailHelper.SendDepartmentEmail(settings, data.Email, "reset-password", tmpl_data)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error sending reset password email")
 		h.responseHelper.SendErrorResponse(w, "Error sending reset password email", constants.InternalServerError, err)
+		return
 	}
 
+	h.usageHelper.Record(departmentId, models.EmailUsage)
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.PasswordResetRequested, ActorID: user.ID, TargetID: user.ID})
+
 	h.responseHelper.SendSuccessResponse(w, "Reset password email sent successfully", nil)
 
 }
@@ -362,7 +537,8 @@ func (h *UserHandler) CredentialsResetPasswordHandler(w http.ResponseWriter, r *
 
 	if token == "" {
 		h.log.Error().Msg("Token is empty")
-		h.responseHelper.SendErrorResponse(w, "Token is empty", constants.InternalServerError, nil)
+		h.responseHelper.SendErrorResponse(w, "Token is empty", constants.BadRequest, nil)
+		return
 	}
 
 	var data models.ResetPasswordRequest
@@ -371,42 +547,56 @@ func (h *UserHandler) CredentialsResetPasswordHandler(w http.ResponseWriter, r *
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+		return
+	}
+
+	if !h.validatorHelper.ValidateStruct(w, &data) {
+		return
 	}
 
 	record, err := h.authRepo.FindByTokenAndType(token, models.ResetPassword)
 
-	if err == nil {
-		err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "email:", "")
-		h.responseHelper.SendErrorResponse(w, err_message, constants.BadRequest, err)
+	if err != nil {
+		h.auditHelper.Failure(r, models.PasswordReset, "", "Invalid token")
+		h.responseHelper.SendErrorResponse(w, "Invalid token", constants.BadRequest, err)
+		return
 	}
 
-	if token == record.Token {
-		user, err := h.userRepo.FindById(record.UserID)
+	user, err := h.userRepo.FindByIdInDepartment(helpers.GetDepartmentId(r), record.UserID)
 
-		if err != nil {
-			err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "id:", record.UserID)
-			h.responseHelper.SendErrorResponse(w, err_message, constants.BadRequest, err)
-		}
+	if err != nil {
+		err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "id:", record.UserID)
+		h.responseHelper.SendErrorResponse(w, err_message, constants.BadRequest, err)
+		return
+	}
 
-		password_hash, err := h.authHelper.HashPassword(data.Password)
+	password_hash, err := h.authHelper.HashPassword(data.Password)
 
-		if err != nil {
-			h.log.Error().Err(err).Msg("Error hashing password")
-			h.responseHelper.SendErrorResponse(w, "Error resetting password", constants.InternalServerError, err)
-		}
+	if err != nil {
+		h.log.Error().Err(err).Msg("Error hashing password")
+		h.responseHelper.SendErrorResponse(w, "Error resetting password", constants.InternalServerError, err)
+		return
+	}
 
-		user.Password = password_hash
+	user.Password = password_hash
+	user.PasswordAlgorithm = models.Bcrypt
+	user.PasswordResetRequired = false
 
-		err = h.userRepo.Save(user)
+	err = h.userRepo.Save(user)
 
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error resetting password", constants.InternalServerError, err)
-		}
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error resetting password", constants.InternalServerError, err)
+		return
+	}
 
-	} else {
-		h.responseHelper.SendErrorResponse(w, "Invalid token", constants.BadRequest, nil)
+	err = h.authRepo.Delete(record.Token)
+
+	if err != nil {
+		h.log.Error().Err(err).Msg("Error deleting reset password token")
 	}
 
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.PasswordReset, ActorID: user.ID, TargetID: user.ID})
+
 	h.responseHelper.SendSuccessResponse(w, "Password reset successfully", nil)
 
 }
@@ -422,8 +612,18 @@ func (h *UserHandler) SendOtpCode(w http.ResponseWriter, r *http.Request) {
 
 	h.validatorHelper.ValidateStruct(w, &data)
 
+	departmentId := helpers.GetDepartmentId(r)
+
+	if !h.checkLoginMethod(w, departmentId, models.OtpLogin) {
+		return
+	}
+
+	if !h.checkQuota(w, h.usageHelper.CheckQuota(departmentId, models.SmsUsage)) {
+		return
+	}
+
 	// NOTE: should we retry this operation if it fails?
-	code, err := h.authHelper.GenerateOtpCode(data.PhoneNumber)
+	code, err := h.authHelper.GenerateOtpCode(departmentId, data.PhoneNumber)
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, "Error generating OTP code", constants.InternalServerError, err)
@@ -435,9 +635,14 @@ func (h *UserHandler) SendOtpCode(w http.ResponseWriter, r *http.Request) {
 	err = h.twilioHelper.SendSMS(data.PhoneNumber, msg)
 
 	if err != nil {
+		h.auditHelper.Failure(r, models.OtpSent, "", "Error sending OTP code")
 		h.responseHelper.SendErrorResponse(w, "Error sending OTP code", constants.InternalServerError, err)
+		return
 	}
 
+	h.usageHelper.Record(departmentId, models.SmsUsage)
+	h.auditHelper.Success(r, models.OtpSent, "")
+
 	h.responseHelper.SendSuccessResponse(w, "OTP code sent successfully", nil)
 
 }
@@ -454,46 +659,70 @@ func (h *UserHandler) VerifyOtpCode(w http.ResponseWriter, r *http.Request) {
 
 	h.validatorHelper.ValidateStruct(w, &data)
 
-	err = h.authHelper.ValidateOtpCode(data.PhoneNumber, data.Otp)
+	departmentId := helpers.GetDepartmentId(r)
+
+	if !h.checkLoginMethod(w, departmentId, models.OtpLogin) {
+		return
+	}
+
+	err = h.authHelper.ValidateOtpCode(departmentId, data.PhoneNumber, data.Otp)
 
 	if err != nil {
+		h.auditHelper.Failure(r, models.OtpVerified, "", err.Error())
 		h.responseHelper.SendErrorResponse(w, "Error verifying OTP code", constants.InternalServerError, err)
+		return
 	}
 
-	user, err = h.userRepo.FindByPhoneNumber(data.PhoneNumber)
-	departmentId := helpers.GetDepartmentId(r)
+	user, err = h.userRepo.FindByPhoneNumberInDepartment(departmentId, data.PhoneNumber)
+
+	if err == nil {
+		if err := h.authHelper.CheckLoginAllowed(user, departmentId); err != nil {
+			h.recordLoginFailed(r, user.ID, err.Error())
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+			return
+		}
+
+		if !h.checkQuota(w, h.usageHelper.CheckLoginQuota(departmentId, user.ID)) {
+			return
+		}
+	}
 
 	if err != nil {
 		h.log.Info().Str("phoneNumber", data.PhoneNumber).Msg("User does not exist")
 
-		userId := uuid.New().String()
+		if !h.checkSignupOpen(w, departmentId) || !h.checkQuota(w, h.usageHelper.CheckUserQuota(departmentId)) {
+			return
+		}
 
-		user = &models.UserModel{
-			ID:          userId,
-			PhoneNumber: data.PhoneNumber,
+		if !h.checkQuota(w, h.usageHelper.CheckLoginQuota(departmentId, "")) {
+			return
 		}
 
-		err = h.userRepo.Create(user)
+		userId := uuid.New().String()
 
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error creating user", constants.InternalServerError, err)
+		user = &models.UserModel{
+			ID:           userId,
+			DepartmentID: departmentId,
+			PhoneNumber:  data.PhoneNumber,
 		}
 
 		user_role := models.DepartmentRoles{
-			ID:     departmentId,
-			Role:   models.User,
-			UserID: userId,
+			DepartmentID: departmentId,
+			Role:         models.User,
+			UserID:       userId,
 		}
 
-		err = h.departmentRoleRepo.Create(&user_role)
+		err = h.userRepo.CreateWithRole(user, &user_role)
 
 		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error creating user role", constants.InternalServerError, err)
+			h.responseHelper.SendErrorResponse(w, "Error creating user", constants.InternalServerError, err)
+			return
 		}
 
+		h.recordRegistered(r, userId)
 	}
 
-	access_token, err := h.authHelper.GenerateAccessJwtToken(user, departmentId)
+	access_token, err := h.issueAccessToken(user, departmentId)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error generating access token")
@@ -507,53 +736,63 @@ func (h *UserHandler) VerifyOtpCode(w http.ResponseWriter, r *http.Request) {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, err)
 	}
 
-	h.authHelper.GenerateAccessCookie(access_token, w)
+	h.authHelper.GenerateAccessCookie(access_token, departmentId, w)
 
 	w.Header().Set(constants.JwtHeader, refresh_token)
 
+	h.usageHelper.RecordLogin(departmentId, user.ID)
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.OtpVerified, ActorID: user.ID, TargetID: user.ID})
+	h.recordLogin(r, user.ID, models.OtpLogin)
+
 	h.responseHelper.SendSuccessResponse(w, "OTP code verified successfully", nil)
 
 }
 
+// RefreshAccessTokenHandler issues a new access token for the refresh token
+// in the x-jwt-token header. The access token isn't needed, it may have
+// expired already.
 func (h *UserHandler) RefreshAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var accessToken string
-	cookies := r.Cookies()
+	refreshToken := r.Header.Get(constants.JwtHeader)
 
-	for _, cookie := range cookies {
-		if cookie.Name == "access-token" {
-			accessToken = cookie.Value
-		}
-
-		if accessToken == "" {
-			h.responseHelper.SendErrorResponse(w, "Access token is empty", constants.BadRequest, nil)
-		}
+	if refreshToken == "" {
+		h.responseHelper.SendErrorResponse(w, constants.RefreshTokenMissingError, constants.Unauthorized, nil)
+		return
+	}
 
-		claims, err := h.authHelper.ParseAccessJwtToken(accessToken)
+	// tokens issued for another department than the tenant credentials are
+	// rejected, and so are expired ones
+	claims, err := h.authHelper.ParseRefreshJwtToken(refreshToken, helpers.GetDepartmentId(r))
 
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error parsing access token", constants.InternalServerError, err)
-		}
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.RefreshTokenInvalidError, constants.Unauthorized, err)
+		return
+	}
 
-		userId := claims["userId"].(string)
-		departmentId := claims["departmentId"].(string)
+	departmentId := claims.DepartmentID
 
-		user, err := h.userRepo.FindById(userId)
+	// members removed from the department can't refresh
+	user, err := h.userRepo.FindByIdInDepartment(departmentId, claims.UserID)
 
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error finding user", constants.InternalServerError, err)
-		}
-
-		access_token, err := h.authHelper.GenerateAccessJwtToken(user, departmentId)
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.RefreshTokenInvalidError, constants.Unauthorized, err)
+		return
+	}
 
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error generating access token", constants.InternalServerError, err)
-		}
+	if err := h.authHelper.CheckLoginAllowed(user, departmentId); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+		return
+	}
 
-		h.authHelper.GenerateAccessCookie(access_token, w)
+	access_token, err := h.issueAccessToken(user, departmentId)
 
-		h.responseHelper.SendSuccessResponse(w, "Access token refreshed successfully", nil)
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error generating access token", constants.InternalServerError, err)
+		return
 	}
 
+	h.authHelper.GenerateAccessCookie(access_token, departmentId, w)
+
+	h.responseHelper.SendSuccessResponse(w, "Access token refreshed successfully", nil)
 }
 
 func (h *UserHandler) SendMagicLinkEmail(w http.ResponseWriter, r *http.Request) {
@@ -568,37 +807,63 @@ func (h *UserHandler) SendMagicLinkEmail(w http.ResponseWriter, r *http.Request)
 
 	h.validatorHelper.ValidateStruct(w, &data)
 
-	user, err = h.userRepo.FindByEmail(data.Email)
 	departmentId := helpers.GetDepartmentId(r)
 
+	if !h.checkLoginMethod(w, departmentId, models.MagicLinkLogin) {
+		return
+	}
+
+	if data.RedirectUrl != "" {
+		if err := h.authHelper.CheckRedirectUrl(departmentId, data.RedirectUrl); err != nil {
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+			return
+		}
+	}
+
+	if !h.checkQuota(w, h.usageHelper.CheckQuota(departmentId, models.EmailUsage)) {
+		return
+	}
+
+	settings, err := h.authHelper.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	user, err = h.userRepo.FindByEmailInDepartment(departmentId, data.Email)
+
 	if err != nil {
 		h.log.Info().Str("email", data.Email).Msg("User does not exist")
 
+		if !h.checkSignupOpen(w, departmentId) || !h.checkQuota(w, h.usageHelper.CheckUserQuota(departmentId)) {
+			return
+		}
+
 		userId := uuid.New().String()
 
 		user = &models.UserModel{
-			ID:    userId,
-			Email: data.Email,
-		}
+			ID:           userId,
+			DepartmentID: departmentId,
+			Email:        data.Email,
 
-		err = h.userRepo.Create(user)
-
-		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error creating user", constants.InternalServerError, err)
+			VerificationExpiresAt: helpers.VerificationExpiry(),
 		}
 
 		user_role := models.DepartmentRoles{
-			ID:     departmentId,
-			Role:   models.User,
-			UserID: userId,
+			DepartmentID: departmentId,
+			Role:         models.User,
+			UserID:       userId,
 		}
 
-		err = h.departmentRoleRepo.Create(&user_role)
+		err = h.userRepo.CreateWithRole(user, &user_role)
 
 		if err != nil {
-			h.responseHelper.SendErrorResponse(w, "Error creating user role", constants.InternalServerError, err)
+			h.responseHelper.SendErrorResponse(w, "Error creating user", constants.InternalServerError, err)
+			return
 		}
 
+		h.recordRegistered(r, userId)
 	}
 
 	token := h.authHelper.GenerateAuthToken()
@@ -606,7 +871,7 @@ func (h *UserHandler) SendMagicLinkEmail(w http.ResponseWriter, r *http.Request)
 	tmp := models.AuthModel{
 		UserID: user.ID,
 		Token:  token,
-		Type: models.MagicLink,
+		Type:   models.MagicLink,
 	}
 
 	err = h.authRepo.Create(&tmp)
@@ -615,17 +880,26 @@ func (h *UserHandler) SendMagicLinkEmail(w http.ResponseWriter, r *http.Request)
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, err)
 	}
 
+	link := fmt.Sprintf("%s?token=%s", r.URL, token)
+
+	if data.RedirectUrl != "" {
+		link = fmt.Sprintf("%s&redirect=%s", link, url.QueryEscape(data.RedirectUrl))
+	}
+
 	tmpl_data := models.MagicEmailData{
 		Name: user.Name,
-		Url:  fmt.Sprintf("%s?token=%s", r.URL, token),
+		Url:  link,
 	}
 
-	err = h.emailHelper.SendEmail(data.Email, "magic-link", tmpl_data)
+	err = h.emailHelper.SendDepartmentEmail(settings, data.Email, "magic-link", tmpl_data)
 
 	if err != nil {
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, err)
+		return
 	}
 
+	h.usageHelper.Record(departmentId, models.EmailUsage)
+
 	h.responseHelper.SendSuccessResponse(w, "magic link sent to", nil)
 }
 
@@ -641,17 +915,187 @@ func (h *UserHandler) VerifyMagicLinkEmail(w http.ResponseWriter, r *http.Reques
 	record, err := h.authRepo.FindByTokenAndType(token, models.MagicLink)
 
 	if err != nil {
+		h.recordLoginFailed(r, "", "Invalid magic link")
 		h.responseHelper.SendErrorResponse(w, err.Error(), constants.InternalServerError, nil)
+		return
 	}
 
 	if token == record.Token {
-		user, err := h.userRepo.FindById(record.UserID)
+		departmentId := helpers.GetDepartmentId(r)
+
+		user, err := h.userRepo.FindByIdInDepartment(departmentId, record.UserID)
 
 		if err != nil {
 			err_message := fmt.Sprintf(constants.EntityNotFound, "User ", "id:", record.UserID)
 			h.responseHelper.SendErrorResponse(w, err_message, constants.BadRequest, err)
+			return
+		}
+
+		if !h.checkLoginMethod(w, departmentId, models.MagicLinkLogin) {
+			return
+		}
+
+		// the redirect isn't part of the token, check it again in case the link was altered
+		redirect := params.Get("redirect")
+
+		if redirect != "" {
+			if err := h.authHelper.CheckRedirectUrl(departmentId, redirect); err != nil {
+				h.responseHelper.SendErrorResponse(w, err.Error(), constants.BadRequest, err)
+				return
+			}
+		}
+
+		if err := h.authHelper.CheckLoginAllowed(user, departmentId); err != nil {
+			h.recordLoginFailed(r, user.ID, err.Error())
+			h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+			return
+		}
+
+		if !h.checkQuota(w, h.usageHelper.CheckLoginQuota(departmentId, user.ID)) {
+			return
+		}
+
+		// following the link proves ownership of the address
+		if !user.EmailVerified {
+			user.EmailVerified = true
+			user.VerificationExpiresAt = nil
+
+			if err := h.userRepo.Save(user); err != nil {
+				h.responseHelper.SendErrorResponse(w, "Error verifying email", constants.InternalServerError, err)
+				return
+			}
+		}
+
+		access_token, err := h.issueAccessToken(user, departmentId)
+
+		if err != nil {
+			h.responseHelper.SendErrorResponse(w, "Error generating access token", constants.InternalServerError, err)
+			return
+		}
+
+		h.authHelper.GenerateAccessCookie(access_token, departmentId, w)
+
+		h.usageHelper.RecordLogin(departmentId, user.ID)
+		h.recordLogin(r, user.ID, models.MagicLinkLogin)
+
+		if redirect != "" {
+			http.Redirect(w, r, redirect, http.StatusFound)
+			return
 		}
 
+		h.responseHelper.SendSuccessResponse(w, "Magic link verified successfully", nil)
+	}
+
+}
+
+// recordLogin adds a successful login with the method to the audit log. The
+// user isn't authenticated yet, so they are named as the actor.
+func (h *UserHandler) recordLogin(r *http.Request, userId string, method models.LoginMethod) {
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.UserLogin, ActorID: userId, TargetID: userId, Details: string(method)})
+}
+
+// recordLoginFailed adds a failed login to the audit log, userId is empty
+// when no user was found.
+func (h *UserHandler) recordLoginFailed(r *http.Request, userId string, reason string) {
+	h.auditHelper.Record(r, &models.AuditEventModel{
+		Action:   models.UserLogin,
+		Outcome:  models.AuditFailure,
+		ActorID:  userId,
+		TargetID: userId,
+		Details:  reason,
+	})
+}
+
+func (h *UserHandler) recordRegistered(r *http.Request, userId string) {
+	h.auditHelper.Record(r, &models.AuditEventModel{Action: models.UserRegistered, ActorID: userId, TargetID: userId})
+}
+
+// checkLoginMethod sends a forbidden response if the department has disabled the login method.
+func (h *UserHandler) checkLoginMethod(w http.ResponseWriter, departmentId string, method models.LoginMethod) bool {
+	if err := h.authHelper.CheckLoginMethod(departmentId, method); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+		return false
+	}
+
+	return true
+}
+
+// checkSignupOpen sends a forbidden response if users can't create accounts in the department.
+func (h *UserHandler) checkSignupOpen(w http.ResponseWriter, departmentId string) bool {
+	if err := h.authHelper.CheckSignupOpen(departmentId); err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.Forbidden, err)
+		return false
+	}
+
+	return true
+}
+
+// checkQuota sends a quota exceeded response if the quota check failed.
+func (h *UserHandler) checkQuota(w http.ResponseWriter, err error) bool {
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, err.Error(), constants.QuotaExceeded, err)
+		return false
+	}
+
+	return true
+}
+
+func (h *UserHandler) markEmailVerified(w http.ResponseWriter, user *models.UserModel) {
+	if user.EmailVerified {
+		h.responseHelper.SendSuccessResponse(w, "Email already verified", nil)
+		return
+	}
+
+	user.EmailVerified = true
+	user.VerificationExpiresAt = nil
+
+	err := h.userRepo.Save(user)
+
+	if err != nil {
+		h.responseHelper.SendErrorResponse(w, "Error verifying email", constants.InternalServerError, err)
+		return
+	}
+
+	h.responseHelper.SendSuccessResponse(w, "Email verified successfully", nil)
+}
+
+// upgradePasswordHash re-hashes an imported password with the current
+// algorithm after a successful login. Failures are logged and not surfaced,
+// the user can still log in with the imported hash.
+func (h *UserHandler) upgradePasswordHash(user *models.UserModel, password string) {
+	password_hash, err := h.authHelper.HashPassword(password)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("userId", user.ID).Msg("Error upgrading password hash")
+		return
+	}
+
+	previous := user.PasswordAlgorithm
+	user.Password = password_hash
+	user.PasswordAlgorithm = models.Bcrypt
+
+	if err := h.userRepo.Save(user); err != nil {
+		h.log.Error().Err(err).Str("userId", user.ID).Msg("Error upgrading password hash")
+		return
+	}
+
+	h.log.Info().Str("userId", user.ID).Str("from", string(previous)).Msg("Upgraded password hash")
+}
+
+// issueAccessToken issues an access token with the scopes the member's roles
+// grant in the department.
+func (h *UserHandler) issueAccessToken(user *models.UserModel, departmentId string) (string, error) {
+	membership, err := h.departmentRoleRepo.FindById(departmentId, user.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	scopes, err := h.roleHelper.MemberScopes(departmentId, user.ID, membership.Role)
+
+	if err != nil {
+		return "", err
 	}
 
+	return h.authHelper.GenerateAccessJwtToken(user, departmentId, scopes)
 }
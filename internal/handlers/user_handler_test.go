@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	refreshDepartment = "refresh-department"
+	refreshUserId     = "refresh-user"
+	expiredUserId     = "expired-user"
+	removedUserId     = "removed-user"
+	unverifiedUserId  = "unverified-user"
+	expiredRefresh    = "expired-refresh-department"
+)
+
+type refreshFixture struct {
+	router     *mux.Router
+	authHelper *helpers.AuthHelper
+	tenantId   string
+}
+
+// newRefreshFixture serves the refresh and forgot password endpoints without the RBAC middleware,
+// as in main.go, so no access token is sent. removedUserId is no longer a member, expiredRefresh issues
+// refresh tokens that are already expired.
+func newRefreshFixture(t *testing.T) *refreshFixture {
+	t.Helper()
+
+	departmentRepo := &fakeDepartmentRepo{
+		departments: map[string]*models.DepartmentModel{
+			refreshDepartment: {ID: refreshDepartment},
+			expiredRefresh:    {ID: expiredRefresh},
+		},
+		settings: map[string]models.DepartmentSettings{
+			expiredRefresh: {RefreshTokenTtlHours: -1},
+		},
+	}
+
+	departmentRoleRepo := &fakeDepartmentRoleRepo{roles: []models.DepartmentRoles{
+		{DepartmentID: refreshDepartment, UserID: refreshUserId, Role: models.User},
+		{DepartmentID: expiredRefresh, UserID: expiredUserId, Role: models.User},
+	}}
+
+	userRepo := &fakeUserRepo{departmentRoleRepo: departmentRoleRepo, users: map[string]*models.UserModel{
+		refreshUserId:    {ID: refreshUserId, DepartmentID: refreshDepartment},
+		expiredUserId:    {ID: expiredUserId, DepartmentID: expiredRefresh},
+		removedUserId:    {ID: removedUserId, DepartmentID: refreshDepartment},
+		unverifiedUserId: {ID: unverifiedUserId, DepartmentID: refreshDepartment, Email: "unverified@example.com"},
+	}}
+
+	redisHelper := unreachableRedis()
+	authHelper := helpers.NewAuthHelper(&testLog, departmentRepo, *redisHelper)
+	responseHelper := helpers.NewResponseHelper(&testLog)
+
+	handler := NewUserHandler(
+		userRepo,
+		nil,
+		departmentRoleRepo,
+		departmentRepo,
+		&testLog,
+		authHelper,
+		responseHelper,
+		helpers.NewValidatorHelper(&testLog, responseHelper),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		helpers.NewRoleHelper(&testLog, nil, departmentRepo, &fakeGroupRepo{}, redisHelper),
+		helpers.NewAuditHelper(&testLog, &fakeAuditRepo{}),
+	)
+
+	f := &refreshFixture{authHelper: authHelper}
+
+	// stands in for the tenant credentials the trace middleware reads
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if f.tenantId != "" {
+				r = helpers.SetDepartmentId(r, f.tenantId)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.HandleFunc(constants.RefreshTokenEndpoint, handler.RefreshAccessTokenHandler).Methods(http.MethodPost)
+	router.HandleFunc(constants.CredentialsForgotEndpoint, handler.CredentialsForgotPasswordHandler).Methods(http.MethodPost)
+
+	f.router = router
+	return f
+}
+
+func (f *refreshFixture) refreshToken(t *testing.T, departmentId string, userId string) string {
+	t.Helper()
+
+	token, err := f.authHelper.GenerateRefreshJwtToken(&models.UserModel{ID: userId}, departmentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (f *refreshFixture) refresh(refreshToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, constants.RefreshTokenEndpoint, nil)
+
+	if refreshToken != "" {
+		req.Header.Set(constants.JwtHeader, refreshToken)
+	}
+
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// issuedClaims parses the access token of the cookie the response set.
+func (f *refreshFixture) issuedClaims(t *testing.T, rec *httptest.ResponseRecorder) *helpers.AccessClaims {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	token, err := f.authHelper.AccessToken(req)
+	if err != nil {
+		t.Fatalf("no access token cookie: %v", err)
+	}
+
+	claims, err := f.authHelper.ParseAccessJwtToken(token, refreshDepartment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestRefreshIssuesAccessTokenForRefreshToken(t *testing.T) {
+	f := newRefreshFixture(t)
+
+	rec := f.refresh(f.refreshToken(t, refreshDepartment, refreshUserId))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	claims := f.issuedClaims(t, rec)
+
+	if claims.UserID != refreshUserId || claims.DepartmentID != refreshDepartment {
+		t.Fatalf("claims = %+v, want the refresh token's user and department", claims)
+	}
+
+	if claims.Scope != string(models.ProfileScope) {
+		t.Fatalf("scope = %q, want %q", claims.Scope, models.ProfileScope)
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	f := newRefreshFixture(t)
+
+	accessToken, err := f.authHelper.GenerateAccessJwtToken(&models.UserModel{ID: refreshUserId}, refreshDepartment, []models.Scope{models.ProfileScope})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing", ""},
+		{"access token", accessToken},
+		{"expired", f.refreshToken(t, expiredRefresh, expiredUserId)},
+		{"removed member", f.refreshToken(t, refreshDepartment, removedUserId)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.refresh(tt.token)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+
+			if len(rec.Result().Cookies()) != 0 {
+				t.Fatal("an access token cookie was set")
+			}
+		})
+	}
+}
+
+func TestRefreshRejectsTokenOfOtherTenant(t *testing.T) {
+	f := newRefreshFixture(t)
+	f.tenantId = expiredRefresh
+
+	if rec := f.refresh(f.refreshToken(t, refreshDepartment, refreshUserId)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+// The fixture has no auth repository, usage or email helper, so a branch
+// that carried on after its error response would panic.
+func TestForgotPasswordStopsAtTheFirstError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "invalid json", body: `{`, want: http.StatusBadRequest},
+		{name: "invalid email", body: `{"email": "nope"}`, want: http.StatusBadRequest},
+		{name: "unknown email", body: `{"email": "unknown@example.com"}`, want: http.StatusNotFound},
+		{name: "unverified email", body: `{"email": "unverified@example.com"}`, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRefreshFixture(t)
+			f.tenantId = refreshDepartment
+
+			req := httptest.NewRequest(http.MethodPost, constants.CredentialsForgotEndpoint, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			f.router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			decoder := json.NewDecoder(rec.Body)
+			var body map[string]interface{}
+
+			if err := decoder.Decode(&body); err != nil || decoder.More() {
+				t.Fatalf("body = %s, want one error response", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+)
+
+// AuditHelper appends security relevant actions to the department's audit
+// log. The actions have already happened, so storage errors are logged and
+// the request goes ahead.
+type AuditHelper struct {
+	log       *zerolog.Logger
+	auditRepo repository.AuditRepository
+}
+
+// ErasedUser is a user erased while serving a request, events recorded later
+// in the request carry their pseudonym instead of their id.
+type ErasedUser struct {
+	ID        string
+	Pseudonym string
+}
+
+func NewAuditHelper(log *zerolog.Logger, auditRepo repository.AuditRepository) *AuditHelper {
+	return &AuditHelper{log: log, auditRepo: auditRepo}
+}
+
+// Record appends the event. The department, actor, client address, user
+// agent and request id are taken from the request unless the event has them.
+// The request id comes from the client's trace header and is cut to fit like
+// the user agent.
+func (h *AuditHelper) Record(r *http.Request, event *models.AuditEventModel) {
+	if event.DepartmentID == "" {
+		event.DepartmentID = GetDepartmentId(r)
+	}
+
+	if event.ActorID == "" {
+		event.ActorID = GetUserId(r)
+	}
+
+	if event.ActorID == "" {
+		event.ActorID = GetPlatformActor(r)
+	}
+
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+
+	event.ID = 0
+	event.IP = ClientIp(r)
+	event.UserAgent = truncate(r.UserAgent(), constants.AuditUserAgentLength)
+	event.Details = truncate(event.Details, constants.AuditDetailsLength)
+	event.ActorID = truncate(event.ActorID, constants.AuditIdLength)
+	event.TargetID = truncate(event.TargetID, constants.AuditIdLength)
+	event.RequestID = truncate(GetRequestId(r), constants.AuditRequestIdLength)
+
+	if erased := GetErasedUser(r); erased != nil && erased.ID != "" {
+		forgetErasedUser(event, erased)
+	}
+
+	// events without a department, e.g. logins without tenant credentials,
+	// have no audit log to go to
+	if event.DepartmentID == "" {
+		return
+	}
+
+	if err := h.auditRepo.Create(event); err != nil {
+		h.log.Error().Err(err).Str("departmentId", event.DepartmentID).Str("action", string(event.Action)).Msg("Error recording audit event")
+	}
+}
+
+// MarkErased reports the user the request erased, see SetErasedUser.
+func MarkErased(r *http.Request, userId string, pseudonym string) {
+	if erased := GetErasedUser(r); erased != nil {
+		erased.ID = userId
+		erased.Pseudonym = pseudonym
+	}
+}
+
+// forgetErasedUser replaces the erased user in the event with their
+// pseudonym, like the erasure does for the stored events. The address and
+// user agent are theirs when they are the actor and are dropped.
+func forgetErasedUser(event *models.AuditEventModel, erased *ErasedUser) {
+	if event.ActorID == erased.ID {
+		event.ActorID = erased.Pseudonym
+		event.IP = ""
+		event.UserAgent = ""
+	}
+
+	if event.TargetID == erased.ID {
+		event.TargetID = erased.Pseudonym
+	}
+}
+
+// Success records that the actor performed the action on the target.
+func (h *AuditHelper) Success(r *http.Request, action models.AuditAction, targetId string) {
+	h.Record(r, &models.AuditEventModel{Action: action, TargetID: targetId})
+}
+
+// Failure records that the action on the target was attempted and failed.
+func (h *AuditHelper) Failure(r *http.Request, action models.AuditAction, targetId string, details string) {
+	h.Record(r, &models.AuditEventModel{Action: action, Outcome: models.AuditFailure, TargetID: targetId, Details: details})
+}
+
+// ClientIp is the address the request came from, without the port.
+func ClientIp(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// truncate cuts the value to at most length bytes without splitting a rune.
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+
+	cut := value[:length]
+	for !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return cut
+}
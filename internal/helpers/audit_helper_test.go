@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRecordTruncatesClientValues(t *testing.T) {
+	log := zerolog.Nop()
+	auditRepo := &fakeAuditRepo{}
+	auditHelper := NewAuditHelper(&log, auditRepo)
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r = SetDepartmentId(r, "department")
+	r = SetRequestId(r, strings.Repeat("r", 500))
+
+	auditHelper.Record(r, &models.AuditEventModel{Action: models.AdminRequest, TargetID: strings.Repeat("t", 500)})
+
+	event := auditRepo.events[0]
+
+	if len(event.RequestID) != constants.AuditRequestIdLength {
+		t.Fatalf("request id length = %d, want %d", len(event.RequestID), constants.AuditRequestIdLength)
+	}
+
+	if len(event.TargetID) != constants.AuditIdLength {
+		t.Fatalf("target id length = %d, want %d", len(event.TargetID), constants.AuditIdLength)
+	}
+}
+
+func TestRecordLeavesOutErasedUser(t *testing.T) {
+	log := zerolog.Nop()
+	auditRepo := &fakeAuditRepo{}
+	auditHelper := NewAuditHelper(&log, auditRepo)
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("User-Agent", "browser")
+	r = SetDepartmentId(r, "department")
+	r = SetUserId(r, "erased")
+	r = SetErasedUser(r)
+
+	MarkErased(r, "erased", "pseudonym")
+
+	auditHelper.Record(r, &models.AuditEventModel{Action: models.AdminRequest})
+	auditHelper.Record(r, &models.AuditEventModel{Action: models.AdminRequest, ActorID: "admin", TargetID: "erased"})
+
+	self, admin := auditRepo.events[0], auditRepo.events[1]
+
+	if self.ActorID != "pseudonym" || self.IP != "" || self.UserAgent != "" {
+		t.Fatalf("self erasure event = %+v, want the pseudonym without address or user agent", self)
+	}
+
+	if admin.ActorID != "admin" || admin.TargetID != "pseudonym" || admin.IP == "" {
+		t.Fatalf("admin erasure event = %+v, want the admin acting on the pseudonym", admin)
+	}
+}
@@ -1,15 +1,23 @@
 package helpers
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/models"
 	repository "uas/internal/repositories"
 
 	"github.com/google/uuid"
@@ -22,10 +30,11 @@ type AuthHelper struct {
 	log            *zerolog.Logger
 	departmentRepo repository.DepartmentRepository
 	redisHelper    RedisHelper
+	signingKeys    *sync.Map
 }
 
 func NewAuthHelper(log *zerolog.Logger, departmentRepo repository.DepartmentRepository, redisHelper RedisHelper) *AuthHelper {
-	return &AuthHelper{log: log, departmentRepo: departmentRepo, redisHelper: redisHelper}
+	return &AuthHelper{log: log, departmentRepo: departmentRepo, redisHelper: redisHelper, signingKeys: &sync.Map{}}
 }
 
 func (h *AuthHelper) GenerateBasicAuthToken(tenantId string, tenantSecret string) string {
@@ -33,19 +42,21 @@ func (h *AuthHelper) GenerateBasicAuthToken(tenantId string, tenantSecret string
 	return base64.StdEncoding.EncodeToString([]byte(tenantId + ":" + tenantSecret))
 }
 
-func (h *AuthHelper) ValidateBasicAuthToken(token string) (string, error) {
+// ValidateBasicAuthToken returns the tenant of the token and which of its
+// secrets the token carries.
+func (h *AuthHelper) ValidateBasicAuthToken(token string) (string, models.TenantCredential, error) {
 	h.log.Debug().Msgf("Validating token: %s", token)
 
 	data, err := base64.StdEncoding.DecodeString(token)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error decoding token")
-		return "", err
+		return "", "", err
 	}
 
 	parts := strings.Split(string(data), ":")
 	if len(parts) < 2 {
-		return "", errors.New("invalid token format")
+		return "", "", errors.New("invalid token format")
 	}
 
 	tenantId := parts[0]
@@ -54,16 +65,67 @@ func (h *AuthHelper) ValidateBasicAuthToken(token string) (string, error) {
 	tenant, err := h.departmentRepo.FindById(tenantId)
 
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	// during a rotation both the new and the previous secret are accepted
+	credential := models.TenantCredentialCurrent
+
+	if !h.CheckPasswordHash(tenantSecret, tenant.Secret) {
+		if !tenant.PreviousSecretActive() || !h.CheckPasswordHash(tenantSecret, tenant.PreviousSecret) {
+			return "", "", errors.New(constants.TenantCredentialsError)
+		}
+
+		credential = models.TenantCredentialPrevious
+	}
+
+	h.recordCredentialUse(tenant, credential)
+
+	return tenantId, credential, nil
+}
+
+// recordCredentialUse keeps track of which secret the tenant authenticates
+// with. Repeated use of the same secret is only written once per window to
+// keep a write off every request.
+func (h *AuthHelper) recordCredentialUse(tenant *models.DepartmentModel, credential models.TenantCredential) {
+	now := time.Now()
+
+	if tenant.LastUsedCredential == credential && tenant.LastUsedAt != nil && now.Sub(*tenant.LastUsedAt) < constants.CredentialUseWindow {
+		return
+	}
+
+	if err := h.departmentRepo.RecordCredentialUse(tenant.ID, credential, now); err != nil {
+		h.log.Error().Err(err).Str("departmentId", tenant.ID).Msg("Error recording tenant credential use")
+	}
+}
+
+// CheckLoginAllowed returns an error when the user may not log in to the
+// department, because the account is disabled or either the account or the
+// department is deactivated.
+func (h *AuthHelper) CheckLoginAllowed(user *models.UserModel, departmentId string) error {
+	if user.Disabled {
+		return errors.New(constants.AccountDisabledError)
+	}
+
+	if user.DeactivatedAt != nil {
+		return errors.New(constants.AccountDeactivatedError)
 	}
 
-	valid := h.CheckPasswordHash(tenantSecret, tenant.Secret)
+	if departmentId == "" {
+		return nil
+	}
+
+	department, err := h.departmentRepo.FindById(departmentId)
+
+	if err != nil {
+		return err
+	}
 
-	if valid {
-		return tenantId, nil
+	if department.DeactivatedAt != nil {
+		return errors.New(constants.TenantDeactivatedError)
 	}
 
-	return "", err
+	return nil
 }
 
 func (h *AuthHelper) HashPassword(password string) (string, error) {
@@ -89,13 +151,22 @@ func (h *AuthHelper) GenerateAuthToken() string {
 	return h.GenerateBasicAuthToken(a, b)
 }
 
-func (h *AuthHelper) GenerateOtpCode(target string) (string, error) {
-	otp_code := strconv.Itoa(rand.Intn(9000) + 1000)
+// GenerateOtpCode stores a new OTP code for the target, its length and
+// expiry come from the department's settings.
+func (h *AuthHelper) GenerateOtpCode(departmentId string, target string) (string, error) {
+	settings, err := h.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		return "", err
+	}
+
+	low := int(math.Pow10(settings.OtpLength - 1))
+	otp_code := strconv.Itoa(rand.Intn(9*low) + low)
 
-	key := fmt.Sprintf("otp:%s", target)
-	dur := time.Duration(config.AppConfig.OtpExpire) * time.Minute
+	key := fmt.Sprintf(constants.OtpRedisKey, departmentId, target)
+	dur := time.Duration(settings.OtpExpireMinutes) * time.Minute
 
-	err := h.redisHelper.SetData(key, otp_code, dur)
+	err = h.redisHelper.SetData(key, otp_code, dur)
 
 	if err != nil {
 		h.log.Error().Err(err).Msg("Error generating OTP code")
@@ -105,8 +176,10 @@ func (h *AuthHelper) GenerateOtpCode(target string) (string, error) {
 	return otp_code, nil
 }
 
-func (h *AuthHelper) ValidateOtpCode(target string, otpCode string) error {
-	key := fmt.Sprintf("otp:%s", target)
+// ValidateOtpCode checks a code generated for the target in the department,
+// codes don't carry over to other departments.
+func (h *AuthHelper) ValidateOtpCode(departmentId string, target string, otpCode string) error {
+	key := fmt.Sprintf(constants.OtpRedisKey, departmentId, target)
 
 	code, err := h.redisHelper.GetData(key)
 
@@ -126,20 +199,233 @@ func (h *AuthHelper) ValidateOtpCode(target string, otpCode string) error {
 	return nil
 }
 
-func (h *AuthHelper) GenerateAccessCookie(access_token string, w http.ResponseWriter) {
-	cookieHashKey := []byte(config.AppConfig.CookieHashKey)
-	cookieBlockKey := []byte(config.AppConfig.CookieBlockKey)
+func (h *AuthHelper) GenerateAccessCookie(access_token string, departmentId string, w http.ResponseWriter) {
+	if encoded, err := accessCookieCodec().Encode(constants.AccessTokenCookie, access_token); err == nil {
+		http.SetCookie(w, h.accessCookie(departmentId, encoded, 0))
+	}
+}
 
-	var s = securecookie.New(cookieHashKey, cookieBlockKey)
+// AccessToken returns the access token of the request, sent as a bearer token
+// or in the access token cookie. Bearer values that aren't JWTs are tenant
+// credentials, the cookie is checked then.
+func (h *AuthHelper) AccessToken(r *http.Request) (string, error) {
+	if token, found := strings.CutPrefix(r.Header.Get(constants.AuthorizationHeader), "Bearer "); found && IsJwt(token) {
+		return token, nil
+	}
 
-	if encoded, err := s.Encode("access-token", access_token); err == nil {
-		cookie := &http.Cookie{
-			Name:     "access-token",
-			Value:    encoded,
-			Path:     "/",
-			Secure:   true,
-			HttpOnly: true,
-		}
-		http.SetCookie(w, cookie)
+	cookie, err := r.Cookie(constants.AccessTokenCookie)
+
+	if err != nil {
+		return "", errors.New(constants.AccessTokenMissingError)
+	}
+
+	var token string
+
+	if err := accessCookieCodec().Decode(constants.AccessTokenCookie, cookie.Value, &token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// IsJwt reports whether the value has the three parts of a JWT, tenant
+// credentials are plain base64 and have none.
+func IsJwt(value string) bool {
+	return strings.Count(value, ".") == 2
+}
+
+func accessCookieCodec() *securecookie.SecureCookie {
+	return securecookie.New([]byte(config.AppConfig.CookieHashKey), []byte(config.AppConfig.CookieBlockKey))
+}
+
+// ClearAccessCookie removes the access token cookie from the browser.
+func (h *AuthHelper) ClearAccessCookie(departmentId string, w http.ResponseWriter) {
+	http.SetCookie(w, h.accessCookie(departmentId, "", -1))
+}
+
+// accessCookie builds the access token cookie with the department's cookie
+// settings, a maxAge of 0 uses the configured one.
+func (h *AuthHelper) accessCookie(departmentId string, value string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     constants.AccessTokenCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	settings, err := h.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		return cookie
+	}
+
+	cookie.Domain = settings.Cookie.Domain
+
+	switch settings.Cookie.SameSite {
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+
+	if maxAge == 0 {
+		cookie.MaxAge = settings.Cookie.MaxAgeSeconds
+	}
+
+	return cookie
+}
+
+// Pseudonymize derives a stable, non-reversible reference for a user id so
+// records that must outlive the user can still be correlated.
+func (h *AuthHelper) Pseudonymize(value string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.PseudonymSecret))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSignedToken signs the values and an expiry into a URL safe token
+// so links don't have to be stored. The purpose is part of the signature,
+// a token issued for one flow is rejected by every other.
+func (h *AuthHelper) GenerateSignedToken(purpose string, expires time.Time, values ...string) string {
+	data, _ := json.Marshal(signedTokenPayload{Purpose: purpose, Values: values, Expires: expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + signTokenPayload(payload)
+}
+
+// ValidateSignedToken checks the signature, purpose and expiry of a token
+// and returns the values it was issued for.
+func (h *AuthHelper) ValidateSignedToken(purpose string, token string) ([]string, error) {
+	payload, signature, found := strings.Cut(token, ".")
+
+	if !found || !hmac.Equal([]byte(signature), []byte(signTokenPayload(payload))) {
+		return nil, errors.New(constants.TokenInvalidError)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+
+	if err != nil {
+		return nil, errors.New(constants.TokenInvalidError)
+	}
+
+	var claims signedTokenPayload
+
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Purpose != purpose {
+		return nil, errors.New(constants.TokenInvalidError)
+	}
+
+	if time.Now().Unix() > claims.Expires {
+		return nil, errors.New(constants.TokenExpiredError)
+	}
+
+	return claims.Values, nil
+}
+
+// GenerateVerificationToken issues the token for email verification links.
+// The email is part of the token, a link stops working once the address changes.
+func (h *AuthHelper) GenerateVerificationToken(userId string, email string) string {
+	expires := time.Now().Add(time.Duration(config.AppConfig.VerifyLinkExpire) * time.Hour)
+	return h.GenerateSignedToken(constants.VerifyEmailTokenPurpose, expires, userId, email)
+}
+
+// ValidateVerificationToken returns the user id and email a verification
+// token was issued for.
+func (h *AuthHelper) ValidateVerificationToken(token string) (string, string, error) {
+	values, err := h.ValidateSignedToken(constants.VerifyEmailTokenPurpose, token)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(values) != 2 {
+		return "", "", errors.New(constants.TokenInvalidError)
+	}
+
+	return values[0], values[1], nil
+}
+
+type signedTokenPayload struct {
+	Purpose string   `json:"p"`
+	Values  []string `json:"v"`
+	Expires int64    `json:"e"`
+}
+
+func signTokenPayload(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.LinkSigningSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateScimToken issues a SCIM bearer token for the department. Only the
+// hash of the secret is stored, the token itself is shown once.
+func (h *AuthHelper) GenerateScimToken(departmentId string) (string, string) {
+	secret := strings.ReplaceAll(uuid.New().String()+uuid.New().String(), "-", "")
+	return departmentId + "." + secret, hashScimSecret(secret)
+}
+
+// ValidateScimToken returns the department a SCIM bearer token belongs to.
+func (h *AuthHelper) ValidateScimToken(token string) (string, error) {
+	departmentId, secret, found := strings.Cut(token, ".")
+
+	if !found || departmentId == "" || secret == "" {
+		return "", errors.New(constants.TokenInvalidError)
+	}
+
+	config, err := h.departmentRepo.FindConfig(departmentId)
+
+	if err != nil {
+		return "", err
+	}
+
+	if config.ScimTokenHash == "" || !hmac.Equal([]byte(config.ScimTokenHash), []byte(hashScimSecret(secret))) {
+		return "", errors.New(constants.TokenInvalidError)
+	}
+
+	return departmentId, nil
+}
+
+func hashScimSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// GeneratePlatformToken issues a session token for a platform admin.
+func (h *AuthHelper) GeneratePlatformToken(adminId string) (string, time.Time) {
+	expires := time.Now().Add(time.Duration(config.AppConfig.PlatformSessionExpire) * time.Hour)
+	return h.GenerateSignedToken(constants.PlatformTokenPurpose, expires, adminId), expires
+}
+
+// ValidatePlatformToken returns the platform admin a session token was issued for.
+func (h *AuthHelper) ValidatePlatformToken(token string) (string, error) {
+	values, err := h.ValidateSignedToken(constants.PlatformTokenPurpose, token)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(values) != 1 {
+		return "", errors.New(constants.TokenInvalidError)
+	}
+
+	return values[0], nil
+}
+
+// NewPlatformAdmin builds a platform admin with a hashed password.
+func (h *AuthHelper) NewPlatformAdmin(email string, name string, password string, createdBy string) (*models.PlatformAdminModel, error) {
+	hash, err := h.HashPassword(password)
+
+	if err != nil {
+		return nil, err
 	}
+
+	return &models.PlatformAdminModel{
+		ID:        uuid.New().String(),
+		Email:     email,
+		Name:      name,
+		Password:  hash,
+		CreatedBy: createdBy,
+	}, nil
 }
@@ -0,0 +1,287 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// AuthzHelper decides whether members of a department may perform actions,
+// for services that delegate their authorization to us. Deny policies win
+// over everything, then the permissions of the subject's role and groups and
+// allow policies can grant the action.
+type AuthzHelper struct {
+	log                *zerolog.Logger
+	userRepo           repository.UserRepository
+	departmentRoleRepo repository.DepartmentRoleRepository
+	roleHelper         *RoleHelper
+}
+
+func NewAuthzHelper(
+	log *zerolog.Logger,
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	roleHelper *RoleHelper,
+) *AuthzHelper {
+	return &AuthzHelper{
+		log:                log,
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		roleHelper:         roleHelper,
+	}
+}
+
+// Check evaluates the request against the policies. Errors are storage
+// errors, a subject that can't be found is denied.
+func (h *AuthzHelper) Check(departmentId string, req *models.AuthzCheckRequest, policies []models.AuthzPolicyModel) (*models.AuthzDecision, error) {
+	explanation := &models.AuthzExplanation{
+		Permissions: []models.Permission{},
+		DryRun:      req.DryRun,
+		Policies:    []models.PolicyEvaluation{},
+	}
+
+	decide := func(allowed bool, reason string, policy string) *models.AuthzDecision {
+		decision := &models.AuthzDecision{Allowed: allowed, Reason: reason, Policy: policy}
+		if req.Explain {
+			decision.Explanation = explanation
+		}
+		return decision
+	}
+
+	user, err := h.userRepo.FindByIdInDepartment(departmentId, req.Subject)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decide(false, "subject is not a member of the department", ""), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled || user.DeactivatedAt != nil {
+		return decide(false, "subject is disabled or deactivated", ""), nil
+	}
+
+	membership, err := h.departmentRoleRepo.FindById(departmentId, req.Subject)
+
+	if err != nil {
+		return nil, err
+	}
+
+	explanation.Role = membership.Role
+
+	// a role deleted from under the member grants nothing
+	rolePermissions, err := h.roleHelper.Permissions(departmentId, membership.Role)
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	groupRoles, err := h.roleHelper.GroupRoles(departmentId, req.Subject)
+
+	if err != nil {
+		return nil, err
+	}
+
+	explanation.GroupRoles = groupRoles
+
+	permissions, err := h.roleHelper.EffectivePermissions(departmentId, req.Subject, membership.Role)
+
+	if err != nil {
+		return nil, err
+	}
+
+	explanation.Permissions = permissions
+	roles := append([]models.Role{membership.Role}, groupRoles...)
+
+	at := time.Now()
+	if req.Context.Time != nil {
+		at = *req.Context.Time
+	}
+
+	var allowedBy, deniedBy string
+
+	for i := range policies {
+		evaluation := evaluatePolicy(&policies[i], req, roles, at)
+		explanation.Policies = append(explanation.Policies, evaluation)
+
+		if !evaluation.Matched {
+			continue
+		}
+
+		if policies[i].Effect == models.PolicyDeny && deniedBy == "" {
+			deniedBy = policies[i].Name
+		}
+
+		if policies[i].Effect == models.PolicyAllow && allowedBy == "" {
+			allowedBy = policies[i].Name
+		}
+	}
+
+	switch {
+	case deniedBy != "":
+		return decide(false, fmt.Sprintf("denied by policy %s", deniedBy), deniedBy), nil
+	case slices.Contains(rolePermissions, models.Permission(req.Action)):
+		return decide(true, fmt.Sprintf("granted by role %s", membership.Role), ""), nil
+	case slices.Contains(permissions, models.Permission(req.Action)):
+		return decide(true, "granted by the roles of the subject's groups", ""), nil
+	case allowedBy != "":
+		return decide(true, fmt.Sprintf("allowed by policy %s", allowedBy), allowedBy), nil
+	}
+
+	return decide(false, fmt.Sprintf("no role or policy grants %s", req.Action), ""), nil
+}
+
+// PoliciesFromRequest builds the policies of a dry run.
+func PoliciesFromRequest(departmentId string, requests []models.PolicyRequest) []models.AuthzPolicyModel {
+	policies := make([]models.AuthzPolicyModel, 0, len(requests))
+
+	for _, req := range requests {
+		policies = append(policies, models.AuthzPolicyModel{
+			DepartmentID: departmentId,
+			Name:         req.Name,
+			Description:  req.Description,
+			Effect:       req.Effect,
+			Roles:        req.Roles,
+			Actions:      req.Actions,
+			Conditions:   req.Conditions,
+		})
+	}
+
+	return policies
+}
+
+func evaluatePolicy(policy *models.AuthzPolicyModel, req *models.AuthzCheckRequest, roles []models.Role, at time.Time) models.PolicyEvaluation {
+	evaluation := models.PolicyEvaluation{
+		Policy: policy.Name,
+		Effect: policy.Effect,
+	}
+
+	roleApplies := len(policy.Roles) == 0
+
+	for _, role := range roles {
+		roleApplies = roleApplies || matchesAny(policy.Roles, string(role))
+	}
+
+	evaluation.Applies = roleApplies && matchesAny(policy.Actions, req.Action)
+
+	if !evaluation.Applies {
+		return evaluation
+	}
+
+	evaluation.Matched = true
+	conditions := policy.Conditions
+
+	if conditions.Owner {
+		result := models.ConditionResult{Condition: "owner", Passed: req.Resource.Owner != "" && req.Resource.Owner == req.Subject}
+		result.Detail = fmt.Sprintf("resource owner %q, subject %q", req.Resource.Owner, req.Subject)
+		evaluation.Conditions = append(evaluation.Conditions, result)
+	}
+
+	if conditions.TimeOfDay != nil {
+		evaluation.Conditions = append(evaluation.Conditions, timeOfDayCondition(conditions.TimeOfDay, at))
+	}
+
+	if len(conditions.IpRanges) > 0 {
+		evaluation.Conditions = append(evaluation.Conditions, ipRangeCondition(conditions.IpRanges, req.Context.Ip))
+	}
+
+	for _, result := range evaluation.Conditions {
+		if !result.Passed {
+			evaluation.Matched = false
+		}
+	}
+
+	return evaluation
+}
+
+func timeOfDayCondition(window *models.TimeWindow, at time.Time) models.ConditionResult {
+	result := models.ConditionResult{Condition: "timeOfDay"}
+
+	location := time.UTC
+
+	if window.Timezone != "" {
+		loaded, err := time.LoadLocation(window.Timezone)
+
+		if err != nil {
+			result.Detail = fmt.Sprintf("unknown timezone %s", window.Timezone)
+			return result
+		}
+
+		location = loaded
+	}
+
+	from, fromErr := time.Parse(constants.TimeOfDayFormat, window.From)
+	to, toErr := time.Parse(constants.TimeOfDayFormat, window.To)
+
+	if fromErr != nil || toErr != nil {
+		result.Detail = "invalid time window"
+		return result
+	}
+
+	local := at.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+
+	if start <= end {
+		result.Passed = minute >= start && minute < end
+	} else {
+		result.Passed = minute >= start || minute < end
+	}
+
+	result.Detail = fmt.Sprintf("%s is within %s-%s", local.Format(constants.TimeOfDayFormat), window.From, window.To)
+
+	if !result.Passed {
+		result.Detail = fmt.Sprintf("%s is outside %s-%s", local.Format(constants.TimeOfDayFormat), window.From, window.To)
+	}
+
+	return result
+}
+
+func ipRangeCondition(ranges []string, ip string) models.ConditionResult {
+	result := models.ConditionResult{Condition: "ipRanges"}
+	parsed := net.ParseIP(ip)
+
+	if parsed == nil {
+		result.Detail = "no valid ip in the context"
+		return result
+	}
+
+	for _, cidr := range ranges {
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err == nil && network.Contains(parsed) {
+			result.Passed = true
+			result.Detail = fmt.Sprintf("%s is in %s", ip, cidr)
+			return result
+		}
+	}
+
+	result.Detail = fmt.Sprintf("%s is in none of %s", ip, strings.Join(ranges, ", "))
+	return result
+}
+
+// matchesAny reports whether the value equals one of the patterns, or starts
+// with a pattern's prefix when it ends in *.
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(value, prefix) {
+			return true
+		}
+
+		if pattern == value {
+			return true
+		}
+	}
+	return false
+}
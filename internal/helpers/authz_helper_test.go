@@ -0,0 +1,187 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+	"uas/internal/models"
+)
+
+// newTestAuthzHelper has alice, a user in the helpdesk group which grants
+// support, and bob, who is disabled.
+func newTestAuthzHelper() *AuthzHelper {
+	userRepo := &fakeUserRepo{users: []models.UserModel{
+		{ID: "alice", DepartmentID: testDepartment},
+		{ID: "bob", DepartmentID: testDepartment, Disabled: true},
+	}}
+	departmentRoleRepo := &fakeDepartmentRoleRepo{memberships: []models.DepartmentRoles{
+		{DepartmentID: testDepartment, UserID: "alice", Role: models.User},
+		{DepartmentID: testDepartment, UserID: "bob", Role: models.Admin},
+	}}
+	groupRepo := &fakeGroupRepo{
+		members: []models.GroupMemberModel{{GroupID: "helpdesk", MemberID: "alice", MemberType: models.GroupMemberUser}},
+		grants:  []models.GroupRoleModel{{GroupID: "helpdesk", Role: "support", DepartmentID: testDepartment}},
+	}
+	roleHelper := newTestRoleHelper(&fakeRoleRepo{roles: []models.RoleModel{supportRole}}, groupRepo)
+
+	return NewAuthzHelper(&testLog, userRepo, departmentRoleRepo, roleHelper)
+}
+
+func TestAuthzCheck(t *testing.T) {
+	noon := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2026, 10, 19, 23, 30, 0, 0, time.UTC)
+
+	allow := func(conditions models.PolicyConditions) models.AuthzPolicyModel {
+		return models.AuthzPolicyModel{Name: "allow-docs", Effect: models.PolicyAllow, Actions: models.StringList{"docs:*"}, Conditions: conditions}
+	}
+
+	tests := []struct {
+		name     string
+		req      models.AuthzCheckRequest
+		policies []models.AuthzPolicyModel
+		allowed  bool
+		reason   string
+	}{
+		{name: "granted by role", req: models.AuthzCheckRequest{Subject: "alice", Action: "profile:read"}, allowed: true, reason: "granted by role user"},
+		{name: "granted by group role", req: models.AuthzCheckRequest{Subject: "alice", Action: "users:write"}, allowed: true, reason: "granted by the roles of the subject's groups"},
+		{name: "nothing grants", req: models.AuthzCheckRequest{Subject: "alice", Action: "users:delete"}, reason: "no role or policy grants users:delete"},
+		{name: "not a member", req: models.AuthzCheckRequest{Subject: "carol", Action: "profile:read"}, reason: "subject is not a member of the department"},
+		{name: "disabled", req: models.AuthzCheckRequest{Subject: "bob", Action: "profile:read"}, reason: "subject is disabled or deactivated"},
+		{
+			name:     "allowed by policy prefix",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read"},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{})},
+			allowed:  true, reason: "allowed by policy allow-docs",
+		},
+		{
+			name: "policy for another role",
+			req:  models.AuthzCheckRequest{Subject: "alice", Action: "docs:read"},
+			policies: []models.AuthzPolicyModel{
+				{Name: "admins-docs", Effect: models.PolicyAllow, Roles: models.StringList{"admin"}, Actions: models.StringList{"docs:read"}},
+			},
+			reason: "no role or policy grants docs:read",
+		},
+		{
+			name: "policy for a group role",
+			req:  models.AuthzCheckRequest{Subject: "alice", Action: "docs:read"},
+			policies: []models.AuthzPolicyModel{
+				{Name: "support-docs", Effect: models.PolicyAllow, Roles: models.StringList{"supp*"}, Actions: models.StringList{"docs:read"}},
+			},
+			allowed: true, reason: "allowed by policy support-docs",
+		},
+		{
+			name: "deny wins over the role",
+			req:  models.AuthzCheckRequest{Subject: "alice", Action: "profile:read"},
+			policies: []models.AuthzPolicyModel{
+				allow(models.PolicyConditions{}),
+				{Name: "deny-profile", Effect: models.PolicyDeny, Actions: models.StringList{"profile:*"}},
+			},
+			reason: "denied by policy deny-profile",
+		},
+		{
+			name:     "owner condition holds",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:write", Resource: models.AuthzResource{Owner: "alice"}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{Owner: true})},
+			allowed:  true, reason: "allowed by policy allow-docs",
+		},
+		{
+			name:     "owner condition fails",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:write", Resource: models.AuthzResource{Owner: "bob"}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{Owner: true})},
+			reason:   "no role or policy grants docs:write",
+		},
+		{
+			name:     "owner condition without an owner",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:write"},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{Owner: true})},
+			reason:   "no role or policy grants docs:write",
+		},
+		{
+			name:     "within time of day",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Context: models.AuthzContext{Time: &noon}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{TimeOfDay: &models.TimeWindow{From: "09:00", To: "17:00"}})},
+			allowed:  true, reason: "allowed by policy allow-docs",
+		},
+		{
+			name:     "outside time of day in the timezone",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Context: models.AuthzContext{Time: &noon}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{TimeOfDay: &models.TimeWindow{From: "09:00", To: "17:00", Timezone: "America/Los_Angeles"}})},
+			reason:   "no role or policy grants docs:read",
+		},
+		{
+			name:     "time of day over midnight",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Context: models.AuthzContext{Time: &midnight}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{TimeOfDay: &models.TimeWindow{From: "22:00", To: "06:00"}})},
+			allowed:  true, reason: "allowed by policy allow-docs",
+		},
+		{
+			name:     "ip in range",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Context: models.AuthzContext{Ip: "10.1.2.3"}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{IpRanges: []string{"192.168.0.0/16", "10.0.0.0/8"}})},
+			allowed:  true, reason: "allowed by policy allow-docs",
+		},
+		{
+			name:     "ip out of range",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Context: models.AuthzContext{Ip: "172.16.0.1"}},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{IpRanges: []string{"10.0.0.0/8"}})},
+			reason:   "no role or policy grants docs:read",
+		},
+		{
+			name:     "no ip for an ip range",
+			req:      models.AuthzCheckRequest{Subject: "alice", Action: "docs:read"},
+			policies: []models.AuthzPolicyModel{allow(models.PolicyConditions{IpRanges: []string{"10.0.0.0/8"}})},
+			reason:   "no role or policy grants docs:read",
+		},
+		{
+			name: "deny only when its conditions hold",
+			req:  models.AuthzCheckRequest{Subject: "alice", Action: "profile:read", Context: models.AuthzContext{Ip: "10.1.2.3"}},
+			policies: []models.AuthzPolicyModel{
+				{Name: "deny-outside", Effect: models.PolicyDeny, Actions: models.StringList{"profile:read"}, Conditions: models.PolicyConditions{IpRanges: []string{"192.168.0.0/16"}}},
+			},
+			allowed: true, reason: "granted by role user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := newTestAuthzHelper().Check(testDepartment, &tt.req, tt.policies)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Fatalf("Check() = %v %q, want %v %q", decision.Allowed, decision.Reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAuthzCheckExplains(t *testing.T) {
+	req := &models.AuthzCheckRequest{Subject: "alice", Action: "docs:read", Explain: true}
+	policies := []models.AuthzPolicyModel{
+		{Name: "owners", Effect: models.PolicyAllow, Actions: models.StringList{"docs:read"}, Conditions: models.PolicyConditions{Owner: true}},
+		{Name: "other-action", Effect: models.PolicyAllow, Actions: models.StringList{"docs:write"}},
+	}
+
+	decision, err := newTestAuthzHelper().Check(testDepartment, req, policies)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation := decision.Explanation
+
+	if explanation == nil || explanation.Role != models.User || len(explanation.GroupRoles) != 1 || explanation.GroupRoles[0] != "support" {
+		t.Fatalf("Explanation = %+v, want role user and group role support", explanation)
+	}
+
+	owners, other := explanation.Policies[0], explanation.Policies[1]
+
+	if !owners.Applies || owners.Matched || len(owners.Conditions) != 1 || owners.Conditions[0].Passed {
+		t.Fatalf("owners policy = %+v, want it to apply with a failed owner condition", owners)
+	}
+
+	if other.Applies || other.Matched {
+		t.Fatalf("other-action policy = %+v, want it not to apply", other)
+	}
+}
@@ -10,10 +10,14 @@ import (
 type ContextKey string
 
 const (
-	RequestIDKey ContextKey = constants.RequestIdCtxKey
-	UserId       ContextKey = constants.UserIdCtxKey
-	DepartmentId ContextKey = constants.DepartmentIdCtxKey
-	Role         ContextKey = constants.RoleCtxKey
+	RequestIDKey  ContextKey = constants.RequestIdCtxKey
+	UserId        ContextKey = constants.UserIdCtxKey
+	DepartmentId  ContextKey = constants.DepartmentIdCtxKey
+	Role          ContextKey = constants.RoleCtxKey
+	Permissions   ContextKey = constants.PermissionsCtxKey
+	PlatformActor ContextKey = constants.PlatformActorKey
+	Credential    ContextKey = constants.CredentialCtxKey
+	Erased        ContextKey = constants.ErasedUserCtxKey
 )
 
 func SetRequestId(r *http.Request, requestID string) *http.Request {
@@ -23,7 +27,11 @@ func SetRequestId(r *http.Request, requestID string) *http.Request {
 }
 
 func GetRequestId(r *http.Request) string {
-	return r.Context().Value(RequestIDKey).(string)
+	requestId := r.Context().Value(RequestIDKey)
+	if requestId == nil {
+		return ""
+	}
+	return requestId.(string)
 }
 
 func SetUserId(r *http.Request, userId string) *http.Request {
@@ -67,3 +75,65 @@ func GetRole(r *http.Request) models.Role {
 	}
 	return role.(models.Role)
 }
+
+func SetPermissions(r *http.Request, permissions []models.Permission) *http.Request {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, Permissions, permissions)
+	return r.WithContext(ctx)
+}
+
+func GetPermissions(r *http.Request) []models.Permission {
+	permissions := r.Context().Value(Permissions)
+	if permissions == nil {
+		return nil
+	}
+	return permissions.([]models.Permission)
+}
+
+func SetPlatformActor(r *http.Request, actor string) *http.Request {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, PlatformActor, actor)
+	return r.WithContext(ctx)
+}
+
+func GetPlatformActor(r *http.Request) string {
+	actor := r.Context().Value(PlatformActor)
+	if actor == nil {
+		return ""
+	}
+	return actor.(string)
+}
+
+func SetTenantCredential(r *http.Request, credential models.TenantCredential) *http.Request {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, Credential, credential)
+	return r.WithContext(ctx)
+}
+
+// GetTenantCredential is the secret the tenant authenticated the request
+// with, empty without tenant credentials.
+func GetTenantCredential(r *http.Request) models.TenantCredential {
+	credential := r.Context().Value(Credential)
+	if credential == nil {
+		return ""
+	}
+	return credential.(models.TenantCredential)
+}
+
+// SetErasedUser makes room for the user the request's handler erases, so
+// events recorded after the handler can leave them out.
+func SetErasedUser(r *http.Request) *http.Request {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, Erased, &ErasedUser{})
+	return r.WithContext(ctx)
+}
+
+// GetErasedUser is the user erased while serving the request, nil when
+// there's no room for one.
+func GetErasedUser(r *http.Request) *ErasedUser {
+	erased := r.Context().Value(Erased)
+	if erased == nil {
+		return nil
+	}
+	return erased.(*ErasedUser)
+}
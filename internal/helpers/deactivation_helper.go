@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+type DeactivationHelper struct {
+	log         *zerolog.Logger
+	userRepo    repository.UserRepository
+	authRepo    repository.AuthRepository
+	emailHelper *EmailHelper
+}
+
+func NewDeactivationHelper(
+	log *zerolog.Logger,
+	userRepo repository.UserRepository,
+	authRepo repository.AuthRepository,
+	emailHelper *EmailHelper,
+) *DeactivationHelper {
+	return &DeactivationHelper{log: log, userRepo: userRepo, authRepo: authRepo, emailHelper: emailHelper}
+}
+
+// DeactivateUser blocks the user from logging in, ends their sessions and
+// schedules the account for purging once the grace period has passed.
+func (h *DeactivationHelper) DeactivateUser(user *models.UserModel) error {
+	now := time.Now()
+	purgeAt := PurgeDate(now)
+
+	user.DeactivatedAt = &now
+	user.PurgeAt = &purgeAt
+	user.PurgeWarningSentAt = nil
+
+	if err := h.userRepo.Save(user); err != nil {
+		return err
+	}
+
+	if err := h.authRepo.DeleteByUserId(user.ID); err != nil {
+		return err
+	}
+
+	// the account is deactivated either way, a failed email is only logged
+	if user.Email != "" {
+		tmpl_data := models.DeactivationData{
+			Name:    user.Name,
+			PurgeAt: purgeAt.UTC().Format(constants.TimeFormat),
+		}
+
+		if err := h.emailHelper.SendEmail(user.Email, "account-deactivated", tmpl_data); err != nil {
+			h.log.Error().Err(err).Str("userId", user.ID).Msg("Error sending deactivation email")
+		}
+	}
+
+	h.log.Info().Str("userId", user.ID).Time("purgeAt", purgeAt).Msg("User deactivated")
+
+	return nil
+}
+
+func (h *DeactivationHelper) RestoreUser(user *models.UserModel) error {
+	user.DeactivatedAt = nil
+	user.PurgeAt = nil
+	user.PurgeWarningSentAt = nil
+
+	if err := h.userRepo.Save(user); err != nil {
+		return err
+	}
+
+	h.log.Info().Str("userId", user.ID).Msg("User restored")
+
+	return nil
+}
+
+// PurgeDate returns when something deactivated at the given time is purged.
+func PurgeDate(deactivatedAt time.Time) time.Time {
+	return deactivatedAt.AddDate(0, 0, config.AppConfig.DeactivationGracePeriod)
+}
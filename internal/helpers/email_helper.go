@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"html/template"
 	"os"
+	"path/filepath"
 
 	"errors"
 	"uas/config"
@@ -17,7 +18,7 @@ import (
 
 type EmailTemplates map[string]struct {
 	Subject   string
-	Component func(data interface{}) string
+	Component func(data interface{}, settings *models.DepartmentSettings) string
 }
 
 type EmailHelper struct {
@@ -29,7 +30,9 @@ func NewEmailHelper(logger *zerolog.Logger, client *resend.Client) *EmailHelper
 	return &EmailHelper{logger: logger, client: client}
 }
 
-func (c EmailHelper) LoadTemplate(name string, args interface{}) (string, error) {
+// LoadTemplate renders the named template. Templates can use the `sender`
+// and `branding` functions to customize the email for the department.
+func (c EmailHelper) LoadTemplate(name string, args interface{}, settings *models.DepartmentSettings) (string, error) {
 	cwd, _ := os.Getwd()
 	templatePath := fmt.Sprintf(constants.EmailTemplatePath, cwd, name)
 
@@ -51,7 +54,22 @@ func (c EmailHelper) LoadTemplate(name string, args interface{}) (string, error)
 		Interface("args", args).
 		Msg("Loading email template")
 
-	parsedTemplate, _ := template.ParseFiles(templatePath)
+	funcs := template.FuncMap{
+		"sender":   func() string { return settings.EmailSenderName },
+		"branding": func() models.EmailBranding { return settings.Branding },
+	}
+
+	parsedTemplate, err := template.New(filepath.Base(templatePath)).Funcs(funcs).ParseFiles(templatePath)
+
+	if err != nil {
+		c.logger.
+			Error().
+			Err(err).
+			Str("template", templatePath).
+			Msg("Error while parsing email template")
+		return "", err
+	}
+
 	var tpl bytes.Buffer
 	err = parsedTemplate.Execute(&tpl, args)
 
@@ -81,32 +99,54 @@ func (c EmailHelper) LoadTemplate(name string, args interface{}) (string, error)
 	return result, nil
 }
 
+// SendEmail sends an email with the default sender and branding.
 func (c *EmailHelper) SendEmail(email string, template string, data interface{}) error {
+	return c.SendDepartmentEmail(EffectiveSettings(models.DepartmentSettings{}), email, template, data)
+}
+
+// SendDepartmentEmail sends an email with the sender name and branding from
+// the department's effective settings.
+func (c *EmailHelper) SendDepartmentEmail(settings *models.DepartmentSettings, email string, template string, data interface{}) error {
 
 	var templates = EmailTemplates{
-		"forgot-password": {
-			Subject: constants.WelcomeEmailSubject,
-			Component: func(data interface{}) string {
-				tmpl, err := c.LoadTemplate("forgot-password", data.(models.ForgotPasswordData))
-				if err != nil {
-					return ""
-				}
-
-				return tmpl
-			},
+		"reset-password": {
+			Subject:   constants.ResetPasswordEmailSubject,
+			Component: c.templateComponent("reset-password"),
+		},
+		"verify-email": {
+			Subject:   constants.VerifyEmailSubject,
+			Component: c.templateComponent("verify-email"),
+		},
+		"magic-link": {
+			Subject:   constants.MagicLinkEmailSubject,
+			Component: c.templateComponent("magic-link"),
+		},
+		"invitation": {
+			Subject:   constants.InvitationEmailSubject,
+			Component: c.templateComponent("invitation"),
+		},
+		"account-deactivated": {
+			Subject:   constants.DeactivatedEmailSubject,
+			Component: c.templateComponent("account-deactivated"),
+		},
+		"purge-warning": {
+			Subject:   constants.PurgeWarningEmailSubject,
+			Component: c.templateComponent("purge-warning"),
 		},
 	}
 
 	templateInfo, exists := templates[template]
 
 	if !exists {
+		err := fmt.Errorf(constants.InvalidTemplatePathError, template)
 		c.logger.Error().
 			Str("template", template).
 			Msg("Template not found")
+		return err
 	}
 
 	subject := templateInfo.Subject
-	html := templateInfo.Component(data)
+	html := templateInfo.Component(data, settings)
 
 	if html == "" {
 		err := errors.New("error while loading email template")
@@ -117,7 +157,7 @@ func (c *EmailHelper) SendEmail(email string, template string, data interface{})
 		return err
 	}
 
-	var domain = fmt.Sprintf(constants.EmailFrom, config.AppConfig.ResendEmailDomain)
+	var domain = fmt.Sprintf(constants.EmailFromWithName, settings.EmailSenderName, config.AppConfig.ResendEmailDomain)
 
 	params := &resend.SendEmailRequest{
 		From:    domain,
@@ -145,3 +185,14 @@ func (c *EmailHelper) SendEmail(email string, template string, data interface{})
 
 	return nil
 }
+
+func (c *EmailHelper) templateComponent(name string) func(data interface{}, settings *models.DepartmentSettings) string {
+	return func(data interface{}, settings *models.DepartmentSettings) string {
+		tmpl, err := c.LoadTemplate(name, data, settings)
+		if err != nil {
+			return ""
+		}
+
+		return tmpl
+	}
+}
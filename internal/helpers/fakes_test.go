@@ -0,0 +1,375 @@
+package helpers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var testLog = zerolog.Nop()
+
+// unreachableRedis fails fast, group roles are read from the repositories
+// then.
+func unreachableRedis() *RedisHelper {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: time.Millisecond, MaxRetries: -1})
+	return NewRedisHelper(client, &testLog, context.Background())
+}
+
+// fakeRedis is an in-memory redis speaking just enough RESP for the
+// RedisHelper: GET, SET, DEL and SCAN, without expiry.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newFakeRedis() (*fakeRedis, *RedisHelper) {
+	server := &fakeRedis{data: map[string]string{}}
+	client := redis.NewClient(&redis.Options{
+		DisableIndentity: true,
+		Dialer: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, peer := net.Pipe()
+			go server.serve(peer)
+			return conn, nil
+		},
+	})
+	return server, NewRedisHelper(client, &testLog, context.Background())
+}
+
+func (f *fakeRedis) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.data))
+	for key := range f.data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write([]byte(f.execute(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) execute(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(value)
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SCAN":
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for key := range f.data {
+			if matched, _ := path.Match(pattern, key); matched {
+				keys = append(keys, bulkString(key))
+			}
+		}
+		return "*2\r\n" + bulkString("0") + fmt.Sprintf("*%d\r\n", len(keys)) + strings.Join(keys, "")
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func bulkString(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// The fakes embed their repository interface, methods a test doesn't need
+// panic on the nil interface.
+
+type fakeDepartmentRepo struct {
+	repository.DepartmentRepository
+	mu   sync.Mutex
+	keys []models.SigningKeyModel
+}
+
+func (r *fakeDepartmentRepo) FindSigningKey(id string) (*models.SigningKeyModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.ID == id {
+			return &key, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// FindSigningKeys returns the keys newest first, like the repository.
+func (r *fakeDepartmentRepo) FindSigningKeys(departmentId string) ([]models.SigningKeyModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []models.SigningKeyModel
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].DepartmentID == departmentId {
+			keys = append(keys, r.keys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeDepartmentRepo) RotateSigningKey(key *models.SigningKeyModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.keys {
+		if r.keys[i].DepartmentID == key.DepartmentID && r.keys[i].RetiredAt == nil {
+			r.keys[i].RetiredAt = &key.CreatedAt
+		}
+	}
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *fakeDepartmentRepo) CreateSigningKeyIfAbsent(key *models.SigningKeyModel) (*models.SigningKeyModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.keys {
+		if existing.DepartmentID == key.DepartmentID && existing.RetiredAt == nil {
+			return &existing, nil
+		}
+	}
+	r.keys = append(r.keys, *key)
+	return key, nil
+}
+
+func (r *fakeDepartmentRepo) FindConfig(departmentId string) (*models.DepartmentConfig, error) {
+	return &models.DepartmentConfig{DepartmentID: departmentId}, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users []models.UserModel
+}
+
+func (r *fakeUserRepo) FindByEmailInDepartment(departmentId string, email string) (*models.UserModel, error) {
+	for i := range r.users {
+		if r.users[i].DepartmentID == departmentId && r.users[i].Email == email {
+			return &r.users[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) FindByIdInDepartment(departmentId string, id string) (*models.UserModel, error) {
+	for i := range r.users {
+		if r.users[i].DepartmentID == departmentId && r.users[i].ID == id {
+			return &r.users[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) CreateWithRole(user *models.UserModel, role *models.DepartmentRoles) error {
+	r.users = append(r.users, *user)
+	return nil
+}
+
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	events []models.AuditEventModel
+}
+
+func (r *fakeAuditRepo) Create(event *models.AuditEventModel) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+type fakeRoleRepo struct {
+	repository.RoleRepository
+	roles       []models.RoleModel
+	memberships []models.DepartmentRoles
+	users       map[string]models.UserModel
+}
+
+func (r *fakeRoleRepo) FindByName(departmentId string, name models.Role) (*models.RoleModel, error) {
+	for i := range r.roles {
+		if r.roles[i].DepartmentID == departmentId && r.roles[i].Name == name {
+			return &r.roles[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRoleRepo) CountActiveMembers(departmentId string, name models.Role, exceptUserId string) (int64, error) {
+	var count int64
+	for _, membership := range r.memberships {
+		if membership.DepartmentID != departmentId || membership.Role != name || membership.UserID == exceptUserId {
+			continue
+		}
+		user, ok := r.users[membership.UserID]
+		if ok && !user.Disabled && user.DeactivatedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type fakeDepartmentRoleRepo struct {
+	repository.DepartmentRoleRepository
+	memberships []models.DepartmentRoles
+}
+
+func (r *fakeDepartmentRoleRepo) FindById(departmentId string, userId string) (*models.DepartmentRoles, error) {
+	for i := range r.memberships {
+		if r.memberships[i].DepartmentID == departmentId && r.memberships[i].UserID == userId {
+			return &r.memberships[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeGroupRepo struct {
+	repository.GroupRepository
+	members []models.GroupMemberModel
+	grants  []models.GroupRoleModel
+}
+
+func (r *fakeGroupRepo) FindMemberships(departmentId string, memberIds []string) ([]models.GroupMemberModel, error) {
+	var memberships []models.GroupMemberModel
+	for _, member := range r.members {
+		if slices.Contains(memberIds, member.MemberID) {
+			memberships = append(memberships, member)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *fakeGroupRepo) FindRoles(groupIds []string) ([]models.GroupRoleModel, error) {
+	var grants []models.GroupRoleModel
+	for _, grant := range r.grants {
+		if slices.Contains(groupIds, grant.GroupID) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+// fakeRelationRepo keeps every tuple with the revisions it was written and
+// deleted at, like the repository.
+type fakeRelationRepo struct {
+	repository.RelationRepository
+	namespaces []models.RelationNamespaceModel
+	tuples     []models.RelationTupleModel
+	revision   uint64
+}
+
+func (r *fakeRelationRepo) FindNamespaces(departmentId string) ([]models.RelationNamespaceModel, error) {
+	return r.namespaces, nil
+}
+
+func (r *fakeRelationRepo) Revision(departmentId string) (uint64, error) {
+	return r.revision, nil
+}
+
+func (r *fakeRelationRepo) Write(departmentId string, writes []models.RelationTupleModel, deletes []models.RelationTupleModel) (uint64, error) {
+	r.revision++
+	for _, deleted := range deletes {
+		for i := range r.tuples {
+			if r.tuples[i].String() == deleted.String() && r.tuples[i].DeletedRevision == nil {
+				revision := r.revision
+				r.tuples[i].DeletedRevision = &revision
+			}
+		}
+	}
+	for _, tuple := range writes {
+		tuple.DepartmentID = departmentId
+		tuple.CreatedRevision = r.revision
+		r.tuples = append(r.tuples, tuple)
+	}
+	return r.revision, nil
+}
+
+func (r *fakeRelationRepo) live(tuple *models.RelationTupleModel, revision uint64) bool {
+	return tuple.CreatedRevision <= revision && (tuple.DeletedRevision == nil || *tuple.DeletedRevision > revision)
+}
+
+func (r *fakeRelationRepo) FindTuples(departmentId string, namespace string, objectId string, relation string, revision uint64) ([]models.RelationTupleModel, error) {
+	var tuples []models.RelationTupleModel
+	for i := range r.tuples {
+		tuple := &r.tuples[i]
+		if tuple.DepartmentID == departmentId && tuple.Namespace == namespace && tuple.ObjectID == objectId && tuple.Relation == relation && r.live(tuple, revision) {
+			tuples = append(tuples, *tuple)
+		}
+	}
+	return tuples, nil
+}
+
+func (r *fakeRelationRepo) FindObjectIds(departmentId string, namespace string, revision uint64, after string, limit int) ([]string, error) {
+	var ids []string
+	for i := range r.tuples {
+		tuple := &r.tuples[i]
+		if tuple.DepartmentID == departmentId && tuple.Namespace == namespace && tuple.ObjectID > after && r.live(tuple, revision) && !slices.Contains(ids, tuple.ObjectID) {
+			ids = append(ids, tuple.ObjectID)
+		}
+	}
+	slices.Sort(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
@@ -0,0 +1,362 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const hashSeparator = "$"
+
+// EncodeImportedHash converts a precomputed hash from an import record into
+// the self-describing form stored in UserModel.Password. Everything needed to
+// verify the hash later (salt, cost parameters, signer key) is kept alongside it.
+func (h *AuthHelper) EncodeImportedHash(record *models.ImportUserRecord, opts models.ImportOptions) (string, error) {
+	if record.HashAlgorithm == models.Bcrypt {
+		if !strings.HasPrefix(record.PasswordHash, "$2") {
+			return "", errors.New("invalid bcrypt hash")
+		}
+		return record.PasswordHash, nil
+	}
+
+	hash, err := decodeHashBytes(record.PasswordHash, "password hash")
+
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := decodeHashBytes(record.PasswordSalt, "password salt")
+
+	if err != nil {
+		return "", err
+	}
+
+	switch record.HashAlgorithm {
+	case models.Pbkdf2Sha256:
+		if record.Iterations <= 0 {
+			return "", errors.New("iterations are required for pbkdf2-sha256")
+		}
+
+		if err := checkPbkdf2Cost(record.Iterations); err != nil {
+			return "", err
+		}
+
+		return joinHash(strconv.Itoa(record.Iterations), encodeB64(salt), encodeB64(hash)), nil
+
+	case models.Scrypt:
+		if record.CostN <= 1 {
+			return "", errors.New("n is required for scrypt")
+		}
+
+		r, p := record.BlockSize, record.Parallelism
+		if r <= 0 {
+			r = 8
+		}
+		if p <= 0 {
+			p = 1
+		}
+
+		if err := checkScryptCost(record.CostN, r, p); err != nil {
+			return "", err
+		}
+
+		return joinHash(
+			strconv.Itoa(record.CostN),
+			strconv.Itoa(r),
+			strconv.Itoa(p),
+			encodeB64(salt),
+			encodeB64(hash),
+		), nil
+
+	case models.FirebaseScrypt:
+		signerKey := firstNonEmpty(record.SignerKey, opts.FirebaseSignerKey)
+		saltSeparator := firstNonEmpty(record.SaltSeparator, opts.FirebaseSaltSeparator)
+		rounds := firstPositive(record.Rounds, opts.FirebaseRounds)
+		memCost := firstPositive(record.MemCost, opts.FirebaseMemCost)
+
+		if signerKey == "" || rounds <= 0 || memCost <= 0 {
+			return "", errors.New("signer key, rounds and mem cost are required for firebase-scrypt")
+		}
+
+		if err := checkFirebaseCost(rounds, memCost); err != nil {
+			return "", err
+		}
+
+		for _, value := range []string{signerKey, saltSeparator} {
+			if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+				return "", fmt.Errorf("invalid base64 value for firebase-scrypt: %w", err)
+			}
+		}
+
+		return joinHash(
+			strconv.Itoa(rounds),
+			strconv.Itoa(memCost),
+			signerKey,
+			saltSeparator,
+			encodeB64(salt),
+			encodeB64(hash),
+		), nil
+
+	case models.SaltedSha256:
+		if len(hash) != sha256.Size {
+			return "", errors.New("invalid salted-sha256 hash length")
+		}
+
+		return joinHash(encodeB64(salt), encodeB64(hash)), nil
+	}
+
+	return "", fmt.Errorf("unsupported hash algorithm: %s", record.HashAlgorithm)
+}
+
+// VerifyPassword checks a password against the user's stored hash, whatever
+// algorithm it was created with. The second return value reports whether the
+// hash should be upgraded to the current algorithm.
+func (h *AuthHelper) VerifyPassword(password string, user *models.UserModel) (bool, bool) {
+	if user.PasswordAlgorithm == "" || user.PasswordAlgorithm == models.Bcrypt {
+		return h.CheckPasswordHash(password, user.Password), false
+	}
+
+	if password == "" || user.Password == "" {
+		h.log.Error().Msg("Password or hash is empty")
+		return false, false
+	}
+
+	expected, computed, err := computeForeignHash(user.PasswordAlgorithm, user.Password, password)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("algorithm", string(user.PasswordAlgorithm)).Msg("Error verifying imported password hash")
+		return false, false
+	}
+
+	valid := subtle.ConstantTimeCompare(expected, computed) == 1
+
+	return valid, valid
+}
+
+func computeForeignHash(algorithm models.PasswordAlgorithm, stored string, password string) ([]byte, []byte, error) {
+	parts := strings.Split(stored, hashSeparator)
+
+	switch algorithm {
+	case models.Pbkdf2Sha256:
+		if len(parts) != 3 {
+			return nil, nil, errors.New("malformed pbkdf2-sha256 hash")
+		}
+
+		iterations, salt, expected, err := parseIntAndBytes(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkPbkdf2Cost(iterations); err != nil {
+			return nil, nil, err
+		}
+
+		return expected, pbkdf2.Key([]byte(password), salt, iterations, len(expected), sha256.New), nil
+
+	case models.Scrypt:
+		if len(parts) != 5 {
+			return nil, nil, errors.New("malformed scrypt hash")
+		}
+
+		n, errN := strconv.Atoi(parts[0])
+		r, errR := strconv.Atoi(parts[1])
+		p, errP := strconv.Atoi(parts[2])
+		if err := errors.Join(errN, errR, errP); err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkScryptCost(n, r, p); err != nil {
+			return nil, nil, err
+		}
+
+		salt, expected, err := decodeB64Pair(parts[3], parts[4])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		computed, err := scrypt.Key([]byte(password), salt, n, r, p, len(expected))
+
+		return expected, computed, err
+
+	case models.FirebaseScrypt:
+		if len(parts) != 6 {
+			return nil, nil, errors.New("malformed firebase-scrypt hash")
+		}
+
+		rounds, errRounds := strconv.Atoi(parts[0])
+		memCost, errMem := strconv.Atoi(parts[1])
+		if err := errors.Join(errRounds, errMem); err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkFirebaseCost(rounds, memCost); err != nil {
+			return nil, nil, err
+		}
+
+		signerKey, saltSeparator, err := decodeB64Pair(parts[2], parts[3])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		salt, expected, err := decodeB64Pair(parts[4], parts[5])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		computed, err := firebaseScryptKey([]byte(password), salt, signerKey, saltSeparator, rounds, memCost)
+
+		return expected, computed, err
+
+	case models.SaltedSha256:
+		if len(parts) != 2 {
+			return nil, nil, errors.New("malformed salted-sha256 hash")
+		}
+
+		salt, expected, err := decodeB64Pair(parts[0], parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sum := sha256.Sum256(append(salt, []byte(password)...))
+
+		return expected, sum[:], nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+}
+
+// firebaseScryptKey implements Firebase's modified scrypt: the scrypt derived
+// key is used to AES-256-CTR encrypt the project's signer key.
+func firebaseScryptKey(password, salt, signerKey, saltSeparator []byte, rounds, memCost int) ([]byte, error) {
+	derived, err := scrypt.Key(password, append(append([]byte{}, salt...), saltSeparator...), 1<<memCost, rounds, 1, 32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derived)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(signerKey))
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	stream.XORKeyStream(out, signerKey)
+
+	return out, nil
+}
+
+// checkPbkdf2Cost rejects iteration counts that would make every login
+// expensive. Imported hashes come from files, so their costs can't be trusted.
+func checkPbkdf2Cost(iterations int) error {
+	if iterations <= 0 || iterations > constants.MaxPbkdf2Iterations {
+		return fmt.Errorf("iterations must be between 1 and %d", constants.MaxPbkdf2Iterations)
+	}
+	return nil
+}
+
+// checkScryptCost rejects scrypt parameters scrypt.Key doesn't accept or that
+// would take too much memory or time on every login.
+func checkScryptCost(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || n > constants.MaxScryptN {
+		return fmt.Errorf("n must be a power of 2 up to %d", constants.MaxScryptN)
+	}
+
+	if r <= 0 || r > constants.MaxScryptBlockSize {
+		return fmt.Errorf("r must be between 1 and %d", constants.MaxScryptBlockSize)
+	}
+
+	if p <= 0 || p > constants.MaxScryptParallelism {
+		return fmt.Errorf("p must be between 1 and %d", constants.MaxScryptParallelism)
+	}
+
+	if 128*n*r > constants.MaxScryptMemory {
+		return fmt.Errorf("n and r must not need more than %d MiB", constants.MaxScryptMemory>>20)
+	}
+
+	return nil
+}
+
+// checkFirebaseCost applies checkScryptCost to Firebase's parameters, the mem
+// cost is the binary logarithm of n.
+func checkFirebaseCost(rounds, memCost int) error {
+	if memCost <= 0 || memCost >= 31 {
+		return fmt.Errorf("mem cost must be a power of 2 up to %d", constants.MaxScryptN)
+	}
+	return checkScryptCost(1<<memCost, rounds, 1)
+}
+
+// decodeHashBytes decodes a hex or base64 encoded hash or salt. Hex is tried
+// first, a value that is valid in both encodings is read as hex.
+func decodeHashBytes(value string, name string) ([]byte, error) {
+	if decoded, err := hex.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+
+	if decoded, err := base64.RawStdEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+
+	return nil, fmt.Errorf("%s must be hex or base64 encoded", name)
+}
+
+func parseIntAndBytes(number string, a string, b string) (int, []byte, []byte, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	first, second, err := decodeB64Pair(a, b)
+
+	return n, first, second, err
+}
+
+func decodeB64Pair(a string, b string) ([]byte, []byte, error) {
+	first, errA := base64.StdEncoding.DecodeString(a)
+	second, errB := base64.StdEncoding.DecodeString(b)
+
+	return first, second, errors.Join(errA, errB)
+}
+
+func encodeB64(value []byte) string {
+	return base64.StdEncoding.EncodeToString(value)
+}
+
+func joinHash(parts ...string) string {
+	return strings.Join(parts, hashSeparator)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func firstPositive(values ...int) int {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// binarySalt isn't valid UTF-8, exports with salts like it used to be
+// imported with the encoded text as the salt and never verified.
+var binarySalt = []byte{0x00, 0xff, 0x10, 0x80, 0xc3, 0x28, 0x7f, 0xfe}
+
+const importedPassword = "correct horse battery staple"
+
+func newTestAuthHelper() *AuthHelper {
+	log := zerolog.Nop()
+	return &AuthHelper{log: &log}
+}
+
+func TestEncodeImportedHashVerifiesWithDecodedSalt(t *testing.T) {
+	h := newTestAuthHelper()
+
+	pbkdf2Hash := pbkdf2.Key([]byte(importedPassword), binarySalt, 1000, 32, sha256.New)
+
+	scryptHash, err := scrypt.Key([]byte(importedPassword), binarySalt, 16, 8, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha256Hash := sha256.Sum256(append(append([]byte{}, binarySalt...), importedPassword...))
+
+	signerKey := []byte("firebase-signer-key-for-tests!!!")
+	saltSeparator := []byte{0x07}
+
+	firebaseHash, err := firebaseScryptKey([]byte(importedPassword), binarySalt, signerKey, saltSeparator, 8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		record models.ImportUserRecord
+	}{
+		{
+			name: "pbkdf2-sha256 with hex salt",
+			record: models.ImportUserRecord{
+				HashAlgorithm: models.Pbkdf2Sha256,
+				PasswordHash:  hex.EncodeToString(pbkdf2Hash),
+				PasswordSalt:  hex.EncodeToString(binarySalt),
+				Iterations:    1000,
+			},
+		},
+		{
+			name: "scrypt with base64 salt",
+			record: models.ImportUserRecord{
+				HashAlgorithm: models.Scrypt,
+				PasswordHash:  base64.StdEncoding.EncodeToString(scryptHash),
+				PasswordSalt:  base64.StdEncoding.EncodeToString(binarySalt),
+				CostN:         16,
+			},
+		},
+		{
+			name: "salted-sha256 with unpadded base64 salt",
+			record: models.ImportUserRecord{
+				HashAlgorithm: models.SaltedSha256,
+				PasswordHash:  hex.EncodeToString(sha256Hash[:]),
+				PasswordSalt:  base64.RawStdEncoding.EncodeToString(binarySalt),
+			},
+		},
+		{
+			name: "firebase-scrypt with base64 salt",
+			record: models.ImportUserRecord{
+				HashAlgorithm: models.FirebaseScrypt,
+				PasswordHash:  base64.StdEncoding.EncodeToString(firebaseHash),
+				PasswordSalt:  base64.StdEncoding.EncodeToString(binarySalt),
+				SignerKey:     base64.StdEncoding.EncodeToString(signerKey),
+				SaltSeparator: base64.StdEncoding.EncodeToString(saltSeparator),
+				Rounds:        8,
+				MemCost:       4,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := h.EncodeImportedHash(&tt.record, models.ImportOptions{})
+			if err != nil {
+				t.Fatalf("EncodeImportedHash() error = %v", err)
+			}
+
+			user := &models.UserModel{Password: encoded, PasswordAlgorithm: tt.record.HashAlgorithm}
+
+			if valid, upgrade := h.VerifyPassword(importedPassword, user); !valid || !upgrade {
+				t.Errorf("VerifyPassword() = %v, %v, want true, true", valid, upgrade)
+			}
+
+			if valid, _ := h.VerifyPassword("wrong password", user); valid {
+				t.Error("VerifyPassword() accepted a wrong password")
+			}
+		})
+	}
+}
+
+func TestEncodeImportedHashRejectsPlainTextSalt(t *testing.T) {
+	h := newTestAuthHelper()
+
+	record := models.ImportUserRecord{
+		HashAlgorithm: models.SaltedSha256,
+		PasswordHash:  hex.EncodeToString(make([]byte, sha256.Size)),
+		PasswordSalt:  "not encoded!",
+	}
+
+	if _, err := h.EncodeImportedHash(&record, models.ImportOptions{}); err == nil {
+		t.Error("EncodeImportedHash() accepted a salt that is neither hex nor base64")
+	}
+}
+
+func TestEncodeImportedHashRejectsExcessiveCosts(t *testing.T) {
+	h := newTestAuthHelper()
+
+	hash := hex.EncodeToString(make([]byte, 32))
+	salt := hex.EncodeToString(binarySalt)
+	key := base64.StdEncoding.EncodeToString([]byte("signer"))
+
+	tests := []struct {
+		name   string
+		record models.ImportUserRecord
+	}{
+		{"pbkdf2 iterations", models.ImportUserRecord{HashAlgorithm: models.Pbkdf2Sha256, Iterations: constants.MaxPbkdf2Iterations + 1}},
+		{"scrypt n too large", models.ImportUserRecord{HashAlgorithm: models.Scrypt, CostN: constants.MaxScryptN * 2}},
+		{"scrypt n not a power of 2", models.ImportUserRecord{HashAlgorithm: models.Scrypt, CostN: 1000}},
+		{"scrypt r too large", models.ImportUserRecord{HashAlgorithm: models.Scrypt, CostN: 16, BlockSize: constants.MaxScryptBlockSize + 1}},
+		{"scrypt p too large", models.ImportUserRecord{HashAlgorithm: models.Scrypt, CostN: 16, Parallelism: constants.MaxScryptParallelism + 1}},
+		{"scrypt memory", models.ImportUserRecord{HashAlgorithm: models.Scrypt, CostN: constants.MaxScryptN, BlockSize: constants.MaxScryptBlockSize}},
+		{"firebase mem cost", models.ImportUserRecord{HashAlgorithm: models.FirebaseScrypt, SignerKey: key, Rounds: 8, MemCost: 40}},
+		{"firebase rounds", models.ImportUserRecord{HashAlgorithm: models.FirebaseScrypt, SignerKey: key, Rounds: constants.MaxScryptBlockSize + 1, MemCost: 14}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.record.PasswordHash = hash
+			tt.record.PasswordSalt = salt
+
+			if _, err := h.EncodeImportedHash(&tt.record, models.ImportOptions{}); err == nil {
+				t.Error("EncodeImportedHash() accepted the cost")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRejectsExcessiveStoredCost(t *testing.T) {
+	h := newTestAuthHelper()
+
+	// stored before costs were checked on import
+	user := &models.UserModel{
+		PasswordAlgorithm: models.Scrypt,
+		Password:          joinHash("1073741824", "8", "1", encodeB64(binarySalt), encodeB64(make([]byte, 32))),
+	}
+
+	if valid, _ := h.VerifyPassword(importedPassword, user); valid {
+		t.Error("VerifyPassword() accepted a hash with an excessive cost")
+	}
+}
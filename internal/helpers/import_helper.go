@@ -0,0 +1,255 @@
+package helpers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const maxImportLineSize = 1024 * 1024
+
+type ImportHelper struct {
+	log         *zerolog.Logger
+	userRepo    repository.UserRepository
+	authHelper  *AuthHelper
+	usageHelper *UsageHelper
+}
+
+func NewImportHelper(
+	log *zerolog.Logger,
+	userRepo repository.UserRepository,
+	authHelper *AuthHelper,
+	usageHelper *UsageHelper,
+) *ImportHelper {
+	return &ImportHelper{
+		log:         log,
+		userRepo:    userRepo,
+		authHelper:  authHelper,
+		usageHelper: usageHelper,
+	}
+}
+
+// ImportUsers reads NDJSON or CSV user records and creates them in the given
+// department. Rows are processed independently; a bad row is recorded in the
+// report and does not stop the import. In dry-run mode nothing is written.
+func (h *ImportHelper) ImportUsers(reader io.Reader, format models.ImportFormat, departmentId string, opts models.ImportOptions) (*models.ImportUsersResponse, error) {
+	report := &models.ImportUsersResponse{DryRun: opts.DryRun, Errors: []models.ImportRowError{}}
+	seen := make(map[string]bool)
+
+	handleRow := func(row int, record *models.ImportUserRecord, parseErr error) {
+		report.Total++
+
+		err := parseErr
+		if err == nil {
+			err = h.importRecord(record, departmentId, opts, seen)
+		}
+
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, models.ImportRowError{Row: row, Email: record.Email, Error: err.Error()})
+			return
+		}
+
+		report.Imported++
+	}
+
+	var err error
+
+	switch format {
+	case models.CSV:
+		err = readCsvRecords(reader, handleRow)
+	case models.NDJSON:
+		err = readNdjsonRecords(reader, handleRow)
+	default:
+		err = fmt.Errorf("unsupported import format: %s", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	h.log.Info().
+		Bool("dryRun", opts.DryRun).
+		Str("departmentId", departmentId).
+		Int("total", report.Total).
+		Int("imported", report.Imported).
+		Int("failed", report.Failed).
+		Msg("User import finished")
+
+	return report, nil
+}
+
+func (h *ImportHelper) importRecord(record *models.ImportUserRecord, departmentId string, opts models.ImportOptions, seen map[string]bool) error {
+	if err := validate.Struct(record); err != nil {
+		return errors.New(formatValidationErrors(err))
+	}
+
+	email := strings.ToLower(record.Email)
+
+	if seen[email] {
+		return errors.New("duplicate email in import file")
+	}
+
+	_, err := h.userRepo.FindByEmailInDepartment(departmentId, email)
+
+	if err == nil {
+		return errors.New("user with this email already exists")
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	passwordHash, err := h.authHelper.EncodeImportedHash(record, opts)
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.usageHelper.CheckUserQuota(departmentId); err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		seen[email] = true
+		return nil
+	}
+
+	user := models.UserModel{
+		ID:                uuid.New().String(),
+		DepartmentID:      departmentId,
+		Name:              record.Name,
+		Email:             record.Email,
+		Password:          passwordHash,
+		PasswordAlgorithm: record.HashAlgorithm,
+		PhoneNumber:       record.PhoneNumber,
+		EmailVerified:     record.EmailVerified,
+	}
+
+	err = h.userRepo.CreateWithRole(&user, &models.DepartmentRoles{
+		DepartmentID: departmentId,
+		Role:         models.User,
+		UserID:       user.ID,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// only accepted rows reserve their email, a failed row doesn't hide a
+	// later valid one
+	seen[email] = true
+	return nil
+}
+
+func readNdjsonRecords(reader io.Reader, handleRow func(int, *models.ImportUserRecord, error)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		var record models.ImportUserRecord
+		err := json.Unmarshal([]byte(line), &record)
+		handleRow(row, &record, err)
+	}
+
+	return scanner.Err()
+}
+
+func readCsvRecords(reader io.Reader, handleRow func(int, *models.ImportUserRecord, error)) error {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+
+	if err != nil {
+		return fmt.Errorf("error reading csv header: %w", err)
+	}
+
+	row := 1
+	for {
+		fields, err := csvReader.Read()
+		row++
+
+		if err == io.EOF {
+			return nil
+		}
+
+		var record models.ImportUserRecord
+
+		if err != nil {
+			handleRow(row, &record, err)
+			continue
+		}
+
+		values := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(fields) {
+				values[strings.TrimSpace(column)] = fields[i]
+			}
+		}
+
+		handleRow(row, &record, csvToRecord(values, &record))
+	}
+}
+
+func csvToRecord(values map[string]string, record *models.ImportUserRecord) error {
+	record.Name = values["name"]
+	record.Email = values["email"]
+	record.PhoneNumber = values["phoneNumber"]
+	record.PasswordHash = values["passwordHash"]
+	record.PasswordSalt = values["passwordSalt"]
+	record.HashAlgorithm = models.PasswordAlgorithm(values["hashAlgorithm"])
+	record.SignerKey = values["signerKey"]
+	record.SaltSeparator = values["saltSeparator"]
+
+	if value := values["emailVerified"]; value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid emailVerified value: %s", value)
+		}
+		record.EmailVerified = verified
+	}
+
+	numbers := map[string]*int{
+		"iterations": &record.Iterations,
+		"n":          &record.CostN,
+		"r":          &record.BlockSize,
+		"p":          &record.Parallelism,
+		"rounds":     &record.Rounds,
+		"memCost":    &record.MemCost,
+	}
+
+	for column, target := range numbers {
+		value := values[column]
+		if value == "" {
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %s", column, value)
+		}
+		*target = number
+	}
+
+	return nil
+}
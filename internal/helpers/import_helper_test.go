@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+	"uas/internal/models"
+)
+
+const bcryptHash = "$2a$10$abcdefghijklmnopqrstuuJ8uJQ9rM5c8nqSx4E0kZp3kQ2o7yLe"
+
+func importNdjson(t *testing.T, userRepo *fakeUserRepo, lines ...string) *models.ImportUsersResponse {
+	t.Helper()
+
+	usageHelper := NewUsageHelper(&testLog, nil, &fakeDepartmentRepo{})
+	importHelper := NewImportHelper(&testLog, userRepo, newTestAuthHelper(), usageHelper)
+
+	report, err := importHelper.ImportUsers(strings.NewReader(strings.Join(lines, "\n")), models.NDJSON, testDepartment, models.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestImportFailedRowDoesntReserveEmail(t *testing.T) {
+	userRepo := &fakeUserRepo{}
+
+	report := importNdjson(t, userRepo,
+		`{"email":"user@example.com","passwordHash":"not-bcrypt","hashAlgorithm":"bcrypt"}`,
+		`{"email":"user@example.com","passwordHash":"`+bcryptHash+`","hashAlgorithm":"bcrypt"}`,
+	)
+
+	if report.Imported != 1 || report.Failed != 1 {
+		t.Fatalf("imported %d, failed %d, want 1, 1: %+v", report.Imported, report.Failed, report.Errors)
+	}
+
+	if report.Errors[0].Row != 1 {
+		t.Errorf("failed row = %d, want 1", report.Errors[0].Row)
+	}
+}
+
+func TestImportDedupesEmailsIgnoringCase(t *testing.T) {
+	userRepo := &fakeUserRepo{users: []models.UserModel{{ID: "existing", DepartmentID: testDepartment, Email: "taken@example.com"}}}
+
+	report := importNdjson(t, userRepo,
+		`{"email":"User@Example.com","passwordHash":"`+bcryptHash+`","hashAlgorithm":"bcrypt"}`,
+		`{"email":"user@example.com","passwordHash":"`+bcryptHash+`","hashAlgorithm":"bcrypt"}`,
+		`{"email":"Taken@Example.com","passwordHash":"`+bcryptHash+`","hashAlgorithm":"bcrypt"}`,
+	)
+
+	if report.Imported != 1 || report.Failed != 2 {
+		t.Fatalf("imported %d, failed %d, want 1, 2: %+v", report.Imported, report.Failed, report.Errors)
+	}
+
+	if len(userRepo.users) != 2 {
+		t.Errorf("users = %d, want 2", len(userRepo.users))
+	}
+}
@@ -2,24 +2,101 @@ package helpers
 
 import (
 	"errors"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 	"uas/config"
+	"uas/internal/constants"
 	"uas/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func (h *AuthHelper) GenerateAccessJwtToken(user *models.UserModel, tenant string) (string, error) {
+// AccessClaims are the claims of an access token. Scope lists the token's
+// scopes separated by spaces, as in OAuth.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	UserID       string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Email        string                 `json:"email"`
+	DepartmentID string                 `json:"departmentId"`
+	Scope        string                 `json:"scope,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func (c *AccessClaims) Scopes() []models.Scope {
+	var scopes []models.Scope
+	for _, scope := range strings.Fields(c.Scope) {
+		scopes = append(scopes, models.Scope(scope))
+	}
+	return scopes
+}
+
+// HasScopes reports whether the token was granted every scope.
+func (c *AccessClaims) HasScopes(required []models.Scope) bool {
+	granted := c.Scopes()
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// RefreshClaims are the claims of a refresh token.
+type RefreshClaims struct {
+	jwt.RegisteredClaims
+	UserID       string `json:"id"`
+	DepartmentID string `json:"departmentId"`
+}
+
+func joinScopes(scopes []models.Scope) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, " ")
+}
+
+// GenerateAccessJwtToken issues an access token with the scopes the member
+// was granted in the department.
+func (h *AuthHelper) GenerateAccessJwtToken(user *models.UserModel, tenant string, scopes []models.Scope) (string, error) {
 	h.log.Debug().Msgf("Generating JWT token for user: %s", user.Name)
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":           user.ID,
-		"name":         user.Name,
-		"email":        user.Email,
-		"departmentId": tenant,
-		"exp":          time.Now().Add(time.Hour * time.Duration(config.AppConfig.AccessJwtExpire)).Unix(),
-	})
+	settings, err := h.GetEffectiveSettings(tenant)
+	if err != nil {
+		return "", errors.New("error generating JWT Access token")
+	}
+
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    JwtIssuer(tenant),
+			Audience:  jwt.ClaimStrings{tenant},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * time.Duration(settings.AccessTokenTtlMinutes))),
+		},
+		UserID:       user.ID,
+		Name:         user.Name,
+		Email:        user.Email,
+		DepartmentID: tenant,
+		Scope:        joinScopes(scopes),
+	}
 
-	token, err := t.SignedString([]byte(config.AppConfig.AccessJwtSecret))
+	departmentConfig, err := h.departmentRepo.FindConfig(tenant)
+	if err != nil {
+		return "", errors.New("error generating JWT Access token")
+	}
+
+	claims.Attributes = ProjectClaims(user.Metadata, departmentConfig.TokenClaims)
+
+	key, err := h.activeSigningKey(tenant)
+	if err != nil {
+		return "", errors.New("error generating JWT Access token")
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, &claims)
+	t.Header["kid"] = key.id
+
+	token, err := t.SignedString(key.private)
 	if err != nil {
 		return "", errors.New("error generating JWT Access token")
 	}
@@ -27,30 +104,115 @@ func (h *AuthHelper) GenerateAccessJwtToken(user *models.UserModel, tenant strin
 	return token, nil
 }
 
-func (h *AuthHelper) ParseAccessJwtToken(tokenString string) (jwt.MapClaims, error) {
+// ParseAccessJwtToken verifies an access token with the signing key named in
+// its header. The token must have been issued for departmentId, when the
+// request carries no tenant credentials the key's department is used.
+func (h *AuthHelper) ParseAccessJwtToken(tokenString string, departmentId string) (*AccessClaims, error) {
 	h.log.Debug().Msgf("Parsing JWT Access token: %s", tokenString)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.AppConfig.AccessJwtSecret), nil
-	})
+	var keyDepartment string
+
+	token, err := jwt.ParseWithClaims(tokenString, &AccessClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := h.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		keyDepartment = key.departmentId
+		return &key.private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{constants.SigningAlgorithm}), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	claims, ok := token.Claims.(*AccessClaims)
 	if !ok {
 		return nil, errors.New("error extracting claims")
 	}
 
+	if departmentId == "" {
+		departmentId = keyDepartment
+	}
+
+	if keyDepartment != departmentId {
+		return nil, errors.New(constants.TokenIssuerError)
+	}
+
+	if err := checkIssuedFor(claims, claims.DepartmentID, departmentId); err != nil {
+		return nil, err
+	}
+
 	return claims, nil
 }
 
+// AccessTokenDepartment returns the department whose key signed the
+// request's access token. The signature is checked but not the lifetime, an
+// expired token still belongs to its department.
+func (h *AuthHelper) AccessTokenDepartment(r *http.Request) (string, error) {
+	tokenString, err := h.AccessToken(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	var keyDepartment string
+
+	_, err = jwt.ParseWithClaims(tokenString, &AccessClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := h.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		keyDepartment = key.departmentId
+		return &key.private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{constants.SigningAlgorithm}), jwt.WithoutClaimsValidation())
+
+	if err != nil {
+		return "", err
+	}
+
+	return keyDepartment, nil
+}
+
+// checkIssuedFor checks the token's issuer, audience and department claims
+// all name the department.
+func checkIssuedFor(claims jwt.Claims, tokenDepartment string, departmentId string) error {
+	issuer, err := claims.GetIssuer()
+	if err != nil || issuer != JwtIssuer(departmentId) {
+		return errors.New(constants.TokenIssuerError)
+	}
+
+	audience, err := claims.GetAudience()
+	if err != nil || !slices.Contains(audience, departmentId) {
+		return errors.New(constants.TokenIssuerError)
+	}
+
+	if tokenDepartment != departmentId {
+		return errors.New(constants.TokenIssuerError)
+	}
+
+	return nil
+}
+
 func (h *AuthHelper) GenerateRefreshJwtToken(user *models.UserModel, tenant string) (string, error) {
 	h.log.Debug().Msgf("Generating JWT token for user: %s", user.Name)
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":           user.ID,
-		"departmentId": tenant,
-		"exp":          time.Now().Add(time.Hour * time.Duration(config.AppConfig.RefreshJwtExpire)).Unix(),
+	settings, err := h.GetEffectiveSettings(tenant)
+	if err != nil {
+		return "", errors.New("error generating JWT Refresh token")
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, &RefreshClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    JwtIssuer(tenant),
+			Audience:  jwt.ClaimStrings{tenant},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(settings.RefreshTokenTtlHours))),
+		},
+		UserID:       user.ID,
+		DepartmentID: tenant,
 	})
 
 	token, err := t.SignedString([]byte(config.AppConfig.RefreshJwtSecret))
@@ -61,20 +223,35 @@ func (h *AuthHelper) GenerateRefreshJwtToken(user *models.UserModel, tenant stri
 	return token, nil
 }
 
-func (h *AuthHelper) ParseRefreshJwtToken(tokenString string) (jwt.MapClaims, error) {
+// ParseRefreshJwtToken verifies a refresh token issued for the department.
+// Without tenant credentials the token's own department is used, it is
+// signed with the refresh secret so the claim can be trusted.
+func (h *AuthHelper) ParseRefreshJwtToken(tokenString string, departmentId string) (*RefreshClaims, error) {
 	h.log.Debug().Msgf("Parsing JWT Refresh token: %s", tokenString)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &RefreshClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(config.AppConfig.RefreshJwtSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	claims, ok := token.Claims.(*RefreshClaims)
 	if !ok {
 		return nil, errors.New("error extracting claims")
 	}
 
+	if departmentId == "" {
+		departmentId = claims.DepartmentID
+	}
+
+	if err := checkIssuedFor(claims, claims.DepartmentID, departmentId); err != nil {
+		return nil, err
+	}
+
+	if claims.UserID == "" || departmentId == "" {
+		return nil, errors.New("refresh token has no user or department")
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+type MetadataHelper struct {
+	log            *zerolog.Logger
+	departmentRepo repository.DepartmentRepository
+}
+
+func NewMetadataHelper(log *zerolog.Logger, departmentRepo repository.DepartmentRepository) *MetadataHelper {
+	return &MetadataHelper{log: log, departmentRepo: departmentRepo}
+}
+
+// LoadSchema returns the department's user metadata schema, or nil when the
+// department has not defined one.
+func (h *MetadataHelper) LoadSchema(departmentId string) (*JSONSchema, error) {
+	config, err := h.departmentRepo.FindConfig(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.UserMetadataSchema) == 0 {
+		return nil, nil
+	}
+
+	return ParseJSONSchema(config.UserMetadataSchema)
+}
+
+// MergeMetadata applies a top-level merge patch to the current metadata. A
+// null value removes the key.
+func MergeMetadata(current json.RawMessage, patch map[string]json.RawMessage) (json.RawMessage, error) {
+	merged := map[string]json.RawMessage{}
+
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &merged); err != nil {
+			return nil, fmt.Errorf("invalid stored metadata: %w", err)
+		}
+	}
+
+	for key, value := range patch {
+		if string(value) == "null" {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+// ProjectClaims picks the configured attributes out of a user's metadata for
+// inclusion in an access token.
+func ProjectClaims(metadata json.RawMessage, claims models.StringList) map[string]interface{} {
+	if len(claims) == 0 || len(metadata) == 0 {
+		return nil
+	}
+
+	var values map[string]interface{}
+
+	if err := json.Unmarshal(metadata, &values); err != nil {
+		return nil
+	}
+
+	projected := make(map[string]interface{}, len(claims))
+
+	for _, claim := range claims {
+		if value, ok := values[claim]; ok {
+			projected[claim] = value
+		}
+	}
+
+	return projected
+}
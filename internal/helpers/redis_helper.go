@@ -36,3 +36,41 @@ func (r *RedisHelper) SetData(key string, value string, ttl time.Duration) error
 
 	return r.client.Set(r.ctx, key, value, ttl|constants.DefaultRedisTtl).Err()
 }
+
+func (r *RedisHelper) DeleteData(keys ...string) error {
+	r.log.
+		Debug().
+		Strs("keys", keys).
+		Msg("Deleting keys from redis")
+
+	return r.client.Del(r.ctx, keys...).Err()
+}
+
+// SetDataIfAbsent sets the key only if it does not exist yet and reports
+// whether it was set. Unlike SetData the ttl is used as is.
+func (r *RedisHelper) SetDataIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	r.log.
+		Debug().
+		Str("key", key).
+		Msgf("Setting key %s in redis if absent", key)
+
+	return r.client.SetNX(r.ctx, key, value, ttl).Result()
+}
+
+// DeleteByPattern deletes every key matching the glob pattern.
+func (r *RedisHelper) DeleteByPattern(pattern string) error {
+	r.log.
+		Debug().
+		Str("pattern", pattern).
+		Msgf("Deleting keys matching %s from redis", pattern)
+
+	iter := r.client.Scan(r.ctx, 0, pattern, 0).Iterator()
+
+	for iter.Next(r.ctx) {
+		if err := r.client.Del(r.ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
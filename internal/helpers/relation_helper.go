@@ -0,0 +1,560 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrConsistencyToken = errors.New(constants.ConsistencyTokenError)
+	ErrRelationDepth    = fmt.Errorf(constants.RelationDepthError, constants.RelationMaxDepth)
+	ErrRelationFanOut   = fmt.Errorf(constants.RelationFanOutError, constants.RelationMaxUsersets)
+)
+
+// RelationNotDefinedError is returned for tuples whose relation the
+// department's namespace configuration doesn't define.
+type RelationNotDefinedError struct {
+	Namespace string
+	Relation  string
+}
+
+func (e *RelationNotDefinedError) Error() string {
+	return fmt.Sprintf(constants.RelationNotDefinedError, e.Relation, e.Namespace)
+}
+
+// RelationHelper stores relation tuples and answers questions about them the
+// way Zanzibar does: a subject has a relation to an object through a tuple,
+// through a relation that implies it, or through related objects, following
+// usersets such as group:eng#member.
+type RelationHelper struct {
+	log          *zerolog.Logger
+	relationRepo repository.RelationRepository
+}
+
+func NewRelationHelper(log *zerolog.Logger, relationRepo repository.RelationRepository) *RelationHelper {
+	return &RelationHelper{log: log, relationRepo: relationRepo}
+}
+
+// ParseRelationTuple parses a tuple such as doc:123#viewer@user:abc or
+// doc:123#viewer@group:eng#member.
+func ParseRelationTuple(value string) (*models.RelationTupleModel, error) {
+	object, subject, ok := strings.Cut(value, "@")
+
+	if !ok {
+		return nil, fmt.Errorf("tuple %q has no subject", value)
+	}
+
+	tuple := &models.RelationTupleModel{}
+
+	match := relationUsersetPattern.FindStringSubmatch(object)
+
+	if match == nil {
+		return nil, fmt.Errorf("tuple %q has an invalid object or relation", value)
+	}
+
+	tuple.Namespace, tuple.ObjectID, tuple.Relation = match[1], match[2], match[3]
+
+	namespace, id, relation, err := ParseRelationSubject(subject)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tuple.SubjectNamespace, tuple.SubjectID, tuple.SubjectRelation = namespace, id, relation
+	return tuple, nil
+}
+
+// ParseRelationSubject parses a subject, an object such as user:abc or a
+// userset such as group:eng#member.
+func ParseRelationSubject(value string) (string, string, string, error) {
+	match := relationSubjectPattern.FindStringSubmatch(value)
+
+	if match == nil {
+		return "", "", "", fmt.Errorf("invalid subject %q", value)
+	}
+
+	return match[1], match[2], match[3], nil
+}
+
+// ParseRelationUserset parses a userset such as doc:123#viewer.
+func ParseRelationUserset(value string) (string, string, string, error) {
+	match := relationUsersetPattern.FindStringSubmatch(value)
+
+	if match == nil {
+		return "", "", "", fmt.Errorf("invalid userset %q", value)
+	}
+
+	return match[1], match[2], match[3], nil
+}
+
+// Write deletes and writes tuples of the department in one revision and
+// returns its consistency token. Every relation has to be defined by the
+// department's namespaces, those of userset subjects included.
+func (h *RelationHelper) Write(departmentId string, writes []string, deletes []string) (string, error) {
+	namespaces, err := h.namespaces(departmentId)
+
+	if err != nil {
+		return "", err
+	}
+
+	writeTuples, err := parseDefinedTuples(namespaces, writes)
+
+	if err != nil {
+		return "", err
+	}
+
+	deleteTuples, err := parseDefinedTuples(namespaces, deletes)
+
+	if err != nil {
+		return "", err
+	}
+
+	revision, err := h.relationRepo.Write(departmentId, writeTuples, deleteTuples)
+
+	if err != nil {
+		return "", err
+	}
+
+	return EncodeConsistencyToken(departmentId, revision), nil
+}
+
+// Revision returns the revision a read with the consistency is evaluated at.
+// The store is the database every write commits to, so its latest revision
+// is at least as fresh as any token, only exact reads go back in time.
+func (h *RelationHelper) Revision(departmentId string, consistency models.RelationConsistency) (uint64, error) {
+	latest, err := h.relationRepo.Revision(departmentId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if consistency.Token == "" {
+		return latest, nil
+	}
+
+	revision, err := DecodeConsistencyToken(departmentId, consistency.Token)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if revision > latest {
+		return 0, ErrConsistencyToken
+	}
+
+	if consistency.Exact {
+		return revision, nil
+	}
+
+	return latest, nil
+}
+
+// Check reports whether the tuple's subject has the relation to the object at
+// the revision, directly or through rewrites and usersets.
+func (h *RelationHelper) Check(departmentId string, value string, revision uint64) (bool, error) {
+	tuple, err := ParseRelationTuple(value)
+
+	if err != nil {
+		return false, err
+	}
+
+	evaluation, err := h.evaluation(departmentId, revision)
+
+	if err != nil {
+		return false, err
+	}
+
+	return evaluation.check(tuple.Namespace, tuple.ObjectID, tuple.Relation, tuple.Subject(), map[string]bool{}, 0)
+}
+
+// Expand returns the tree of the subjects that have the userset at the
+// revision, following rewrites and nested usersets.
+func (h *RelationHelper) Expand(departmentId string, userset string, revision uint64) (*models.RelationNode, error) {
+	namespace, objectId, relation, err := ParseRelationUserset(userset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation, err := h.evaluation(departmentId, revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := evaluation.relation(namespace, relation); err != nil {
+		return nil, err
+	}
+
+	return evaluation.expand(namespace, objectId, relation, "", map[string]bool{}, 0)
+}
+
+// ListObjects returns the ids of the namespace's objects the subject has the
+// relation to at the revision. Only objects with tuples can have relations,
+// so those are the candidates: a page examines up to limit of them after the
+// cursor, and returns the cursor of the next page while there are more. A
+// page can hold fewer objects than it examined, even none.
+func (h *RelationHelper) ListObjects(departmentId string, namespace string, relation string, subject string, revision uint64, cursor string, limit int) ([]string, string, error) {
+	if limit <= 0 || limit > constants.RelationListObjectsLimit {
+		limit = constants.RelationListObjectsLimit
+	}
+
+	evaluation, err := h.evaluation(departmentId, revision)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := evaluation.relation(namespace, relation); err != nil {
+		return nil, "", err
+	}
+
+	ids, err := h.relationRepo.FindObjectIds(departmentId, namespace, revision, cursor, limit)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	objects := []string{}
+
+	for _, id := range ids {
+		evaluation.visited = 0
+		allowed, err := evaluation.check(namespace, id, relation, subject, map[string]bool{}, 0)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if allowed {
+			objects = append(objects, id)
+		}
+	}
+
+	next := ""
+
+	if len(ids) == limit {
+		next = ids[len(ids)-1]
+	}
+
+	return objects, next, nil
+}
+
+// ValidRelationName reports whether the name can name a namespace or relation.
+func ValidRelationName(name string) bool {
+	return relationNamePattern.MatchString(name)
+}
+
+// ValidateNamespace checks the relations are defined once and only refer to
+// relations of the namespace. Relations of related objects live in other
+// namespaces and are resolved when evaluated.
+func ValidateNamespace(name string, relations models.NamespaceRelations) error {
+	namespace := &models.RelationNamespaceModel{Name: name, Relations: relations}
+	seen := map[string]bool{}
+
+	for _, relation := range relations {
+		if seen[relation.Name] {
+			return fmt.Errorf(constants.DuplicateRelationError, relation.Name)
+		}
+
+		seen[relation.Name] = true
+
+		for _, implying := range relation.ImpliedBy {
+			if namespace.Relation(implying) == nil {
+				return &RelationNotDefinedError{Namespace: name, Relation: implying}
+			}
+		}
+
+		for _, related := range relation.FromRelated {
+			if namespace.Relation(related.Tupleset) == nil {
+				return &RelationNotDefinedError{Namespace: name, Relation: related.Tupleset}
+			}
+		}
+	}
+
+	return nil
+}
+
+// EncodeConsistencyToken returns the opaque token of the department's revision.
+func EncodeConsistencyToken(departmentId string, revision uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(departmentId + ":" + strconv.FormatUint(revision, 10)))
+}
+
+// DecodeConsistencyToken returns the revision of a token issued to the department.
+func DecodeConsistencyToken(departmentId string, token string) (uint64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return 0, ErrConsistencyToken
+	}
+
+	tokenDepartment, value, ok := strings.Cut(string(decoded), ":")
+
+	if !ok || tokenDepartment != departmentId {
+		return 0, ErrConsistencyToken
+	}
+
+	revision, err := strconv.ParseUint(value, 10, 64)
+
+	if err != nil {
+		return 0, ErrConsistencyToken
+	}
+
+	return revision, nil
+}
+
+func (h *RelationHelper) namespaces(departmentId string) (map[string]*models.RelationNamespaceModel, error) {
+	namespaces, err := h.relationRepo.FindNamespaces(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*models.RelationNamespaceModel, len(namespaces))
+
+	for i := range namespaces {
+		byName[namespaces[i].Name] = &namespaces[i]
+	}
+
+	return byName, nil
+}
+
+func (h *RelationHelper) evaluation(departmentId string, revision uint64) (*relationEvaluation, error) {
+	namespaces, err := h.namespaces(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &relationEvaluation{
+		departmentId: departmentId,
+		revision:     revision,
+		namespaces:   namespaces,
+		relationRepo: h.relationRepo,
+	}, nil
+}
+
+func parseDefinedTuples(namespaces map[string]*models.RelationNamespaceModel, values []string) ([]models.RelationTupleModel, error) {
+	tuples := make([]models.RelationTupleModel, 0, len(values))
+
+	for _, value := range values {
+		tuple, err := ParseRelationTuple(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !relationDefined(namespaces, tuple.Namespace, tuple.Relation) {
+			return nil, &RelationNotDefinedError{Namespace: tuple.Namespace, Relation: tuple.Relation}
+		}
+
+		if tuple.SubjectRelation != "" && !relationDefined(namespaces, tuple.SubjectNamespace, tuple.SubjectRelation) {
+			return nil, &RelationNotDefinedError{Namespace: tuple.SubjectNamespace, Relation: tuple.SubjectRelation}
+		}
+
+		tuples = append(tuples, *tuple)
+	}
+
+	return tuples, nil
+}
+
+func relationDefined(namespaces map[string]*models.RelationNamespaceModel, namespace string, relation string) bool {
+	config, ok := namespaces[namespace]
+	return ok && config.Relation(relation) != nil
+}
+
+// relationEvaluation answers the questions of one request at one revision
+// with the namespaces loaded once. Visited counts the usersets a question
+// has looked up, so wide rewrites give up like deep ones do.
+type relationEvaluation struct {
+	departmentId string
+	revision     uint64
+	namespaces   map[string]*models.RelationNamespaceModel
+	relationRepo repository.RelationRepository
+	visited      int
+}
+
+func (e *relationEvaluation) visit() error {
+	e.visited++
+
+	if e.visited > constants.RelationMaxUsersets {
+		return ErrRelationFanOut
+	}
+
+	return nil
+}
+
+func (e *relationEvaluation) relation(namespace string, name string) (*models.NamespaceRelation, error) {
+	config, ok := e.namespaces[namespace]
+
+	if ok {
+		if relation := config.Relation(name); relation != nil {
+			return relation, nil
+		}
+	}
+
+	return nil, &RelationNotDefinedError{Namespace: namespace, Relation: name}
+}
+
+// check reports whether the subject, an object or a userset, has the relation
+// to the object. A relation a namespace doesn't define is had by no one, so a
+// rewrite to a relation of another namespace that is missing grants nothing.
+// Usersets already on the path grant nothing more, so cycles end.
+func (e *relationEvaluation) check(namespace string, objectId string, name string, subject string, path map[string]bool, depth int) (bool, error) {
+	if depth > constants.RelationMaxDepth {
+		return false, ErrRelationDepth
+	}
+
+	userset := namespace + ":" + objectId + "#" + name
+	relation, err := e.relation(namespace, name)
+
+	if err != nil || path[userset] {
+		return false, nil
+	}
+
+	if err := e.visit(); err != nil {
+		return false, err
+	}
+
+	path[userset] = true
+	defer delete(path, userset)
+
+	tuples, err := e.relationRepo.FindTuples(e.departmentId, namespace, objectId, name, e.revision)
+
+	if err != nil {
+		return false, err
+	}
+
+	for i := range tuples {
+		if tuples[i].Subject() == subject {
+			return true, nil
+		}
+	}
+
+	for i := range tuples {
+		if tuples[i].SubjectRelation == "" {
+			continue
+		}
+
+		allowed, err := e.check(tuples[i].SubjectNamespace, tuples[i].SubjectID, tuples[i].SubjectRelation, subject, path, depth+1)
+
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	for _, implying := range relation.ImpliedBy {
+		allowed, err := e.check(namespace, objectId, implying, subject, path, depth+1)
+
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	for _, related := range relation.FromRelated {
+		tuplesets, err := e.relationRepo.FindTuples(e.departmentId, namespace, objectId, related.Tupleset, e.revision)
+
+		if err != nil {
+			return false, err
+		}
+
+		for i := range tuplesets {
+			allowed, err := e.check(tuplesets[i].SubjectNamespace, tuplesets[i].SubjectID, related.Relation, subject, path, depth+1)
+
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// expand builds the tree of the userset. Usersets already on the path are
+// listed without children, so cycles end.
+func (e *relationEvaluation) expand(namespace string, objectId string, name string, via string, path map[string]bool, depth int) (*models.RelationNode, error) {
+	node := &models.RelationNode{
+		Userset:  namespace + ":" + objectId + "#" + name,
+		Via:      via,
+		Subjects: []string{},
+	}
+
+	if depth > constants.RelationMaxDepth {
+		return nil, ErrRelationDepth
+	}
+
+	relation, err := e.relation(namespace, name)
+
+	if err != nil || path[node.Userset] {
+		return node, nil
+	}
+
+	if err := e.visit(); err != nil {
+		return nil, err
+	}
+
+	path[node.Userset] = true
+	defer delete(path, node.Userset)
+
+	tuples, err := e.relationRepo.FindTuples(e.departmentId, namespace, objectId, name, e.revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	children := []*models.RelationNode{}
+
+	add := func(namespace string, objectId string, name string, via string) error {
+		child, err := e.expand(namespace, objectId, name, via, path, depth+1)
+
+		if err == nil {
+			children = append(children, child)
+		}
+
+		return err
+	}
+
+	for i := range tuples {
+		if tuples[i].SubjectRelation == "" {
+			node.Subjects = append(node.Subjects, tuples[i].Subject())
+			continue
+		}
+
+		if err := add(tuples[i].SubjectNamespace, tuples[i].SubjectID, tuples[i].SubjectRelation, "subject"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, implying := range relation.ImpliedBy {
+		if err := add(namespace, objectId, implying, "impliedBy"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, related := range relation.FromRelated {
+		tuplesets, err := e.relationRepo.FindTuples(e.departmentId, namespace, objectId, related.Tupleset, e.revision)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range tuplesets {
+			if err := add(tuplesets[i].SubjectNamespace, tuplesets[i].SubjectID, related.Relation, "fromRelated "+related.Tupleset); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(children) > 0 {
+		node.Children = children
+	}
+
+	return node, nil
+}
@@ -0,0 +1,221 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"uas/internal/models"
+)
+
+// testNamespaces let doc owners edit and editors view, and viewers of a
+// doc's parent folder view the doc.
+var testNamespaces = []models.RelationNamespaceModel{
+	{Name: "user"},
+	{Name: "group", Relations: models.NamespaceRelations{{Name: "member"}}},
+	{Name: "folder", Relations: models.NamespaceRelations{{Name: "viewer"}}},
+	{Name: "doc", Relations: models.NamespaceRelations{
+		{Name: "parent"},
+		{Name: "owner"},
+		{Name: "editor", ImpliedBy: []string{"owner"}},
+		{Name: "viewer", ImpliedBy: []string{"editor"}, FromRelated: []models.RelatedUserset{{Tupleset: "parent", Relation: "viewer"}}},
+	}},
+}
+
+func newTestRelationHelper(t *testing.T, tuples ...string) (*RelationHelper, *fakeRelationRepo) {
+	t.Helper()
+
+	relationRepo := &fakeRelationRepo{namespaces: testNamespaces}
+	helper := NewRelationHelper(&testLog, relationRepo)
+
+	if len(tuples) > 0 {
+		if _, err := helper.Write(testDepartment, tuples, nil); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+
+	return helper, relationRepo
+}
+
+func TestRelationCheck(t *testing.T) {
+	helper, relationRepo := newTestRelationHelper(t,
+		"doc:readme#viewer@user:alice",
+		"doc:readme#viewer@group:eng#member",
+		"group:eng#member@user:carol",
+		"doc:readme#owner@user:dave",
+		"doc:readme#parent@folder:docs",
+		"folder:docs#viewer@user:erin",
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+	)
+
+	tests := []struct {
+		name  string
+		tuple string
+		want  bool
+	}{
+		{name: "direct", tuple: "doc:readme#viewer@user:alice", want: true},
+		{name: "direct other subject", tuple: "doc:readme#viewer@user:bob"},
+		{name: "direct userset subject", tuple: "doc:readme#viewer@group:eng#member", want: true},
+		{name: "through userset", tuple: "doc:readme#viewer@user:carol", want: true},
+		{name: "computed userset", tuple: "doc:readme#editor@user:dave", want: true},
+		{name: "computed userset twice", tuple: "doc:readme#viewer@user:dave", want: true},
+		{name: "computed userset doesn't imply upwards", tuple: "doc:readme#owner@user:alice"},
+		{name: "tuple to userset", tuple: "doc:readme#viewer@user:erin", want: true},
+		{name: "tuple to userset only for its relation", tuple: "doc:readme#editor@user:erin"},
+		{name: "tuple to userset of another object", tuple: "doc:other#viewer@user:erin"},
+		{name: "cycle", tuple: "group:a#member@user:alice"},
+		{name: "undefined relation", tuple: "doc:readme#commenter@user:alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := helper.Check(testDepartment, tt.tuple, relationRepo.revision)
+
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			if allowed != tt.want {
+				t.Fatalf("Check() = %v, want %v", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationCheckGivesUp(t *testing.T) {
+	deep := []string{}
+
+	for i := 0; i < 30; i++ {
+		deep = append(deep, fmt.Sprintf("group:g%d#member@group:g%d#member", i, i+1))
+	}
+
+	wide := []string{}
+
+	for i := 0; i < 1001; i++ {
+		wide = append(wide, fmt.Sprintf("group:root#member@group:g%d#member", i))
+	}
+
+	tests := []struct {
+		name   string
+		tuples []string
+		check  string
+		want   error
+	}{
+		{name: "too deep", tuples: deep, check: "group:g0#member@user:alice", want: ErrRelationDepth},
+		{name: "too wide", tuples: wide, check: "group:root#member@user:alice", want: ErrRelationFanOut},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helper, relationRepo := newTestRelationHelper(t)
+
+			// written past Write, which takes at most 100 tuples per request
+			for _, value := range tt.tuples {
+				tuple, err := ParseRelationTuple(value)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tuple.DepartmentID = testDepartment
+				relationRepo.tuples = append(relationRepo.tuples, *tuple)
+			}
+
+			if _, err := helper.Check(testDepartment, tt.check, relationRepo.revision); !errors.Is(err, tt.want) {
+				t.Fatalf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationConsistency(t *testing.T) {
+	helper, relationRepo := newTestRelationHelper(t)
+
+	written, err := helper.Write(testDepartment, []string{"doc:readme#viewer@user:alice"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := helper.Write(testDepartment, nil, []string{"doc:readme#viewer@user:alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		consistency models.RelationConsistency
+		want        bool
+		wantErr     error
+	}{
+		{name: "no token sees the latest", consistency: models.RelationConsistency{}},
+		{name: "stale token sees the latest", consistency: models.RelationConsistency{Token: written}},
+		{name: "stale exact token sees its revision", consistency: models.RelationConsistency{Token: written, Exact: true}, want: true},
+		{name: "latest exact token", consistency: models.RelationConsistency{Token: deleted, Exact: true}},
+		{name: "token from the future", consistency: models.RelationConsistency{Token: EncodeConsistencyToken(testDepartment, relationRepo.revision+1)}, wantErr: ErrConsistencyToken},
+		{name: "token of another department", consistency: models.RelationConsistency{Token: EncodeConsistencyToken("other", 1), Exact: true}, wantErr: ErrConsistencyToken},
+		{name: "malformed token", consistency: models.RelationConsistency{Token: "!"}, wantErr: ErrConsistencyToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision, err := helper.Revision(testDepartment, tt.consistency)
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Revision() = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			allowed, err := helper.Check(testDepartment, "doc:readme#viewer@user:alice", revision)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if allowed != tt.want {
+				t.Fatalf("Check() at revision %d = %v, want %v", revision, allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationListObjectsPages(t *testing.T) {
+	helper, relationRepo := newTestRelationHelper(t,
+		"doc:d1#viewer@user:alice",
+		"doc:d2#viewer@user:bob",
+		"doc:d3#owner@user:alice",
+		"doc:d4#parent@folder:docs",
+		"folder:docs#viewer@user:alice",
+		"doc:d5#viewer@user:bob",
+	)
+
+	pages := []struct {
+		objects []string
+		next    string
+	}{
+		{objects: []string{"d1"}, next: "d2"},
+		{objects: []string{"d3", "d4"}, next: "d4"},
+		{objects: []string{}},
+	}
+
+	cursor := ""
+
+	for i, page := range pages {
+		objects, next, err := helper.ListObjects(testDepartment, "doc", "viewer", "user:alice", relationRepo.revision, cursor, 2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(objects, page.objects) || next != page.next {
+			t.Fatalf("page %d = %v, %q, want %v, %q", i, objects, next, page.objects, page.next)
+		}
+
+		cursor = next
+	}
+}
@@ -23,11 +23,13 @@ func (r *ResponseHelper) SendSuccessResponse(w http.ResponseWriter, message stri
 		Data:    data,
 	}
 
-	json.NewEncoder(w).Encode(response)
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 	return
 }
 
+// SendErrorResponse writes the status before the body, once the body is
+// written Go has already sent a 200.
 func (r *ResponseHelper) SendErrorResponse(w http.ResponseWriter, message string, errorCode string, err error) {
 	r.log.Error().Err(err).Msg(message)
 
@@ -36,20 +38,26 @@ func (r *ResponseHelper) SendErrorResponse(w http.ResponseWriter, message string
 		ErrorCode: errorCode,
 	}
 
+	w.WriteHeader(errorStatus(errorCode))
 	json.NewEncoder(w).Encode(response)
+	return
+}
+
+func errorStatus(errorCode string) int {
 	switch errorCode {
 	case constants.NotFound:
-		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
 	case constants.Unauthorized:
-		w.WriteHeader(http.StatusUnauthorized)
+		return http.StatusUnauthorized
 	case constants.InternalServerError:
-		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
 	case constants.Forbidden:
-		w.WriteHeader(http.StatusForbidden)
+		return http.StatusForbidden
 	case constants.BadRequest:
-		w.WriteHeader(http.StatusBadRequest)
+		return http.StatusBadRequest
+	case constants.TooManyRequests, constants.QuotaExceeded:
+		return http.StatusTooManyRequests
 	default:
-		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
 	}
-	return
 }
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSendErrorResponseStatus(t *testing.T) {
+	log := zerolog.Nop()
+	h := NewResponseHelper(&log)
+
+	tests := []struct {
+		errorCode string
+		want      int
+	}{
+		{constants.BadRequest, http.StatusBadRequest},
+		{constants.Unauthorized, http.StatusUnauthorized},
+		{constants.Forbidden, http.StatusForbidden},
+		{constants.NotFound, http.StatusNotFound},
+		{constants.TooManyRequests, http.StatusTooManyRequests},
+		{constants.QuotaExceeded, http.StatusTooManyRequests},
+		{constants.InternalServerError, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.errorCode, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.SendErrorResponse(w, "error", tt.errorCode, nil)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			var res models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+
+			if res.ErrorCode != tt.errorCode {
+				t.Errorf("errorCode = %q, want %q", res.ErrorCode, tt.errorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLastAdmin      = errors.New(constants.LastAdminError)
+	ErrRoleEscalation = errors.New(constants.RoleEscalationError)
+	ErrGroupCycle     = errors.New(constants.GroupCycleError)
+)
+
+// RoleHelper resolves what the roles of a department allow, whether members
+// have them directly or through the groups they are in.
+type RoleHelper struct {
+	log            *zerolog.Logger
+	roleRepo       repository.RoleRepository
+	departmentRepo repository.DepartmentRepository
+	groupRepo      repository.GroupRepository
+	redisHelper    *RedisHelper
+}
+
+func NewRoleHelper(
+	log *zerolog.Logger,
+	roleRepo repository.RoleRepository,
+	departmentRepo repository.DepartmentRepository,
+	groupRepo repository.GroupRepository,
+	redisHelper *RedisHelper,
+) *RoleHelper {
+	return &RoleHelper{
+		log:            log,
+		roleRepo:       roleRepo,
+		departmentRepo: departmentRepo,
+		groupRepo:      groupRepo,
+		redisHelper:    redisHelper,
+	}
+}
+
+// Permissions returns the permissions the role grants in the department.
+// Built-in roles always grant what the code defines, so they keep working
+// for departments whose roles haven't been seeded yet.
+func (h *RoleHelper) Permissions(departmentId string, role models.Role) ([]models.Permission, error) {
+	if permissions, ok := models.BuiltInRolePermissions[role]; ok {
+		return permissions, nil
+	}
+
+	model, err := h.roleRepo.FindByName(departmentId, role)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return model.PermissionList(), nil
+}
+
+// EffectivePermissions returns the permissions of the member's role together
+// with those of the roles of every group they are in, nested groups included.
+// Roles deleted from under the member or a group grant nothing.
+func (h *RoleHelper) EffectivePermissions(departmentId string, userId string, role models.Role) ([]models.Permission, error) {
+	groupRoles, err := h.GroupRoles(departmentId, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.rolesPermissions(departmentId, append([]models.Role{role}, groupRoles...))
+}
+
+// MemberScopes returns the scopes of the member's access tokens, granted by
+// their effective permissions in the department.
+func (h *RoleHelper) MemberScopes(departmentId string, userId string, role models.Role) ([]models.Scope, error) {
+	permissions, err := h.EffectivePermissions(departmentId, userId, role)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ScopesFor(permissions), nil
+}
+
+// GroupRoles returns the roles the member, a user or a group, inherits from
+// the groups they are in. The flattened roles are cached in redis until the
+// groups of the department change.
+func (h *RoleHelper) GroupRoles(departmentId string, memberId string) ([]models.Role, error) {
+	key := fmt.Sprintf(constants.GroupRolesRedisKey, departmentId, memberId)
+
+	if cached, err := h.redisHelper.GetData(key); err == nil {
+		var roles []models.Role
+
+		if err := json.Unmarshal([]byte(cached), &roles); err == nil {
+			return roles, nil
+		}
+	}
+
+	groupIds, err := h.Ancestors(departmentId, memberId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := h.groupRepo.FindRoles(groupIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]models.Role, 0, len(grants))
+
+	for _, grant := range grants {
+		if !slices.Contains(roles, grant.Role) {
+			roles = append(roles, grant.Role)
+		}
+	}
+
+	if value, err := json.Marshal(roles); err == nil {
+		if err := h.redisHelper.SetData(key, string(value), constants.GroupRolesCacheTtl); err != nil {
+			h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error caching group roles")
+		}
+	}
+
+	return roles, nil
+}
+
+// Ancestors returns the ids of the groups of the department the member, a
+// user or a group, is in, directly or through nested groups. Every group is
+// visited once, so a cycle in the stored memberships can't loop forever.
+func (h *RoleHelper) Ancestors(departmentId string, memberId string) ([]string, error) {
+	visited := map[string]bool{memberId: true}
+	groupIds := []string{}
+	frontier := []string{memberId}
+
+	for len(frontier) > 0 {
+		memberships, err := h.groupRepo.FindMemberships(departmentId, frontier)
+
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+
+		for _, membership := range memberships {
+			if visited[membership.GroupID] {
+				continue
+			}
+
+			visited[membership.GroupID] = true
+			groupIds = append(groupIds, membership.GroupID)
+			frontier = append(frontier, membership.GroupID)
+		}
+	}
+
+	return groupIds, nil
+}
+
+// CheckNesting returns ErrGroupCycle if putting the child group in the parent
+// would make a group contain itself.
+func (h *RoleHelper) CheckNesting(departmentId string, parentId string, childId string) error {
+	if parentId == childId {
+		return ErrGroupCycle
+	}
+
+	ancestors, err := h.Ancestors(departmentId, parentId)
+
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(ancestors, childId) {
+		return ErrGroupCycle
+	}
+
+	return nil
+}
+
+// CheckGroupGrant returns ErrRoleEscalation if a member with the granted
+// permissions would add members to a group whose roles, its own or inherited
+// from the groups it's in, can do more than they can.
+func (h *RoleHelper) CheckGroupGrant(departmentId string, granted []models.Permission, groupId string) error {
+	grants, err := h.groupRepo.FindRoles([]string{groupId})
+
+	if err != nil {
+		return err
+	}
+
+	roles, err := h.GroupRoles(departmentId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		roles = append(roles, grant.Role)
+	}
+
+	permissions, err := h.rolesPermissions(departmentId, roles)
+
+	if err != nil {
+		return err
+	}
+
+	if !HasPermissions(granted, permissions) {
+		return ErrRoleEscalation
+	}
+
+	return nil
+}
+
+// InvalidateGroupRoles drops the cached group roles of the department's
+// members after its groups, their members or their roles changed.
+func (h *RoleHelper) InvalidateGroupRoles(departmentId string) {
+	if err := h.redisHelper.DeleteByPattern(fmt.Sprintf(constants.GroupRolesRedisKey, departmentId, "*")); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error invalidating group roles")
+	}
+}
+
+// rolesPermissions returns the permissions the roles grant together, in the
+// order of models.Permissions.
+func (h *RoleHelper) rolesPermissions(departmentId string, roles []models.Role) ([]models.Permission, error) {
+	granted := map[models.Permission]bool{}
+
+	for _, role := range roles {
+		permissions, err := h.Permissions(departmentId, role)
+
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		for _, permission := range permissions {
+			granted[permission] = true
+		}
+	}
+
+	permissions := make([]models.Permission, 0, len(granted))
+
+	for _, permission := range models.Permissions {
+		if granted[permission] {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	return permissions, nil
+}
+
+// RoleExists reports whether the department has the role.
+func (h *RoleHelper) RoleExists(departmentId string, role models.Role) (bool, error) {
+	if models.IsBuiltInRole(role) {
+		return true, nil
+	}
+
+	_, err := h.roleRepo.FindByName(departmentId, role)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// CheckGrant returns ErrRoleEscalation if a member with the granted
+// permissions would hand out a role that can do more than they can.
+func (h *RoleHelper) CheckGrant(departmentId string, granted []models.Permission, role models.Role) error {
+	permissions, err := h.Permissions(departmentId, role)
+
+	if err != nil {
+		return err
+	}
+
+	if !HasPermissions(granted, permissions) {
+		return ErrRoleEscalation
+	}
+
+	return nil
+}
+
+// CheckRoleChange returns an error if a member with the granted permissions
+// may not move the membership to the role. Besides CheckGrant and
+// CheckManage, the last admin of a department keeps the role.
+func (h *RoleHelper) CheckRoleChange(granted []models.Permission, membership *models.DepartmentRoles, role models.Role) error {
+	if err := h.CheckGrant(membership.DepartmentID, granted, role); err != nil {
+		return err
+	}
+
+	if err := h.CheckManage(granted, membership); err != nil {
+		return err
+	}
+
+	if role != models.Admin {
+		return h.CheckRemoval(membership)
+	}
+
+	return nil
+}
+
+// CheckManage returns ErrRoleEscalation if a member with the granted
+// permissions would act on a member who can do more than they can, roles of
+// their groups included.
+func (h *RoleHelper) CheckManage(granted []models.Permission, membership *models.DepartmentRoles) error {
+	permissions, err := h.EffectivePermissions(membership.DepartmentID, membership.UserID, membership.Role)
+
+	if err != nil {
+		return err
+	}
+
+	if !HasPermissions(granted, permissions) {
+		return ErrRoleEscalation
+	}
+
+	return nil
+}
+
+// CheckRemoval returns ErrLastAdmin if the membership is the department's
+// last admin, who can't be demoted, disabled or removed. Only admins who can
+// still log in count, a disabled or deactivated one can't take over. The
+// built-in admin role always grants every permission.
+func (h *RoleHelper) CheckRemoval(membership *models.DepartmentRoles) error {
+	if membership.Role != models.Admin {
+		return nil
+	}
+
+	others, err := h.roleRepo.CountActiveMembers(membership.DepartmentID, models.Admin, membership.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	if others == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// CheckUserRemoval is CheckRemoval for every membership of a user who is
+// disabled, deactivated or erased, which takes them out of all of their
+// departments at once.
+func (h *RoleHelper) CheckUserRemoval(memberships []models.DepartmentRoles) error {
+	for i := range memberships {
+		if err := h.CheckRemoval(&memberships[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedBuiltInRoles creates the built-in roles of the department.
+func (h *RoleHelper) SeedBuiltInRoles(departmentId string) error {
+	return h.roleRepo.SeedBuiltIn([]string{departmentId})
+}
+
+// SeedAllBuiltInRoles creates or updates the built-in roles of every
+// department, departments created before roles existed get them this way.
+func (h *RoleHelper) SeedAllBuiltInRoles() error {
+	ids, err := h.departmentRepo.FindIds()
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.roleRepo.SeedBuiltIn(ids); err != nil {
+		return err
+	}
+
+	h.log.Info().Int("departments", len(ids)).Msg("Seeded built-in roles")
+	return nil
+}
+
+// HasPermissions reports whether granted includes every required permission.
+func HasPermissions(granted []models.Permission, required []models.Permission) bool {
+	for _, permission := range required {
+		if !slices.Contains(granted, permission) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,310 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+const testDepartment = "department"
+
+var supportRole = models.RoleModel{
+	DepartmentID: testDepartment,
+	Name:         "support",
+	Permissions:  models.StringList{string(models.UsersReadPermission), string(models.UsersWritePermission)},
+}
+
+func newTestRoleHelper(roleRepo *fakeRoleRepo, groupRepo *fakeGroupRepo) *RoleHelper {
+	return NewRoleHelper(&testLog, roleRepo, nil, groupRepo, unreachableRedis())
+}
+
+func adminMembership(userId string) models.DepartmentRoles {
+	return models.DepartmentRoles{DepartmentID: testDepartment, UserID: userId, Role: models.Admin}
+}
+
+func TestCheckRemoval(t *testing.T) {
+	deactivatedAt := time.Now()
+
+	tests := []struct {
+		name       string
+		membership models.DepartmentRoles
+		other      *models.UserModel
+		otherRole  models.Role
+		want       error
+	}{
+		{name: "last admin", membership: adminMembership("admin"), want: ErrLastAdmin},
+		{name: "another active admin", membership: adminMembership("admin"), other: &models.UserModel{ID: "other"}, otherRole: models.Admin},
+		{name: "other admin disabled", membership: adminMembership("admin"), other: &models.UserModel{ID: "other", Disabled: true}, otherRole: models.Admin, want: ErrLastAdmin},
+		{name: "other admin deactivated", membership: adminMembership("admin"), other: &models.UserModel{ID: "other", DeactivatedAt: &deactivatedAt}, otherRole: models.Admin, want: ErrLastAdmin},
+		{name: "other member not an admin", membership: adminMembership("admin"), other: &models.UserModel{ID: "other"}, otherRole: models.User, want: ErrLastAdmin},
+		{name: "not an admin", membership: models.DepartmentRoles{DepartmentID: testDepartment, UserID: "user", Role: models.User}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleRepo := &fakeRoleRepo{
+				memberships: []models.DepartmentRoles{tt.membership},
+				users:       map[string]models.UserModel{tt.membership.UserID: {ID: tt.membership.UserID}},
+			}
+
+			if tt.other != nil {
+				roleRepo.memberships = append(roleRepo.memberships, models.DepartmentRoles{DepartmentID: testDepartment, UserID: tt.other.ID, Role: tt.otherRole})
+				roleRepo.users[tt.other.ID] = *tt.other
+			}
+
+			err := newTestRoleHelper(roleRepo, &fakeGroupRepo{}).CheckRemoval(&tt.membership)
+
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("CheckRemoval() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUserRemovalChecksEveryDepartment(t *testing.T) {
+	roleRepo := &fakeRoleRepo{
+		memberships: []models.DepartmentRoles{
+			adminMembership("admin"),
+			adminMembership("other"),
+			{DepartmentID: "other-department", UserID: "admin", Role: models.Admin},
+		},
+		users: map[string]models.UserModel{"admin": {ID: "admin"}, "other": {ID: "other"}},
+	}
+
+	memberships := []models.DepartmentRoles{roleRepo.memberships[0], roleRepo.memberships[2]}
+
+	if err := newTestRoleHelper(roleRepo, &fakeGroupRepo{}).CheckUserRemoval(memberships); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("CheckUserRemoval() = %v, want %v", err, ErrLastAdmin)
+	}
+}
+
+func TestCheckGrant(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []models.Permission
+		role    models.Role
+		want    error
+	}{
+		{name: "admin grants admin", granted: models.BuiltInRolePermissions[models.Admin], role: models.Admin},
+		{name: "admin grants custom role", granted: models.BuiltInRolePermissions[models.Admin], role: supportRole.Name},
+		{name: "custom role grants itself", granted: supportRole.PermissionList(), role: supportRole.Name},
+		{name: "custom role grants admin", granted: supportRole.PermissionList(), role: models.Admin, want: ErrRoleEscalation},
+		{name: "user grants custom role", granted: models.BuiltInRolePermissions[models.User], role: supportRole.Name, want: ErrRoleEscalation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleRepo := &fakeRoleRepo{roles: []models.RoleModel{supportRole}}
+
+			err := newTestRoleHelper(roleRepo, &fakeGroupRepo{}).CheckGrant(testDepartment, tt.granted, tt.role)
+
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("CheckGrant() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRoleChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		granted    []models.Permission
+		membership models.DepartmentRoles
+		otherAdmin bool
+		role       models.Role
+		want       error
+	}{
+		{name: "admin demotes admin", granted: models.BuiltInRolePermissions[models.Admin], membership: adminMembership("admin"), otherAdmin: true, role: models.User},
+		{name: "admin demotes last admin", granted: models.BuiltInRolePermissions[models.Admin], membership: adminMembership("admin"), role: models.User, want: ErrLastAdmin},
+		{name: "custom role demotes admin", granted: supportRole.PermissionList(), membership: adminMembership("admin"), otherAdmin: true, role: models.User, want: ErrRoleEscalation},
+		{name: "custom role promotes to admin", granted: supportRole.PermissionList(), membership: models.DepartmentRoles{DepartmentID: testDepartment, UserID: "user", Role: models.User}, role: models.Admin, want: ErrRoleEscalation},
+		{name: "custom role changes user", granted: append(supportRole.PermissionList(), models.BuiltInRolePermissions[models.User]...), membership: models.DepartmentRoles{DepartmentID: testDepartment, UserID: "user", Role: models.User}, role: supportRole.Name},
+		{name: "role deleted from under the member", granted: models.BuiltInRolePermissions[models.User], membership: models.DepartmentRoles{DepartmentID: testDepartment, UserID: "user", Role: "deleted"}, role: models.User},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleRepo := &fakeRoleRepo{
+				roles:       []models.RoleModel{supportRole},
+				memberships: []models.DepartmentRoles{tt.membership},
+				users:       map[string]models.UserModel{tt.membership.UserID: {ID: tt.membership.UserID}},
+			}
+
+			if tt.otherAdmin {
+				roleRepo.memberships = append(roleRepo.memberships, adminMembership("other"))
+				roleRepo.users["other"] = models.UserModel{ID: "other"}
+			}
+
+			err := newTestRoleHelper(roleRepo, &fakeGroupRepo{}).CheckRoleChange(tt.granted, &tt.membership, tt.role)
+
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("CheckRoleChange() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// nestedGroups puts the user in engineering, engineering in staff and staff
+// in admins, which grants admin. Helpdesk only grants support. Loop-a and loop-b contain each other, as
+// stored memberships could if they were written around the checks.
+func nestedGroups() *fakeGroupRepo {
+	return &fakeGroupRepo{
+		members: []models.GroupMemberModel{
+			{GroupID: "engineering", MemberID: "user", MemberType: models.GroupMemberUser},
+			{GroupID: "staff", MemberID: "engineering", MemberType: models.GroupMemberGroup},
+			{GroupID: "admins", MemberID: "staff", MemberType: models.GroupMemberGroup},
+			{GroupID: "loop-a", MemberID: "loop-b", MemberType: models.GroupMemberGroup},
+			{GroupID: "loop-b", MemberID: "loop-a", MemberType: models.GroupMemberGroup},
+		},
+		grants: []models.GroupRoleModel{
+			{GroupID: "engineering", Role: "support", DepartmentID: testDepartment},
+			{GroupID: "helpdesk", Role: "support", DepartmentID: testDepartment},
+			{GroupID: "admins", Role: models.Admin, DepartmentID: testDepartment},
+		},
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	tests := []struct {
+		name     string
+		memberId string
+		want     []string
+	}{
+		{name: "user through nested groups", memberId: "user", want: []string{"admins", "engineering", "staff"}},
+		{name: "group", memberId: "engineering", want: []string{"admins", "staff"}},
+		{name: "top group", memberId: "admins", want: []string{}},
+		{name: "stored cycle ends", memberId: "loop-a", want: []string{"loop-b"}},
+		{name: "in no group", memberId: "other", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ancestors, err := newTestRoleHelper(&fakeRoleRepo{}, nestedGroups()).Ancestors(testDepartment, tt.memberId)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(ancestors)
+
+			if !slices.Equal(ancestors, tt.want) {
+				t.Fatalf("Ancestors() = %v, want %v", ancestors, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNesting(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		child  string
+		want   error
+	}{
+		{name: "itself", parent: "staff", child: "staff", want: ErrGroupCycle},
+		{name: "its parent", parent: "engineering", child: "staff", want: ErrGroupCycle},
+		{name: "its ancestor", parent: "engineering", child: "admins", want: ErrGroupCycle},
+		{name: "its descendant again", parent: "admins", child: "engineering"},
+		{name: "unrelated group", parent: "engineering", child: "loop-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestRoleHelper(&fakeRoleRepo{}, nestedGroups()).CheckNesting(testDepartment, tt.parent, tt.child)
+
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("CheckNesting() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGroupGrant(t *testing.T) {
+	support := supportRole.PermissionList()
+
+	tests := []struct {
+		name    string
+		granted []models.Permission
+		groupId string
+		want    error
+	}{
+		{name: "group role within the caller's", granted: support, groupId: "helpdesk"},
+		{name: "own role within the caller's, inherited one isn't", granted: support, groupId: "engineering", want: ErrRoleEscalation},
+		{name: "only inherited roles", granted: append(support, models.BuiltInRolePermissions[models.User]...), groupId: "staff", want: ErrRoleEscalation},
+		{name: "group with the caller's roles", granted: models.Permissions, groupId: "engineering"},
+		{name: "group without roles", granted: support, groupId: "loop-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleRepo := &fakeRoleRepo{roles: []models.RoleModel{supportRole}}
+			err := newTestRoleHelper(roleRepo, nestedGroups()).CheckGroupGrant(testDepartment, tt.granted, tt.groupId)
+
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("CheckGroupGrant() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePermissionsInheritNestedGroups(t *testing.T) {
+	roleRepo := &fakeRoleRepo{roles: []models.RoleModel{supportRole}}
+	permissions, err := newTestRoleHelper(roleRepo, nestedGroups()).EffectivePermissions(testDepartment, "user", models.User)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(permissions, models.Permissions) {
+		t.Fatalf("EffectivePermissions() = %v, want the admin's %v", permissions, models.Permissions)
+	}
+}
+
+func TestGroupRolesCacheInvalidation(t *testing.T) {
+	cache, redisHelper := newFakeRedis()
+	groupRepo := &fakeGroupRepo{
+		members: []models.GroupMemberModel{{GroupID: "engineering", MemberID: "user", MemberType: models.GroupMemberUser}},
+	}
+	helper := NewRoleHelper(&testLog, &fakeRoleRepo{}, nil, groupRepo, redisHelper)
+
+	groupRoles := func() []models.Role {
+		t.Helper()
+		roles, err := helper.GroupRoles(testDepartment, "user")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return roles
+	}
+
+	if roles := groupRoles(); len(roles) != 0 {
+		t.Fatalf("GroupRoles() = %v, want none", roles)
+	}
+
+	otherKey := fmt.Sprintf(constants.GroupRolesRedisKey, "other-department", "user")
+
+	if err := redisHelper.SetData(otherKey, "[]", constants.GroupRolesCacheTtl); err != nil {
+		t.Fatal(err)
+	}
+
+	groupRepo.grants = append(groupRepo.grants, models.GroupRoleModel{GroupID: "engineering", Role: "support", DepartmentID: testDepartment})
+
+	if roles := groupRoles(); len(roles) != 0 {
+		t.Fatalf("GroupRoles() before the invalidation = %v, want the cached none", roles)
+	}
+
+	helper.InvalidateGroupRoles(testDepartment)
+
+	if keys := cache.keys(); !slices.Equal(keys, []string{otherKey}) {
+		t.Fatalf("cached keys after the invalidation = %v, want only %v", keys, otherKey)
+	}
+
+	if roles := groupRoles(); !slices.Equal(roles, []models.Role{"support"}) {
+		t.Fatalf("GroupRoles() after the invalidation = %v, want [support]", roles)
+	}
+}
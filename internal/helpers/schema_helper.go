@@ -0,0 +1,339 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONSchema is the subset of JSON Schema supported for custom user
+// metadata: type, enum, const, properties, required, additionalProperties,
+// items, min/maxItems, min/maxLength, pattern, format (email, date,
+// date-time), minimum, maximum, exclusiveMinimum, exclusiveMaximum and
+// readOnly.
+type JSONSchema struct {
+	Type                 interface{}            `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Const                interface{}            `json:"const,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *json.RawMessage       `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum,omitempty"`
+	ReadOnly             bool                   `json:"readOnly,omitempty"`
+
+	pattern    *regexp.Regexp
+	additional *JSONSchema
+	closed     bool
+}
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// ParseJSONSchema parses and checks a schema, rejecting keywords values the
+// validator cannot honour so a department can't save a schema that would
+// silently accept everything.
+func ParseJSONSchema(raw json.RawMessage) (*JSONSchema, error) {
+	var schema JSONSchema
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if err := schema.compile("#"); err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+// Validate checks a JSON document against the schema. An empty document is
+// validated as an empty object.
+func (s *JSONSchema) Validate(document json.RawMessage) error {
+	if len(bytes.TrimSpace(document)) == 0 {
+		document = json.RawMessage("{}")
+	}
+
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	var errs []string
+	s.validate("", value, &errs)
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// ReadOnlyProperty reports whether a top-level property is marked readOnly,
+// meaning only admins may change it.
+func (s *JSONSchema) ReadOnlyProperty(name string) bool {
+	property, ok := s.Properties[name]
+	return ok && property.ReadOnly
+}
+
+func (s *JSONSchema) compile(path string) error {
+	for _, name := range s.types() {
+		if !schemaTypes[name] {
+			return fmt.Errorf("invalid schema at %s: unknown type %q", path, name)
+		}
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema at %s: %w", path, err)
+		}
+		s.pattern = pattern
+	}
+
+	switch s.Format {
+	case "", "email", "date", "date-time":
+	default:
+		return fmt.Errorf("invalid schema at %s: unsupported format %q", path, s.Format)
+	}
+
+	if s.AdditionalProperties != nil {
+		var closed bool
+		if err := json.Unmarshal(*s.AdditionalProperties, &closed); err == nil {
+			s.closed = !closed
+		} else {
+			var additional JSONSchema
+			if err := json.Unmarshal(*s.AdditionalProperties, &additional); err != nil {
+				return fmt.Errorf("invalid schema at %s/additionalProperties: %w", path, err)
+			}
+			if err := additional.compile(path + "/additionalProperties"); err != nil {
+				return err
+			}
+			s.additional = &additional
+		}
+	}
+
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("invalid schema at %s/properties/%s", path, name)
+		}
+		if err := property.compile(path + "/properties/" + name); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile(path + "/items")
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(path string, value interface{}, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := path
+		if location == "" {
+			location = "metadata"
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: %s", location, fmt.Sprintf(format, args...)))
+	}
+
+	if types := s.types(); len(types) > 0 && !matchesAnyType(value, types) {
+		fail("must be of type %s", strings.Join(types, " or "))
+		return
+	}
+
+	if s.Const != nil && !jsonEqual(s.Const, value) {
+		fail("must be equal to %v", s.Const)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if jsonEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %s", s.Pattern)
+		}
+		if !matchesFormat(s.Format, v) {
+			fail("must be a valid %s", s.Format)
+		}
+
+	case json.Number:
+		number, _ := v.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && number <= *s.ExclusiveMinimum {
+			fail("must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && number >= *s.ExclusiveMaximum {
+			fail("must be < %v", *s.ExclusiveMaximum)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := joinPath(path, key)
+
+			if property, ok := s.Properties[key]; ok {
+				property.validate(child, v[key], errs)
+			} else if s.closed {
+				fail("property %q is not allowed", key)
+			} else if s.additional != nil {
+				s.additional.validate(child, v[key], errs)
+			}
+		}
+	}
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	for _, name := range types {
+		switch name {
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := value.(json.Number); ok {
+				return true
+			}
+		case "integer":
+			if number, ok := value.(json.Number); ok {
+				f, err := number.Float64()
+				if err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "null":
+			if value == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesFormat(format string, value string) bool {
+	switch format {
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	}
+	return true
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	left, errA := json.Marshal(a)
+	right, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(left, right)
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["employeeId"],
+	"additionalProperties": false,
+	"properties": {
+		"employeeId": {"type": "string", "pattern": "^E[0-9]+$", "readOnly": true},
+		"level": {"type": "integer", "minimum": 1, "maximum": 10},
+		"score": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+		"team": {"enum": ["platform", "identity"]},
+		"nickname": {"type": ["string", "null"], "minLength": 2, "maxLength": 5},
+		"email": {"type": "string", "format": "email"},
+		"birthday": {"type": "string", "format": "date"},
+		"address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {"city": {"type": "string"}, "zip": {"type": "string", "pattern": "^[0-9]{5}$"}},
+			"additionalProperties": {"type": "string"}
+		},
+		"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string", "maxLength": 3}}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := ParseJSONSchema(json.RawMessage(testSchema))
+
+	if err != nil {
+		t.Fatalf("ParseJSONSchema() = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{name: "valid", document: `{"employeeId": "E1", "level": 10, "score": 0.5, "team": "identity", "nickname": null, "email": "a@example.com", "birthday": "2000-01-31", "address": {"city": "Berlin", "zip": "10115", "street": "Unter den Linden"}, "tags": ["a", "bcd"]}`},
+		{name: "only required", document: `{"employeeId": "E1"}`},
+		{name: "empty document", document: ``, want: `metadata: missing required property "employeeId"`},
+		{name: "not an object", document: `[]`, want: "metadata: must be of type object"},
+		{name: "missing required", document: `{"level": 1}`, want: `metadata: missing required property "employeeId"`},
+		{name: "additional property", document: `{"employeeId": "E1", "other": 1}`, want: `metadata: property "other" is not allowed`},
+		{name: "wrong type", document: `{"employeeId": 1}`, want: "employeeId: must be of type string"},
+		{name: "pattern", document: `{"employeeId": "X1"}`, want: "employeeId: must match pattern ^E[0-9]+$"},
+		{name: "integer", document: `{"employeeId": "E1", "level": 1.5}`, want: "level: must be of type integer"},
+		{name: "integer written as a float", document: `{"employeeId": "E1", "level": 2.0}`},
+		{name: "minimum", document: `{"employeeId": "E1", "level": 0}`, want: "level: must be >= 1"},
+		{name: "maximum", document: `{"employeeId": "E1", "level": 11}`, want: "level: must be <= 10"},
+		{name: "exclusive minimum", document: `{"employeeId": "E1", "score": 0}`, want: "score: must be > 0"},
+		{name: "exclusive maximum", document: `{"employeeId": "E1", "score": 1}`, want: "score: must be < 1"},
+		{name: "enum", document: `{"employeeId": "E1", "team": "sales"}`, want: "team: must be one of [platform identity]"},
+		{name: "type list", document: `{"employeeId": "E1", "nickname": 1}`, want: "nickname: must be of type string or null"},
+		{name: "min length", document: `{"employeeId": "E1", "nickname": "a"}`, want: "nickname: must be at least 2 characters"},
+		{name: "max length counts characters", document: `{"employeeId": "E1", "nickname": "ääääää"}`, want: "nickname: must be at most 5 characters"},
+		{name: "email format", document: `{"employeeId": "E1", "email": "Alice <a@example.com>"}`, want: "email: must be a valid email"},
+		{name: "date format", document: `{"employeeId": "E1", "birthday": "2000-02-30"}`, want: "birthday: must be a valid date"},
+		{name: "nested required", document: `{"employeeId": "E1", "address": {}}`, want: `address: missing required property "city"`},
+		{name: "nested property", document: `{"employeeId": "E1", "address": {"city": "Berlin", "zip": "1"}}`, want: "address.zip: must match pattern ^[0-9]{5}$"},
+		{name: "nested additional property schema", document: `{"employeeId": "E1", "address": {"city": "Berlin", "floor": 3}}`, want: "address.floor: must be of type string"},
+		{name: "min items", document: `{"employeeId": "E1", "tags": []}`, want: "tags: must have at least 1 items"},
+		{name: "max items", document: `{"employeeId": "E1", "tags": ["a", "b", "c"]}`, want: "tags: must have at most 2 items"},
+		{name: "array items", document: `{"employeeId": "E1", "tags": ["a", "long"]}`, want: "tags[1]: must be at most 3 characters"},
+		{name: "every error", document: `{"employeeId": 1, "level": 0}`, want: "employeeId: must be of type string, level: must be >= 1"},
+		{name: "invalid json", document: `{`, want: "invalid metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate(json.RawMessage(tt.document))
+
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONSchemaRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{name: "unknown type", schema: `{"type": "date"}`, want: `unknown type "date"`},
+		{name: "unknown nested type", schema: `{"properties": {"a": {"items": {"type": "float"}}}}`, want: `#/properties/a/items: unknown type "float"`},
+		{name: "invalid pattern", schema: `{"pattern": "("}`, want: "invalid schema at #"},
+		{name: "unsupported format", schema: `{"format": "uri"}`, want: `unsupported format "uri"`},
+		{name: "invalid additional properties", schema: `{"additionalProperties": {"type": "set"}}`, want: `#/additionalProperties: unknown type "set"`},
+		{name: "null property", schema: `{"properties": {"a": null}}`, want: "#/properties/a"},
+		{name: "not json", schema: `[`, want: "invalid schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSONSchema(json.RawMessage(tt.schema))
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseJSONSchema() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaReadOnlyProperty(t *testing.T) {
+	schema, err := ParseJSONSchema(json.RawMessage(testSchema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"employeeId": true, "level": false, "missing": false} {
+		if got := schema.ReadOnlyProperty(name); got != want {
+			t.Errorf("ReadOnlyProperty(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+// SCIM error types, see RFC 7644 section 3.12.
+const (
+	ScimInvalidFilter = "invalidFilter"
+	ScimInvalidSyntax = "invalidSyntax"
+	ScimInvalidPath   = "invalidPath"
+	ScimInvalidValue  = "invalidValue"
+	ScimUniqueness    = "uniqueness"
+	ScimNoTarget      = "noTarget"
+)
+
+var scimFilterPattern = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// ScimHelper writes SCIM responses. SCIM clients expect their own content
+// type and error format, so the SCIM endpoints don't use ResponseHelper.
+type ScimHelper struct {
+	log *zerolog.Logger
+}
+
+func NewScimHelper(log *zerolog.Logger) *ScimHelper {
+	return &ScimHelper{log: log}
+}
+
+func (h *ScimHelper) Send(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", constants.ScimContentType)
+	w.WriteHeader(status)
+
+	if data != nil {
+		json.NewEncoder(w).Encode(data)
+	}
+}
+
+func (h *ScimHelper) SendError(w http.ResponseWriter, status int, scimType string, detail string, err error) {
+	h.log.Error().Err(err).Int("status", status).Msg(detail)
+
+	h.Send(w, status, models.ScimError{
+		Schemas:  []string{models.ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// ParseScimFilter parses a filter of the form `attribute eq "value"`, the
+// only form provisioning clients need to look up existing resources. The
+// attribute is returned in lower case, SCIM attribute names are case
+// insensitive. An empty filter returns nil.
+func ParseScimFilter(filter string) (*models.ScimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(filter)
+
+	if match == nil {
+		return nil, fmt.Errorf("unsupported filter %q, only `attribute eq \"value\"` is supported", filter)
+	}
+
+	var value string
+
+	if err := json.Unmarshal([]byte(match[2]), &value); err != nil {
+		return nil, fmt.Errorf("invalid filter value: %w", err)
+	}
+
+	return &models.ScimFilter{Attribute: strings.ToLower(match[1]), Value: value}, nil
+}
+
+// ParseScimPath splits a PATCH path like `members[value eq "id"]` or
+// `emails[type eq "work"].value` into the lower cased attribute, including
+// any sub-attribute, and the value filter if there is one.
+func ParseScimPath(path string) (string, *models.ScimFilter, error) {
+	open := strings.Index(path, "[")
+
+	if open < 0 {
+		return strings.ToLower(path), nil, nil
+	}
+
+	end := strings.LastIndex(path, "]")
+
+	if end < open {
+		return "", nil, fmt.Errorf("invalid path %q", path)
+	}
+
+	filter, err := ParseScimFilter(path[open+1 : end])
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.ToLower(path[:open] + path[end+1:]), filter, nil
+}
+
+// ScimPagination reads the 1-based startIndex and count query parameters.
+func ScimPagination(r *http.Request) (int, int) {
+	query := r.URL.Query()
+
+	startIndex, err := strconv.Atoi(query.Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(query.Get("count"))
+	if err != nil {
+		count = constants.ScimDefaultCount
+	}
+
+	if count < 0 {
+		count = 0
+	}
+
+	if count > constants.ScimMaxCount {
+		count = constants.ScimMaxCount
+	}
+
+	return startIndex, count
+}
+
+// ParseScimBool reads a boolean attribute. Some clients (Azure AD) send
+// booleans as the strings "True" and "False".
+func ParseScimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	var text string
+
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return false, errors.New("value must be a boolean")
+	}
+
+	return strconv.ParseBool(strings.ToLower(text))
+}
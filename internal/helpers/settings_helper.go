@@ -0,0 +1,264 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+// GetDepartmentSettings returns the department's settings as stored, cached
+// in redis so they can be read on every request.
+func (h *AuthHelper) GetDepartmentSettings(departmentId string) (*models.DepartmentSettings, error) {
+	key := fmt.Sprintf(constants.SettingsRedisKey, departmentId)
+
+	if cached, err := h.redisHelper.GetData(key); err == nil {
+		var settings models.DepartmentSettings
+
+		if err := json.Unmarshal([]byte(cached), &settings); err == nil {
+			return &settings, nil
+		}
+	}
+
+	departmentConfig, err := h.departmentRepo.FindConfig(departmentId)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error loading department settings")
+		return nil, err
+	}
+
+	settings := departmentConfig.Settings
+
+	if value, err := json.Marshal(settings); err == nil {
+		if err := h.redisHelper.SetData(key, string(value), constants.SettingsCacheTtl); err != nil {
+			h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error caching department settings")
+		}
+	}
+
+	return &settings, nil
+}
+
+// GetEffectiveSettings returns the department's settings with every unset
+// value replaced by the global default.
+func (h *AuthHelper) GetEffectiveSettings(departmentId string) (*models.DepartmentSettings, error) {
+	settings, err := h.GetDepartmentSettings(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return EffectiveSettings(*settings), nil
+}
+
+// InvalidateDepartmentSettings drops the cached settings after an update.
+func (h *AuthHelper) InvalidateDepartmentSettings(departmentId string) {
+	if err := h.redisHelper.DeleteData(fmt.Sprintf(constants.SettingsRedisKey, departmentId)); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error invalidating department settings")
+	}
+}
+
+// CheckLoginMethod returns an error if the login method is disabled for the department.
+func (h *AuthHelper) CheckLoginMethod(departmentId string, method models.LoginMethod) error {
+	settings, err := h.GetDepartmentSettings(departmentId)
+
+	if err != nil {
+		return err
+	}
+
+	if !settings.LoginMethodEnabled(method) {
+		return fmt.Errorf(constants.LoginMethodDisabledError, method)
+	}
+
+	return nil
+}
+
+// CheckSignupOpen returns an error if users can't create accounts in the department themselves.
+func (h *AuthHelper) CheckSignupOpen(departmentId string) error {
+	settings, err := h.GetDepartmentSettings(departmentId)
+
+	if err != nil {
+		return err
+	}
+
+	if !settings.SignupAllowed() {
+		return errors.New(constants.SignupClosedError)
+	}
+
+	return nil
+}
+
+// CheckRedirectUrl returns an error unless the url's origin is one of the
+// department's allowed redirect origins.
+func (h *AuthHelper) CheckRedirectUrl(departmentId string, redirectUrl string) error {
+	settings, err := h.GetDepartmentSettings(departmentId)
+
+	if err != nil {
+		return err
+	}
+
+	if !OriginAllowed(settings.RedirectOrigins, redirectUrl) {
+		return errors.New(constants.RedirectNotAllowedError)
+	}
+
+	return nil
+}
+
+// CorsSettingsForOrigin returns the effective settings of every department
+// that lets browser apps on the origin call the API. Preflight requests carry
+// no credentials, so this is all that is known about them.
+func (h *AuthHelper) CorsSettingsForOrigin(origin string) ([]*models.DepartmentSettings, error) {
+	origin, ok := urlOrigin(origin)
+
+	if !ok {
+		return nil, nil
+	}
+
+	key := fmt.Sprintf(constants.CorsOriginRedisKey, origin)
+
+	var departmentIds []string
+
+	cached, err := h.redisHelper.GetData(key)
+
+	if err != nil || json.Unmarshal([]byte(cached), &departmentIds) != nil {
+		departmentIds, err = h.departmentRepo.FindDepartmentsByCorsOrigin(origin)
+
+		if err != nil {
+			h.log.Error().Err(err).Str("origin", origin).Msg("Error loading departments of origin")
+			return nil, err
+		}
+
+		if value, err := json.Marshal(departmentIds); err == nil {
+			if err := h.redisHelper.SetData(key, string(value), constants.SettingsCacheTtl); err != nil {
+				h.log.Error().Err(err).Str("origin", origin).Msg("Error caching departments of origin")
+			}
+		}
+	}
+
+	var settings []*models.DepartmentSettings
+
+	for _, departmentId := range departmentIds {
+		effective, err := h.GetEffectiveSettings(departmentId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		settings = append(settings, effective)
+	}
+
+	return settings, nil
+}
+
+// InvalidateCorsOrigins drops the cached departments of the origins after
+// a department added or removed them.
+func (h *AuthHelper) InvalidateCorsOrigins(origins ...string) {
+	for _, origin := range origins {
+		if origin, ok := urlOrigin(origin); ok {
+			if err := h.redisHelper.DeleteData(fmt.Sprintf(constants.CorsOriginRedisKey, origin)); err != nil {
+				h.log.Error().Err(err).Str("origin", origin).Msg("Error invalidating departments of origin")
+			}
+		}
+	}
+}
+
+// NormalizeOrigins reduces urls to their lower case scheme and host, the
+// form origins are looked up in.
+func NormalizeOrigins(origins models.StringList) models.StringList {
+	normalized := models.StringList{}
+
+	for _, rawUrl := range origins {
+		if origin, ok := urlOrigin(rawUrl); ok && !slices.Contains(normalized, origin) {
+			normalized = append(normalized, origin)
+		}
+	}
+
+	return normalized
+}
+
+// OriginAllowed reports whether the origin of rawUrl is in origins.
+func OriginAllowed(origins []string, rawUrl string) bool {
+	origin, ok := urlOrigin(rawUrl)
+
+	if !ok {
+		return false
+	}
+
+	for _, allowed := range origins {
+		if allowedOrigin, ok := urlOrigin(allowed); ok && allowedOrigin == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func urlOrigin(rawUrl string) (string, bool) {
+	parsed, err := url.Parse(rawUrl)
+
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", false
+	}
+
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host), true
+}
+
+// EffectiveSettings fills the unset values of settings from the global config.
+func EffectiveSettings(settings models.DepartmentSettings) *models.DepartmentSettings {
+	if len(settings.LoginMethods) == 0 {
+		settings.LoginMethods = []models.LoginMethod{models.PasswordLogin, models.OtpLogin, models.MagicLinkLogin}
+	}
+
+	if settings.AccessTokenTtlMinutes == 0 {
+		settings.AccessTokenTtlMinutes = int((time.Duration(config.AppConfig.AccessJwtExpire) * time.Hour).Minutes())
+	}
+
+	if settings.RefreshTokenTtlHours == 0 {
+		settings.RefreshTokenTtlHours = config.AppConfig.RefreshJwtExpire
+	}
+
+	if settings.OtpLength == 0 {
+		settings.OtpLength = constants.DefaultOtpLength
+	}
+
+	if settings.OtpExpireMinutes == 0 {
+		settings.OtpExpireMinutes = config.AppConfig.OtpExpire
+	}
+
+	if settings.RedirectOrigins == nil {
+		settings.RedirectOrigins = models.StringList{}
+	}
+
+	if settings.CorsOrigins == nil {
+		settings.CorsOrigins = models.StringList{}
+	}
+
+	if len(settings.CorsMethods) == 0 {
+		settings.CorsMethods = models.StringList{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	if settings.Cookie.SameSite == "" {
+		settings.Cookie.SameSite = "lax"
+	}
+
+	if settings.Cookie.MaxAgeSeconds == 0 {
+		settings.Cookie.MaxAgeSeconds = settings.AccessTokenTtlMinutes * 60
+	}
+
+	if settings.EmailSenderName == "" {
+		settings.EmailSenderName = constants.DefaultEmailSenderName
+	}
+
+	if settings.SignupOpen == nil {
+		open := true
+		settings.SignupOpen = &open
+	}
+
+	return &settings
+}
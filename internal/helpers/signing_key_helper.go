@@ -0,0 +1,365 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// signingKey is a parsed department key. Key material never changes, parsed
+// keys are kept by key id for the life of the process.
+type signingKey struct {
+	id           string
+	departmentId string
+	private      *rsa.PrivateKey
+}
+
+// signingKeyState is what can change about a key, whether it was retired or
+// deleted. The department's key states are cached in redis, so every
+// instance sees a rotation or deletion as soon as the cache is dropped.
+type signingKeyState struct {
+	ID        string     `json:"id"`
+	RetiredAt *time.Time `json:"retiredAt"`
+}
+
+// JwtIssuer returns the iss claim of the department's tokens.
+func JwtIssuer(departmentId string) string {
+	return fmt.Sprintf(constants.JwtIssuerFormat, config.AppConfig.JwtIssuer, departmentId)
+}
+
+// activeSigningKey returns the key new tokens of the department are signed
+// with, a key is created the first time the department issues a token.
+func (h *AuthHelper) activeSigningKey(departmentId string) (*signingKey, error) {
+	states, err := h.signingKeyStates(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, state := range states {
+		if state.RetiredAt == nil {
+			return h.signingKey(state.ID)
+		}
+	}
+
+	record, err := h.createSigningKey(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.loadSigningKey(record)
+}
+
+// verificationKey returns the key with the id, retired keys are accepted
+// until the tokens they signed have expired.
+func (h *AuthHelper) verificationKey(id string) (*signingKey, error) {
+	key, err := h.signingKey(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := h.signingKeyStates(key.departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, state := range states {
+		if state.ID == id {
+			return key, h.checkNotExpired(key.departmentId, state.RetiredAt)
+		}
+	}
+
+	return nil, errors.New("signing key not found")
+}
+
+// signingKeyStates returns the state of the department's keys, newest first.
+func (h *AuthHelper) signingKeyStates(departmentId string) ([]signingKeyState, error) {
+	cacheKey := fmt.Sprintf(constants.SigningKeysRedisKey, departmentId)
+
+	if cached, err := h.redisHelper.GetData(cacheKey); err == nil {
+		var states []signingKeyState
+
+		if err := json.Unmarshal([]byte(cached), &states); err == nil {
+			return states, nil
+		}
+	}
+
+	records, err := h.departmentRepo.FindSigningKeys(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]signingKeyState, 0, len(records))
+
+	for _, record := range records {
+		states = append(states, signingKeyState{ID: record.ID, RetiredAt: record.RetiredAt})
+	}
+
+	// an empty list isn't cached, the first key is about to be created
+	if len(states) > 0 {
+		if value, err := json.Marshal(states); err == nil {
+			if err := h.redisHelper.SetData(cacheKey, string(value), constants.SigningKeyCacheTtl); err != nil {
+				h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error caching signing keys")
+			}
+		}
+	}
+
+	return states, nil
+}
+
+// signingKey returns the parsed key with the id.
+func (h *AuthHelper) signingKey(id string) (*signingKey, error) {
+	if cached, ok := h.signingKeys.Load(id); ok {
+		return cached.(*signingKey), nil
+	}
+
+	record, err := h.departmentRepo.FindSigningKey(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.loadSigningKey(record)
+}
+
+func (h *AuthHelper) checkNotExpired(departmentId string, retiredAt *time.Time) error {
+	expired, err := h.signingKeyExpired(departmentId, retiredAt)
+
+	if err != nil {
+		return err
+	}
+
+	if expired {
+		return errors.New("signing key expired")
+	}
+
+	return nil
+}
+
+// signingKeyExpired reports whether every token signed with a key retired at
+// retiredAt has expired.
+func (h *AuthHelper) signingKeyExpired(departmentId string, retiredAt *time.Time) (bool, error) {
+	if retiredAt == nil {
+		return false, nil
+	}
+
+	settings, err := h.GetEffectiveSettings(departmentId)
+
+	if err != nil {
+		return false, err
+	}
+
+	ttl := time.Duration(settings.AccessTokenTtlMinutes) * time.Minute
+	return time.Now().After(retiredAt.Add(ttl)), nil
+}
+
+func (h *AuthHelper) loadSigningKey(record *models.SigningKeyModel) (*signingKey, error) {
+	der, err := decryptSigningKey(record.PrivateKey)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("kid", record.ID).Msg("Error decrypting signing key")
+		return nil, err
+	}
+
+	private, err := x509.ParsePKCS1PrivateKey(der)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("kid", record.ID).Msg("Error parsing signing key")
+		return nil, err
+	}
+
+	key := &signingKey{
+		id:           record.ID,
+		departmentId: record.DepartmentID,
+		private:      private,
+	}
+
+	h.signingKeys.Store(record.ID, key)
+	return key, nil
+}
+
+// createSigningKey creates the department's first signing key. Instances that
+// issue the department's first tokens at the same time all get the key the
+// first one created.
+func (h *AuthHelper) createSigningKey(departmentId string) (*models.SigningKeyModel, error) {
+	key, err := newSigningKey(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := h.departmentRepo.CreateSigningKeyIfAbsent(key)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error creating signing key")
+		return nil, err
+	}
+
+	h.ForgetSigningKeys(departmentId)
+
+	return active, nil
+}
+
+// RotateSigningKey creates a new signing key for the department and retires
+// the current one.
+func (h *AuthHelper) RotateSigningKey(departmentId string) (*models.SigningKeyModel, error) {
+	key, err := newSigningKey(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.departmentRepo.RotateSigningKey(key); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error rotating signing key")
+		return nil, err
+	}
+
+	// every instance has to stop signing with the retired key
+	h.ForgetSigningKeys(departmentId)
+
+	return key, nil
+}
+
+// ForgetSigningKeys drops the cached state of the department's keys, on
+// every instance, and the keys this instance parsed.
+func (h *AuthHelper) ForgetSigningKeys(departmentId string) {
+	if err := h.redisHelper.DeleteData(fmt.Sprintf(constants.SigningKeysRedisKey, departmentId)); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error invalidating signing keys")
+	}
+
+	h.signingKeys.Range(func(id, cached any) bool {
+		if cached.(*signingKey).departmentId == departmentId {
+			h.signingKeys.Delete(id)
+		}
+		return true
+	})
+}
+
+func newSigningKey(departmentId string) (*models.SigningKeyModel, error) {
+	private, err := rsa.GenerateKey(rand.Reader, constants.SigningKeyBits)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptSigningKey(x509.MarshalPKCS1PrivateKey(private))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKeyModel{
+		ID:           uuid.New().String(),
+		DepartmentID: departmentId,
+		Algorithm:    constants.SigningAlgorithm,
+		PrivateKey:   encrypted,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// DepartmentJwks returns the public keys that verify the department's tokens.
+func (h *AuthHelper) DepartmentJwks(departmentId string) (*models.JwksResponse, error) {
+	records, err := h.departmentRepo.FindSigningKeys(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &models.JwksResponse{Keys: []models.Jwk{}}
+
+	for i := range records {
+		expired, err := h.signingKeyExpired(departmentId, records[i].RetiredAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if expired {
+			continue
+		}
+
+		key, err := h.loadSigningKey(&records[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		jwks.Keys = append(jwks.Keys, models.Jwk{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: records[i].Algorithm,
+			Kid: key.id,
+			N:   base64.RawURLEncoding.EncodeToString(key.private.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.private.E)).Bytes()),
+		})
+	}
+
+	return jwks, nil
+}
+
+func signingKeyCipher() (cipher.AEAD, error) {
+	secret := sha256.Sum256([]byte(config.AppConfig.SigningKeySecret))
+
+	block, err := aes.NewCipher(secret[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptSigningKey(der []byte) (string, error) {
+	gcm, err := signingKeyCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, der, nil)), nil
+}
+
+func decryptSigningKey(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := signingKeyCipher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid signing key")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"sync"
+	"testing"
+)
+
+// newTestInstance is the auth helper of one API instance, instances share
+// the repository.
+func newTestInstance(departmentRepo *fakeDepartmentRepo) *AuthHelper {
+	return NewAuthHelper(&testLog, departmentRepo, *unreachableRedis())
+}
+
+func TestFirstSigningKeyIsCreatedOnce(t *testing.T) {
+	departmentRepo := &fakeDepartmentRepo{}
+
+	var wg sync.WaitGroup
+	ids := make([]string, 4)
+
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key, err := newTestInstance(departmentRepo).activeSigningKey(testDepartment)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = key.id
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(departmentRepo.keys) != 1 {
+		t.Fatalf("keys = %d, want 1", len(departmentRepo.keys))
+	}
+
+	for _, id := range ids {
+		if id != departmentRepo.keys[0].ID {
+			t.Errorf("signed with %s, want %s", id, departmentRepo.keys[0].ID)
+		}
+	}
+}
+
+func TestRotationIsSeenByOtherInstances(t *testing.T) {
+	departmentRepo := &fakeDepartmentRepo{}
+	signer, rotator := newTestInstance(departmentRepo), newTestInstance(departmentRepo)
+
+	before, err := signer.activeSigningKey(testDepartment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rotator.RotateSigningKey(testDepartment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := signer.activeSigningKey(testDepartment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.id == before.id || after.id != rotated.ID {
+		t.Errorf("signed with %s after rotation, want %s", after.id, rotated.ID)
+	}
+}
+
+func TestDeletedSigningKeyDoesntVerify(t *testing.T) {
+	departmentRepo := &fakeDepartmentRepo{}
+	authHelper := newTestInstance(departmentRepo)
+
+	key, err := authHelper.activeSigningKey(testDepartment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the department was deleted by another instance, this one still has
+	// the parsed key
+	departmentRepo.keys = nil
+
+	if _, err := authHelper.verificationKey(key.id); err == nil {
+		t.Error("verificationKey() accepted a deleted key")
+	}
+}
@@ -0,0 +1,251 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+// UsageHelper meters what departments use and enforces their quotas.
+// Metering must not take logins down with it, so storage errors are logged
+// and the request goes ahead.
+type UsageHelper struct {
+	log            *zerolog.Logger
+	usageRepo      repository.UsageRepository
+	departmentRepo repository.DepartmentRepository
+}
+
+func NewUsageHelper(log *zerolog.Logger, usageRepo repository.UsageRepository, departmentRepo repository.DepartmentRepository) *UsageHelper {
+	return &UsageHelper{log: log, usageRepo: usageRepo, departmentRepo: departmentRepo}
+}
+
+// CheckQuota returns an error if the department has used up today's quota
+// of the metric.
+func (h *UsageHelper) CheckQuota(departmentId string, metric models.UsageMetric) error {
+	quotas, ok := h.quotas(departmentId)
+	limit := quotas.DailyLimit(metric)
+
+	if !ok || limit == 0 {
+		return nil
+	}
+
+	count, err := h.usageRepo.FindCount(departmentId, usageDay(time.Now()), metric)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Str("metric", string(metric)).Msg("Error reading usage")
+		return nil
+	}
+
+	if count >= limit {
+		return fmt.Errorf(constants.QuotaExceededError, limit, string(metric)+" per day")
+	}
+
+	return nil
+}
+
+// CheckUserQuota returns an error if the department can't have another user.
+func (h *UsageHelper) CheckUserQuota(departmentId string) error {
+	quotas, ok := h.quotas(departmentId)
+
+	if !ok || quotas.MaxUsers == 0 {
+		return nil
+	}
+
+	count, err := h.usageRepo.CountUsers(departmentId)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error counting users")
+		return nil
+	}
+
+	if count >= quotas.MaxUsers {
+		return fmt.Errorf(constants.QuotaExceededError, quotas.MaxUsers, "users")
+	}
+
+	return nil
+}
+
+// CheckLoginQuota returns an error if the user would be a new monthly active
+// user of a department that has reached its limit. Users who were already
+// active this month can always log in, an empty userId stands for a user
+// who is about to be created.
+func (h *UsageHelper) CheckLoginQuota(departmentId string, userId string) error {
+	quotas, ok := h.quotas(departmentId)
+
+	if !ok || quotas.MaxMonthlyActiveUsers == 0 {
+		return nil
+	}
+
+	month := usageMonth(time.Now())
+
+	if userId != "" {
+		active, err := h.usageRepo.IsActive(departmentId, month, userId)
+
+		if err != nil {
+			h.log.Error().Err(err).Str("departmentId", departmentId).Str("userId", userId).Msg("Error reading active user")
+			return nil
+		}
+
+		if active {
+			return nil
+		}
+	}
+
+	counts, err := h.usageRepo.CountActive(departmentId, month, month)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error counting active users")
+		return nil
+	}
+
+	if counts[month] >= quotas.MaxMonthlyActiveUsers {
+		return fmt.Errorf(constants.QuotaExceededError, quotas.MaxMonthlyActiveUsers, "monthly active users")
+	}
+
+	return nil
+}
+
+// Record counts an event of the metric for the department.
+func (h *UsageHelper) Record(departmentId string, metric models.UsageMetric) {
+	if err := h.usageRepo.Increment(departmentId, usageDay(time.Now()), metric); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Str("metric", string(metric)).Msg("Error recording usage")
+	}
+}
+
+// RecordLogin counts a login and marks the user as active this month.
+func (h *UsageHelper) RecordLogin(departmentId string, userId string) {
+	h.Record(departmentId, models.LoginUsage)
+
+	if err := h.usageRepo.MarkActive(departmentId, usageMonth(time.Now()), userId); err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Str("userId", userId).Msg("Error recording active user")
+	}
+}
+
+// Usage returns the department's daily and monthly usage for the days from
+// from to to, both included.
+func (h *UsageHelper) Usage(departmentId string, from time.Time, to time.Time) (*models.UsageResponse, error) {
+	counters, err := h.usageRepo.FindCounters(departmentId, usageDay(from), usageDay(to))
+
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := h.usageRepo.CountActive(departmentId, usageMonth(from), usageMonth(to))
+
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := h.usageRepo.CountUsers(departmentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	quotas, _ := h.quotas(departmentId)
+
+	res := &models.UsageResponse{
+		DepartmentID: departmentId,
+		From:         usageDay(from),
+		To:           usageDay(to),
+		Users:        users,
+		Quotas:       quotas,
+		Daily:        []models.DailyUsage{},
+		Monthly:      []models.MonthlyUsage{},
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		res.Daily = append(res.Daily, models.DailyUsage{Day: usageDay(day)})
+
+		if month := usageMonth(day); len(res.Monthly) == 0 || res.Monthly[len(res.Monthly)-1].Month != month {
+			res.Monthly = append(res.Monthly, models.MonthlyUsage{Month: month, ActiveUsers: active[month]})
+		}
+	}
+
+	days := make(map[string]*models.DailyUsage, len(res.Daily))
+	for i := range res.Daily {
+		days[res.Daily[i].Day] = &res.Daily[i]
+	}
+
+	months := make(map[string]*models.MonthlyUsage, len(res.Monthly))
+	for i := range res.Monthly {
+		months[res.Monthly[i].Month] = &res.Monthly[i]
+	}
+
+	for _, counter := range counters {
+		daily, ok := days[counter.Day]
+
+		if !ok {
+			continue
+		}
+
+		monthly := months[counter.Day[:len(constants.UsageMonthFormat)]]
+
+		switch counter.Metric {
+		case models.LoginUsage:
+			daily.Logins += counter.Count
+			monthly.Logins += counter.Count
+		case models.SmsUsage:
+			daily.Sms += counter.Count
+			monthly.Sms += counter.Count
+		case models.EmailUsage:
+			daily.Emails += counter.Count
+			monthly.Emails += counter.Count
+		}
+	}
+
+	return res, nil
+}
+
+// quotas returns the department's quotas and whether they could be loaded.
+func (h *UsageHelper) quotas(departmentId string) (models.UsageQuotas, bool) {
+	config, err := h.departmentRepo.FindConfig(departmentId)
+
+	if err != nil {
+		h.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error loading department quotas")
+		return models.UsageQuotas{}, false
+	}
+
+	return config.Quotas, true
+}
+
+// ParseUsageRange reads the from and to days of a usage request, by default
+// the current month up to today.
+func ParseUsageRange(from string, to string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	rangeErr := fmt.Errorf(constants.UsageRangeError, constants.MaxUsageDays)
+
+	var err error
+
+	if from != "" {
+		if start, err = time.Parse(constants.UsageDayFormat, from); err != nil {
+			return start, end, rangeErr
+		}
+	}
+
+	if to != "" {
+		if end, err = time.Parse(constants.UsageDayFormat, to); err != nil {
+			return start, end, rangeErr
+		}
+	}
+
+	if end.Before(start) || end.Sub(start) >= constants.MaxUsageDays*24*time.Hour {
+		return start, end, rangeErr
+	}
+
+	return start, end, nil
+}
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format(constants.UsageDayFormat)
+}
+
+func usageMonth(t time.Time) string {
+	return t.UTC().Format(constants.UsageMonthFormat)
+}
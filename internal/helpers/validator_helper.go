@@ -3,9 +3,11 @@ package helpers
 import (
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"uas/internal/constants"
+	"uas/internal/models"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
@@ -13,6 +15,13 @@ import (
 
 var validate *validator.Validate
 
+var (
+	roleNamePattern        = regexp.MustCompile(constants.RoleNamePattern)
+	relationNamePattern    = regexp.MustCompile(constants.RelationNamePattern)
+	relationUsersetPattern = regexp.MustCompile(constants.RelationUsersetPattern)
+	relationSubjectPattern = regexp.MustCompile(constants.RelationSubjectPattern)
+)
+
 type ValidatorHelper struct {
 	log            *zerolog.Logger
 	responseHelper *ResponseHelper
@@ -21,6 +30,12 @@ type ValidatorHelper struct {
 func init() {
 	validate = validator.New(validator.WithRequiredStructEnabled())
 	validate.RegisterValidation("noSQLKeywords", noSQLKeywords)
+	validate.RegisterValidation("roleName", roleName)
+	validate.RegisterValidation("permission", permission)
+	validate.RegisterValidation("relationName", relationName)
+	validate.RegisterValidation("relationUserset", relationUserset)
+	validate.RegisterValidation("relationSubject", relationSubject)
+	validate.RegisterValidation("relationTuple", relationTuple)
 }
 
 func NewValidatorHelper(log *zerolog.Logger, responseHelper *ResponseHelper) *ValidatorHelper {
@@ -39,15 +54,53 @@ func noSQLKeywords(fl validator.FieldLevel) bool {
 	return true
 }
 
-func (v *ValidatorHelper) ValidateStruct(w http.ResponseWriter, s interface{}) {
+func roleName(fl validator.FieldLevel) bool {
+	return roleNamePattern.MatchString(fl.Field().String())
+}
+
+func permission(fl validator.FieldLevel) bool {
+	return models.ValidPermission(models.Permission(fl.Field().String()))
+}
+
+func relationName(fl validator.FieldLevel) bool {
+	return relationNamePattern.MatchString(fl.Field().String())
+}
+
+func relationUserset(fl validator.FieldLevel) bool {
+	return relationUsersetPattern.MatchString(fl.Field().String())
+}
+
+func relationSubject(fl validator.FieldLevel) bool {
+	return relationSubjectPattern.MatchString(fl.Field().String())
+}
+
+func relationTuple(fl validator.FieldLevel) bool {
+	_, err := ParseRelationTuple(fl.Field().String())
+	return err == nil
+}
+
+// ValidateStruct validates s and writes a bad request response when it is
+// invalid. It reports whether the struct was valid.
+func (v *ValidatorHelper) ValidateStruct(w http.ResponseWriter, s interface{}) bool {
 	v.log.Debug().Interface("struct", s).Msg("Validating Request Data")
 
 	err := validate.Struct(s)
 	if err != nil {
-		var errMsgs []string
-		for _, err := range err.(validator.ValidationErrors) {
-			errMsgs = append(errMsgs, fmt.Sprintf("Field validation for '%s' failed on the '%s' tag", err.Field(), err.Tag()))
-		}
-		v.responseHelper.SendErrorResponse(w, strings.Join(errMsgs, ", "), constants.BadRequest, err)
+		v.responseHelper.SendErrorResponse(w, formatValidationErrors(err), constants.BadRequest, err)
+		return false
+	}
+	return true
+}
+
+func formatValidationErrors(err error) string {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err.Error()
+	}
+
+	var errMsgs []string
+	for _, err := range validationErrors {
+		errMsgs = append(errMsgs, fmt.Sprintf("Field validation for '%s' failed on the '%s' tag", err.Field(), err.Tag()))
 	}
+	return strings.Join(errMsgs, ", ")
 }
@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+type VerificationHelper struct {
+	log         *zerolog.Logger
+	authHelper  *AuthHelper
+	emailHelper *EmailHelper
+	redisHelper *RedisHelper
+	usageHelper *UsageHelper
+}
+
+func NewVerificationHelper(log *zerolog.Logger, authHelper *AuthHelper, emailHelper *EmailHelper, redisHelper *RedisHelper, usageHelper *UsageHelper) *VerificationHelper {
+	return &VerificationHelper{log: log, authHelper: authHelper, emailHelper: emailHelper, redisHelper: redisHelper, usageHelper: usageHelper}
+}
+
+// SendVerificationEmail sends the user both an OTP code and a signed link,
+// either one verifies the email address. The code is only valid in the
+// user's own department.
+func (h *VerificationHelper) SendVerificationEmail(user *models.UserModel) error {
+	settings, err := h.authHelper.GetEffectiveSettings(user.DepartmentID)
+
+	if err != nil {
+		return err
+	}
+
+	code, err := h.authHelper.GenerateOtpCode(user.DepartmentID, user.Email)
+
+	if err != nil {
+		return err
+	}
+
+	token := h.authHelper.GenerateVerificationToken(user.ID, user.Email)
+
+	tmpl_data := models.VerifyEmailData{
+		Name: user.Name,
+		Otp:  code,
+		Url:  fmt.Sprintf("%s?token=%s", config.AppConfig.VerifyLinkBaseUrl, url.QueryEscape(token)),
+	}
+
+	if err := h.emailHelper.SendDepartmentEmail(settings, user.Email, "verify-email", tmpl_data); err != nil {
+		return err
+	}
+
+	h.usageHelper.Record(user.DepartmentID, models.EmailUsage)
+	return nil
+}
+
+// AllowResend reports whether another verification email may be sent to the
+// address in the department and, if so, starts the cooldown. The same address
+// in another department is a different identity with its own cooldown.
+func (h *VerificationHelper) AllowResend(departmentId string, email string) (bool, error) {
+	key := fmt.Sprintf(constants.VerifyResendRedisKey, departmentId, email)
+	cooldown := time.Duration(config.AppConfig.VerifyResendCooldown) * time.Second
+
+	return h.redisHelper.SetDataIfAbsent(key, "1", cooldown)
+}
+
+// VerificationExpiry returns when a newly created unverified account should
+// be removed, nil when unverified accounts are kept.
+func VerificationExpiry() *time.Time {
+	if config.AppConfig.UnverifiedAccountExpire <= 0 {
+		return nil
+	}
+
+	expires := time.Now().Add(time.Duration(config.AppConfig.UnverifiedAccountExpire) * time.Hour)
+	return &expires
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"time"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+// AuditRetentionJob removes audit events older than the retention period,
+// also those of departments that were deleted.
+type AuditRetentionJob struct {
+	log       *zerolog.Logger
+	auditRepo repository.AuditRepository
+	retention time.Duration
+}
+
+func NewAuditRetentionJob(log *zerolog.Logger, auditRepo repository.AuditRepository, retention time.Duration) *AuditRetentionJob {
+	return &AuditRetentionJob{log: log, auditRepo: auditRepo, retention: retention}
+}
+
+// Start runs the job every interval until the context is cancelled.
+func (j *AuditRetentionJob) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *AuditRetentionJob) Run() {
+	deleted, err := j.auditRepo.DeleteBefore(time.Now().Add(-j.retention))
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error removing expired audit events")
+		return
+	}
+
+	if deleted > 0 {
+		j.log.Info().Int64("deleted", deleted).Msg("Removed expired audit events")
+	}
+}
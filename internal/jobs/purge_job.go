@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"time"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+// PurgeJob warns users shortly before their deactivated account is purged
+// and permanently deletes users and departments once the grace period has passed.
+type PurgeJob struct {
+	log            *zerolog.Logger
+	userRepo       repository.UserRepository
+	departmentRepo repository.DepartmentRepository
+	emailHelper    *helpers.EmailHelper
+}
+
+func NewPurgeJob(
+	log *zerolog.Logger,
+	userRepo repository.UserRepository,
+	departmentRepo repository.DepartmentRepository,
+	emailHelper *helpers.EmailHelper,
+) *PurgeJob {
+	return &PurgeJob{log: log, userRepo: userRepo, departmentRepo: departmentRepo, emailHelper: emailHelper}
+}
+
+// Start runs the job every interval until the context is cancelled.
+func (j *PurgeJob) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *PurgeJob) Run() {
+	now := time.Now()
+
+	j.sendWarnings(now)
+
+	users, err := j.userRepo.PurgeDeactivated(now)
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error purging deactivated users")
+	} else if users > 0 {
+		j.log.Info().Int64("purged", users).Msg("Purged deactivated users")
+	}
+
+	departments, err := j.departmentRepo.PurgeDeactivated(now)
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error purging deactivated departments")
+	} else if departments > 0 {
+		j.log.Info().Int64("purged", departments).Msg("Purged deactivated departments")
+	}
+}
+
+func (j *PurgeJob) sendWarnings(now time.Time) {
+	before := now.AddDate(0, 0, config.AppConfig.PurgeWarningPeriod)
+
+	users, err := j.userRepo.FindPurgeWarningDue(before)
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error finding users to warn about purge")
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+
+		if user.Email != "" {
+			tmpl_data := models.DeactivationData{
+				Name:    user.Name,
+				PurgeAt: user.PurgeAt.UTC().Format(constants.TimeFormat),
+			}
+
+			// retried on the next run, the warning is only marked as sent on success
+			if err := j.emailHelper.SendEmail(user.Email, "purge-warning", tmpl_data); err != nil {
+				j.log.Error().Err(err).Str("userId", user.ID).Msg("Error sending purge warning email")
+				continue
+			}
+		}
+
+		user.PurgeWarningSentAt = &now
+
+		if err := j.userRepo.Save(user); err != nil {
+			j.log.Error().Err(err).Str("userId", user.ID).Msg("Error saving purge warning")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// TenantDeletionJob carries out requested tenant deletions: it removes the
+// tenant with its users, memberships and tokens, clears the tenant's redis
+// keys and records the outcome in the audit trail.
+type TenantDeletionJob struct {
+	log            *zerolog.Logger
+	departmentRepo repository.DepartmentRepository
+	platformRepo   repository.PlatformRepository
+	authHelper     *helpers.AuthHelper
+	redisHelper    *helpers.RedisHelper
+}
+
+func NewTenantDeletionJob(
+	log *zerolog.Logger,
+	departmentRepo repository.DepartmentRepository,
+	platformRepo repository.PlatformRepository,
+	authHelper *helpers.AuthHelper,
+	redisHelper *helpers.RedisHelper,
+) *TenantDeletionJob {
+	return &TenantDeletionJob{
+		log:            log,
+		departmentRepo: departmentRepo,
+		platformRepo:   platformRepo,
+		authHelper:     authHelper,
+		redisHelper:    redisHelper,
+	}
+}
+
+// Start runs the job every interval until the context is cancelled.
+func (j *TenantDeletionJob) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *TenantDeletionJob) Run() {
+	staleBefore := time.Now().Add(-constants.TenantDeletionTimeout)
+
+	deletions, err := j.platformRepo.FindClaimableDeletions(staleBefore)
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error finding tenant deletions")
+		return
+	}
+
+	for i := range deletions {
+		deletion := &deletions[i]
+
+		// another instance may have picked it up in the meantime
+		claimed, err := j.platformRepo.ClaimDeletion(deletion, staleBefore)
+
+		if err != nil {
+			j.log.Error().Err(err).Str("deletionId", deletion.ID).Msg("Error claiming tenant deletion")
+			continue
+		}
+
+		if claimed {
+			j.delete(deletion)
+		}
+	}
+}
+
+func (j *TenantDeletionJob) delete(deletion *models.TenantDeletionModel) {
+	departmentId := deletion.DepartmentID
+
+	deleted, detached, err := j.departmentRepo.DeleteCascade(departmentId)
+
+	if err != nil {
+		j.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error deleting tenant")
+		deletion.Status = models.TenantDeletionFailed
+		deletion.Error = err.Error()
+		j.finish(deletion)
+		return
+	}
+
+	if err := j.redisHelper.DeleteByPattern(fmt.Sprintf(constants.OtpRedisKey, departmentId, "*")); err != nil {
+		j.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error deleting tenant otp codes")
+	}
+
+	j.authHelper.InvalidateDepartmentSettings(departmentId)
+	j.authHelper.ForgetSigningKeys(departmentId)
+
+	audit := &models.TenantAuditModel{
+		ID:           uuid.New().String(),
+		DepartmentID: departmentId,
+		Action:       models.TenantDeleted,
+		Actor:        deletion.RequestedBy,
+	}
+
+	if err := j.platformRepo.CreateAudit(audit); err != nil {
+		j.log.Error().Err(err).Str("departmentId", departmentId).Msg("Error recording tenant audit")
+	}
+
+	j.log.Info().
+		Str("departmentId", departmentId).
+		Int64("usersDeleted", deleted).
+		Int64("usersDetached", detached).
+		Msg("Tenant deleted")
+
+	deletion.Status = models.TenantDeletionCompleted
+	deletion.Error = ""
+	deletion.UsersDeleted = deleted
+	deletion.UsersDetached = detached
+	j.finish(deletion)
+}
+
+func (j *TenantDeletionJob) finish(deletion *models.TenantDeletionModel) {
+	now := time.Now()
+	deletion.CompletedAt = &now
+
+	if err := j.platformRepo.SaveDeletion(deletion); err != nil {
+		j.log.Error().Err(err).Str("deletionId", deletion.ID).Msg("Error saving tenant deletion")
+	}
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"time"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+// UnverifiedUserJob removes accounts that were not verified in time.
+type UnverifiedUserJob struct {
+	log      *zerolog.Logger
+	userRepo repository.UserRepository
+}
+
+func NewUnverifiedUserJob(log *zerolog.Logger, userRepo repository.UserRepository) *UnverifiedUserJob {
+	return &UnverifiedUserJob{log: log, userRepo: userRepo}
+}
+
+// Start runs the job every interval until the context is cancelled.
+func (j *UnverifiedUserJob) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *UnverifiedUserJob) Run() {
+	deleted, err := j.userRepo.DeleteExpiredUnverified(time.Now())
+
+	if err != nil {
+		j.log.Error().Err(err).Msg("Error removing expired unverified users")
+		return
+	}
+
+	if deleted > 0 {
+		j.log.Info().Int64("deleted", deleted).Msg("Removed expired unverified users")
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+
+	"github.com/rs/zerolog"
+)
+
+// CorsMiddleware lets browser apps on the origins a department allows call
+// the API. Requests are checked against the department of their tenant
+// credentials or access token, preflight requests carry neither and are
+// allowed for any department that lists the origin.
+type CorsMiddleware struct {
+	log            *zerolog.Logger
+	authHelper     *helpers.AuthHelper
+	responseHelper *helpers.ResponseHelper
+}
+
+func NewCorsMiddleware(log *zerolog.Logger, authHelper *helpers.AuthHelper, responseHelper *helpers.ResponseHelper) *CorsMiddleware {
+	return &CorsMiddleware{log: log, authHelper: authHelper, responseHelper: responseHelper}
+}
+
+// Start adds the CORS headers to requests from allowed origins and rejects
+// cross-origin requests the department doesn't allow. Requests without
+// tenant credentials or a valid access token get no CORS headers.
+func (m *CorsMiddleware) Start(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(constants.OriginHeader)
+		departmentId := helpers.GetDepartmentId(r)
+
+		// members send their access token instead of tenant credentials
+		if departmentId == "" && origin != "" {
+			departmentId, _ = m.authHelper.AccessTokenDepartment(r)
+		}
+
+		if origin == "" || departmentId == "" || r.Method == http.MethodOptions || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", constants.OriginHeader)
+
+		settings, err := m.authHelper.GetEffectiveSettings(departmentId)
+
+		if err != nil {
+			m.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+			return
+		}
+
+		if !helpers.OriginAllowed(settings.CorsOrigins, origin) || !settings.CorsMethodAllowed(r.Method) {
+			m.responseHelper.SendErrorResponse(w, constants.CorsOriginError, constants.Forbidden, nil)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", constants.CorsExposedHeaders)
+
+		if settings.CorsAllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Preflight answers CORS preflight requests.
+func (m *CorsMiddleware) Preflight(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get(constants.OriginHeader)
+	method := r.Header.Get("Access-Control-Request-Method")
+
+	w.Header().Add("Vary", constants.OriginHeader)
+
+	if origin == "" || method == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	departments, err := m.authHelper.CorsSettingsForOrigin(origin)
+
+	if err != nil {
+		m.responseHelper.SendErrorResponse(w, constants.InternalServerErrorMessage, constants.InternalServerError, err)
+		return
+	}
+
+	allowed, credentials := false, false
+	methods := map[string]bool{}
+
+	// cached department lists may be stale, the settings are authoritative
+	for _, settings := range departments {
+		if !helpers.OriginAllowed(settings.CorsOrigins, origin) || !settings.CorsMethodAllowed(method) {
+			continue
+		}
+
+		allowed = true
+		credentials = credentials || settings.CorsAllowCredentials
+
+		for _, allowedMethod := range settings.CorsMethods {
+			methods[allowedMethod] = true
+		}
+	}
+
+	if !allowed {
+		m.log.Debug().Str("origin", origin).Str("method", method).Msg("Preflight request rejected")
+		m.responseHelper.SendErrorResponse(w, constants.CorsOriginError, constants.Forbidden, nil)
+		return
+	}
+
+	var allowedMethods []string
+	for _, allowedMethod := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if methods[allowedMethod] {
+			allowedMethods = append(allowedMethods, allowedMethod)
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", constants.CorsAllowedHeaders)
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.AppConfig.CorsMaxAge))
+
+	if credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == r.Host
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+)
+
+const (
+	corsDepartment      = "cors-department"
+	corsOtherDepartment = "cors-other-department"
+	expiredDepartment   = "expired-department"
+	corsOrigin          = "https://app.example"
+)
+
+type corsFixture struct {
+	handler    http.Handler
+	authHelper *helpers.AuthHelper
+}
+
+// newCorsFixture serves a handler behind the trace and CORS middleware, as
+// in main.go. Only corsDepartment and expiredDepartment allow corsOrigin,
+// expiredDepartment issues tokens that are already expired.
+func newCorsFixture() *corsFixture {
+	departmentRepo := &fakeDepartmentRepo{settings: map[string]models.DepartmentSettings{
+		corsDepartment:    {CorsOrigins: models.StringList{corsOrigin}},
+		expiredDepartment: {CorsOrigins: models.StringList{corsOrigin}, AccessTokenTtlMinutes: -1},
+	}}
+
+	authHelper := helpers.NewAuthHelper(&testLog, departmentRepo, *unreachableRedis())
+	cors := NewCorsMiddleware(&testLog, authHelper, helpers.NewResponseHelper(&testLog))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return &corsFixture{
+		handler:    NewTraceRequestMiddleware(&testLog, authHelper).Start(cors.Start(handler)),
+		authHelper: authHelper,
+	}
+}
+
+func (f *corsFixture) request(t *testing.T, departmentId string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+	req.Header.Set(constants.OriginHeader, corsOrigin)
+
+	if departmentId != "" {
+		token, err := f.authHelper.GenerateAccessJwtToken(&models.UserModel{ID: "user", Name: "User"}, departmentId, []models.Scope{models.ProfileScope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(constants.AuthorizationHeader, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCorsAllowsBearerTokenOfAllowingDepartment(t *testing.T) {
+	rec := newCorsFixture().request(t, corsDepartment)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != corsOrigin {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, corsOrigin)
+	}
+}
+
+func TestCorsAllowsExpiredBearerToken(t *testing.T) {
+	rec := newCorsFixture().request(t, expiredDepartment)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != corsOrigin {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, corsOrigin)
+	}
+}
+
+func TestCorsRejectsBearerTokenOfOtherDepartment(t *testing.T) {
+	rec := newCorsFixture().request(t, corsOtherDepartment)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
+
+func TestCorsSkipsRequestsWithoutCredentials(t *testing.T) {
+	rec := newCorsFixture().request(t, "")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"time"
+	"uas/internal/helpers"
+	"uas/internal/models"
+	repository "uas/internal/repositories"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+var testLog = zerolog.Nop()
+
+// unreachableRedis fails fast, settings and group roles are read from the
+// repositories then.
+func unreachableRedis() *helpers.RedisHelper {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: time.Millisecond, MaxRetries: -1})
+	return helpers.NewRedisHelper(client, &testLog, context.Background())
+}
+
+// The fakes embed their repository interface, methods a test doesn't need
+// panic on the nil interface.
+
+type fakeDepartmentRepo struct {
+	repository.DepartmentRepository
+	departments map[string]*models.DepartmentModel
+	settings    map[string]models.DepartmentSettings
+	keys        []models.SigningKeyModel
+}
+
+func (r *fakeDepartmentRepo) FindById(id string) (*models.DepartmentModel, error) {
+	department, ok := r.departments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *department
+	return &copied, nil
+}
+
+func (r *fakeDepartmentRepo) FindConfig(departmentId string) (*models.DepartmentConfig, error) {
+	return &models.DepartmentConfig{DepartmentID: departmentId, Settings: r.settings[departmentId]}, nil
+}
+
+func (r *fakeDepartmentRepo) FindSigningKey(id string) (*models.SigningKeyModel, error) {
+	for _, key := range r.keys {
+		if key.ID == id {
+			copied := key
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeDepartmentRepo) FindSigningKeys(departmentId string) ([]models.SigningKeyModel, error) {
+	var keys []models.SigningKeyModel
+	for _, key := range r.keys {
+		if key.DepartmentID == departmentId {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeDepartmentRepo) RotateSigningKey(key *models.SigningKeyModel) error {
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *fakeDepartmentRepo) CreateSigningKeyIfAbsent(key *models.SigningKeyModel) (*models.SigningKeyModel, error) {
+	for _, existing := range r.keys {
+		if existing.DepartmentID == key.DepartmentID && existing.RetiredAt == nil {
+			return &existing, nil
+		}
+	}
+	r.keys = append(r.keys, *key)
+	return key, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[string]*models.UserModel
+}
+
+func (r *fakeUserRepo) FindById(id string) (*models.UserModel, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+type fakeDepartmentRoleRepo struct {
+	repository.DepartmentRoleRepository
+	roles []models.DepartmentRoles
+}
+
+func (r *fakeDepartmentRoleRepo) FindById(departmentId string, userId string) (*models.DepartmentRoles, error) {
+	for _, role := range r.roles {
+		if role.DepartmentID == departmentId && role.UserID == userId {
+			copied := role
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// fakeGroupRepo has no groups.
+type fakeGroupRepo struct {
+	repository.GroupRepository
+}
+
+func (r *fakeGroupRepo) FindMemberships(departmentId string, memberIds []string) ([]models.GroupMemberModel, error) {
+	return nil, nil
+}
+
+func (r *fakeGroupRepo) FindRoles(groupIds []string) ([]models.GroupRoleModel, error) {
+	return nil, nil
+}
+
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	events []models.AuditEventModel
+}
+
+func (r *fakeAuditRepo) Create(event *models.AuditEventModel) error {
+	r.events = append(r.events, *event)
+	return nil
+}
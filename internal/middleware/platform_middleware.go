@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"uas/config"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	repository "uas/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+type PlatformMiddleware struct {
+	log            *zerolog.Logger
+	authHelper     *helpers.AuthHelper
+	platformRepo   repository.PlatformRepository
+	responseHelper *helpers.ResponseHelper
+}
+
+func NewPlatformMiddleware(
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	platformRepo repository.PlatformRepository,
+	responseHelper *helpers.ResponseHelper,
+) *PlatformMiddleware {
+	return &PlatformMiddleware{log: log, authHelper: authHelper, platformRepo: platformRepo, responseHelper: responseHelper}
+}
+
+// Authorize only lets platform callers through: a platform admin session
+// token or the bootstrap API key from config. The caller is stored as the
+// platform actor for the audit trail.
+func (m *PlatformMiddleware) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(constants.PlatformTokenHeader)
+
+		if token == "" {
+			m.responseHelper.SendErrorResponse(w, constants.PlatformCredentialsError, constants.Unauthorized, nil)
+			return
+		}
+
+		apiKey := config.AppConfig.PlatformApiKey
+
+		if apiKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1 {
+			next.ServeHTTP(w, helpers.SetPlatformActor(r, constants.PlatformApiKeyActor))
+			return
+		}
+
+		adminId, err := m.authHelper.ValidatePlatformToken(token)
+
+		if err != nil {
+			m.responseHelper.SendErrorResponse(w, constants.PlatformCredentialsError, constants.Unauthorized, err)
+			return
+		}
+
+		// the admin must still exist, a deleted admin's sessions stop working
+		if _, err := m.platformRepo.FindAdminById(adminId); err != nil {
+			m.responseHelper.SendErrorResponse(w, constants.PlatformCredentialsError, constants.Unauthorized, err)
+			return
+		}
+
+		next.ServeHTTP(w, helpers.SetPlatformActor(r, adminId))
+	})
+}
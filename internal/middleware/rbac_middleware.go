@@ -1,29 +1,71 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"time"
 	"uas/internal/constants"
 	"uas/internal/helpers"
 	"uas/internal/models"
 	repository "uas/internal/repositories"
 
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 )
 
 type RBACMiddleware struct {
 	log                *zerolog.Logger
-	jwtHelper          *helpers.AuthHelper
+	authHelper         *helpers.AuthHelper
+	userRepo           repository.UserRepository
 	departmentRoleRepo repository.DepartmentRoleRepository
+	roleHelper         *helpers.RoleHelper
+	auditHelper        *helpers.AuditHelper
 }
 
-func NewRBACMiddleware(log *zerolog.Logger, departmentRoleRepo repository.DepartmentRoleRepository) *RBACMiddleware {
-	return &RBACMiddleware{log: log, departmentRoleRepo: departmentRoleRepo}
+// statusRecorder remembers the status a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
 }
 
-func (m *RBACMiddleware) Authorize(roles []models.Role, next http.Handler) http.Handler {
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func NewRBACMiddleware(
+	log *zerolog.Logger,
+	authHelper *helpers.AuthHelper,
+	userRepo repository.UserRepository,
+	departmentRoleRepo repository.DepartmentRoleRepository,
+	roleHelper *helpers.RoleHelper,
+	auditHelper *helpers.AuditHelper,
+) *RBACMiddleware {
+	return &RBACMiddleware{
+		log:                log,
+		authHelper:         authHelper,
+		userRepo:           userRepo,
+		departmentRoleRepo: departmentRoleRepo,
+		roleHelper:         roleHelper,
+		auditHelper:        auditHelper,
+	}
+}
+
+// Require wraps a route's handler so only members whose role or groups grant
+// every permission can call it. Without permissions any member can.
+func (m *RBACMiddleware) Require(handler http.HandlerFunc, permissions ...models.Permission) http.Handler {
+	return m.Authorize(permissions, nil, handler)
+}
+
+// RequireScopes is Require for routes that also need the access token to have
+// been granted every scope.
+func (m *RBACMiddleware) RequireScopes(handler http.HandlerFunc, scopes []models.Scope, permissions ...models.Permission) http.Handler {
+	return m.Authorize(permissions, scopes, handler)
+}
+
+func (m *RBACMiddleware) Authorize(permissions []models.Permission, scopes []models.Scope, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		accessToken, err := r.Cookie(constants.AccessTokenCookie)
+		// the bearer token or the access token cookie
+		accessToken, err := m.authHelper.AccessToken(r)
 
 		if err != nil {
 			m.log.Error().Msgf("Error: %s", err)
@@ -31,7 +73,9 @@ func (m *RBACMiddleware) Authorize(roles []models.Role, next http.Handler) http.
 			return
 		}
 
-		claims, err := m.jwtHelper.ParseAccessJwtToken(accessToken.Value)
+		// tokens issued for another department than the tenant credentials are
+		// rejected, and so are expired ones
+		claims, err := m.authHelper.ParseAccessJwtToken(accessToken, helpers.GetDepartmentId(r))
 
 		if err != nil {
 			m.log.Error().Msgf("Error: %s", err)
@@ -39,32 +83,36 @@ func (m *RBACMiddleware) Authorize(roles []models.Role, next http.Handler) http.
 			return
 		}
 
-		expTime, err := claims.GetExpirationTime()
+		m.log.Info().Msgf("Access token is valid")
 
-		if err != nil {
-			m.log.Error().Msgf("Error: %s", err)
+		userId := claims.UserID
+		departmentId := claims.DepartmentID
+
+		if userId == "" || departmentId == "" {
+			m.log.Error().Msg("Error: access token has no user or department")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if expTime.Before(time.Now()) {
+		departmentRole, err := m.departmentRoleRepo.FindById(departmentId, userId)
+
+		if err != nil {
 			m.log.Error().Msgf("Error: %s", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		m.log.Info().Msgf("Access token is valid")
+		// tokens outlive the account's status, so users who couldn't log in
+		// now can't use the tokens they got before either
+		user, err := m.userRepo.FindById(userId)
 
-		userId := claims["userId"].(string)
-		departmentId := claims["departmentId"].(string)
-
-		if userId == "" || departmentId == "" {
-			m.log.Error().Msgf("Error: %s", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+		if err == nil {
+			err = m.authHelper.CheckLoginAllowed(user, departmentId)
 		}
 
-		departmentRole, err := m.departmentRoleRepo.FindById(departmentId, userId)
+		if err == nil && user.PasswordResetRequired {
+			err = errors.New(constants.ResetRequiredError)
+		}
 
 		if err != nil {
 			m.log.Error().Msgf("Error: %s", err)
@@ -72,16 +120,80 @@ func (m *RBACMiddleware) Authorize(roles []models.Role, next http.Handler) http.
 			return
 		}
 
+		// the token's department is the tenant's, or the request had no tenant
+		// credentials and the token alone decides the department
 		r = helpers.SetUserId(r, userId)
+		r = helpers.SetDepartmentId(r, departmentId)
 		r = helpers.SetRole(r, departmentRole.Role)
 
-		for _, role := range roles {
-			if role == departmentRole.Role {
-				next.ServeHTTP(w, r)
-				return
-			}
+		if !claims.HasScopes(scopes) {
+			m.auditHelper.Failure(r, models.AccessDenied, routeTarget(r), routeName(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
 		}
 
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		// the member's own role and the roles of their groups, nested ones included
+		granted, err := m.roleHelper.EffectivePermissions(departmentId, userId, departmentRole.Role)
+
+		if err != nil {
+			m.log.Error().Err(err).Str("role", string(departmentRole.Role)).Msg("Error resolving effective permissions")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		r = helpers.SetPermissions(r, granted)
+
+		if !helpers.HasPermissions(granted, permissions) {
+			m.auditHelper.Failure(r, models.AccessDenied, routeTarget(r), routeName(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// reads and the routes any member can call aren't admin actions
+		if r.Method == http.MethodGet || len(permissions) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// erasure handlers report the user they erased, the event mustn't name them
+		r = helpers.SetErasedUser(r)
+
+		rw := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		event := &models.AuditEventModel{Action: models.AdminRequest, TargetID: routeTarget(r), Details: routeName(r)}
+
+		if rw.statusCode >= http.StatusBadRequest {
+			event.Outcome = models.AuditFailure
+		}
+
+		m.auditHelper.Record(r, event)
 	})
 }
+
+// routeName is the method and path template of the request's route, e.g.
+// "POST /api/v1/admin/users/{id}/disable".
+func routeName(r *http.Request) string {
+	path := r.URL.Path
+
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			path = template
+		}
+	}
+
+	return r.Method + " " + path
+}
+
+// routeTarget is the id in the request's path: the user it acts on, or else
+// the resource.
+func routeTarget(r *http.Request) string {
+	vars := mux.Vars(r)
+
+	for _, name := range []string{"userId", "memberId", "id", "name"} {
+		if value := vars[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
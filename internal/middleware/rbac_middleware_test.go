@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	rbacDepartment  = "rbac-department"
+	otherDepartment = "other-department"
+	rbacAdminId     = "rbac-admin"
+	rbacUserId      = "rbac-user"
+	adminPath       = "/api/v1/admin/users"
+	profilePath     = "/api/v1/users/me"
+)
+
+type rbacFixture struct {
+	router         *mux.Router
+	authHelper     *helpers.AuthHelper
+	roleHelper     *helpers.RoleHelper
+	auditRepo      *fakeAuditRepo
+	userRepo       *fakeUserRepo
+	departmentRepo *fakeDepartmentRepo
+}
+
+// newRbacFixture serves an admin and a profile route the way main.go does,
+// for an admin and a user of rbacDepartment. otherDepartment has no members.
+func newRbacFixture() *rbacFixture {
+	redisHelper := unreachableRedis()
+	departmentRepo := &fakeDepartmentRepo{
+		departments: map[string]*models.DepartmentModel{rbacDepartment: {ID: rbacDepartment}},
+		settings:    map[string]models.DepartmentSettings{},
+	}
+	userRepo := &fakeUserRepo{users: map[string]*models.UserModel{
+		rbacAdminId: {ID: rbacAdminId, DepartmentID: rbacDepartment},
+		rbacUserId:  {ID: rbacUserId, DepartmentID: rbacDepartment},
+	}}
+	departmentRoleRepo := &fakeDepartmentRoleRepo{roles: []models.DepartmentRoles{
+		{DepartmentID: rbacDepartment, UserID: rbacAdminId, Role: models.Admin},
+		{DepartmentID: rbacDepartment, UserID: rbacUserId, Role: models.User},
+	}}
+	auditRepo := &fakeAuditRepo{}
+
+	authHelper := helpers.NewAuthHelper(&testLog, departmentRepo, *redisHelper)
+	roleHelper := helpers.NewRoleHelper(&testLog, nil, departmentRepo, &fakeGroupRepo{}, redisHelper)
+	rbac := NewRBACMiddleware(&testLog, authHelper, userRepo, departmentRoleRepo, roleHelper, helpers.NewAuditHelper(&testLog, auditRepo))
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := mux.NewRouter()
+	router.Use(NewTraceRequestMiddleware(&testLog, authHelper).Start)
+	router.Handle(adminPath, rbac.RequireScopes(ok, []models.Scope{models.AdminScope}, models.UsersReadPermission)).Methods(http.MethodGet)
+	router.Handle(profilePath, rbac.RequireScopes(ok, []models.Scope{models.ProfileScope}, models.ProfileReadPermission)).Methods(http.MethodGet)
+
+	return &rbacFixture{router: router, authHelper: authHelper, roleHelper: roleHelper, auditRepo: auditRepo, userRepo: userRepo, departmentRepo: departmentRepo}
+}
+
+// token issues an access token for the member with the scopes their role
+// grants, like the login handlers.
+func (f *rbacFixture) token(t *testing.T, departmentId string, userId string, role models.Role) string {
+	t.Helper()
+
+	scopes, err := f.roleHelper.MemberScopes(departmentId, userId, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f.tokenWithScopes(t, departmentId, userId, scopes)
+}
+
+func (f *rbacFixture) tokenWithScopes(t *testing.T, departmentId string, userId string, scopes []models.Scope) string {
+	t.Helper()
+
+	token, err := f.authHelper.GenerateAccessJwtToken(&models.UserModel{ID: userId}, departmentId, scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (f *rbacFixture) get(path string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+
+	if token != "" {
+		req.Header.Set(constants.AuthorizationHeader, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMemberScopesFollowPermissions(t *testing.T) {
+	f := newRbacFixture()
+
+	admin, err := f.roleHelper.MemberScopes(rbacDepartment, rbacAdminId, models.Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := f.roleHelper.MemberScopes(rbacDepartment, rbacUserId, models.User)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(admin) != 2 || admin[0] != models.ProfileScope || admin[1] != models.AdminScope {
+		t.Fatalf("admin scopes = %v, want [profile admin]", admin)
+	}
+
+	if len(user) != 1 || user[0] != models.ProfileScope {
+		t.Fatalf("user scopes = %v, want [profile]", user)
+	}
+}
+
+func TestRequireScopesAcceptsGrantedScope(t *testing.T) {
+	f := newRbacFixture()
+
+	if rec := f.get(adminPath, f.token(t, rbacDepartment, rbacAdminId, models.Admin)); rec.Code != http.StatusOK {
+		t.Fatalf("admin route status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if rec := f.get(profilePath, f.token(t, rbacDepartment, rbacUserId, models.User)); rec.Code != http.StatusOK {
+		t.Fatalf("profile route status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRequireScopesRejectsMissingScope(t *testing.T) {
+	f := newRbacFixture()
+
+	rec := f.get(adminPath, f.token(t, rbacDepartment, rbacUserId, models.User))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	if len(f.auditRepo.events) != 1 || f.auditRepo.events[0].Action != models.AccessDenied {
+		t.Fatalf("audit events = %+v, want one access denied event", f.auditRepo.events)
+	}
+}
+
+// the admin's permissions don't make up for a token without the admin scope
+func TestRequireScopesRejectsAdminTokenWithoutScope(t *testing.T) {
+	f := newRbacFixture()
+
+	token := f.tokenWithScopes(t, rbacDepartment, rbacAdminId, []models.Scope{models.ProfileScope})
+
+	if rec := f.get(adminPath, token); rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAuthorizeRejectsMissingToken(t *testing.T) {
+	if rec := newRbacFixture().get(profilePath, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthorizeRejectsNonMember(t *testing.T) {
+	f := newRbacFixture()
+
+	token := f.tokenWithScopes(t, otherDepartment, rbacAdminId, []models.Scope{models.ProfileScope, models.AdminScope})
+
+	if rec := f.get(adminPath, token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthorizeAcceptsAccessTokenCookie(t *testing.T) {
+	f := newRbacFixture()
+
+	issued := httptest.NewRecorder()
+	f.authHelper.GenerateAccessCookie(f.token(t, rbacDepartment, rbacUserId, models.User), rbacDepartment, issued)
+
+	req := httptest.NewRequest(http.MethodGet, profilePath, nil)
+	for _, cookie := range issued.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// tokens issued before the account or department changed status stop working
+func TestAuthorizeRejectsMembersWhoCantLogIn(t *testing.T) {
+	deactivatedAt := time.Now()
+
+	tests := []struct {
+		name                  string
+		user                  models.UserModel
+		departmentDeactivated bool
+	}{
+		{name: "disabled", user: models.UserModel{Disabled: true}},
+		{name: "deactivated", user: models.UserModel{DeactivatedAt: &deactivatedAt}},
+		{name: "password reset required", user: models.UserModel{PasswordResetRequired: true}},
+		{name: "department deactivated", departmentDeactivated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRbacFixture()
+			token := f.token(t, rbacDepartment, rbacUserId, models.User)
+
+			if rec := f.get(profilePath, token); rec.Code != http.StatusOK {
+				t.Fatalf("status before = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			tt.user.ID, tt.user.DepartmentID = rbacUserId, rbacDepartment
+			f.userRepo.users[rbacUserId] = &tt.user
+
+			if tt.departmentDeactivated {
+				f.departmentRepo.departments[rbacDepartment].DeactivatedAt = &deactivatedAt
+			}
+
+			if rec := f.get(profilePath, token); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status after = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+
+	"github.com/rs/zerolog"
+)
+
+type ScimMiddleware struct {
+	log        *zerolog.Logger
+	authHelper *helpers.AuthHelper
+	scimHelper *helpers.ScimHelper
+}
+
+func NewScimMiddleware(log *zerolog.Logger, authHelper *helpers.AuthHelper, scimHelper *helpers.ScimHelper) *ScimMiddleware {
+	return &ScimMiddleware{log: log, authHelper: authHelper, scimHelper: scimHelper}
+}
+
+// Authorize authenticates the department's SCIM bearer token and scopes the
+// request to that department.
+func (m *ScimMiddleware) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get(constants.AuthorizationHeader), "Bearer ")
+
+		if !found || token == "" {
+			m.scimHelper.SendError(w, http.StatusUnauthorized, "", "Missing bearer token", nil)
+			return
+		}
+
+		departmentId, err := m.authHelper.ValidateScimToken(token)
+
+		if err != nil {
+			m.scimHelper.SendError(w, http.StatusUnauthorized, "", "Invalid bearer token", err)
+			return
+		}
+
+		next.ServeHTTP(w, helpers.SetDepartmentId(r, departmentId))
+	})
+}
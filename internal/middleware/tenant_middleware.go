@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+
+	"github.com/rs/zerolog"
+)
+
+type TenantMiddleware struct {
+	log            *zerolog.Logger
+	responseHelper *helpers.ResponseHelper
+}
+
+func NewTenantMiddleware(log *zerolog.Logger, responseHelper *helpers.ResponseHelper) *TenantMiddleware {
+	return &TenantMiddleware{log: log, responseHelper: responseHelper}
+}
+
+// Authorize only lets requests through that carry valid tenant credentials.
+// The credentials themselves are checked by the trace middleware.
+func (m *TenantMiddleware) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if helpers.GetDepartmentId(r) == "" {
+			m.responseHelper.SendErrorResponse(w, constants.TenantCredentialsError, constants.Unauthorized, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
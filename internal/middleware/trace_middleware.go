@@ -31,18 +31,19 @@ func (m *TraceRequestMiddleware) Start(next http.Handler) http.Handler {
 
 		w.Header().Add(constants.TraceIdHeader, requestId)
 
-		authToken := r.Header.Get(constants.AuthorizationHeader)
+		authToken := strings.Replace(r.Header.Get(constants.AuthorizationHeader), "Bearer ", "", 1)
 
-		if authToken != "" {
-			authToken = strings.Replace(authToken, "Bearer ", "", 1)
-
-			tenantId, err := m.authHelper.ValidateBasicAuthToken(authToken)
+		// a JWT is a member's access token, RBACMiddleware checks those, and
+		// SCIM clients send the department's SCIM token, ScimMiddleware does
+		if authToken != "" && !helpers.IsJwt(authToken) && !strings.HasPrefix(r.URL.Path, constants.ScimPrefix+"/") {
+			tenantId, credential, err := m.authHelper.ValidateBasicAuthToken(authToken)
 
 			if err != nil {
 				m.log.Error().Str(constants.RequestIdCtxKey, requestId).Msgf("Error: %s", err)
 			}
 
 			r = helpers.SetDepartmentId(r, tenantId)
+			r = helpers.SetTenantCredential(r, credential)
 		}
 
 		r = helpers.SetRequestId(r, requestId)
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"uas/internal/constants"
+	"uas/internal/helpers"
+	"uas/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestTraceSkipsTenantCredentialsOnScimRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		wantError bool
+	}{
+		{name: "scim route", path: constants.ScimUsersEndpoint},
+		{name: "tenant route", path: constants.RelationCheckEndpoint, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log := zerolog.New(&logs).Level(zerolog.ErrorLevel)
+			departmentRepo := &fakeDepartmentRepo{settings: map[string]models.DepartmentSettings{}}
+			trace := NewTraceRequestMiddleware(&log, helpers.NewAuthHelper(&testLog, departmentRepo, *unreachableRedis()))
+
+			departmentId := "unset"
+			handler := trace.Start(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				departmentId = helpers.GetDepartmentId(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(constants.AuthorizationHeader, "Bearer scim-department.secret")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if departmentId != "" {
+				t.Fatalf("department = %q, want none", departmentId)
+			}
+
+			if logged := logs.Len() > 0; logged != tt.wantError {
+				t.Fatalf("error logged = %v, want %v: %s", logged, tt.wantError, logs.String())
+			}
+		})
+	}
+}
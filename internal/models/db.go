@@ -1,55 +1,259 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Role string
+type Permission string
+type Scope string
 type AuthModelType string
+type PasswordAlgorithm string
+type InvitationStatus string
+
+// StringList is stored as a JSON array column.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	value, err := json.Marshal(l)
+	return string(value), err
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, l)
+	case string:
+		return json.Unmarshal([]byte(value), l)
+	}
+	return errors.New("unsupported type for StringList")
+}
 
 const (
 	User  Role = "user"
 	Admin Role = "admin"
 )
 
+const (
+	UsersReadPermission        Permission = "users:read"
+	UsersWritePermission       Permission = "users:write"
+	UsersDeletePermission      Permission = "users:delete"
+	UsersImportPermission      Permission = "users:import"
+	InvitationsReadPermission  Permission = "invitations:read"
+	InvitationsWritePermission Permission = "invitations:write"
+	RolesReadPermission        Permission = "roles:read"
+	RolesWritePermission       Permission = "roles:write"
+	RolesAssignPermission      Permission = "roles:assign"
+	SettingsReadPermission     Permission = "settings:read"
+	SettingsWritePermission    Permission = "settings:write"
+	KeysReadPermission         Permission = "keys:read"
+	KeysWritePermission        Permission = "keys:write"
+	ScimWritePermission        Permission = "scim:write"
+	UsageReadPermission        Permission = "usage:read"
+	ProfileReadPermission      Permission = "profile:read"
+	ProfileWritePermission     Permission = "profile:write"
+	PoliciesReadPermission     Permission = "policies:read"
+	PoliciesWritePermission    Permission = "policies:write"
+	GroupsReadPermission       Permission = "groups:read"
+	GroupsWritePermission      Permission = "groups:write"
+	RelationsReadPermission    Permission = "relations:read"
+	RelationsWritePermission   Permission = "relations:write"
+	AuditReadPermission        Permission = "audit:read"
+)
+
+// Permissions lists every permission a role can grant.
+var Permissions = []Permission{
+	UsersReadPermission,
+	UsersWritePermission,
+	UsersDeletePermission,
+	UsersImportPermission,
+	InvitationsReadPermission,
+	InvitationsWritePermission,
+	RolesReadPermission,
+	RolesWritePermission,
+	RolesAssignPermission,
+	SettingsReadPermission,
+	SettingsWritePermission,
+	KeysReadPermission,
+	KeysWritePermission,
+	ScimWritePermission,
+	UsageReadPermission,
+	ProfileReadPermission,
+	ProfileWritePermission,
+	PoliciesReadPermission,
+	PoliciesWritePermission,
+	GroupsReadPermission,
+	GroupsWritePermission,
+	RelationsReadPermission,
+	RelationsWritePermission,
+	AuditReadPermission,
+}
+
+const (
+	ProfileScope Scope = "profile"
+	AdminScope   Scope = "admin"
+)
+
+// ScopesFor returns the access token scopes of a member with the
+// permissions. Every member gets profile, admin only comes with a permission
+// beyond their own profile.
+func ScopesFor(permissions []Permission) []Scope {
+	scopes := []Scope{ProfileScope}
+
+	for _, permission := range permissions {
+		if permission != ProfileReadPermission && permission != ProfileWritePermission {
+			return append(scopes, AdminScope)
+		}
+	}
+
+	return scopes
+}
+
+// BuiltInRolePermissions are the permissions of the roles every department
+// has. Admins can do everything, users only manage their own profile.
+var BuiltInRolePermissions = map[Role][]Permission{
+	Admin: Permissions,
+	User:  {ProfileReadPermission, ProfileWritePermission},
+}
+
+func ValidPermission(permission Permission) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func IsBuiltInRole(role Role) bool {
+	_, ok := BuiltInRolePermissions[role]
+	return ok
+}
+
 const (
 	ResetPassword AuthModelType = "reset-password"
 	MagicLink     AuthModelType = "magic-link"
 )
 
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+const (
+	Bcrypt         PasswordAlgorithm = "bcrypt"
+	Pbkdf2Sha256   PasswordAlgorithm = "pbkdf2-sha256"
+	Scrypt         PasswordAlgorithm = "scrypt"
+	FirebaseScrypt PasswordAlgorithm = "firebase-scrypt"
+	SaltedSha256   PasswordAlgorithm = "salted-sha256"
+)
+
+// TenantCredential identifies which of a tenant's secrets authenticated a request.
+type TenantCredential string
+
+const (
+	TenantCredentialCurrent  TenantCredential = "current"
+	TenantCredentialPrevious TenantCredential = "previous"
+)
+
 type DepartmentModel struct {
 	gorm.Model
 	ID               string           `gorm:"primaryKey;type:varchar(36);unique_index"`
 	Name             string           `gorm:"type:varchar(100);unique_index"`
-	Secret           string           `gorm:"type:varchar(36);unique_index"`
+	Secret           string           `gorm:"type:varchar(60)"`
 	DepartmentConfig DepartmentConfig `gorm:"foreignKey:DepartmentID"`
+
+	DeactivatedAt *time.Time
+	PurgeAt       *time.Time `gorm:"index"`
+
+	// After a rotation the previous secret stays valid until
+	// PreviousSecretExpiresAt so clients can switch over.
+	PreviousSecret          string `gorm:"type:varchar(60)"`
+	PreviousSecretExpiresAt *time.Time
+	SecretRotatedAt         *time.Time
+
+	LastUsedCredential TenantCredential `gorm:"type:varchar(10)"`
+	LastUsedAt         *time.Time
+}
+
+// PreviousSecretActive reports whether the secret replaced by the last
+// rotation is still accepted.
+func (d *DepartmentModel) PreviousSecretActive() bool {
+	return d.PreviousSecret != "" && d.PreviousSecretExpiresAt != nil && time.Now().Before(*d.PreviousSecretExpiresAt)
 }
 
 type UserModel struct {
 	gorm.Model
-	ID            string `gorm:"primaryKey;type:varchar(36);unique_index"`
+	ID string `gorm:"primaryKey;type:varchar(36);unique_index"`
+
+	// DepartmentID is the department the identity belongs to. Emails and
+	// phone numbers are only unique within it, empty ones are stored as NULL
+	// so they don't collide.
+	DepartmentID  string `gorm:"type:varchar(36);uniqueIndex:idx_department_email;uniqueIndex:idx_department_phone"`
 	Name          string `gorm:"type:varchar(100)"`
-	Email         string `gorm:"type:varchar(100);unique_index"`
-	Password      string `gorm:"type:varchar(100);unique_index"`
-	PhoneNumber   string `gorm:"type:varchar(14);unique_index"`
+	Email         string `gorm:"type:varchar(100);default:null;uniqueIndex:idx_department_email"`
+	Password      string `gorm:"type:varchar(255)"`
+	PhoneNumber   string `gorm:"type:varchar(14);default:null;uniqueIndex:idx_department_phone"`
 	EmailVerified bool   `gorm:"type:boolean"`
+
+	PasswordAlgorithm PasswordAlgorithm `gorm:"type:varchar(20);default:bcrypt"`
+
+	PendingEmail       string `gorm:"type:varchar(100)"`
+	PendingPhoneNumber string `gorm:"type:varchar(14)"`
+
+	Disabled              bool `gorm:"type:boolean"`
+	PasswordResetRequired bool `gorm:"type:boolean"`
+
+	// VerificationExpiresAt is when an unverified account is removed, nil
+	// once the email is verified or for accounts that never expire.
+	VerificationExpiresAt *time.Time `gorm:"index"`
+
+	// A deactivated account can be restored until PurgeAt, after which it
+	// is permanently deleted.
+	DeactivatedAt      *time.Time
+	PurgeAt            *time.Time `gorm:"index"`
+	PurgeWarningSentAt *time.Time
+
+	Metadata json.RawMessage `gorm:"type:json"`
+
+	// ExternalID is the identifier the provisioning client (SCIM) uses for the user.
+	ExternalID string `gorm:"type:varchar(255);index"`
 }
 
+// OwnedBy reports whether the identity belongs to the department, rather
+// than being a member from another department.
+func (u *UserModel) OwnedBy(departmentId string) bool {
+	return u.DepartmentID != "" && u.DepartmentID == departmentId
+}
+
+// DepartmentRoles is a user's membership of a department. A user can belong
+// to several departments, with one role in each.
 type DepartmentRoles struct {
-	ID        string `gorm:"primaryKey;type:varchar(36);unique_index"`
-	Role      Role   `gorm:"type:varchar(10);unique_index"`
-	UserID    string `gorm:"primaryKey;type:varchar(36);unique_index"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DepartmentID string `gorm:"primaryKey;type:varchar(36)"`
+	UserID       string `gorm:"primaryKey;type:varchar(36);index"`
+	Role         Role   `gorm:"type:varchar(50);index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
 }
 
 type AuthModel struct {
 	UserID    string        `gorm:"type:varchar(36);unique_index"`
 	Token     string        `gorm:"primaryKey;type:varchar(36)"`
-	Type      AuthModelType `gorm:"primaryKey:type:varchar(36);`
+	Type      AuthModelType `gorm:"primaryKey;type:varchar(36)"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -61,4 +265,589 @@ type DepartmentConfig struct {
 	Name             string `gorm:"type:varchar(100);unique_index"`
 	DepartmentID     string `gorm:"type:varchar(36);unique_index"`
 	MagicLinkBaseUrl string `gorm:"type:varchar(100);unique_index"`
+
+	UserMetadataSchema json.RawMessage `gorm:"type:json"`
+	TokenClaims        StringList      `gorm:"type:json"`
+
+	// ScimTokenHash is the SHA-256 of the department's SCIM bearer token.
+	ScimTokenHash string `gorm:"type:varchar(64)"`
+
+	Settings DepartmentSettings `gorm:"type:json"`
+
+	// Quotas are set by the platform, unlike Settings departments can't
+	// change them.
+	Quotas UsageQuotas `gorm:"type:json"`
+}
+
+// UsageQuotas limit what a department can use, zero means unlimited.
+type UsageQuotas struct {
+	MaxUsers              int64 `json:"maxUsers" validate:"gte=0"`
+	MaxMonthlyActiveUsers int64 `json:"maxMonthlyActiveUsers" validate:"gte=0"`
+	SmsPerDay             int64 `json:"smsPerDay" validate:"gte=0"`
+	EmailsPerDay          int64 `json:"emailsPerDay" validate:"gte=0"`
+}
+
+func (q UsageQuotas) Value() (driver.Value, error) {
+	value, err := json.Marshal(q)
+	return string(value), err
+}
+
+func (q *UsageQuotas) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*q = UsageQuotas{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, q)
+	case string:
+		return json.Unmarshal([]byte(value), q)
+	}
+	return errors.New("unsupported type for UsageQuotas")
+}
+
+// DailyLimit returns the daily quota of the metric, zero means unlimited.
+func (q *UsageQuotas) DailyLimit(metric UsageMetric) int64 {
+	switch metric {
+	case SmsUsage:
+		return q.SmsPerDay
+	case EmailUsage:
+		return q.EmailsPerDay
+	}
+	return 0
+}
+
+// UsageMetric is a metered event, counted per department and day.
+type UsageMetric string
+
+const (
+	LoginUsage UsageMetric = "logins"
+	SmsUsage   UsageMetric = "sms"
+	EmailUsage UsageMetric = "emails"
+)
+
+// UsageCounterModel counts the events of a metric for a department and day.
+type UsageCounterModel struct {
+	DepartmentID string      `gorm:"primaryKey;type:varchar(36)"`
+	Day          string      `gorm:"primaryKey;type:char(10)"`
+	Metric       UsageMetric `gorm:"primaryKey;type:varchar(20)"`
+	Count        int64
+}
+
+// ActiveUserModel marks a user as active in a department for a month, the
+// rows of a month are the department's monthly active users.
+type ActiveUserModel struct {
+	DepartmentID string `gorm:"primaryKey;type:varchar(36)"`
+	Month        string `gorm:"primaryKey;type:char(7)"`
+	UserID       string `gorm:"primaryKey;type:varchar(36)"`
+	CreatedAt    time.Time
+}
+
+// LoginMethod is a way users can sign in to a department.
+type LoginMethod string
+
+const (
+	PasswordLogin  LoginMethod = "password"
+	OtpLogin       LoginMethod = "otp"
+	MagicLinkLogin LoginMethod = "magic-link"
+)
+
+// CookieSettings controls the attributes of the access token cookie.
+type CookieSettings struct {
+	// SameSite is lax, strict or none, empty means lax.
+	SameSite string `json:"sameSite" validate:"omitempty,oneof=lax strict none"`
+	// Domain shares the cookie with subdomains, empty keeps it on the API host.
+	Domain string `json:"domain" validate:"omitempty,fqdn"`
+	// MaxAgeSeconds defaults to the access token lifetime.
+	MaxAgeSeconds int `json:"maxAgeSeconds" validate:"gte=0"`
+}
+
+// EmailBranding customizes the emails sent on behalf of a department.
+type EmailBranding struct {
+	LogoUrl      string `json:"logoUrl,omitempty" validate:"omitempty,url"`
+	PrimaryColor string `json:"primaryColor,omitempty" validate:"omitempty,hexcolor"`
+	SupportEmail string `json:"supportEmail,omitempty" validate:"omitempty,email"`
+}
+
+// DepartmentSettings is the department's auth configuration, stored as a
+// JSON column. Zero values fall back to the global config.
+type DepartmentSettings struct {
+	// LoginMethods lists the enabled login methods, empty enables all of them.
+	LoginMethods []LoginMethod `json:"loginMethods" validate:"dive,oneof=password otp magic-link"`
+
+	AccessTokenTtlMinutes int `json:"accessTokenTtlMinutes" validate:"gte=0"`
+	RefreshTokenTtlHours  int `json:"refreshTokenTtlHours" validate:"gte=0"`
+
+	OtpLength        int `json:"otpLength" validate:"omitempty,min=4,max=10"`
+	OtpExpireMinutes int `json:"otpExpireMinutes" validate:"gte=0"`
+
+	RedirectOrigins StringList `json:"redirectOrigins" validate:"dive,url"`
+
+	// Browser apps on these origins may call the API, with the methods in
+	// CorsMethods, empty allows all of them.
+	CorsOrigins          StringList `json:"corsOrigins" validate:"dive,url"`
+	CorsMethods          StringList `json:"corsMethods" validate:"dive,oneof=GET POST PUT PATCH DELETE"`
+	CorsAllowCredentials bool       `json:"corsAllowCredentials"`
+
+	Cookie CookieSettings `json:"cookie"`
+
+	EmailSenderName string        `json:"emailSenderName" validate:"omitempty,max=100,excludesall=<>\"@"`
+	Branding        EmailBranding `json:"branding"`
+
+	// SignupOpen controls whether users can create accounts themselves,
+	// nil means open. Invitations and SCIM provisioning are not affected.
+	SignupOpen *bool `json:"signupOpen"`
+}
+
+func (s DepartmentSettings) Value() (driver.Value, error) {
+	value, err := json.Marshal(s)
+	return string(value), err
+}
+
+func (s *DepartmentSettings) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*s = DepartmentSettings{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, s)
+	case string:
+		return json.Unmarshal([]byte(value), s)
+	}
+	return errors.New("unsupported type for DepartmentSettings")
+}
+
+// CorsMethodAllowed reports whether browser apps may use the HTTP method.
+func (s *DepartmentSettings) CorsMethodAllowed(method string) bool {
+	if len(s.CorsMethods) == 0 {
+		return true
+	}
+
+	for _, m := range s.CorsMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoginMethodEnabled reports whether users can sign in with the method.
+func (s *DepartmentSettings) LoginMethodEnabled(method LoginMethod) bool {
+	if len(s.LoginMethods) == 0 {
+		return true
+	}
+
+	for _, m := range s.LoginMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SignupAllowed reports whether users can create accounts themselves.
+func (s *DepartmentSettings) SignupAllowed() bool {
+	return s.SignupOpen == nil || *s.SignupOpen
+}
+
+// DataErasureModel records a completed right-to-erasure request. It only
+// keeps a pseudonym of the erased user so the record holds no personal data.
+type DataErasureModel struct {
+	ID            string `gorm:"primaryKey;type:varchar(36)"`
+	UserPseudonym string `gorm:"type:varchar(64);index"`
+	DepartmentID  string `gorm:"type:varchar(36);index"`
+	RequestedBy   string `gorm:"type:varchar(64)"`
+	CompletedAt   time.Time
+}
+
+// InvitationModel is an admin's invitation for someone to join a department
+// with a given role.
+type InvitationModel struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string `gorm:"type:varchar(36);index"`
+	Email        string `gorm:"type:varchar(100);index"`
+	Role         Role   `gorm:"type:varchar(50)"`
+	InvitedBy    string `gorm:"type:varchar(36)"`
+	AcceptedBy   string `gorm:"type:varchar(36)"`
+	ExpiresAt    time.Time
+	AcceptedAt   *time.Time
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (i *InvitationModel) Status() InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+type GroupMemberType string
+
+const (
+	GroupMemberUser  GroupMemberType = "user"
+	GroupMemberGroup GroupMemberType = "group"
+)
+
+// GroupModel is a named set of users and other groups within a department.
+type GroupModel struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string `gorm:"type:varchar(36);index"`
+	Name         string `gorm:"type:varchar(100)"`
+	Description  string `gorm:"type:varchar(255)"`
+	ExternalID   string `gorm:"type:varchar(255);index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type GroupMemberModel struct {
+	GroupID    string          `gorm:"primaryKey;type:varchar(36)"`
+	MemberID   string          `gorm:"primaryKey;type:varchar(36);index"`
+	MemberType GroupMemberType `gorm:"type:varchar(10);default:user"`
+	CreatedAt  time.Time
+}
+
+// GroupRoleModel grants a role to the members of a group, and to the members
+// of the groups nested in it.
+type GroupRoleModel struct {
+	GroupID      string `gorm:"primaryKey;type:varchar(36)"`
+	Role         Role   `gorm:"primaryKey;type:varchar(50)"`
+	DepartmentID string `gorm:"type:varchar(36);index"`
+	CreatedAt    time.Time
+}
+
+// RoleModel is a named set of permissions within a department. Besides the
+// built-in admin and user roles, which are seeded for every department and
+// can't be changed, departments define their own.
+type RoleModel struct {
+	DepartmentID string     `gorm:"primaryKey;type:varchar(36)"`
+	Name         Role       `gorm:"primaryKey;type:varchar(50)"`
+	Description  string     `gorm:"type:varchar(255)"`
+	Permissions  StringList `gorm:"type:json"`
+	BuiltIn      bool       `gorm:"type:boolean"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// PermissionList returns the permissions the role grants.
+func (r *RoleModel) PermissionList() []Permission {
+	permissions := make([]Permission, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		permissions = append(permissions, Permission(p))
+	}
+	return permissions
+}
+
+// BuiltInRoles returns the built-in roles of the department.
+func BuiltInRoles(departmentId string) []RoleModel {
+	roles := make([]RoleModel, 0, len(BuiltInRolePermissions))
+
+	for _, name := range []Role{Admin, User} {
+		permissions := make(StringList, 0, len(BuiltInRolePermissions[name]))
+		for _, p := range BuiltInRolePermissions[name] {
+			permissions = append(permissions, string(p))
+		}
+
+		roles = append(roles, RoleModel{
+			DepartmentID: departmentId,
+			Name:         name,
+			Description:  "Built-in " + string(name) + " role",
+			Permissions:  permissions,
+			BuiltIn:      true,
+		})
+	}
+
+	return roles
+}
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// TimeWindow is a time of day range in the timezone, UTC when empty. A
+// window whose end is before its start runs over midnight.
+type TimeWindow struct {
+	From     string `json:"from" validate:"required,datetime=15:04"`
+	To       string `json:"to" validate:"required,datetime=15:04"`
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,timezone"`
+}
+
+// PolicyConditions must all hold for a policy to match.
+type PolicyConditions struct {
+	// Owner requires the subject to own the resource.
+	Owner     bool        `json:"owner,omitempty"`
+	TimeOfDay *TimeWindow `json:"timeOfDay,omitempty" validate:"omitempty"`
+	IpRanges  []string    `json:"ipRanges,omitempty" validate:"omitempty,dive,cidr"`
+}
+
+func (c PolicyConditions) Value() (driver.Value, error) {
+	value, err := json.Marshal(c)
+	return string(value), err
+}
+
+func (c *PolicyConditions) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*c = PolicyConditions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, c)
+	case string:
+		return json.Unmarshal([]byte(value), c)
+	}
+	return errors.New("unsupported type for PolicyConditions")
+}
+
+// AuthzPolicyModel allows or denies actions to members of a department for
+// the authorization decision API. Roles and actions may end in * to match
+// a prefix, no roles means every member.
+type AuthzPolicyModel struct {
+	ID           string           `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string           `gorm:"type:varchar(36);index"`
+	Name         string           `gorm:"type:varchar(100)"`
+	Description  string           `gorm:"type:varchar(255)"`
+	Effect       PolicyEffect     `gorm:"type:varchar(5)"`
+	Roles        StringList       `gorm:"type:json"`
+	Actions      StringList       `gorm:"type:json"`
+	Conditions   PolicyConditions `gorm:"type:json"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RelatedUserset grants a relation to the subjects that have Relation on the
+// objects the object points at through Tupleset, e.g. the viewers of a
+// document's parent folder.
+type RelatedUserset struct {
+	Tupleset string `json:"tupleset" validate:"required,relationName"`
+	Relation string `json:"relation" validate:"required,relationName"`
+}
+
+// NamespaceRelation is a relation objects of a namespace can have. Besides
+// the subjects of its own tuples, it's had by the subjects of the relations
+// implying it, e.g. viewer implied by editor, and of related usersets.
+type NamespaceRelation struct {
+	Name        string           `json:"name" validate:"required,relationName"`
+	ImpliedBy   []string         `json:"impliedBy,omitempty" validate:"max=50,dive,relationName"`
+	FromRelated []RelatedUserset `json:"fromRelated,omitempty" validate:"max=50,dive"`
+}
+
+type NamespaceRelations []NamespaceRelation
+
+func (r NamespaceRelations) Value() (driver.Value, error) {
+	value, err := json.Marshal(r)
+	return string(value), err
+}
+
+func (r *NamespaceRelations) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*r = NamespaceRelations{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, r)
+	case string:
+		return json.Unmarshal([]byte(value), r)
+	}
+	return errors.New("unsupported type for NamespaceRelations")
+}
+
+// RelationNamespaceModel configures the relations the objects of a
+// namespace, e.g. doc, can have within a department.
+type RelationNamespaceModel struct {
+	DepartmentID string             `gorm:"primaryKey;type:varchar(36)"`
+	Name         string             `gorm:"primaryKey;type:varchar(64)"`
+	Relations    NamespaceRelations `gorm:"type:json"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Relation returns the relation of the namespace with the name, or nil.
+func (n *RelationNamespaceModel) Relation(name string) *NamespaceRelation {
+	for i := range n.Relations {
+		if n.Relations[i].Name == name {
+			return &n.Relations[i]
+		}
+	}
+	return nil
+}
+
+// RelationUserNamespace is the namespace of the department's users as
+// subjects of relation tuples, e.g. user:<id>.
+const RelationUserNamespace = "user"
+
+// RelationTupleModel stores that a subject has a relation to an object, e.g.
+// doc:123#viewer@user:abc. With SubjectRelation the subject is everyone with
+// that relation to the subject object, e.g. doc:123#viewer@group:eng#member.
+// Tuples aren't changed in place, writes and deletes record the department's
+// revision so reads can be evaluated at the snapshot of a consistency token.
+type RelationTupleModel struct {
+	ID               uint64  `gorm:"primaryKey;autoIncrement"`
+	DepartmentID     string  `gorm:"type:varchar(36);index:idx_relation_object,priority:1"`
+	Namespace        string  `gorm:"type:varchar(64);index:idx_relation_object,priority:2"`
+	ObjectID         string  `gorm:"type:varchar(128);index:idx_relation_object,priority:3"`
+	Relation         string  `gorm:"type:varchar(64);index:idx_relation_object,priority:4"`
+	SubjectNamespace string  `gorm:"type:varchar(64);index:idx_relation_subject,priority:1"`
+	SubjectID        string  `gorm:"type:varchar(128);index:idx_relation_subject,priority:2"`
+	SubjectRelation  string  `gorm:"type:varchar(64)"`
+	CreatedRevision  uint64  `gorm:"index"`
+	DeletedRevision  *uint64 `gorm:"index"`
+	CreatedAt        time.Time
+}
+
+// Object returns the tuple's object, e.g. doc:123.
+func (t *RelationTupleModel) Object() string {
+	return t.Namespace + ":" + t.ObjectID
+}
+
+// Subject returns the tuple's subject, e.g. user:abc or group:eng#member.
+func (t *RelationTupleModel) Subject() string {
+	if t.SubjectRelation == "" {
+		return t.SubjectNamespace + ":" + t.SubjectID
+	}
+	return t.SubjectNamespace + ":" + t.SubjectID + "#" + t.SubjectRelation
+}
+
+func (t *RelationTupleModel) String() string {
+	return t.Object() + "#" + t.Relation + "@" + t.Subject()
+}
+
+// RelationRevisionModel counts the writes to a department's relation tuples,
+// consistency tokens carry the revision they were issued at.
+type RelationRevisionModel struct {
+	DepartmentID string `gorm:"primaryKey;type:varchar(36)"`
+	Revision     uint64
+	UpdatedAt    time.Time
+}
+
+// SigningKeyModel is an RSA key a department signs its access tokens with,
+// the ID is the key id (kid) in token headers and the JWKS. The private key
+// is stored encrypted. After a rotation the retired key keeps verifying
+// tokens until they have expired.
+type SigningKeyModel struct {
+	ID           string `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string `gorm:"type:varchar(36);index"`
+	Algorithm    string `gorm:"type:varchar(10)"`
+	PrivateKey   string `gorm:"type:text"`
+	CreatedAt    time.Time
+	RetiredAt    *time.Time
+}
+
+type TenantDeletionStatus string
+
+const (
+	TenantDeletionPending   TenantDeletionStatus = "pending"
+	TenantDeletionRunning   TenantDeletionStatus = "running"
+	TenantDeletionCompleted TenantDeletionStatus = "completed"
+	TenantDeletionFailed    TenantDeletionStatus = "failed"
+)
+
+// TenantDeletionModel tracks the asynchronous deletion of a tenant and
+// everything that belongs to it.
+type TenantDeletionModel struct {
+	ID           string               `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string               `gorm:"type:varchar(36);index"`
+	Status       TenantDeletionStatus `gorm:"type:varchar(10);index"`
+	RequestedBy  string               `gorm:"type:varchar(100)"`
+	Error        string               `gorm:"type:text"`
+
+	// Users of the tenant are deleted, members from other departments
+	// only lose their membership.
+	UsersDeleted  int64
+	UsersDetached int64
+
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// Finished reports whether the deletion has completed or failed.
+func (d *TenantDeletionModel) Finished() bool {
+	return d.Status == TenantDeletionCompleted || d.Status == TenantDeletionFailed
+}
+
+// PlatformAdminModel is a super-admin of the platform, above every
+// department. Only the platform can onboard, list and delete tenants.
+type PlatformAdminModel struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	Email     string `gorm:"type:varchar(100);uniqueIndex"`
+	Name      string `gorm:"type:varchar(100)"`
+	Password  string `gorm:"type:varchar(255)"`
+	CreatedBy string `gorm:"type:varchar(100)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type TenantAuditAction string
+
+const (
+	TenantCreated           TenantAuditAction = "tenant.created"
+	TenantDeletionRequested TenantAuditAction = "tenant.deletion_requested"
+	TenantDeleted           TenantAuditAction = "tenant.deleted"
+)
+
+// TenantAuditModel records who performed a platform action on a tenant. The
+// actor is a plain string, either a platform admin id or the API key, so
+// records outlive the admins and tenants they refer to.
+type TenantAuditModel struct {
+	ID           string            `gorm:"primaryKey;type:varchar(36)"`
+	DepartmentID string            `gorm:"type:varchar(36);index"`
+	Action       TenantAuditAction `gorm:"type:varchar(30)"`
+	Actor        string            `gorm:"type:varchar(100)"`
+	CreatedAt    time.Time
+}
+
+type AuditAction string
+type AuditOutcome string
+
+const (
+	UserRegistered         AuditAction = "user.registered"
+	UserLogin              AuditAction = "user.login"
+	OtpSent                AuditAction = "otp.sent"
+	OtpVerified            AuditAction = "otp.verified"
+	PasswordResetRequested AuditAction = "password.reset_requested"
+	PasswordReset          AuditAction = "password.reset"
+	RoleAssigned           AuditAction = "role.assigned"
+	RoleRevoked            AuditAction = "role.revoked"
+	RoleCreated            AuditAction = "role.created"
+	RoleUpdated            AuditAction = "role.updated"
+	RoleDeleted            AuditAction = "role.deleted"
+	GroupRoleGranted       AuditAction = "group.role_granted"
+	GroupRoleRevoked       AuditAction = "group.role_revoked"
+	TenantDeactivated      AuditAction = "tenant.deactivated"
+	TenantRestored         AuditAction = "tenant.restored"
+	TenantSecretRotated    AuditAction = "tenant.secret_rotated"
+	AdminRequest           AuditAction = "admin.request"
+	AccessDenied           AuditAction = "access.denied"
+)
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEventModel is a security relevant action in a department. Events are
+// only ever appended. Actor and target are plain ids, the actor is a user,
+// a platform admin or the platform API key.
+type AuditEventModel struct {
+	ID           uint64       `gorm:"primaryKey;autoIncrement"`
+	DepartmentID string       `gorm:"type:varchar(36);index"`
+	Action       AuditAction  `gorm:"type:varchar(40);index"`
+	Outcome      AuditOutcome `gorm:"type:varchar(10)"`
+	ActorID      string       `gorm:"type:varchar(100);index"`
+	TargetID     string       `gorm:"type:varchar(100);index"`
+	Details      string       `gorm:"type:varchar(255)"`
+	IP           string       `gorm:"type:varchar(45)"`
+	UserAgent    string       `gorm:"type:varchar(255)"`
+	RequestID    string       `gorm:"type:varchar(36)"`
+	CreatedAt    time.Time    `gorm:"index"`
 }
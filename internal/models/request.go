@@ -1,11 +1,43 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Request struct {
 	ID           string
 	DepartmentID string
 	User         UserModel
 }
 
+type PlatformLoginRequest struct {
+	Email    string `json:"email" validate:"email,required,noSQLKeywords"`
+	Password string `json:"password" validate:"required,noSQLKeywords"`
+}
+
+type CreatePlatformAdminRequest struct {
+	Email    string `json:"email" validate:"email,required,noSQLKeywords"`
+	Name     string `json:"name" validate:"required,noSQLKeywords"`
+	Password string `json:"password" validate:"required,min=12,noSQLKeywords"`
+}
+
+type UpdateTenantRequest struct {
+	DepartmentName string `json:"departmentName" validate:"required,noSQLKeywords"`
+}
+
+type RotateSecretRequest struct {
+	// GracePeriodHours overrides how long the previous secret stays valid, 0 revokes it immediately.
+	GracePeriodHours *int `json:"gracePeriodHours" validate:"omitempty,min=0,max=720"`
+}
+
+type TenantFilter struct {
+	Search      string
+	Deactivated *bool
+	Page        int
+	PageSize    int
+}
+
 type OnboardTenantRequest struct {
 	DepartmentName string `json:"departmentName" validate:"required,noSQLKeywords"`
 	DepartmentID   string `json:"departmentId" validate:"required,noSQLKeywords"`
@@ -21,6 +53,8 @@ type RegisterRequest struct {
 	Email       string `json:"email" validate:"email,required,noSQLKeywords"`
 	Password    string `json:"password" validate:"required,noSQLKeywords"`
 	PhoneNumber string `json:"phoneNumber" validate:"required,e164,noSQLKeywords"`
+
+	Metadata json.RawMessage `json:"metadata"`
 }
 
 type ForgotPasswordRequest struct {
@@ -28,7 +62,7 @@ type ForgotPasswordRequest struct {
 }
 
 type ResetPasswordRequest struct {
-	Password string `json:"password" validate:"email,required,noSQLKeywords"`
+	Password string `json:"password" validate:"required,noSQLKeywords"`
 }
 
 type SendOtpRequest struct {
@@ -45,4 +79,224 @@ type VerifyEmailRequest struct {
 	Otp   string `json:"otp" validate:"required,noSQLKeywords,numeric"`
 }
 
-type MagicLinkEmailRequest = ForgotPasswordRequest
\ No newline at end of file
+type MagicLinkEmailRequest struct {
+	Email string `json:"email" validate:"email,required,noSQLKeywords"`
+	// RedirectUrl is where the user is sent after following the link, its
+	// origin must be one of the department's redirect origins.
+	RedirectUrl string `json:"redirectUrl" validate:"omitempty,url"`
+}
+
+type ResendVerificationRequest = ForgotPasswordRequest
+
+type UpdateProfileRequest struct {
+	Name        string `json:"name" validate:"omitempty,noSQLKeywords"`
+	Email       string `json:"email" validate:"omitempty,email,noSQLKeywords"`
+	PhoneNumber string `json:"phoneNumber" validate:"omitempty,e164,noSQLKeywords"`
+
+	// Metadata keys are merged into the existing metadata, a null value removes the key.
+	Metadata map[string]json.RawMessage `json:"metadata"`
+}
+
+type UpdateMetadataRequest struct {
+	Metadata map[string]json.RawMessage `json:"metadata" validate:"required"`
+}
+
+type UserSchemaRequest struct {
+	Schema      json.RawMessage `json:"schema"`
+	TokenClaims []string        `json:"tokenClaims" validate:"dive,required,noSQLKeywords"`
+}
+
+type VerifyProfileChangeRequest struct {
+	Otp string `json:"otp" validate:"required,noSQLKeywords,numeric"`
+}
+
+type UserFilter struct {
+	Search        string
+	Role          Role
+	EmailVerified *bool
+	Disabled      *bool
+	Deactivated   *bool
+	Email         string
+	ExternalID    string
+	Name          string
+	Page          int
+	PageSize      int
+	// Offset overrides Page when set, for clients that page by index.
+	Offset int
+}
+
+type GroupFilter struct {
+	Name       string
+	ExternalID string
+	Offset     int
+	Limit      int
+}
+
+type ChangeRoleRequest struct {
+	Role Role `json:"role" validate:"required,roleName"`
+}
+
+type CreateRoleRequest struct {
+	Name        Role         `json:"name" validate:"required,roleName"`
+	Description string       `json:"description" validate:"max=255,noSQLKeywords"`
+	Permissions []Permission `json:"permissions" validate:"required,min=1,dive,permission"`
+}
+
+type UpdateRoleRequest struct {
+	Description string       `json:"description" validate:"max=255,noSQLKeywords"`
+	Permissions []Permission `json:"permissions" validate:"required,min=1,dive,permission"`
+}
+
+type GroupRequest struct {
+	Name        string `json:"name" validate:"required,max=100,noSQLKeywords"`
+	Description string `json:"description" validate:"max=255,noSQLKeywords"`
+}
+
+type GroupMembersRequest struct {
+	Users  []string `json:"users" validate:"max=100,dive,uuid"`
+	Groups []string `json:"groups" validate:"max=100,dive,uuid"`
+}
+
+type NamespaceRequest struct {
+	Relations NamespaceRelations `json:"relations" validate:"required,min=1,max=50,dive"`
+}
+
+type RelationTuplesRequest struct {
+	Tuples []string `json:"tuples" validate:"required,min=1,max=100,dive,relationTuple"`
+}
+
+// RelationConsistency picks the revision a read is evaluated at. Without a
+// token reads see the latest tuples, which are at least as fresh as any
+// token, with Exact they see the tuples as they were at the token's revision.
+type RelationConsistency struct {
+	Token string `json:"token" validate:"required_if=Exact true,max=200"`
+	Exact bool   `json:"exact"`
+}
+
+type RelationCheckRequest struct {
+	Tuple       string              `json:"tuple" validate:"required,relationTuple"`
+	Consistency RelationConsistency `json:"consistency"`
+}
+
+type RelationExpandRequest struct {
+	Userset     string              `json:"userset" validate:"required,relationUserset"`
+	Consistency RelationConsistency `json:"consistency"`
+}
+
+type RelationListObjectsRequest struct {
+	Namespace   string              `json:"namespace" validate:"required,relationName"`
+	Relation    string              `json:"relation" validate:"required,relationName"`
+	Subject     string              `json:"subject" validate:"required,relationSubject"`
+	Cursor      string              `json:"cursor" validate:"max=128"`
+	Limit       int                 `json:"limit" validate:"min=0,max=1000"`
+	Consistency RelationConsistency `json:"consistency"`
+}
+
+type PolicyRequest struct {
+	Name        string           `json:"name" validate:"required,max=100,noSQLKeywords"`
+	Description string           `json:"description" validate:"max=255,noSQLKeywords"`
+	Effect      PolicyEffect     `json:"effect" validate:"required,oneof=allow deny"`
+	Roles       []string         `json:"roles" validate:"dive,required,max=50"`
+	Actions     []string         `json:"actions" validate:"required,min=1,dive,required,max=100"`
+	Conditions  PolicyConditions `json:"conditions"`
+}
+
+type AuthzResource struct {
+	Type  string `json:"type" validate:"max=100"`
+	ID    string `json:"id" validate:"max=255"`
+	Owner string `json:"owner" validate:"max=36"`
+}
+
+// AuthzContext describes the request being authorized. Time defaults to now.
+type AuthzContext struct {
+	Ip   string     `json:"ip" validate:"omitempty,ip"`
+	Time *time.Time `json:"time"`
+}
+
+// AuthzCheckRequest asks whether the subject, a user id, may perform the
+// action on the resource. Explain adds how the decision was reached, DryRun
+// evaluates the given policies instead of the stored ones.
+type AuthzCheckRequest struct {
+	Subject  string          `json:"subject" validate:"required,max=36"`
+	Action   string          `json:"action" validate:"required,max=100"`
+	Resource AuthzResource   `json:"resource"`
+	Context  AuthzContext    `json:"context"`
+	Explain  bool            `json:"explain"`
+	DryRun   bool            `json:"dryRun"`
+	Policies []PolicyRequest `json:"policies" validate:"dive"`
+}
+
+type AuthzBatchRequest struct {
+	Checks []AuthzCheckRequest `json:"checks" validate:"required,min=1,max=100,dive"`
+}
+
+// AuditFilter narrows the audit log, empty fields match every event.
+type AuditFilter struct {
+	Action    AuditAction
+	Outcome   AuditOutcome
+	ActorID   string
+	TargetID  string
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	Page      int
+	PageSize  int
+}
+
+type ImportFormat string
+
+const (
+	NDJSON ImportFormat = "ndjson"
+	CSV    ImportFormat = "csv"
+)
+
+// ImportUserRecord is a single row of a bulk user import. Hashes and salts
+// may be hex or base64 encoded, whatever the algorithm.
+type ImportUserRecord struct {
+	Name          string            `json:"name" validate:"noSQLKeywords"`
+	Email         string            `json:"email" validate:"email,required,noSQLKeywords"`
+	PhoneNumber   string            `json:"phoneNumber" validate:"omitempty,e164"`
+	EmailVerified bool              `json:"emailVerified"`
+	PasswordHash  string            `json:"passwordHash" validate:"required"`
+	PasswordSalt  string            `json:"passwordSalt"`
+	HashAlgorithm PasswordAlgorithm `json:"hashAlgorithm" validate:"required,oneof=bcrypt pbkdf2-sha256 scrypt firebase-scrypt salted-sha256"`
+
+	// pbkdf2-sha256
+	Iterations int `json:"iterations"`
+
+	// scrypt
+	CostN       int `json:"n"`
+	BlockSize   int `json:"r"`
+	Parallelism int `json:"p"`
+
+	// firebase-scrypt, falling back to ImportOptions when empty
+	SignerKey     string `json:"signerKey"`
+	SaltSeparator string `json:"saltSeparator"`
+	Rounds        int    `json:"rounds"`
+	MemCost       int    `json:"memCost"`
+}
+
+type ImportOptions struct {
+	DryRun                bool
+	FirebaseSignerKey     string
+	FirebaseSaltSeparator string
+	FirebaseRounds        int
+	FirebaseMemCost       int
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" validate:"email,required,noSQLKeywords"`
+	Role  Role   `json:"role" validate:"required,roleName"`
+}
+
+// AcceptInvitationRequest creates the invitee's account. The password is
+// optional, without one the account signs in with a magic link or OTP.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Name     string `json:"name" validate:"omitempty,noSQLKeywords"`
+	Password string `json:"password" validate:"omitempty,noSQLKeywords"`
+}
+
+type TokenExchangeRequest struct {
+	DepartmentID string `json:"departmentId" validate:"required,noSQLKeywords"`
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type SuccessResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
@@ -15,6 +20,80 @@ type OnboardDepartmentResponse struct {
 	DepartmentName string `json:"departmentName"`
 }
 
+type PlatformLoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type PlatformAdminResponse struct {
+	AdminID   string    `json:"adminId"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TenantAuditResponse struct {
+	AuditID      string            `json:"auditId"`
+	DepartmentID string            `json:"departmentId"`
+	Action       TenantAuditAction `json:"action"`
+	Actor        string            `json:"actor"`
+	CreatedAt    time.Time         `json:"createdAt"`
+}
+
+type AuditEventResponse struct {
+	EventID      uint64       `json:"eventId"`
+	DepartmentID string       `json:"departmentId"`
+	Action       AuditAction  `json:"action"`
+	Outcome      AuditOutcome `json:"outcome"`
+	ActorID      string       `json:"actorId,omitempty"`
+	TargetID     string       `json:"targetId,omitempty"`
+	Details      string       `json:"details,omitempty"`
+	IP           string       `json:"ip,omitempty"`
+	UserAgent    string       `json:"userAgent,omitempty"`
+	RequestID    string       `json:"requestId,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+type TenantDeletionResponse struct {
+	DeletionID    string               `json:"deletionId"`
+	DepartmentID  string               `json:"departmentId"`
+	Status        TenantDeletionStatus `json:"status"`
+	RequestedBy   string               `json:"requestedBy"`
+	Error         string               `json:"error,omitempty"`
+	UsersDeleted  int64                `json:"usersDeleted"`
+	UsersDetached int64                `json:"usersDetached"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	StartedAt     *time.Time           `json:"startedAt,omitempty"`
+	CompletedAt   *time.Time           `json:"completedAt,omitempty"`
+}
+
+type TenantResponse struct {
+	DepartmentID            string     `json:"departmentId"`
+	DepartmentName          string     `json:"departmentName"`
+	CreatedAt               time.Time  `json:"createdAt"`
+	UpdatedAt               time.Time  `json:"updatedAt"`
+	DeactivatedAt           *time.Time `json:"deactivatedAt,omitempty"`
+	PurgeAt                 *time.Time `json:"purgeAt,omitempty"`
+	SecretRotatedAt         *time.Time `json:"secretRotatedAt,omitempty"`
+	PreviousSecretExpiresAt *time.Time `json:"previousSecretExpiresAt,omitempty"`
+}
+
+type RotateSecretResponse struct {
+	DepartmentID            string     `json:"departmentId"`
+	SecretRotatedAt         *time.Time `json:"secretRotatedAt"`
+	PreviousSecretExpiresAt *time.Time `json:"previousSecretExpiresAt"`
+}
+
+type TenantCredentialsResponse struct {
+	DepartmentID            string           `json:"departmentId"`
+	LastUsedCredential      TenantCredential `json:"lastUsedCredential,omitempty"`
+	LastUsedAt              *time.Time       `json:"lastUsedAt"`
+	SecretRotatedAt         *time.Time       `json:"secretRotatedAt"`
+	PreviousSecretActive    bool             `json:"previousSecretActive"`
+	PreviousSecretExpiresAt *time.Time       `json:"previousSecretExpiresAt,omitempty"`
+}
+
 type HealthCheckResponse struct {
 	Service string `json:"service"`
 	Status  bool   `json:"status"`
@@ -25,3 +104,301 @@ type RegisterUserResponse struct {
 	Name   string `json:"name"`
 	Email  string `json:"email"`
 }
+
+type UserProfileResponse struct {
+	UserID             string `json:"userId"`
+	Name               string `json:"name"`
+	Email              string `json:"email"`
+	PhoneNumber        string `json:"phoneNumber"`
+	EmailVerified      bool   `json:"emailVerified"`
+	PendingEmail       string `json:"pendingEmail,omitempty"`
+	PendingPhoneNumber string `json:"pendingPhoneNumber,omitempty"`
+
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+type UserSchemaResponse struct {
+	Schema      json.RawMessage `json:"schema"`
+	TokenClaims []string        `json:"tokenClaims"`
+}
+
+// Jwk is an RSA public key in JSON Web Key format (RFC 7517).
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JwksResponse struct {
+	Keys []Jwk `json:"keys"`
+}
+
+type SigningKeyResponse struct {
+	Kid       string     `json:"kid"`
+	Algorithm string     `json:"algorithm"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+}
+
+type RoleResponse struct {
+	Name        Role       `json:"name"`
+	Description string     `json:"description"`
+	Permissions StringList `json:"permissions"`
+	BuiltIn     bool       `json:"builtIn"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+type GroupResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ExternalID  string    `json:"externalId,omitempty"`
+	Roles       []Role    `json:"roles"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type GroupMemberResponse struct {
+	ID      string          `json:"id"`
+	Type    GroupMemberType `json:"type"`
+	AddedAt time.Time       `json:"addedAt"`
+}
+
+// EffectivePermissionsResponse shows where a member's permissions come from,
+// their own role and the roles of every group they are in, nested ones included.
+type EffectivePermissionsResponse struct {
+	Role        Role         `json:"role"`
+	Groups      []string     `json:"groups"`
+	GroupRoles  []Role       `json:"groupRoles"`
+	Permissions []Permission `json:"permissions"`
+}
+
+type NamespaceResponse struct {
+	Name      string             `json:"name"`
+	Relations NamespaceRelations `json:"relations"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+// RelationTokenResponse carries the consistency token of a write, reads
+// with it see the write.
+type RelationTokenResponse struct {
+	Token string `json:"token"`
+}
+
+type RelationCheckResponse struct {
+	Allowed bool   `json:"allowed"`
+	Token   string `json:"token"`
+}
+
+// RelationNode is a userset, e.g. doc:123#viewer, with the subjects that have
+// it directly and the usersets whose subjects have it too. Via says how a
+// child is included: as a subject, through impliedBy or through fromRelated.
+type RelationNode struct {
+	Userset  string          `json:"userset"`
+	Via      string          `json:"via,omitempty"`
+	Subjects []string        `json:"subjects"`
+	Children []*RelationNode `json:"children,omitempty"`
+}
+
+type RelationExpandResponse struct {
+	Tree  *RelationNode `json:"tree"`
+	Token string        `json:"token"`
+}
+
+// RelationListObjectsResponse is a page of objects, NextCursor is empty on
+// the last page.
+type RelationListObjectsResponse struct {
+	Objects    []string `json:"objects"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+	Token      string   `json:"token"`
+}
+
+type PolicyResponse struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Effect      PolicyEffect     `json:"effect"`
+	Roles       StringList       `json:"roles"`
+	Actions     StringList       `json:"actions"`
+	Conditions  PolicyConditions `json:"conditions"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+}
+
+type AuthzDecision struct {
+	Allowed     bool              `json:"allowed"`
+	Reason      string            `json:"reason"`
+	Policy      string            `json:"policy,omitempty"`
+	Explanation *AuthzExplanation `json:"explanation,omitempty"`
+}
+
+// AuthzExplanation is how a decision was reached, for debugging policies.
+type AuthzExplanation struct {
+	Role        Role               `json:"role,omitempty"`
+	GroupRoles  []Role             `json:"groupRoles,omitempty"`
+	Permissions []Permission       `json:"permissions"`
+	DryRun      bool               `json:"dryRun"`
+	Policies    []PolicyEvaluation `json:"policies"`
+}
+
+type PolicyEvaluation struct {
+	Policy     string            `json:"policy"`
+	Effect     PolicyEffect      `json:"effect"`
+	Applies    bool              `json:"applies"`
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+	Matched    bool              `json:"matched"`
+}
+
+type ConditionResult struct {
+	Condition string `json:"condition"`
+	Passed    bool   `json:"passed"`
+	Detail    string `json:"detail"`
+}
+
+type AuthzBatchResponse struct {
+	Results []AuthzDecision `json:"results"`
+}
+
+type DailyUsage struct {
+	Day    string `json:"day"`
+	Logins int64  `json:"logins"`
+	Sms    int64  `json:"sms"`
+	Emails int64  `json:"emails"`
+}
+
+type MonthlyUsage struct {
+	Month       string `json:"month"`
+	Logins      int64  `json:"logins"`
+	Sms         int64  `json:"sms"`
+	Emails      int64  `json:"emails"`
+	ActiveUsers int64  `json:"activeUsers"`
+}
+
+type UsageResponse struct {
+	DepartmentID string         `json:"departmentId"`
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	Users        int64          `json:"users"`
+	Quotas       UsageQuotas    `json:"quotas"`
+	Daily        []DailyUsage   `json:"daily"`
+	Monthly      []MonthlyUsage `json:"monthly"`
+}
+
+// DepartmentSettingsResponse holds the settings as stored and with the
+// global defaults applied.
+type DepartmentSettingsResponse struct {
+	Settings  DepartmentSettings `json:"settings"`
+	Effective DepartmentSettings `json:"effective"`
+}
+
+type AdminUserResponse struct {
+	UserProfileResponse
+	Role                  Role       `json:"role"`
+	Disabled              bool       `json:"disabled"`
+	PasswordResetRequired bool       `json:"passwordResetRequired"`
+	DeactivatedAt         *time.Time `json:"deactivatedAt,omitempty"`
+	PurgeAt               *time.Time `json:"purgeAt,omitempty"`
+	CreatedAt             time.Time  `json:"createdAt"`
+}
+
+type PaginatedResponse struct {
+	Items    interface{} `json:"items"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Total    int64       `json:"total"`
+}
+
+type DataExportResponse struct {
+	ExportedAt  time.Time            `json:"exportedAt"`
+	Profile     *AdminUserResponse   `json:"profile"`
+	Roles       []ExportRole         `json:"roles"`
+	Sessions    []ExportSession      `json:"sessions"`
+	Identities  []ExportIdentity     `json:"identities"`
+	AuditEvents []AuditEventResponse `json:"auditEvents"`
+}
+
+type ExportRole struct {
+	DepartmentID string    `json:"departmentId"`
+	Role         Role      `json:"role"`
+	AssignedAt   time.Time `json:"assignedAt"`
+}
+
+type ExportSession struct {
+	Type      AuthModelType `json:"type"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+type ExportIdentity struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Verified bool   `json:"verified"`
+}
+
+type DataErasureResponse struct {
+	ErasureID     string    `json:"erasureId"`
+	UserPseudonym string    `json:"userPseudonym"`
+	CompletedAt   time.Time `json:"completedAt"`
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+type ImportUsersResponse struct {
+	DryRun   bool             `json:"dryRun"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type InvitationResponse struct {
+	InvitationID string           `json:"invitationId"`
+	DepartmentID string           `json:"departmentId"`
+	Email        string           `json:"email"`
+	Role         Role             `json:"role"`
+	Status       InvitationStatus `json:"status"`
+	InvitedBy    string           `json:"invitedBy"`
+	ExpiresAt    time.Time        `json:"expiresAt"`
+	AcceptedAt   *time.Time       `json:"acceptedAt,omitempty"`
+	CreatedAt    time.Time        `json:"createdAt"`
+}
+
+type InvitationPreviewResponse struct {
+	DepartmentName string    `json:"departmentName"`
+	Email          string    `json:"email"`
+	Role           Role      `json:"role"`
+	ExistingUser   bool      `json:"existingUser"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+type AcceptInvitationResponse struct {
+	UserID       string `json:"userId"`
+	DepartmentID string `json:"departmentId"`
+	Role         Role   `json:"role"`
+}
+
+type DeactivationResponse struct {
+	DeactivatedAt *time.Time `json:"deactivatedAt"`
+	PurgeAt       *time.Time `json:"purgeAt"`
+}
+
+type MembershipResponse struct {
+	DepartmentID   string    `json:"departmentId"`
+	DepartmentName string    `json:"departmentName"`
+	Role           Role      `json:"role"`
+	Current        bool      `json:"current"`
+	JoinedAt       time.Time `json:"joinedAt"`
+}
+
+type TokenExchangeResponse struct {
+	DepartmentID string `json:"departmentId"`
+	Role         Role   `json:"role"`
+}
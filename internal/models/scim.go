@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ScimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimListSchema         = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchSchema        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimConfigSchema       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimResourceTypeSchema = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	ScimSchemaSchema       = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas      []string         `json:"schemas"`
+	ID           string           `json:"id,omitempty"`
+	ExternalID   string           `json:"externalId,omitempty"`
+	UserName     string           `json:"userName"`
+	Name         *ScimName        `json:"name,omitempty"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	Emails       []ScimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []ScimMultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+	Groups       []ScimMultiValue `json:"groups,omitempty"`
+	Meta         *ScimMeta        `json:"meta,omitempty"`
+
+	// Password is write only, it is never returned.
+	Password string `json:"password,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []ScimMultiValue `json:"members"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ScimFilter is a single `attribute eq "value"` filter expression.
+type ScimFilter struct {
+	Attribute string
+	Value     string
+}
+
+type ScimTokenResponse struct {
+	Token string `json:"token"`
+}
@@ -8,6 +8,19 @@ type ForgotPasswordData struct {
 type VerifyEmailData struct {
 	Name string
 	Otp  string
+	Url  string
 }
 
 type MagicEmailData = ForgotPasswordData
+
+type InvitationData struct {
+	DepartmentName string
+	Role           Role
+	Url            string
+	ExpiresAt      string
+}
+
+type DeactivationData struct {
+	Name    string
+	PurgeAt string
+}
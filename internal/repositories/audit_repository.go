@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+// AuditRepository only appends to the audit log and reads it, events are
+// never changed. They outlive their department until the retention job
+// removes them.
+type AuditRepository interface {
+	Create(event *models.AuditEventModel) error
+	FindEvents(departmentId string, filter models.AuditFilter) ([]models.AuditEventModel, int64, error)
+	FindEventsAfter(departmentId string, filter models.AuditFilter, after uint64, limit int) ([]models.AuditEventModel, error)
+	FindByUser(departmentId string, userId string) ([]models.AuditEventModel, error)
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+type GormAuditRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormAuditRepository) Create(event *models.AuditEventModel) error {
+	return r.db.Create(event).Error
+}
+
+// FindEvents returns a page of the department's events, newest first.
+func (r *GormAuditRepository) FindEvents(departmentId string, filter models.AuditFilter) ([]models.AuditEventModel, int64, error) {
+	query := r.filter(departmentId, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AuditEventModel
+	err := query.
+		Order(constants.OrderByNewestId).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&events).Error
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// FindEventsAfter returns up to limit events in the order they were recorded,
+// starting after the given id. Exports page through the log with it, events
+// appended meanwhile don't shift the pages.
+func (r *GormAuditRepository) FindEventsAfter(departmentId string, filter models.AuditFilter, after uint64, limit int) ([]models.AuditEventModel, error) {
+	var events []models.AuditEventModel
+	err := r.filter(departmentId, filter).
+		Where(constants.FindIdsAfterQuery, after).
+		Order(constants.OrderById).
+		Limit(limit).
+		Find(&events).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FindByUser returns the events the user performed or was the target of.
+func (r *GormAuditRepository) FindByUser(departmentId string, userId string) ([]models.AuditEventModel, error) {
+	var events []models.AuditEventModel
+	err := r.db.
+		Where(constants.FindByDepartmentQuery, departmentId).
+		Where(constants.FindByActorOrTargetQuery, userId, userId).
+		Order(constants.OrderById).
+		Find(&events).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *GormAuditRepository) filter(departmentId string, filter models.AuditFilter) *gorm.DB {
+	query := r.db.Model(&models.AuditEventModel{}).Where(constants.FindByDepartmentQuery, departmentId)
+
+	if filter.Action != "" {
+		query = query.Where(constants.FindByActionQuery, filter.Action)
+	}
+
+	if filter.Outcome != "" {
+		query = query.Where(constants.FindByOutcomeQuery, filter.Outcome)
+	}
+
+	if filter.ActorID != "" {
+		query = query.Where(constants.FindByActorQuery, filter.ActorID)
+	}
+
+	if filter.TargetID != "" {
+		query = query.Where(constants.FindByTargetQuery, filter.TargetID)
+	}
+
+	if filter.RequestID != "" {
+		query = query.Where(constants.FindByRequestIdQuery, filter.RequestID)
+	}
+
+	if filter.From != nil {
+		query = query.Where(constants.FindCreatedFromQuery, *filter.From)
+	}
+
+	if filter.To != nil {
+		query = query.Where(constants.FindCreatedToQuery, *filter.To)
+	}
+
+	return query
+}
+
+func NewGormAuditRepository(db *gorm.DB) AuditRepository {
+	return &GormAuditRepository{db}
+}
+
+// DeleteBefore removes the events of every department recorded before the
+// given time, and returns how many were removed.
+func (r *GormAuditRepository) DeleteBefore(before time.Time) (int64, error) {
+	result := r.db.Where(constants.FindCreatedBeforeQuery, before).Delete(&models.AuditEventModel{})
+	return result.RowsAffected, result.Error
+}
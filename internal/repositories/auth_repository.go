@@ -9,17 +9,19 @@ import (
 
 type AuthRepository interface {
 	Create(user *models.AuthModel) error
-	Delete(id string) error
+	Delete(token string) error
 	FindByTokenAndType(token string, authType models.AuthModelType) (*models.AuthModel, error)
+	DeleteByUserId(userId string) error
+	FindByUserId(userId string) ([]models.AuthModel, error)
 }
 
 type GormAuthRepository struct {
 	db *gorm.DB
 }
 
-func (r *GormAuthRepository) FindByTokenAndType(id string, authType models.AuthModelType) (*models.AuthModel, error) {
+func (r *GormAuthRepository) FindByTokenAndType(token string, authType models.AuthModelType) (*models.AuthModel, error) {
 	var model models.AuthModel
-	if err := r.db.Where(constants.FindByTokenAndTypeQuery, id).First(&model).Error; err != nil {
+	if err := r.db.Where(constants.FindByTokenAndTypeQuery, token, authType).First(&model).Error; err != nil {
 		return nil, err
 	}
 
@@ -30,8 +32,21 @@ func (r *GormAuthRepository) Create(model *models.AuthModel) error {
 	return r.db.Create(model).Error
 }
 
-func (r *GormAuthRepository) Delete(id string) error {
-	return r.db.Where(constants.FindByIdQuery, id).Delete(&models.AuthModel{}).Error
+func (r *GormAuthRepository) Delete(token string) error {
+	return r.db.Where(constants.FindByTokenQuery, token).Delete(&models.AuthModel{}).Error
+}
+
+func (r *GormAuthRepository) DeleteByUserId(userId string) error {
+	return r.db.Where(constants.FindByUserIdQuery, userId).Delete(&models.AuthModel{}).Error
+}
+
+func (r *GormAuthRepository) FindByUserId(userId string) ([]models.AuthModel, error) {
+	var records []models.AuthModel
+	if err := r.db.Where(constants.FindByUserIdQuery, userId).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
 }
 
 func NewGormAuthRepository(db *gorm.DB) AuthRepository {
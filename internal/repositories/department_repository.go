@@ -1,7 +1,12 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"uas/internal/constants"
 	"uas/internal/models"
@@ -11,6 +16,19 @@ type DepartmentRepository interface {
 	FindById(id string) (*models.DepartmentModel, error)
 	Create(user *models.DepartmentModel) error
 	Delete(id string) error
+	FindConfig(departmentId string) (*models.DepartmentConfig, error)
+	SaveConfig(config *models.DepartmentConfig) error
+	Save(department *models.DepartmentModel) error
+	PurgeDeactivated(now time.Time) (int64, error)
+	FindAll(filter models.TenantFilter) ([]models.DepartmentModel, int64, error)
+	RecordCredentialUse(id string, credential models.TenantCredential, at time.Time) error
+	FindSigningKey(id string) (*models.SigningKeyModel, error)
+	FindSigningKeys(departmentId string) ([]models.SigningKeyModel, error)
+	RotateSigningKey(key *models.SigningKeyModel) error
+	CreateSigningKeyIfAbsent(key *models.SigningKeyModel) (*models.SigningKeyModel, error)
+	DeleteCascade(departmentId string) (int64, int64, error)
+	FindDepartmentsByCorsOrigin(origin string) ([]string, error)
+	FindIds() ([]string, error)
 }
 
 type GormDepartmentRepository struct {
@@ -33,6 +51,341 @@ func (r *GormDepartmentRepository) Delete(id string) error {
 	return r.db.Delete(&models.DepartmentModel{}, id).Error
 }
 
+// FindConfig returns the department's config, or an unsaved empty config
+// when the department has none yet.
+func (r *GormDepartmentRepository) FindConfig(departmentId string) (*models.DepartmentConfig, error) {
+	var config models.DepartmentConfig
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).First(&config).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.DepartmentConfig{ID: uuid.New().String(), DepartmentID: departmentId}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// FindDepartmentsByCorsOrigin returns the ids of the departments that list
+// the origin in their CORS settings.
+func (r *GormDepartmentRepository) FindDepartmentsByCorsOrigin(origin string) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.DepartmentConfig{}).
+		Where(constants.FindByCorsOrigin, origin).
+		Pluck("department_id", &ids).Error
+
+	return ids, err
+}
+
+// FindIds returns the ids of every department, deactivated ones included.
+func (r *GormDepartmentRepository) FindIds() ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.DepartmentModel{}).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *GormDepartmentRepository) SaveConfig(config *models.DepartmentConfig) error {
+	return r.db.Save(config).Error
+}
+
+func (r *GormDepartmentRepository) Save(department *models.DepartmentModel) error {
+	return r.db.Save(department).Error
+}
+
+// PurgeDeactivated permanently removes departments whose grace period has
+// passed, along with everything that belongs to them.
+func (r *GormDepartmentRepository) PurgeDeactivated(now time.Time) (int64, error) {
+	var purged int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&models.DepartmentModel{}).Where(constants.FindDuePurgeQuery, now).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		var err error
+		purged, _, _, err = purgeDepartments(tx, ids)
+		return err
+	})
+
+	return purged, err
+}
+
+// DeleteCascade permanently removes the department and everything that
+// belongs to it. Users of the department are deleted, members from other
+// departments only lose their membership, or their owner if it was this
+// department.
+func (r *GormDepartmentRepository) DeleteCascade(departmentId string) (int64, int64, error) {
+	var deleted, detached int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, deleted, detached, err = purgeDepartments(tx, []string{departmentId})
+		return err
+	})
+
+	return deleted, detached, err
+}
+
+// purgeDepartments hard deletes the departments and returns how many
+// departments and users were deleted and how many users were detached. Users
+// the departments own who are still a member elsewhere lose their owner
+// instead of being deleted, and the audit log is kept for the retention job.
+func purgeDepartments(tx *gorm.DB, ids []string) (int64, int64, int64, error) {
+	// users the departments own, and legacy users without an owner, who are
+	// not a member anywhere else
+	members := tx.Model(&models.DepartmentRoles{}).Select("user_id").Where(constants.FindByDepartmentIdsQuery, ids)
+	elsewhere := tx.Model(&models.DepartmentRoles{}).Select("user_id").Where(constants.FindOutsideDepartments, ids)
+	owned := tx.Where(constants.FindByDepartmentIdsQuery, ids).
+		Where(constants.FindByIdNotInQuery, elsewhere)
+	unowned := tx.Where(constants.FindUnownedUsersQuery).
+		Where(constants.FindByIdInQuery, members).
+		Where(constants.FindByIdNotInQuery, elsewhere)
+
+	var userIds []string
+	err := tx.Model(&models.UserModel{}).
+		Where(owned).
+		Or(unowned).
+		Pluck("id", &userIds).Error
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if len(userIds) > 0 {
+		if err := tx.Unscoped().Where(constants.FindByUserIdsQuery, userIds).Delete(&models.DepartmentRoles{}).Error; err != nil {
+			return 0, 0, 0, err
+		}
+
+		if err := tx.Unscoped().Where(constants.FindByUserIdsQuery, userIds).Delete(&models.AuthModel{}).Error; err != nil {
+			return 0, 0, 0, err
+		}
+
+		if err := tx.Where(constants.FindByMemberIdsQuery, userIds).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return 0, 0, 0, err
+		}
+
+		if err := tx.Unscoped().Where(constants.FindByIdsQuery, userIds).Delete(&models.UserModel{}).Error; err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	// the remaining users are members of other departments, they are assigned
+	// to one of them on the next start like other users without an owner
+	err = tx.Unscoped().Model(&models.UserModel{}).
+		Where(constants.FindByDepartmentIdsQuery, ids).
+		UpdateColumn("department_id", gorm.Expr("NULL")).Error
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	detached := tx.Unscoped().Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.DepartmentRoles{})
+	if detached.Error != nil {
+		return 0, 0, 0, detached.Error
+	}
+
+	if err := tx.Unscoped().Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.InvitationModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	groups := tx.Model(&models.GroupModel{}).Select("id").Where(constants.FindByDepartmentIdsQuery, ids)
+	if err := tx.Where(constants.FindByGroupIdsQuery, groups).Delete(&models.GroupMemberModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.RelationTupleModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.RelationNamespaceModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.RelationRevisionModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.GroupRoleModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.GroupModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Unscoped().Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.DepartmentConfig{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.SigningKeyModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.UsageCounterModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.ActiveUserModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.RoleModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := tx.Where(constants.FindByDepartmentIdsQuery, ids).Delete(&models.AuthzPolicyModel{}).Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	// the audit log outlives the department, without the client details of
+	// users who are gone
+	err = tx.Model(&models.AuditEventModel{}).
+		Where(constants.FindByDepartmentIdsQuery, ids).
+		UpdateColumns(map[string]interface{}{"ip": "", "user_agent": ""}).Error
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	result := tx.Unscoped().Where(constants.FindByIdsQuery, ids).Delete(&models.DepartmentModel{})
+	if result.Error != nil {
+		return 0, 0, 0, result.Error
+	}
+
+	return result.RowsAffected, int64(len(userIds)), detached.RowsAffected, nil
+}
+
+func (r *GormDepartmentRepository) FindSigningKey(id string) (*models.SigningKeyModel, error) {
+	var key models.SigningKeyModel
+	if err := r.db.Where(constants.FindByIdQuery, id).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindSigningKeys returns the department's signing keys, newest first.
+func (r *GormDepartmentRepository) FindSigningKeys(departmentId string) ([]models.SigningKeyModel, error) {
+	var keys []models.SigningKeyModel
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).
+		Order(constants.OrderByNewest).
+		Find(&keys).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RotateSigningKey retires the department's active keys and adds the new one.
+func (r *GormDepartmentRepository) RotateSigningKey(key *models.SigningKeyModel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDepartment(tx, key.DepartmentID); err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.SigningKeyModel{}).
+			Where(constants.FindActiveSigningKeys, key.DepartmentID).
+			Update("retired_at", key.CreatedAt).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(key).Error
+	})
+}
+
+// CreateSigningKeyIfAbsent adds the key unless the department has an active
+// one, and returns the active key. Concurrent calls wait for each other on
+// the department's row, so only one key is created.
+func (r *GormDepartmentRepository) CreateSigningKeyIfAbsent(key *models.SigningKeyModel) (*models.SigningKeyModel, error) {
+	active := key
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDepartment(tx, key.DepartmentID); err != nil {
+			return err
+		}
+
+		var existing models.SigningKeyModel
+		err := tx.Where(constants.FindActiveSigningKeys, key.DepartmentID).
+			Order(constants.OrderByNewest).
+			First(&existing).Error
+
+		if err == nil {
+			active = &existing
+			return nil
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return tx.Create(key).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return active, nil
+}
+
+// lockDepartment locks the department's row until the transaction ends.
+func lockDepartment(tx *gorm.DB, departmentId string) error {
+	var department models.DepartmentModel
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(constants.FindByIdQuery, departmentId).
+		Limit(1).
+		Find(&department).Error
+}
+
+func (r *GormDepartmentRepository) FindAll(filter models.TenantFilter) ([]models.DepartmentModel, int64, error) {
+	query := r.db.Model(&models.DepartmentModel{})
+
+	if filter.Search != "" {
+		query = query.Where(constants.SearchByNameQuery, "%"+filter.Search+"%")
+	}
+
+	if filter.Deactivated != nil {
+		if *filter.Deactivated {
+			query = query.Where(constants.FindDeactivatedTenants)
+		} else {
+			query = query.Where(constants.FindActiveTenants)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var departments []models.DepartmentModel
+	err := query.
+		Order(constants.OrderByNewest).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&departments).Error
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return departments, total, nil
+}
+
+// RecordCredentialUse stores which secret last authenticated the tenant
+// without touching UpdatedAt.
+func (r *GormDepartmentRepository) RecordCredentialUse(id string, credential models.TenantCredential, at time.Time) error {
+	return r.db.Model(&models.DepartmentModel{}).Where(constants.FindByIdQuery, id).UpdateColumns(map[string]interface{}{
+		"last_used_credential": credential,
+		"last_used_at":         at,
+	}).Error
+}
+
 func NewGormDepartmentRepository(db *gorm.DB) DepartmentRepository {
 	return &GormDepartmentRepository{db}
 }
@@ -11,6 +11,9 @@ type DepartmentRoleRepository interface {
 	Create(user *models.DepartmentRoles) error
 	Update(user *models.DepartmentRoles) error
 	FindById(departmentId string, userId string) (*models.DepartmentRoles, error)
+	DeleteByUserId(userId string) error
+	FindByUserId(userId string) ([]models.DepartmentRoles, error)
+	Delete(departmentId string, userId string) error
 }
 
 type GormDepartmentRoleRepository struct {
@@ -27,13 +30,31 @@ func (r *GormDepartmentRoleRepository) Update(model *models.DepartmentRoles) err
 
 func (r *GormDepartmentRoleRepository) FindById(departmentId string, userId string) (*models.DepartmentRoles, error) {
 	var model models.DepartmentRoles
-	if err := r.db.Where(constants.FindByIdAndUserIdQuery, departmentId, userId).First(&model).Error; err != nil {
+	if err := r.db.Where(constants.FindByDepartmentAndUser, departmentId, userId).First(&model).Error; err != nil {
 		return nil, err
 	}
 
 	return &model, nil
 }
 
+func (r *GormDepartmentRoleRepository) DeleteByUserId(userId string) error {
+	return r.db.Where(constants.FindByUserIdQuery, userId).Delete(&models.DepartmentRoles{}).Error
+}
+
+func (r *GormDepartmentRoleRepository) FindByUserId(userId string) ([]models.DepartmentRoles, error) {
+	var roles []models.DepartmentRoles
+	if err := r.db.Where(constants.FindByUserIdQuery, userId).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *GormDepartmentRoleRepository) Delete(departmentId string, userId string) error {
+	// hard delete, the composite key would block the user from being added back
+	return r.db.Unscoped().Where(constants.FindByDepartmentAndUser, departmentId, userId).Delete(&models.DepartmentRoles{}).Error
+}
+
 func NewGormDepartmentRoleRepository(db *gorm.DB) DepartmentRoleRepository {
 	return &GormDepartmentRoleRepository{db}
 }
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type GroupRepository interface {
+	Create(group *models.GroupModel) error
+	Save(group *models.GroupModel) error
+	Delete(id string) error
+	FindByIdInDepartment(departmentId string, id string) (*models.GroupModel, error)
+	FindByDepartment(departmentId string, filter models.GroupFilter) ([]models.GroupModel, int64, error)
+	FindByMember(departmentId string, memberId string) ([]models.GroupModel, error)
+	FindMembers(groupId string) ([]models.GroupMemberModel, error)
+	FindMemberships(departmentId string, memberIds []string) ([]models.GroupMemberModel, error)
+	AddMembers(groupId string, memberType models.GroupMemberType, memberIds []string) error
+	RemoveMembers(groupId string, memberIds []string) error
+	ReplaceMembers(groupId string, memberType models.GroupMemberType, memberIds []string) error
+	RemoveFromDepartment(departmentId string, memberId string) error
+	FindRoles(groupIds []string) ([]models.GroupRoleModel, error)
+	GrantRole(grant *models.GroupRoleModel) error
+	RevokeRole(groupId string, role models.Role) error
+}
+
+type GormGroupRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormGroupRepository) Create(group *models.GroupModel) error {
+	return r.db.Create(group).Error
+}
+
+func (r *GormGroupRepository) Save(group *models.GroupModel) error {
+	return r.db.Save(group).Error
+}
+
+func (r *GormGroupRepository) Delete(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(constants.FindByGroupIdQuery, id).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return err
+		}
+
+		// the group leaves the groups it was nested in
+		if err := tx.Where(constants.FindByMemberIdQuery, id).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where(constants.FindByGroupIdQuery, id).Delete(&models.GroupRoleModel{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where(constants.FindByIdQuery, id).Delete(&models.GroupModel{}).Error
+	})
+}
+
+func (r *GormGroupRepository) FindByIdInDepartment(departmentId string, id string) (*models.GroupModel, error) {
+	var group models.GroupModel
+	if err := r.db.Where(constants.FindByIdAndDepartment, id, departmentId).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *GormGroupRepository) FindByDepartment(departmentId string, filter models.GroupFilter) ([]models.GroupModel, int64, error) {
+	query := r.db.Model(&models.GroupModel{}).Where(constants.FindByDepartmentQuery, departmentId)
+
+	if filter.Name != "" {
+		query = query.Where(constants.FindByNameQuery, filter.Name)
+	}
+
+	if filter.ExternalID != "" {
+		query = query.Where(constants.FindByExternalIdQuery, filter.ExternalID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var groups []models.GroupModel
+	if err := query.Order(constants.OrderByName).Offset(filter.Offset).Limit(filter.Limit).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (r *GormGroupRepository) FindByMember(departmentId string, memberId string) ([]models.GroupModel, error) {
+	var groups []models.GroupModel
+	err := r.db.
+		Where(constants.FindByDepartmentQuery, departmentId).
+		Where(constants.FindByIdsQuery, r.db.Model(&models.GroupMemberModel{}).Select("group_id").Where(constants.FindByMemberIdQuery, memberId)).
+		Order(constants.OrderByName).
+		Find(&groups).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *GormGroupRepository) FindMembers(groupId string) ([]models.GroupMemberModel, error) {
+	var members []models.GroupMemberModel
+	if err := r.db.Where(constants.FindByGroupIdQuery, groupId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// FindMemberships returns the rows putting the members, users or groups, in
+// groups of the department.
+func (r *GormGroupRepository) FindMemberships(departmentId string, memberIds []string) ([]models.GroupMemberModel, error) {
+	var memberships []models.GroupMemberModel
+	if len(memberIds) == 0 {
+		return memberships, nil
+	}
+
+	groups := r.db.Model(&models.GroupModel{}).Select("id").Where(constants.FindByDepartmentQuery, departmentId)
+	if err := r.db.Where(constants.FindByMemberIdsQuery, memberIds).Where(constants.FindByGroupIdsQuery, groups).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *GormGroupRepository) AddMembers(groupId string, memberType models.GroupMemberType, memberIds []string) error {
+	if len(memberIds) == 0 {
+		return nil
+	}
+
+	members := make([]models.GroupMemberModel, 0, len(memberIds))
+	for _, memberId := range memberIds {
+		members = append(members, models.GroupMemberModel{GroupID: groupId, MemberID: memberId, MemberType: memberType})
+	}
+
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+func (r *GormGroupRepository) RemoveMembers(groupId string, memberIds []string) error {
+	if len(memberIds) == 0 {
+		return nil
+	}
+
+	return r.db.Where(constants.FindGroupMembersQuery, groupId, memberIds).Delete(&models.GroupMemberModel{}).Error
+}
+
+// ReplaceMembers replaces the members of the type, members of the other type
+// are kept.
+func (r *GormGroupRepository) ReplaceMembers(groupId string, memberType models.GroupMemberType, memberIds []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(constants.FindByGroupIdQuery, groupId).Where(constants.FindByMemberTypeQuery, memberType).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return err
+		}
+
+		return (&GormGroupRepository{tx}).AddMembers(groupId, memberType, memberIds)
+	})
+}
+
+// RemoveFromDepartment removes the member from every group of the department.
+func (r *GormGroupRepository) RemoveFromDepartment(departmentId string, memberId string) error {
+	groups := r.db.Model(&models.GroupModel{}).Select("id").Where(constants.FindByDepartmentQuery, departmentId)
+	return r.db.Where(constants.FindByMemberIdQuery, memberId).Where(constants.FindByGroupIdsQuery, groups).Delete(&models.GroupMemberModel{}).Error
+}
+
+func (r *GormGroupRepository) FindRoles(groupIds []string) ([]models.GroupRoleModel, error) {
+	var roles []models.GroupRoleModel
+	if len(groupIds) == 0 {
+		return roles, nil
+	}
+
+	if err := r.db.Where(constants.FindByGroupIdsQuery, groupIds).Order(constants.OrderByRole).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *GormGroupRepository) GrantRole(grant *models.GroupRoleModel) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(grant).Error
+}
+
+func (r *GormGroupRepository) RevokeRole(groupId string, role models.Role) error {
+	return r.db.Where(constants.FindByGroupIdQuery, groupId).Where(constants.FindByRoleNameQuery, role).Delete(&models.GroupRoleModel{}).Error
+}
+
+func NewGormGroupRepository(db *gorm.DB) GroupRepository {
+	return &GormGroupRepository{db}
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type InvitationRepository interface {
+	Create(invitation *models.InvitationModel) error
+	Save(invitation *models.InvitationModel) error
+	FindById(id string) (*models.InvitationModel, error)
+	FindByIdInDepartment(departmentId string, id string) (*models.InvitationModel, error)
+	FindByDepartment(departmentId string) ([]models.InvitationModel, error)
+	FindPending(departmentId string, email string) (*models.InvitationModel, error)
+	Accept(invitation *models.InvitationModel, user *models.UserModel, role *models.DepartmentRoles) error
+}
+
+type GormInvitationRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormInvitationRepository) Create(invitation *models.InvitationModel) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *GormInvitationRepository) Save(invitation *models.InvitationModel) error {
+	return r.db.Save(invitation).Error
+}
+
+func (r *GormInvitationRepository) FindById(id string) (*models.InvitationModel, error) {
+	var invitation models.InvitationModel
+	if err := r.db.Where(constants.FindByIdQuery, id).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *GormInvitationRepository) FindByIdInDepartment(departmentId string, id string) (*models.InvitationModel, error) {
+	var invitation models.InvitationModel
+	if err := r.db.Where(constants.FindByIdAndDepartment, id, departmentId).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *GormInvitationRepository) FindByDepartment(departmentId string) ([]models.InvitationModel, error) {
+	var invitations []models.InvitationModel
+	if err := r.db.Where(constants.FindByDepartmentQuery, departmentId).Order(constants.OrderByNewest).Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *GormInvitationRepository) FindPending(departmentId string, email string) (*models.InvitationModel, error) {
+	var invitation models.InvitationModel
+	if err := r.db.Where(constants.FindPendingInvitation, departmentId, email, time.Now()).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// Accept creates the invitee's account when user is set, adds the role and
+// marks the invitation accepted in one transaction.
+func (r *GormInvitationRepository) Accept(invitation *models.InvitationModel, user *models.UserModel, role *models.DepartmentRoles) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if user != nil {
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(role).Error; err != nil {
+			return err
+		}
+
+		return tx.Save(invitation).Error
+	})
+}
+
+func NewGormInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &GormInvitationRepository{db}
+}
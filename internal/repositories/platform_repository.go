@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type PlatformRepository interface {
+	CreateAdmin(admin *models.PlatformAdminModel) error
+	FindAdminById(id string) (*models.PlatformAdminModel, error)
+	FindAdminByEmail(email string) (*models.PlatformAdminModel, error)
+	CountAdmins() (int64, error)
+	CreateAudit(audit *models.TenantAuditModel) error
+	FindAudit(departmentId string, page int, pageSize int) ([]models.TenantAuditModel, int64, error)
+	CreateDeletion(deletion *models.TenantDeletionModel) error
+	SaveDeletion(deletion *models.TenantDeletionModel) error
+	FindLatestDeletion(departmentId string) (*models.TenantDeletionModel, error)
+	FindClaimableDeletions(staleBefore time.Time) ([]models.TenantDeletionModel, error)
+	ClaimDeletion(deletion *models.TenantDeletionModel, staleBefore time.Time) (bool, error)
+}
+
+type GormPlatformRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormPlatformRepository) CreateAdmin(admin *models.PlatformAdminModel) error {
+	return r.db.Create(admin).Error
+}
+
+func (r *GormPlatformRepository) FindAdminById(id string) (*models.PlatformAdminModel, error) {
+	var admin models.PlatformAdminModel
+	if err := r.db.Where(constants.FindByIdQuery, id).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (r *GormPlatformRepository) FindAdminByEmail(email string) (*models.PlatformAdminModel, error) {
+	var admin models.PlatformAdminModel
+	if err := r.db.Where(constants.FindByEmailQuery, email).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (r *GormPlatformRepository) CountAdmins() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PlatformAdminModel{}).Count(&count).Error
+	return count, err
+}
+
+func (r *GormPlatformRepository) CreateAudit(audit *models.TenantAuditModel) error {
+	return r.db.Create(audit).Error
+}
+
+// FindAudit returns the tenant audit trail, newest first, optionally for a
+// single tenant.
+func (r *GormPlatformRepository) FindAudit(departmentId string, page int, pageSize int) ([]models.TenantAuditModel, int64, error) {
+	query := r.db.Model(&models.TenantAuditModel{})
+
+	if departmentId != "" {
+		query = query.Where(constants.FindByDepartmentQuery, departmentId)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var audits []models.TenantAuditModel
+	err := query.
+		Order(constants.OrderByNewest).
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&audits).Error
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return audits, total, nil
+}
+
+func (r *GormPlatformRepository) CreateDeletion(deletion *models.TenantDeletionModel) error {
+	return r.db.Create(deletion).Error
+}
+
+func (r *GormPlatformRepository) SaveDeletion(deletion *models.TenantDeletionModel) error {
+	return r.db.Save(deletion).Error
+}
+
+// FindLatestDeletion returns the most recent deletion requested for the tenant.
+func (r *GormPlatformRepository) FindLatestDeletion(departmentId string) (*models.TenantDeletionModel, error) {
+	var deletion models.TenantDeletionModel
+	err := r.db.
+		Where(constants.FindByDepartmentQuery, departmentId).
+		Order(constants.OrderByNewest).
+		First(&deletion).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// FindClaimableDeletions returns pending deletions and running ones that
+// were started before staleBefore, oldest first.
+func (r *GormPlatformRepository) FindClaimableDeletions(staleBefore time.Time) ([]models.TenantDeletionModel, error) {
+	var deletions []models.TenantDeletionModel
+	err := r.db.
+		Where(constants.FindClaimableDeletions, models.TenantDeletionPending, models.TenantDeletionRunning, staleBefore).
+		Order(constants.OrderByOldest).
+		Find(&deletions).Error
+
+	return deletions, err
+}
+
+// ClaimDeletion marks the deletion as running unless another instance
+// claimed it first, and reports whether the claim succeeded.
+func (r *GormPlatformRepository) ClaimDeletion(deletion *models.TenantDeletionModel, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+
+	result := r.db.Model(&models.TenantDeletionModel{}).
+		Where(constants.FindByIdQuery, deletion.ID).
+		Where(constants.FindClaimableDeletions, models.TenantDeletionPending, models.TenantDeletionRunning, staleBefore).
+		Updates(map[string]interface{}{"status": models.TenantDeletionRunning, "started_at": now})
+
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false, result.Error
+	}
+
+	deletion.Status = models.TenantDeletionRunning
+	deletion.StartedAt = &now
+	return true, nil
+}
+
+func NewGormPlatformRepository(db *gorm.DB) PlatformRepository {
+	return &GormPlatformRepository{db}
+}
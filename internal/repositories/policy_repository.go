@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type PolicyRepository interface {
+	Create(policy *models.AuthzPolicyModel) error
+	Save(policy *models.AuthzPolicyModel) error
+	Delete(departmentId string, id string) error
+	FindById(departmentId string, id string) (*models.AuthzPolicyModel, error)
+	FindByDepartment(departmentId string) ([]models.AuthzPolicyModel, error)
+}
+
+type GormPolicyRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormPolicyRepository) Create(policy *models.AuthzPolicyModel) error {
+	return r.db.Create(policy).Error
+}
+
+func (r *GormPolicyRepository) Save(policy *models.AuthzPolicyModel) error {
+	return r.db.Save(policy).Error
+}
+
+func (r *GormPolicyRepository) Delete(departmentId string, id string) error {
+	return r.db.Where(constants.FindByIdAndDepartment, id, departmentId).Delete(&models.AuthzPolicyModel{}).Error
+}
+
+func (r *GormPolicyRepository) FindById(departmentId string, id string) (*models.AuthzPolicyModel, error) {
+	var policy models.AuthzPolicyModel
+	if err := r.db.Where(constants.FindByIdAndDepartment, id, departmentId).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *GormPolicyRepository) FindByDepartment(departmentId string) ([]models.AuthzPolicyModel, error) {
+	var policies []models.AuthzPolicyModel
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).
+		Order(constants.OrderByName).
+		Find(&policies).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func NewGormPolicyRepository(db *gorm.DB) PolicyRepository {
+	return &GormPolicyRepository{db}
+}
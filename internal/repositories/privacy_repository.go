@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type PrivacyRepository interface {
+	EraseUser(userId string, record *models.DataErasureModel) error
+	FindErasuresByDepartment(departmentId string) ([]models.DataErasureModel, error)
+}
+
+type GormPrivacyRepository struct {
+	db *gorm.DB
+}
+
+// EraseUser permanently removes the user and everything that references it,
+// bypassing soft delete, and stores the erasure record in the same transaction.
+// Audit events are kept but name the user by the record's pseudonym, and the
+// address and user agent of the events they performed are cleared.
+func (r *GormPrivacyRepository) EraseUser(userId string, record *models.DataErasureModel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(constants.FindByUserIdQuery, userId).Delete(&models.DepartmentRoles{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(constants.FindByUserIdQuery, userId).Delete(&models.AuthModel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where(constants.FindByMemberIdQuery, userId).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return err
+		}
+
+		// relation tuples naming the user as subject go too, even from past revisions
+		if err := tx.Where(constants.FindSubjectObjectQuery, models.RelationUserNamespace, userId).Delete(&models.RelationTupleModel{}).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.AuditEventModel{}).
+			Where(constants.FindByActorQuery, userId).
+			UpdateColumns(map[string]interface{}{"actor_id": record.UserPseudonym, "ip": "", "user_agent": ""}).Error
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.AuditEventModel{}).
+			Where(constants.FindByTargetQuery, userId).
+			UpdateColumn("target_id", record.UserPseudonym).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(constants.FindByIdQuery, userId).Delete(&models.UserModel{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(record).Error
+	})
+}
+
+func (r *GormPrivacyRepository) FindErasuresByDepartment(departmentId string) ([]models.DataErasureModel, error) {
+	var records []models.DataErasureModel
+	if err := r.db.Where(constants.FindByDepartmentQuery, departmentId).Order("completed_at DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func NewGormPrivacyRepository(db *gorm.DB) PrivacyRepository {
+	return &GormPrivacyRepository{db}
+}
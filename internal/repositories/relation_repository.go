@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type RelationRepository interface {
+	SaveNamespace(namespace *models.RelationNamespaceModel) error
+	DeleteNamespace(departmentId string, name string) error
+	FindNamespace(departmentId string, name string) (*models.RelationNamespaceModel, error)
+	FindNamespaces(departmentId string) ([]models.RelationNamespaceModel, error)
+	CountTuples(departmentId string, namespace string) (int64, error)
+	Write(departmentId string, writes []models.RelationTupleModel, deletes []models.RelationTupleModel) (uint64, error)
+	Revision(departmentId string) (uint64, error)
+	FindTuples(departmentId string, namespace string, objectId string, relation string, revision uint64) ([]models.RelationTupleModel, error)
+	HasTuple(tuple *models.RelationTupleModel, revision uint64) (bool, error)
+	FindObjectIds(departmentId string, namespace string, revision uint64, after string, limit int) ([]string, error)
+}
+
+type GormRelationRepository struct {
+	db *gorm.DB
+}
+
+// SaveNamespace creates the namespace or replaces its relations.
+func (r *GormRelationRepository) SaveNamespace(namespace *models.RelationNamespaceModel) error {
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"relations", "updated_at"}),
+	}).Create(namespace).Error
+}
+
+func (r *GormRelationRepository) DeleteNamespace(departmentId string, name string) error {
+	return r.db.Where(constants.FindByDepartmentAndName, departmentId, name).Delete(&models.RelationNamespaceModel{}).Error
+}
+
+func (r *GormRelationRepository) FindNamespace(departmentId string, name string) (*models.RelationNamespaceModel, error) {
+	var namespace models.RelationNamespaceModel
+	if err := r.db.Where(constants.FindByDepartmentAndName, departmentId, name).First(&namespace).Error; err != nil {
+		return nil, err
+	}
+	return &namespace, nil
+}
+
+func (r *GormRelationRepository) FindNamespaces(departmentId string) ([]models.RelationNamespaceModel, error) {
+	var namespaces []models.RelationNamespaceModel
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).
+		Order(constants.OrderByName).
+		Find(&namespaces).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return namespaces, nil
+}
+
+// CountTuples returns how many tuples of the namespace haven't been deleted.
+func (r *GormRelationRepository) CountTuples(departmentId string, namespace string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RelationTupleModel{}).
+		Where(constants.FindByNamespaceQuery, departmentId, namespace).
+		Where(constants.FindUndeletedTuples).
+		Count(&count).Error
+
+	return count, err
+}
+
+// Write deletes and then writes the tuples at the department's next revision,
+// which it returns. Writing a tuple that exists or deleting one that doesn't
+// changes nothing. The revision row is locked so the writes of a department
+// are ordered.
+func (r *GormRelationRepository) Write(departmentId string, writes []models.RelationTupleModel, deletes []models.RelationTupleModel) (uint64, error) {
+	var revision uint64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		counter := models.RelationRevisionModel{DepartmentID: departmentId}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(constants.FindByDepartmentQuery, departmentId).First(&counter).Error; err != nil {
+			return err
+		}
+
+		revision = counter.Revision + 1
+
+		for _, tuple := range deletes {
+			err := tx.Model(&models.RelationTupleModel{}).
+				Where(constants.FindRelationObjectQuery, departmentId, tuple.Namespace, tuple.ObjectID, tuple.Relation).
+				Where(constants.FindRelationSubjectQuery, tuple.SubjectNamespace, tuple.SubjectID, tuple.SubjectRelation).
+				Where(constants.FindUndeletedTuples).
+				Update("deleted_revision", revision).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, tuple := range writes {
+			var existing int64
+			err := tx.Model(&models.RelationTupleModel{}).
+				Where(constants.FindRelationObjectQuery, departmentId, tuple.Namespace, tuple.ObjectID, tuple.Relation).
+				Where(constants.FindRelationSubjectQuery, tuple.SubjectNamespace, tuple.SubjectID, tuple.SubjectRelation).
+				Where(constants.FindUndeletedTuples).
+				Count(&existing).Error
+
+			if err != nil {
+				return err
+			}
+
+			if existing > 0 {
+				continue
+			}
+
+			tuple.ID = 0
+			tuple.DepartmentID = departmentId
+			tuple.CreatedRevision = revision
+			tuple.DeletedRevision = nil
+
+			if err := tx.Create(&tuple).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&counter).Update("revision", revision).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// Revision returns the department's latest revision, 0 before any write.
+func (r *GormRelationRepository) Revision(departmentId string) (uint64, error) {
+	var counter models.RelationRevisionModel
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).Limit(1).Find(&counter).Error
+	return counter.Revision, err
+}
+
+// FindTuples returns the tuples giving the object the relation at the revision.
+func (r *GormRelationRepository) FindTuples(departmentId string, namespace string, objectId string, relation string, revision uint64) ([]models.RelationTupleModel, error) {
+	var tuples []models.RelationTupleModel
+	err := r.db.
+		Where(constants.FindRelationObjectQuery, departmentId, namespace, objectId, relation).
+		Where(constants.FindLiveRelationTuples, revision, revision).
+		Order(constants.OrderById).
+		Find(&tuples).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return tuples, nil
+}
+
+// HasTuple reports whether the tuple existed at the revision.
+func (r *GormRelationRepository) HasTuple(tuple *models.RelationTupleModel, revision uint64) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RelationTupleModel{}).
+		Where(constants.FindRelationObjectQuery, tuple.DepartmentID, tuple.Namespace, tuple.ObjectID, tuple.Relation).
+		Where(constants.FindRelationSubjectQuery, tuple.SubjectNamespace, tuple.SubjectID, tuple.SubjectRelation).
+		Where(constants.FindLiveRelationTuples, revision, revision).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// FindObjectIds returns a page of the ids of the namespace's objects that had
+// tuples at the revision, in order, starting after the given id.
+func (r *GormRelationRepository) FindObjectIds(departmentId string, namespace string, revision uint64, after string, limit int) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.RelationTupleModel{}).
+		Distinct("object_id").
+		Where(constants.FindByNamespaceQuery, departmentId, namespace).
+		Where(constants.FindLiveRelationTuples, revision, revision).
+		Where(constants.FindObjectIdsAfterQuery, after).
+		Order(constants.OrderByObjectId).
+		Limit(limit).
+		Pluck("object_id", &ids).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func NewGormRelationRepository(db *gorm.DB) RelationRepository {
+	return &GormRelationRepository{db}
+}
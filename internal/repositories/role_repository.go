@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type RoleRepository interface {
+	Create(role *models.RoleModel) error
+	Update(role *models.RoleModel) error
+	Delete(departmentId string, name models.Role) error
+	FindByName(departmentId string, name models.Role) (*models.RoleModel, error)
+	FindByDepartment(departmentId string) ([]models.RoleModel, error)
+	SeedBuiltIn(departmentIds []string) error
+	CountMembers(departmentId string, name models.Role) (int64, error)
+	CountActiveMembers(departmentId string, name models.Role, exceptUserId string) (int64, error)
+	CountGroups(departmentId string, name models.Role) (int64, error)
+}
+
+type GormRoleRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormRoleRepository) Create(role *models.RoleModel) error {
+	return r.db.Create(role).Error
+}
+
+func (r *GormRoleRepository) Update(role *models.RoleModel) error {
+	return r.db.Save(role).Error
+}
+
+func (r *GormRoleRepository) Delete(departmentId string, name models.Role) error {
+	return r.db.Where(constants.FindByDepartmentAndName, departmentId, name).Delete(&models.RoleModel{}).Error
+}
+
+func (r *GormRoleRepository) FindByName(departmentId string, name models.Role) (*models.RoleModel, error) {
+	var role models.RoleModel
+	if err := r.db.Where(constants.FindByDepartmentAndName, departmentId, name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *GormRoleRepository) FindByDepartment(departmentId string) ([]models.RoleModel, error) {
+	var roles []models.RoleModel
+	err := r.db.Where(constants.FindByDepartmentQuery, departmentId).
+		Order(constants.OrderByName).
+		Find(&roles).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SeedBuiltIn creates the built-in roles of the departments, or brings them
+// up to date when permissions were added since they were seeded.
+func (r *GormRoleRepository) SeedBuiltIn(departmentIds []string) error {
+	if len(departmentIds) == 0 {
+		return nil
+	}
+
+	roles := make([]models.RoleModel, 0, len(departmentIds)*len(models.BuiltInRolePermissions))
+	for _, departmentId := range departmentIds {
+		roles = append(roles, models.BuiltInRoles(departmentId)...)
+	}
+
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"description", "permissions", "built_in", "updated_at"}),
+	}).CreateInBatches(roles, 100).Error
+}
+
+// CountMembers returns how many members of the department have the role.
+func (r *GormRoleRepository) CountMembers(departmentId string, name models.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.DepartmentRoles{}).
+		Where(constants.FindByDepartmentAndRole, departmentId, name).
+		Count(&count).Error
+
+	return count, err
+}
+
+// CountActiveMembers returns how many members of the department other than
+// the user have the role and can still log in, disabled and deactivated
+// users don't count.
+func (r *GormRoleRepository) CountActiveMembers(departmentId string, name models.Role, exceptUserId string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.DepartmentRoles{}).
+		Joins(constants.JoinMemberUsersQuery).
+		Where(constants.FindMembersByRoleQuery, departmentId, name).
+		Where(constants.FindOtherMembersQuery, exceptUserId).
+		Where(constants.FindLoginAllowedQuery, false).
+		Count(&count).Error
+
+	return count, err
+}
+
+// CountGroups returns how many groups of the department are granted the role.
+func (r *GormRoleRepository) CountGroups(departmentId string, name models.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.GroupRoleModel{}).
+		Where(constants.FindByDepartmentAndRole, departmentId, name).
+		Count(&count).Error
+
+	return count, err
+}
+
+func NewGormRoleRepository(db *gorm.DB) RoleRepository {
+	return &GormRoleRepository{db}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"uas/internal/constants"
+	"uas/internal/models"
+)
+
+type UsageRepository interface {
+	Increment(departmentId string, day string, metric models.UsageMetric) error
+	FindCount(departmentId string, day string, metric models.UsageMetric) (int64, error)
+	FindCounters(departmentId string, fromDay string, toDay string) ([]models.UsageCounterModel, error)
+	MarkActive(departmentId string, month string, userId string) error
+	IsActive(departmentId string, month string, userId string) (bool, error)
+	CountActive(departmentId string, fromMonth string, toMonth string) (map[string]int64, error)
+	CountUsers(departmentId string) (int64, error)
+}
+
+type GormUsageRepository struct {
+	db *gorm.DB
+}
+
+// Increment adds one to the department's counter of the metric for the day.
+func (r *GormUsageRepository) Increment(departmentId string, day string, metric models.UsageMetric) error {
+	counter := &models.UsageCounterModel{DepartmentID: departmentId, Day: day, Metric: metric, Count: 1}
+
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr(constants.IncrementCount)}),
+	}).Create(counter).Error
+}
+
+func (r *GormUsageRepository) FindCount(departmentId string, day string, metric models.UsageMetric) (int64, error) {
+	var counter models.UsageCounterModel
+	err := r.db.Where(constants.FindUsageCounter, departmentId, day, metric).First(&counter).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return counter.Count, err
+}
+
+// FindCounters returns the department's counters of the days in the range,
+// both days included.
+func (r *GormUsageRepository) FindCounters(departmentId string, fromDay string, toDay string) ([]models.UsageCounterModel, error) {
+	var counters []models.UsageCounterModel
+	err := r.db.
+		Where(constants.FindUsageCounters, departmentId, fromDay, toDay).
+		Order(constants.OrderByDay).
+		Find(&counters).Error
+
+	return counters, err
+}
+
+// MarkActive records the user as active in the month, once.
+func (r *GormUsageRepository) MarkActive(departmentId string, month string, userId string) error {
+	active := &models.ActiveUserModel{DepartmentID: departmentId, Month: month, UserID: userId}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(active).Error
+}
+
+func (r *GormUsageRepository) IsActive(departmentId string, month string, userId string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ActiveUserModel{}).
+		Where(constants.FindActiveUser, departmentId, month, userId).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// CountActive returns the department's monthly active users for the months
+// in the range, both months included.
+func (r *GormUsageRepository) CountActive(departmentId string, fromMonth string, toMonth string) (map[string]int64, error) {
+	var rows []struct {
+		Month string
+		Count int64
+	}
+
+	err := r.db.Model(&models.ActiveUserModel{}).
+		Select(constants.SelectActiveUsers).
+		Where(constants.FindActiveUsers, departmentId, fromMonth, toMonth).
+		Group("month").
+		Scan(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Month] = row.Count
+	}
+	return counts, nil
+}
+
+// CountUsers returns how many users the department owns.
+func (r *GormUsageRepository) CountUsers(departmentId string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.UserModel{}).Where(constants.FindByDepartmentQuery, departmentId).Count(&count).Error
+	return count, err
+}
+
+func NewGormUsageRepository(db *gorm.DB) UsageRepository {
+	return &GormUsageRepository{db}
+}
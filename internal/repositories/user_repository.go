@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 
 	"uas/internal/constants"
@@ -9,20 +11,29 @@ import (
 
 type UserRepository interface {
 	FindById(id string) (*models.UserModel, error)
-	FindByEmail(email string) (*models.UserModel, error)
-	FindByPhoneNumber(phoneNumber string) (*models.UserModel, error)
+	FindByEmailInDepartment(departmentId string, email string) (*models.UserModel, error)
+	FindByPhoneNumberInDepartment(departmentId string, phoneNumber string) (*models.UserModel, error)
 	Create(user *models.UserModel) error
+	CreateWithRole(user *models.UserModel, role *models.DepartmentRoles) error
 	Delete(id string) error
 	Save(user *models.UserModel) error
+	FindByDepartment(departmentId string, filter models.UserFilter) ([]models.UserModel, int64, error)
+	FindByIdInDepartment(departmentId string, id string) (*models.UserModel, error)
+	DeleteExpiredUnverified(now time.Time) (int64, error)
+	PurgeDeactivated(now time.Time) (int64, error)
+	FindPurgeWarningDue(before time.Time) ([]models.UserModel, error)
+	BackfillDepartments() (int64, int64, error)
 }
 
 type GormUserRepository struct {
 	db *gorm.DB
 }
 
-func (r *GormUserRepository) FindByEmail(id string) (*models.UserModel, error) {
+// FindByEmailInDepartment finds the department's own identity with the
+// email, users of other departments are never returned.
+func (r *GormUserRepository) FindByEmailInDepartment(departmentId string, email string) (*models.UserModel, error) {
 	var user models.UserModel
-	if err := r.db.Where(constants.FindByEmailQuery, id).First(&user).Error; err != nil {
+	if err := r.db.Where(constants.FindByDepartmentAndEmail, departmentId, email).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -32,8 +43,20 @@ func (r *GormUserRepository) Create(user *models.UserModel) error {
 	return r.db.Create(user).Error
 }
 
+// CreateWithRole creates the user and their department role in one
+// transaction, a failed role insert leaves no user behind.
+func (r *GormUserRepository) CreateWithRole(user *models.UserModel, role *models.DepartmentRoles) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(role).Error
+	})
+}
+
 func (r *GormUserRepository) Delete(id string) error {
-	return r.db.Delete(&models.UserModel{}, id).Error
+	return r.db.Where(constants.FindByIdQuery, id).Delete(&models.UserModel{}).Error
 }
 
 func (r *GormUserRepository) FindById(id string) (*models.UserModel, error) {
@@ -44,18 +67,208 @@ func (r *GormUserRepository) FindById(id string) (*models.UserModel, error) {
 	return &user, nil
 }
 
+// Save stores empty emails and phone numbers as NULL, they are part of the
+// department's unique indexes. Clearing them writes an explicit NULL.
 func (r *GormUserRepository) Save(user *models.UserModel) error {
-	return r.db.Save(user).Error
+	var omit []string
+	nulls := map[string]interface{}{}
+
+	if user.Email == "" {
+		omit = append(omit, "email")
+		nulls["email"] = nil
+	}
+
+	if user.PhoneNumber == "" {
+		omit = append(omit, "phone_number")
+		nulls["phone_number"] = nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(omit...).Save(user).Error; err != nil {
+			return err
+		}
+
+		if len(nulls) == 0 {
+			return nil
+		}
+
+		return tx.Model(user).UpdateColumns(nulls).Error
+	})
 }
 
-func (r *GormUserRepository) FindByPhoneNumber(phoneNumber string) (*models.UserModel, error) {
+// FindByPhoneNumberInDepartment finds the department's own identity with the
+// phone number, users of other departments are never returned.
+func (r *GormUserRepository) FindByPhoneNumberInDepartment(departmentId string, phoneNumber string) (*models.UserModel, error) {
 	var user models.UserModel
-	if err := r.db.Where(constants.FindByPhoneNumberQuery, phoneNumber).First(&user).Error; err != nil {
+	if err := r.db.Where(constants.FindByDepartmentAndPhone, departmentId, phoneNumber).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+func (r *GormUserRepository) FindByDepartment(departmentId string, filter models.UserFilter) ([]models.UserModel, int64, error) {
+	if filter.Offset == 0 {
+		filter.Offset = (filter.Page - 1) * filter.PageSize
+	}
+
+	var total int64
+	if err := r.filterByDepartment(departmentId, filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.UserModel
+	err := r.filterByDepartment(departmentId, filter).
+		Select(constants.SelectUserColumns).
+		Order(constants.OrderByNewestUsers).
+		Offset(filter.Offset).
+		Limit(filter.PageSize).
+		Find(&users).Error
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *GormUserRepository) FindByIdInDepartment(departmentId string, id string) (*models.UserModel, error) {
+	var user models.UserModel
+	err := r.inDepartment(departmentId).
+		Select(constants.SelectUserColumns).
+		Where(constants.FindUserByIdQuery, id).
+		First(&user).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteExpiredUnverified permanently removes accounts whose verification
+// window has passed, so the email address can be registered again.
+func (r *GormUserRepository) DeleteExpiredUnverified(now time.Time) (int64, error) {
+	return r.hardDelete(r.db.Model(&models.UserModel{}).Where(constants.FindExpiredUnverified, false, now))
+}
+
+// PurgeDeactivated permanently removes deactivated accounts whose grace
+// period has passed.
+func (r *GormUserRepository) PurgeDeactivated(now time.Time) (int64, error) {
+	return r.hardDelete(r.db.Model(&models.UserModel{}).Where(constants.FindDuePurgeQuery, now))
+}
+
+func (r *GormUserRepository) FindPurgeWarningDue(before time.Time) ([]models.UserModel, error) {
+	var users []models.UserModel
+	if err := r.db.Where(constants.FindPurgeWarningQuery, before).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// BackfillDepartments gives users created before identities belonged to a
+// department the department they joined first. It returns how many users
+// were updated and how many are left without a department because they
+// aren't a member anywhere.
+func (r *GormUserRepository) BackfillDepartments() (int64, int64, error) {
+	result := r.db.Model(&models.UserModel{}).
+		Where(constants.FindUnownedUsersQuery).
+		Where(constants.HasMembershipQuery).
+		UpdateColumn("department_id", gorm.Expr(constants.FirstMembershipQuery))
+
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+
+	var unowned int64
+	if err := r.db.Model(&models.UserModel{}).Where(constants.FindUnownedUsersQuery).Count(&unowned).Error; err != nil {
+		return result.RowsAffected, 0, err
+	}
+
+	return result.RowsAffected, unowned, nil
+}
+
+// hardDelete removes the selected users and everything that references them,
+// bypassing soft delete.
+func (r *GormUserRepository) hardDelete(query *gorm.DB) (int64, error) {
+	var ids []string
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var deleted int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(constants.FindByUserIdsQuery, ids).Delete(&models.DepartmentRoles{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(constants.FindByUserIdsQuery, ids).Delete(&models.AuthModel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where(constants.FindByMemberIdsQuery, ids).Delete(&models.GroupMemberModel{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where(constants.FindByIdsQuery, ids).Delete(&models.UserModel{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+
+	return deleted, err
+}
+
+func (r *GormUserRepository) inDepartment(departmentId string) *gorm.DB {
+	return r.db.Model(&models.UserModel{}).
+		Joins(constants.JoinDepartmentRolesQuery).
+		Where(constants.FindByDepartmentIdQuery, departmentId)
+}
+
+func (r *GormUserRepository) filterByDepartment(departmentId string, filter models.UserFilter) *gorm.DB {
+	query := r.inDepartment(departmentId)
+
+	if filter.Search != "" {
+		like := "%" + filter.Search + "%"
+		query = query.Where(constants.SearchEmailOrPhoneQuery, like, like)
+	}
+
+	if filter.Role != "" {
+		query = query.Where(constants.FindByRoleQuery, filter.Role)
+	}
+
+	if filter.EmailVerified != nil {
+		query = query.Where(constants.FindByEmailVerifiedQuery, *filter.EmailVerified)
+	}
+
+	if filter.Disabled != nil {
+		query = query.Where(constants.FindByDisabledQuery, *filter.Disabled)
+	}
+
+	if filter.Email != "" {
+		query = query.Where(constants.FindUserByEmailQuery, filter.Email)
+	}
+
+	if filter.ExternalID != "" {
+		query = query.Where(constants.FindUserByExternalId, filter.ExternalID)
+	}
+
+	if filter.Name != "" {
+		query = query.Where(constants.FindUserByNameQuery, filter.Name)
+	}
+
+	if filter.Deactivated != nil {
+		if *filter.Deactivated {
+			query = query.Where(constants.FindDeactivatedQuery)
+		} else {
+			query = query.Where(constants.FindActiveQuery)
+		}
+	}
+
+	return query
+}
+
 func NewGormUserRepository(db *gorm.DB) UserRepository {
 	return &GormUserRepository{db}
 }
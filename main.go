@@ -1,7 +1,23 @@
 package main
 
-import "uas/cmd/api"
+import (
+	"os"
+
+	"uas/cmd/api"
+	"uas/cmd/bootstrap"
+	"uas/cmd/importer"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importer.Run(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		bootstrap.Run(os.Args[2:])
+		return
+	}
+
 	api.Run()
 }